@@ -0,0 +1,121 @@
+/* SPDX-License-Identifier: AGPL-3.0-or-later
+ *
+ * Copyright 2024 Damian Peckett <damian@pecke.tt>.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"bytes"
+	"html"
+	"html/template"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/bucket-sailor/bucketeer/internal/download"
+	"github.com/bucket-sailor/bucketeer/internal/filesystem"
+	"github.com/bucket-sailor/bucketeer/internal/upload"
+	"github.com/bucket-sailor/writablefs"
+	"github.com/labstack/echo/v4"
+)
+
+// bucket is a bucket served by this instance.
+type bucket struct {
+	name           string
+	fsys           writablefs.FS
+	presigner      filesystem.Presigner
+	dirPager       filesystem.DirPager
+	checksumSource upload.ChecksumSource
+	rangeReader    download.RangeReader
+	// prefix is the path prefix the bucket's handlers are mounted beneath
+	// (empty if only a single bucket is being served).
+	prefix string
+}
+
+// mount registers a handler for the bucket, stripping the bucket's prefix from
+// the request path before it reaches the handler.
+func (b *bucket) mount(e *echo.Echo, path string, h http.Handler) {
+	if b.prefix != "" {
+		h = http.StripPrefix(b.prefix, h)
+	}
+
+	e.Any(b.prefix+path, echo.WrapHandler(h))
+}
+
+var bucketIndexTemplate = template.Must(template.New("index").Parse(`<!doctype html>
+<html lang="en">
+  <head>
+    <meta charset="UTF-8" />
+    <link rel="icon" type="image/svg+xml" href="/bucketeer.svg" />
+    <meta name="viewport" content="width=device-width, initial-scale=1.0" />
+    <title>Bucketeer</title>
+  </head>
+  <body>
+    <h1>Buckets</h1>
+    <ul>
+      {{- range . }}
+      <li><a href="/browse/{{ . }}/">{{ . }}</a></li>
+      {{- end }}
+    </ul>
+  </body>
+</html>
+`))
+
+// bucketIndexHandler renders a page listing the available buckets.
+func bucketIndexHandler(buckets []bucket) echo.HandlerFunc {
+	names := make([]string, 0, len(buckets))
+	for _, b := range buckets {
+		names = append(names, b.name)
+	}
+
+	return func(c echo.Context) error {
+		var buf bytes.Buffer
+		if err := bucketIndexTemplate.Execute(&buf, names); err != nil {
+			return err
+		}
+
+		return c.HTMLBlob(http.StatusOK, buf.Bytes())
+	}
+}
+
+func readIndexHTML(webFS http.FileSystem) ([]byte, error) {
+	f, err := webFS.Open("index.html")
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return io.ReadAll(f)
+}
+
+// bucketAppHandler serves the React app, with a meta tag telling it which
+// bucket it is browsing.
+func bucketAppHandler(indexHTML []byte, bucketName string) http.HandlerFunc {
+	meta := `<meta name="bucketeer-bucket" content="` + html.EscapeString(bucketName) + `" />`
+
+	page := string(indexHTML)
+	if strings.Contains(page, "</head>") {
+		page = strings.Replace(page, "</head>", meta+"</head>", 1)
+	} else {
+		page = meta + page
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		_, _ = w.Write([]byte(page))
+	}
+}
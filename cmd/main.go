@@ -19,31 +19,48 @@
 package main
 
 import (
+	"context"
 	"crypto/tls"
 	"crypto/x509"
 	"errors"
 	"fmt"
 	"io"
 	"log/slog"
+	"math"
 	"net/http"
+	"net/url"
 	"os"
 	"os/signal"
+	"path"
 	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
 	"syscall"
+	"time"
 
 	"github.com/adrg/xdg"
+	"github.com/bucket-sailor/bucketeer/internal/auth"
 	"github.com/bucket-sailor/bucketeer/internal/constants"
 	"github.com/bucket-sailor/bucketeer/internal/download"
 	"github.com/bucket-sailor/bucketeer/internal/filesystem"
+	"github.com/bucket-sailor/bucketeer/internal/health"
+	"github.com/bucket-sailor/bucketeer/internal/metrics"
 	"github.com/bucket-sailor/bucketeer/internal/telemetry"
 	"github.com/bucket-sailor/bucketeer/internal/upload"
+	"github.com/bucket-sailor/bucketeer/internal/util"
+	"github.com/bucket-sailor/bucketeer/internal/util/awsconfig"
+	"github.com/bucket-sailor/bucketeer/internal/version"
 	"github.com/bucket-sailor/bucketeer/web"
+	"github.com/bucket-sailor/writablefs"
 	"github.com/bucket-sailor/writablefs/dirfs"
 	"github.com/bucket-sailor/writablefs/s3fs"
+	"github.com/docker/go-units"
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
 	"github.com/mattn/go-isatty"
 	"github.com/minio/minio-go/v7/pkg/credentials"
+	"github.com/redis/go-redis/v9"
 	slogecho "github.com/samber/slog-echo"
 	"github.com/urfave/cli/v2"
 	"golang.org/x/net/http2"
@@ -60,10 +77,20 @@ The Ultimate S3 Bucket Explorer.`
 
 func main() {
 	var logWriter io.WriteCloser = os.Stderr
-	logger := slog.New(slog.NewTextHandler(logWriter, nil))
+	// Flags haven't been parsed yet, so the startup logger can only be configured from the environment.
+	logFormat := os.Getenv("BUCKETEER_LOG_FORMAT")
+	logger := slog.New(newLogHandler(logWriter, logFormat, nil))
 
 	beforeAll := func(c *cli.Context) error {
-		logFilePath := c.String("log-file")
+		logFormat = c.String("log-format")
+		if logFormat != "text" && logFormat != "json" {
+			return fmt.Errorf("invalid log format: %s", logFormat)
+		}
+
+		logFilePath, err := util.ExpandPath(c.String("log-file"))
+		if err != nil {
+			return fmt.Errorf("invalid log file path: %w", err)
+		}
 
 		if logFilePath != "" {
 			err := os.MkdirAll(filepath.Dir(logFilePath), 0o755)
@@ -77,7 +104,7 @@ func main() {
 			}
 		}
 
-		logger = slog.New(slog.NewTextHandler(logWriter, &slog.HandlerOptions{
+		logger = slog.New(newLogHandler(logWriter, logFormat, &slog.HandlerOptions{
 			Level: (*slog.Level)(c.Generic("log-level").(*logLevelFlag)),
 		}))
 
@@ -93,7 +120,7 @@ func main() {
 			}
 
 			// For any shutdown logs.
-			logger = slog.New(slog.NewTextHandler(os.Stderr, nil))
+			logger = slog.New(newLogHandler(os.Stderr, logFormat, nil))
 		}
 
 		return nil
@@ -120,6 +147,12 @@ func main() {
 			EnvVars: []string{"BUCKETEER_LOG_LEVEL"},
 			Value:   fromLogLevel(slog.LevelInfo),
 		},
+		&cli.StringFlag{
+			Name:    "log-format",
+			Usage:   "Set the log format (text or json)",
+			EnvVars: []string{"BUCKETEER_LOG_FORMAT"},
+			Value:   "text",
+		},
 		&cli.StringFlag{
 			Name:    "log-file",
 			Usage:   "The path to the log file, if not set logs will be written to stderr",
@@ -137,21 +170,43 @@ func main() {
 	app := &cli.App{
 		Name:      "bucketeer",
 		Usage:     "The ultimate S3 bucket explorer",
-		ArgsUsage: "<bucket name>",
+		ArgsUsage: "<bucket name> [bucket name...]",
 		Version:   constants.Version,
 		Flags: append([]cli.Flag{
 			&cli.StringFlag{
 				Name:    "listen",
-				Usage:   "The address to listen on",
+				Usage:   "The address to listen on (or unix:///path/to/sock for a unix domain socket)",
 				Aliases: []string{"l"},
 				EnvVars: []string{"BUCKETEER_LISTEN_ADDR"},
 				Value:   "localhost:16321",
 			},
+			&cli.StringFlag{
+				Name:    "listen-socket-mode",
+				Usage:   "The permissions (in octal) of the unix domain socket, eg. 0660",
+				EnvVars: []string{"BUCKETEER_LISTEN_SOCKET_MODE"},
+			},
 			&cli.BoolFlag{
 				Name:    "disable-cors",
 				Usage:   "Disable CORS protection",
 				EnvVars: []string{"BUCKETEER_DISABLE_CORS"},
 			},
+			&cli.IntFlag{
+				Name:    "gzip-level",
+				Usage:   "The gzip compression level of responses, from 1 (fastest) to 9 (smallest), 0 disables compression",
+				EnvVars: []string{"BUCKETEER_GZIP_LEVEL"},
+				Value:   6,
+			},
+			&cli.IntFlag{
+				Name:    "gzip-min-length",
+				Usage:   "The minimum size (in bytes) of a response before it is compressed",
+				EnvVars: []string{"BUCKETEER_GZIP_MIN_LENGTH"},
+				Value:   1024,
+			},
+			&cli.StringSliceFlag{
+				Name:    "cors-origin",
+				Usage:   "An origin allowed to make cross-origin requests, eg. https://app.example.com (can be repeated)",
+				EnvVars: []string{"BUCKETEER_CORS_ORIGINS"},
+			},
 			&cli.StringFlag{
 				Name:    "endpoint-url",
 				Usage:   "The URL of your S3 server",
@@ -168,6 +223,16 @@ func main() {
 				Usage:   "Your S3 secret access key",
 				EnvVars: []string{"AWS_SECRET_ACCESS_KEY"},
 			},
+			&cli.StringFlag{
+				Name:    "session-token",
+				Usage:   "Your S3 session token (when using temporary credentials)",
+				EnvVars: []string{"AWS_SESSION_TOKEN"},
+			},
+			&cli.StringFlag{
+				Name:    "profile",
+				Usage:   "The AWS profile to use for credentials and configuration",
+				EnvVars: []string{"AWS_PROFILE"},
+			},
 			&cli.StringFlag{
 				Name:    "region",
 				Usage:   "The region of your S3 server",
@@ -183,6 +248,181 @@ func main() {
 				Usage:   "Whether the TLS client should skip TLS verification",
 				EnvVars: []string{"AWS_NO_VERIFY_SSL"},
 			},
+			&cli.BoolFlag{
+				Name:    "presign-path-style",
+				Usage:   "Force path-style addressing (endpoint/bucket/key) for presigned URLs and the other requests Bucketeer makes directly to S3 (eg. paging listings), reading and writing files is always path-style unless the endpoint is AWS, GCS, or Aliyun",
+				EnvVars: []string{"BUCKETEER_PRESIGN_PATH_STYLE"},
+			},
+			&cli.StringFlag{
+				Name:    "cache-dir",
+				Usage:   "The directory used to stage uploads, if not set a temporary directory will be used",
+				EnvVars: []string{"BUCKETEER_CACHE_DIR"},
+			},
+			&cli.BoolFlag{
+				Name:    "keep-cache",
+				Usage:   "Keep staged uploads in the cache directory on shutdown",
+				EnvVars: []string{"BUCKETEER_KEEP_CACHE"},
+			},
+			&cli.StringFlag{
+				Name:    "cache-backend",
+				Usage:   "Where to cache directory listings (memory or redis)",
+				EnvVars: []string{"BUCKETEER_CACHE_BACKEND"},
+				Value:   "memory",
+			},
+			&cli.StringFlag{
+				Name:    "redis-url",
+				Usage:   "The URL of the Redis server to use with the redis cache backend",
+				EnvVars: []string{"BUCKETEER_REDIS_URL"},
+				Value:   "redis://localhost:6379/0",
+			},
+			&cli.IntFlag{
+				Name:    "read-dir-cache-size",
+				Usage:   "The maximum number of directory listings held by the memory cache backend (each listing holds every entry in a directory, so large directories use more memory)",
+				EnvVars: []string{"BUCKETEER_READ_DIR_CACHE_SIZE"},
+				Value:   100,
+			},
+			&cli.DurationFlag{
+				Name:    "read-dir-cache-ttl",
+				Usage:   "How long directory listings are cached for",
+				EnvVars: []string{"BUCKETEER_READ_DIR_CACHE_TTL"},
+				Value:   5 * time.Minute,
+			},
+			&cli.DurationFlag{
+				Name:    "stale-upload-ttl",
+				Usage:   "How long an incomplete upload can be inactive before it is removed",
+				EnvVars: []string{"BUCKETEER_STALE_UPLOAD_TTL"},
+				Value:   24 * time.Hour,
+			},
+			&cli.BoolFlag{
+				Name:    "read-only",
+				Usage:   "Disable all operations that modify the bucket (uploads, deletes, etc)",
+				EnvVars: []string{"BUCKETEER_READ_ONLY"},
+			},
+			&cli.StringFlag{
+				Name:    "trash-prefix",
+				Usage:   "Move deleted files and directories under this prefix (eg. .trash/) instead of deleting them",
+				EnvVars: []string{"BUCKETEER_TRASH_PREFIX"},
+			},
+			&cli.StringFlag{
+				Name:    "auth-user",
+				Usage:   "Require HTTP basic authentication with this username",
+				EnvVars: []string{"BUCKETEER_AUTH_USER"},
+			},
+			&cli.StringFlag{
+				Name:    "auth-pass",
+				Usage:   "The password to use with HTTP basic authentication",
+				EnvVars: []string{"BUCKETEER_AUTH_PASS"},
+			},
+			&cli.StringFlag{
+				Name:    "auth-token",
+				Usage:   "Require a bearer token for authentication",
+				EnvVars: []string{"BUCKETEER_AUTH_TOKEN"},
+			},
+			&cli.DurationFlag{
+				Name:    "presign-max-expiry",
+				Usage:   "The maximum lifetime of presigned download URLs",
+				EnvVars: []string{"BUCKETEER_PRESIGN_MAX_EXPIRY"},
+				Value:   7 * 24 * time.Hour,
+			},
+			&cli.StringFlag{
+				Name:    "share-key",
+				Usage:   "The key used to sign share links, if not set a random key is generated on startup",
+				EnvVars: []string{"BUCKETEER_SHARE_KEY"},
+			},
+			&cli.DurationFlag{
+				Name:    "share-max-expiry",
+				Usage:   "The maximum lifetime of share links",
+				EnvVars: []string{"BUCKETEER_SHARE_MAX_EXPIRY"},
+				Value:   7 * 24 * time.Hour,
+			},
+			&cli.DurationFlag{
+				Name:    "watch-poll-interval",
+				Usage:   "How often watched directories are polled for changes made outside of bucketeer",
+				EnvVars: []string{"BUCKETEER_WATCH_POLL_INTERVAL"},
+				Value:   10 * time.Second,
+			},
+			&cli.StringFlag{
+				Name:    "download-rate-limit",
+				Usage:   "The maximum download bandwidth shared by all clients in bytes per second (eg. 10MB), zero means unlimited",
+				EnvVars: []string{"BUCKETEER_DOWNLOAD_RATE_LIMIT"},
+				Value:   "0",
+			},
+			&cli.StringFlag{
+				Name:    "download-path-prefix",
+				Usage:   "The route prefix downloads are served beneath, change this if it collides with a reverse proxy's path",
+				EnvVars: []string{"BUCKETEER_DOWNLOAD_PATH_PREFIX"},
+				Value:   "/files/",
+			},
+			&cli.BoolFlag{
+				Name:    "no-auto-archive",
+				Usage:   "Reject directory downloads unless an archive format is explicitly requested (eg. ?format=zip)",
+				EnvVars: []string{"BUCKETEER_NO_AUTO_ARCHIVE"},
+			},
+			&cli.BoolFlag{
+				Name:    "telemetry",
+				Usage:   "Report anonymous crash and usage data to help improve Bucketeer",
+				EnvVars: []string{"BUCKETEER_TELEMETRY"},
+			},
+			&cli.StringFlag{
+				Name:    "telemetry-url",
+				Usage:   "The base URL of the telemetry server (for self-hosting)",
+				EnvVars: []string{"BUCKETEER_TELEMETRY_URL"},
+				Value:   constants.TelemetryURL,
+			},
+			&cli.StringFlag{
+				Name:    "max-upload-size",
+				Usage:   "The maximum size of an uploaded file, eg. 10GB (unlimited by default, uploads are staged in the cache directory so large uploads can fill the disk)",
+				EnvVars: []string{"BUCKETEER_MAX_UPLOAD_SIZE"},
+			},
+			&cli.StringFlag{
+				Name:    "max-put-size",
+				Usage:   "The maximum size of a file uploaded with a single PUT request, larger files must be uploaded in chunks",
+				EnvVars: []string{"BUCKETEER_MAX_PUT_SIZE"},
+				Value:   "16MB",
+			},
+			&cli.StringFlag{
+				Name:    "chunk-size",
+				Usage:   "The upload chunk size recommended to clients, eg. 64MB (larger chunks suit high latency links, smaller chunks unreliable links)",
+				EnvVars: []string{"BUCKETEER_CHUNK_SIZE"},
+				Value:   "16MB",
+			},
+			&cli.IntFlag{
+				Name:    "upload-workers",
+				Usage:   "The number of uploads (per bucket) that can be copied to the bucket concurrently (defaults to the number of CPUs)",
+				EnvVars: []string{"BUCKETEER_UPLOAD_WORKERS"},
+			},
+			&cli.DurationFlag{
+				Name:    "chunk-lock-timeout",
+				Usage:   "How long an upload chunk waits for an overlapping chunk before the client is asked to retry",
+				EnvVars: []string{"BUCKETEER_CHUNK_LOCK_TIMEOUT"},
+				Value:   60 * time.Second,
+			},
+			&cli.StringFlag{
+				Name:    "max-request-body",
+				Usage:   "The maximum size of a request body (excluding upload chunks), eg. 10MB (unlimited by default)",
+				EnvVars: []string{"BUCKETEER_MAX_REQUEST_BODY"},
+			},
+			&cli.UintFlag{
+				Name:    "http2-max-concurrent-streams",
+				Usage:   "The maximum number of concurrent HTTP/2 streams per connection, zero means the default of 250",
+				EnvVars: []string{"BUCKETEER_HTTP2_MAX_CONCURRENT_STREAMS"},
+			},
+			&cli.StringFlag{
+				Name:    "http2-max-read-frame-size",
+				Usage:   "The largest HTTP/2 frame the server will read, between 16KB and 16MB (defaults to 1MB)",
+				EnvVars: []string{"BUCKETEER_HTTP2_MAX_READ_FRAME_SIZE"},
+			},
+			&cli.DurationFlag{
+				Name:    "shutdown-timeout",
+				Usage:   "How long to wait for in-flight requests and uploads to finish when shutting down",
+				EnvVars: []string{"BUCKETEER_SHUTDOWN_TIMEOUT"},
+				Value:   30 * time.Second,
+			},
+			&cli.BoolFlag{
+				Name:    "metrics",
+				Usage:   "Expose Prometheus metrics on /metrics",
+				EnvVars: []string{"BUCKETEER_METRICS"},
+			},
 		}, sharedFlags...),
 		Before: beforeAll,
 		After:  afterAll,
@@ -193,17 +433,69 @@ func main() {
 				return fmt.Errorf("bucket name argument is required")
 			}
 
-			bucketName := c.Args().Get(0)
+			bucketNames := c.Args().Slice()
+
+			seenBucketNames := make(map[string]bool)
+			for _, bucketName := range bucketNames {
+				if seenBucketNames[bucketName] {
+					return fmt.Errorf("duplicate bucket name: %s", bucketName)
+				}
+				seenBucketNames[bucketName] = true
+			}
+
+			if (c.String("auth-user") == "") != (c.String("auth-pass") == "") {
+				return fmt.Errorf("both --auth-user and --auth-pass must be set for basic authentication")
+			}
+
+			var corsOrigins []string
+			for _, origin := range c.StringSlice("cors-origin") {
+				if err := validateCORSOrigin(origin); err != nil {
+					return fmt.Errorf("invalid cors origin %q: %w", origin, err)
+				}
+
+				corsOrigins = append(corsOrigins, strings.TrimSuffix(origin, "/"))
+			}
+
+			if c.Int("gzip-level") < 0 || c.Int("gzip-level") > 9 {
+				return fmt.Errorf("invalid gzip level: %d", c.Int("gzip-level"))
+			}
+
+			// A trash prefix of the bucket root would make every file trash.
+			if trashPrefix := c.String("trash-prefix"); trashPrefix != "" && path.Clean(strings.Trim(trashPrefix, "/")) == "." {
+				return fmt.Errorf("invalid trash prefix: %s", trashPrefix)
+			}
+
+			endpointURL := c.String("endpoint-url")
+			region := c.String("region")
+
+			// Fallback to the AWS config file for any settings that weren't explicitly set.
+			profile, err := awsconfig.Load(c.String("profile"))
+			if err != nil {
+				if c.IsSet("profile") {
+					return fmt.Errorf("failed to load aws config: %w", err)
+				}
+
+				logger.Debug("Failed to load aws config", "error", err)
+			} else {
+				if !c.IsSet("endpoint-url") && profile.EndpointURL != "" {
+					endpointURL = profile.EndpointURL
+				}
+
+				if !c.IsSet("region") && profile.Region != "" {
+					region = profile.Region
+				}
+			}
 
 			accessKeyID := c.String("access-key-id")
 			secretAccessKey := c.String("secret-access-key")
+			sessionToken := c.String("session-token")
 
 			// If the access key ID or secret access key are not set, try to get them from the
 			// AWS credentials file.
 			if accessKeyID == "" || secretAccessKey == "" {
 				logger.Info("Attempting to get credentials from AWS credentials file")
 
-				creds := credentials.NewFileAWSCredentials("", "")
+				creds := credentials.NewFileAWSCredentials("", c.String("profile"))
 				credValues, err := creds.Get()
 				if err != nil {
 					return fmt.Errorf("missing s3 credentials: %w", err)
@@ -211,6 +503,7 @@ func main() {
 
 				accessKeyID = credValues.AccessKeyID
 				secretAccessKey = credValues.SecretAccessKey
+				sessionToken = credValues.SessionToken
 			}
 
 			var tlsClientConfig *tls.Config
@@ -219,7 +512,11 @@ func main() {
 					InsecureSkipVerify: c.Bool("no-verify-ssl"),
 				}
 
-				caBundlePath := c.String("ca-bundle")
+				caBundlePath, err := util.ExpandPath(c.String("ca-bundle"))
+				if err != nil {
+					return fmt.Errorf("invalid ca bundle path: %w", err)
+				}
+
 				if caBundlePath != "" {
 					caBundle, err := os.ReadFile(caBundlePath)
 					if err != nil {
@@ -235,24 +532,77 @@ func main() {
 				}
 			}
 
-			opts := s3fs.Options{
-				EndpointURL:     c.String("endpoint-url"),
-				Region:          c.String("region"),
-				TLSClientConfig: tlsClientConfig,
-				Credentials:     credentials.NewStaticV4(accessKeyID, secretAccessKey, ""),
-				BucketName:      bucketName,
+			// Credentials and the endpoint are shared across all buckets.
+			buckets := make([]bucket, 0, len(bucketNames))
+			for _, bucketName := range bucketNames {
+				opts := s3fs.Options{
+					EndpointURL:     endpointURL,
+					Region:          region,
+					TLSClientConfig: tlsClientConfig,
+					Credentials:     credentials.NewStaticV4(accessKeyID, secretAccessKey, sessionToken),
+					BucketName:      bucketName,
+				}
+
+				fsys, err := s3fs.New(c.Context, logger, opts)
+				if err != nil {
+					return fmt.Errorf("failed to open s3 filesystem for bucket %q: %w", bucketName, err)
+				}
+
+				presigner, err := filesystem.NewS3Presigner(opts, c.Bool("presign-path-style"))
+				if err != nil {
+					return fmt.Errorf("failed to create presigner for bucket %q: %w", bucketName, err)
+				}
+
+				dirPager, err := filesystem.NewS3DirPager(opts, c.Bool("presign-path-style"))
+				if err != nil {
+					return fmt.Errorf("failed to create directory pager for bucket %q: %w", bucketName, err)
+				}
+
+				checksumSource, err := upload.NewS3ChecksumSource(opts, c.Bool("presign-path-style"))
+				if err != nil {
+					return fmt.Errorf("failed to create checksum source for bucket %q: %w", bucketName, err)
+				}
+
+				rangeReader, err := download.NewS3RangeReader(opts, c.Bool("presign-path-style"))
+				if err != nil {
+					return fmt.Errorf("failed to create range reader for bucket %q: %w", bucketName, err)
+				}
+
+				buckets = append(buckets, bucket{
+					name:           bucketName,
+					fsys:           fsys,
+					presigner:      presigner,
+					dirPager:       dirPager,
+					checksumSource: checksumSource,
+					rangeReader:    rangeReader,
+				})
+			}
+
+			// When serving multiple buckets, each bucket's handlers are mounted
+			// beneath its own path prefix.
+			multiBucket := len(buckets) > 1
+			if multiBucket {
+				for i := range buckets {
+					buckets[i].prefix = "/buckets/" + url.PathEscape(buckets[i].name)
+				}
 			}
 
-			fsys, err := s3fs.New(c.Context, logger, opts)
-			if err != nil {
-				return fmt.Errorf("failed to open s3 filesystem: %w", err)
+			if noticePath, err := xdg.DataFile("bucketeer/telemetry-notice"); err != nil {
+				logger.Warn("Failed to get telemetry notice path", "error", err)
+			} else if err := telemetry.ShowNoticeOnce(os.Stderr, noticePath); err != nil {
+				logger.Warn("Failed to show telemetry notice", "error", err)
+			}
+
+			telemetryURL, err := url.Parse(c.String("telemetry-url"))
+			if err != nil || (telemetryURL.Scheme != "http" && telemetryURL.Scheme != "https") {
+				return fmt.Errorf("invalid telemetry url: %s", c.String("telemetry-url"))
 			}
 
 			telemetryReporter := telemetry.NewRemoteReporter(
-				c.Context, logger, http.DefaultClient, constants.TelemetryURL)
+				c.Context, logger, http.DefaultClient, telemetryURL.String(), c.Bool("telemetry"))
 			defer telemetryReporter.Close()
 
-			err = telemetryReporter.ReportStart(c.Context, c.String("endpoint-url"))
+			err = telemetryReporter.ReportStart(c.Context, endpointURL)
 			if err != nil {
 				logger.Warn("Failed to report application start", "error", err)
 			}
@@ -262,6 +612,17 @@ func main() {
 
 			e.Use(slogecho.New(logger))
 
+			// Keep track of in-flight requests so we can report them if shutdown times out.
+			var inFlightRequests atomic.Int64
+			e.Use(func(next echo.HandlerFunc) echo.HandlerFunc {
+				return func(c echo.Context) error {
+					inFlightRequests.Add(1)
+					defer inFlightRequests.Add(-1)
+
+					return next(c)
+				}
+			})
+
 			recoverConfig := middleware.DefaultRecoverConfig
 			recoverConfig.StackSize = 8000000 // Capture as much as practical
 
@@ -270,15 +631,68 @@ func main() {
 
 			e.Use(middleware.RecoverWithConfig(recoverConfig))
 
+			if c.String("max-request-body") != "" {
+				maxRequestBody, err := units.FromHumanSize(c.String("max-request-body"))
+				if err != nil || maxRequestBody <= 0 {
+					return fmt.Errorf("invalid max request body: %s", c.String("max-request-body"))
+				}
+
+				e.Use(middleware.BodyLimitWithConfig(middleware.BodyLimitConfig{
+					Limit: strconv.FormatInt(maxRequestBody, 10),
+					// Upload chunks are bounded by the chunk size instead.
+					Skipper: func(c echo.Context) bool {
+						return strings.Contains(c.Request().URL.Path, "/files/upload")
+					},
+				}))
+			}
+
 			// For local development.
 			if c.Bool("disable-cors") {
+				corsOrigins = append(corsOrigins, "http://localhost:*")
+			}
+
+			if len(corsOrigins) > 0 {
 				e.Use(middleware.CORSWithConfig(middleware.CORSConfig{
-					AllowOrigins: []string{"http://localhost:*"},
+					AllowOrigins: corsOrigins,
 					AllowMethods: []string{http.MethodGet, http.MethodPut, http.MethodPost, http.MethodPatch, http.MethodDelete},
-					AllowHeaders: []string{echo.HeaderOrigin, echo.HeaderContentType, echo.HeaderAccept, "Content-Range", "Connect-Protocol-Version"},
+					AllowHeaders: []string{echo.HeaderOrigin, echo.HeaderContentType, echo.HeaderAccept, echo.HeaderAuthorization, "Content-Range", "Connect-Protocol-Version"},
 				}))
 			}
 
+			if c.Int("gzip-level") > 0 {
+				e.Use(middleware.GzipWithConfig(middleware.GzipConfig{
+					Level:     c.Int("gzip-level"),
+					MinLength: c.Int("gzip-min-length"),
+					Skipper:   skipGzip(c.String("download-path-prefix")),
+				}))
+			}
+
+			if c.String("auth-user") != "" || c.String("auth-token") != "" {
+				e.Use(auth.Middleware(auth.Options{
+					Username: c.String("auth-user"),
+					Password: c.String("auth-pass"),
+					Token:    c.String("auth-token"),
+					Skipper: func(c echo.Context) bool {
+						// Share links carry their own (signed) credentials.
+						return c.Path() == "/healthz" || c.Path() == "/readyz" || strings.HasSuffix(c.Path(), "/shared/*")
+					},
+				}))
+			}
+
+			// Health checks (for Kubernetes etc).
+			e.GET("/healthz", echo.WrapHandler(health.LivenessHandler()))
+			filesystems := make([]writablefs.FS, 0, len(buckets))
+			for _, b := range buckets {
+				filesystems = append(filesystems, b.fsys)
+			}
+			e.GET("/readyz", echo.WrapHandler(health.ReadinessHandler(logger, 5*time.Second, filesystems...)))
+
+			e.GET("/api/v1alpha1/version", echo.WrapHandler(version.Handler()))
+
+			if c.Bool("metrics") {
+				e.GET("/metrics", echo.WrapHandler(metrics.Handler()))
+			}
+
 			// The rendered React app.
 			webFS, err := web.GetFS()
 			if err != nil {
@@ -291,26 +705,67 @@ func main() {
 				return c.Redirect(http.StatusMovedPermanently, "/browse/")
 			})
 
-			// React.
-			e.GET("/browse/*", func(c echo.Context) error {
-				c.Request().URL.Path = "/"
-				webFSServer.ServeHTTP(c.Response(), c.Request())
-				return nil
-			})
+			if multiBucket {
+				indexHTML, err := readIndexHTML(webFS)
+				if err != nil {
+					return fmt.Errorf("failed to read web index: %w", err)
+				}
+
+				// The list of available buckets.
+				e.GET("/browse/", bucketIndexHandler(buckets))
+
+				// React (told which bucket it is browsing).
+				for _, b := range buckets {
+					e.GET("/browse/"+url.PathEscape(b.name)+"/*", echo.WrapHandler(bucketAppHandler(indexHTML, b.name)))
+				}
+			} else {
+				// React.
+				e.GET("/browse/*", func(c echo.Context) error {
+					c.Request().URL.Path = "/"
+					webFSServer.ServeHTTP(c.Response(), c.Request())
+					return nil
+				})
+			}
 
 			// Assets etc.
 			e.GET("/*", echo.WrapHandler(webFSServer))
 
-			// Handle filesystem operations.
-			filesystemServerPath, filesystemServer := filesystem.NewServer(logger, fsys)
-			e.Any(filesystemServerPath+"*", echo.WrapHandler(filesystemServer))
+			if c.Int("read-dir-cache-size") <= 0 {
+				return fmt.Errorf("invalid read dir cache size: %d", c.Int("read-dir-cache-size"))
+			}
+
+			var readDirCache filesystem.ListingCache
+			switch c.String("cache-backend") {
+			case "memory":
+				// The default.
+			case "redis":
+				redisOpts, err := redis.ParseURL(c.String("redis-url"))
+				if err != nil {
+					return fmt.Errorf("failed to parse redis url: %w", err)
+				}
+
+				redisClient := redis.NewClient(redisOpts)
+				defer redisClient.Close()
+
+				readDirCache = filesystem.NewRedisListingCache(redisClient, c.Duration("read-dir-cache-ttl"))
+			default:
+				return fmt.Errorf("unsupported cache backend: %s", c.String("cache-backend"))
+			}
 
 			// Handle file uploads / downloads.
-			cacheDir, err := os.MkdirTemp("", "bucketeer-*")
+			cacheDir, err := util.ExpandPath(c.String("cache-dir"))
 			if err != nil {
-				return err
+				return fmt.Errorf("invalid cache directory: %w", err)
+			}
+
+			if cacheDir == "" {
+				cacheDir, err = os.MkdirTemp("", "bucketeer-*")
+				if err != nil {
+					return err
+				}
+			} else if err := os.MkdirAll(cacheDir, 0o755); err != nil {
+				return fmt.Errorf("failed to create cache directory: %w", err)
 			}
-			defer os.RemoveAll(cacheDir)
 
 			// S3 doesn't support partial file writes, so we need to stage files locally before
 			// uploading them.
@@ -319,30 +774,235 @@ func main() {
 				return err
 			}
 
-			uploadServerPath, uploadServer := upload.NewServer(logger, fsys, cacheFS)
-			e.Any(uploadServerPath+"*", echo.WrapHandler(uploadServer))
+			if !c.Bool("keep-cache") {
+				defer func() {
+					if c.String("cache-dir") == "" {
+						_ = os.RemoveAll(cacheDir)
+					}
+				}()
+			}
+
+			downloadRateLimit, err := units.FromHumanSize(c.String("download-rate-limit"))
+			if err != nil {
+				return fmt.Errorf("invalid download rate limit: %w", err)
+			}
+
+			var maxUploadSize int64
+			if c.String("max-upload-size") != "" {
+				maxUploadSize, err = units.FromHumanSize(c.String("max-upload-size"))
+				if err != nil {
+					return fmt.Errorf("invalid max upload size: %w", err)
+				}
+			}
+
+			maxPutSize, err := units.FromHumanSize(c.String("max-put-size"))
+			if err != nil || maxPutSize <= 0 {
+				return fmt.Errorf("invalid max put size: %s", c.String("max-put-size"))
+			}
+
+			chunkSize, err := units.FromHumanSize(c.String("chunk-size"))
+			if err != nil || chunkSize <= 0 {
+				return fmt.Errorf("invalid chunk size: %s", c.String("chunk-size"))
+			}
+
+			if c.Int("upload-workers") < 0 {
+				return fmt.Errorf("invalid number of upload workers: %d", c.Int("upload-workers"))
+			}
+
+			var uploadServers []*upload.Server
+			for _, b := range buckets {
+				b := b
+
+				watcher := filesystem.NewWatcher(logger, b.fsys, c.Duration("watch-poll-interval"))
+
+				// Handle filesystem operations.
+				filesystemOpts := &filesystem.ServerOptions{
+					ReadDirCache:        readDirCache,
+					ReadDirCacheMaxSize: c.Int("read-dir-cache-size"),
+					ReadDirCacheTTL:     c.Duration("read-dir-cache-ttl"),
+					ReadOnly:            c.Bool("read-only"),
+					Presigner:           b.presigner,
+					MaxPresignExpiry:    c.Duration("presign-max-expiry"),
+					DirPager:            b.dirPager,
+					Watcher:             watcher,
+					TrashPrefix:         c.String("trash-prefix"),
+					// Only S3 is supported at the moment.
+					ObjectStore: true,
+				}
+
+				filesystemServerPath, filesystemServer := filesystem.NewServer(logger, b.fsys, filesystemOpts)
+				b.mount(e, filesystemServerPath+"*", filesystemServer)
+
+				removeServerPath, removeServer := filesystemServer.(*filesystem.Server).RemoveHandler()
+				b.mount(e, removeServerPath, removeServer)
+
+				listServerPath, listServer := filesystemServer.(*filesystem.Server).ListHandler()
+				b.mount(e, listServerPath, listServer)
 
-			chunkServerPath, chunkServer := upload.NewChunkServer(logger, fsys, cacheFS)
-			e.Any(chunkServerPath, echo.WrapHandler(chunkServer))
+				capabilitiesServerPath, capabilitiesServer := filesystem.NewCapabilitiesServer(logger, b.fsys, filesystemOpts)
+				b.mount(e, capabilitiesServerPath, capabilitiesServer)
 
-			downloadServerPath, downloadServer := download.NewServer(logger, fsys)
-			e.Any(downloadServerPath+"*", echo.WrapHandler(downloadServer))
+				infoServerPath, infoServer := filesystem.NewInfoServer(logger, b.fsys)
+				b.mount(e, infoServerPath, infoServer)
+
+				previewServerPath, previewServer := filesystem.NewPreviewServer(logger, b.fsys)
+				b.mount(e, previewServerPath, previewServer)
+
+				watchServerPath, watchServer := filesystem.NewWatchServer(logger, watcher)
+				b.mount(e, watchServerPath, watchServer)
+
+				// Each bucket stages its uploads separately.
+				bucketCacheFS, bucketCacheDir := cacheFS, cacheDir
+				if multiBucket {
+					if err := cacheFS.MkdirAll(b.name); err != nil {
+						return fmt.Errorf("failed to create cache directory: %w", err)
+					}
+
+					bucketCacheDir = filepath.Join(cacheDir, b.name)
+					bucketCacheFS, err = dirfs.New(bucketCacheDir)
+					if err != nil {
+						return err
+					}
+				}
+
+				if !c.Bool("keep-cache") {
+					defer func() {
+						// Only remove the staged uploads, the cache directory might be shared.
+						if err := upload.RemoveCache(bucketCacheFS); err != nil {
+							logger.Warn("Failed to remove staged uploads", "bucket", b.name, "error", err)
+						}
+					}()
+				}
+
+				// Shared so that chunk range locks are released when uploads are aborted or completed.
+				rangeLocks := upload.NewRangeLocks()
+
+				uploadServerPath, uploadServer := upload.NewServer(c.Context, logger, b.fsys, bucketCacheFS, &upload.ServerOptions{
+					StaleUploadTTL:    c.Duration("stale-upload-ttl"),
+					ReadOnly:          c.Bool("read-only"),
+					MaxUploadSize:     maxUploadSize,
+					ChunkSize:         chunkSize,
+					CacheDir:          bucketCacheDir,
+					Workers:           c.Int("upload-workers"),
+					RangeLocks:        rangeLocks,
+					TelemetryReporter: telemetryReporter,
+					ChecksumSource:    b.checksumSource,
+					OnComplete: func(dstPath string) {
+						filesystemServer.(*filesystem.Server).Changed(c.Context, path.Dir(dstPath))
+					},
+				})
+				b.mount(e, uploadServerPath+"*", uploadServer)
+				uploadServers = append(uploadServers, uploadServer.(*upload.Server))
+
+				chunkServerPath, chunkServer := upload.NewChunkServer(logger, b.fsys, bucketCacheFS, &upload.ServerOptions{
+					ReadOnly:    c.Bool("read-only"),
+					RangeLocks:  rangeLocks,
+					LockTimeout: c.Duration("chunk-lock-timeout"),
+				})
+				b.mount(e, chunkServerPath, chunkServer)
+
+				putServerPath, putServer := upload.NewPutServer(logger, b.fsys, &upload.ServerOptions{
+					ReadOnly:          c.Bool("read-only"),
+					MaxUploadSize:     maxUploadSize,
+					MaxPutSize:        maxPutSize,
+					TelemetryReporter: telemetryReporter,
+					OnComplete: func(dstPath string) {
+						filesystemServer.(*filesystem.Server).Changed(c.Context, path.Dir(dstPath))
+					},
+				})
+				b.mount(e, putServerPath+"*", putServer)
+
+				checksumServerPath, checksumServer := upload.NewChecksumServer(logger, b.fsys, &upload.ServerOptions{
+					ReadOnly: c.Bool("read-only"),
+				})
+				b.mount(e, checksumServerPath, checksumServer)
+
+				cacheStatusServerPath, cacheStatusServer := upload.NewCacheStatusServer(logger, bucketCacheFS, &upload.ServerOptions{
+					CacheDir: bucketCacheDir,
+				})
+				b.mount(e, cacheStatusServerPath, cacheStatusServer)
+
+				downloadServerPath, downloadServer := download.NewServer(logger, b.fsys, &download.ServerOptions{
+					RateLimit:         downloadRateLimit,
+					TelemetryReporter: telemetryReporter,
+					PathPrefix:        c.String("download-path-prefix"),
+					NoAutoArchive:     c.Bool("no-auto-archive"),
+					RangeReader:       b.rangeReader,
+					BucketName:        b.name,
+				})
+				b.mount(e, downloadServerPath+"*", downloadServer)
+
+				sharePath, sharedPath, shareServer := download.NewShareServer(logger, downloadServer.(*download.Server), &download.ShareServerOptions{
+					Key:       []byte(c.String("share-key")),
+					MaxExpiry: c.Duration("share-max-expiry"),
+				})
+				b.mount(e, sharePath, shareServer)
+				b.mount(e, sharedPath+"*", shareServer)
+			}
 
 			// Allow the browser to report telemetry / errors.
 			telemetryProxyServerPath, telemetryProxyServer := telemetry.NewProxyServer(logger, telemetryReporter)
 			e.Any(telemetryProxyServerPath+"*", echo.WrapHandler(telemetryProxyServer))
 
+			if c.Uint("http2-max-concurrent-streams") > math.MaxUint32 {
+				return fmt.Errorf("invalid http2 max concurrent streams: %d", c.Uint("http2-max-concurrent-streams"))
+			}
+
+			h2s := &http2.Server{
+				MaxConcurrentStreams: uint32(c.Uint("http2-max-concurrent-streams")),
+			}
+
+			if c.String("http2-max-read-frame-size") != "" {
+				maxReadFrameSize, err := units.FromHumanSize(c.String("http2-max-read-frame-size"))
+				// The limits imposed by the HTTP/2 spec.
+				if err != nil || maxReadFrameSize < 1<<14 || maxReadFrameSize > 1<<24-1 {
+					return fmt.Errorf("invalid http2 max read frame size: %s", c.String("http2-max-read-frame-size"))
+				}
+
+				h2s.MaxReadFrameSize = uint32(maxReadFrameSize)
+			}
+
+			var socketMode uint64
+			if c.String("listen-socket-mode") != "" {
+				socketMode, err = strconv.ParseUint(c.String("listen-socket-mode"), 8, 32)
+				if err != nil {
+					return fmt.Errorf("invalid socket mode: %w", err)
+				}
+			}
+
+			// Unix domain sockets are removed when the listener is closed on shutdown.
+			e.Listener, err = util.Listen(c.String("listen"), os.FileMode(socketMode))
+			if err != nil {
+				return fmt.Errorf("failed to listen: %w", err)
+			}
+
 			// Catch any shutdown signals.
 			sigCh := make(chan os.Signal, 1)
 			signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
 
+			shutdownComplete := make(chan struct{})
 			go func() {
+				defer close(shutdownComplete)
+
 				<-sigCh
 
 				logger.Info("Shutting down server")
 
-				if err := e.Shutdown(c.Context); err != nil {
-					logger.Error("Failed to shutdown server", "error", err)
+				ctx, cancel := context.WithTimeout(c.Context, c.Duration("shutdown-timeout"))
+				defer cancel()
+
+				if err := e.Shutdown(ctx); err != nil {
+					if errors.Is(err, context.DeadlineExceeded) {
+						logger.Warn("Timed out waiting for requests to finish", "inFlight", inFlightRequests.Load())
+					} else {
+						logger.Error("Failed to shutdown server", "error", err)
+					}
+				}
+
+				for _, uploadServer := range uploadServers {
+					if err := uploadServer.Shutdown(ctx); err != nil {
+						logger.Warn("Abandoning pending upload completions", "error", err)
+					}
 				}
 			}()
 
@@ -350,10 +1010,14 @@ func main() {
 				fmt.Println(banner)
 			}
 
-			if err := e.StartH2CServer(c.String("listen"), &http2.Server{}); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			if err := e.StartH2CServer(c.String("listen"), h2s); err != nil && !errors.Is(err, http.ErrServerClosed) {
 				return fmt.Errorf("failed to start server: %w", err)
 			}
 
+			// The server stops accepting connections as soon as shutdown begins, wait
+			// for in-flight requests and upload completions to finish.
+			<-shutdownComplete
+
 			return nil
 		},
 	}
@@ -364,6 +1028,52 @@ func main() {
 	}
 }
 
+// skipGzip skips compression of downloads (which are often already compressed,
+// and archives are compressed anyway) and of connect RPCs (which negotiate their
+// own compression, the gzip middleware would compress them twice).
+func skipGzip(downloadPathPrefix string) middleware.Skipper {
+	downloadPathPrefix = "/" + strings.Trim(downloadPathPrefix, "/") + "/"
+
+	return func(c echo.Context) bool {
+		p := c.Request().URL.Path
+
+		// Event streams must be flushed as they are written.
+		return strings.Contains(p, "/files/") || strings.Contains(p, downloadPathPrefix) || strings.Contains(p, "/shared/") ||
+			strings.Contains(p, "/api/bucketeer.") || strings.HasSuffix(p, "/fs/watch")
+	}
+}
+
+// validateCORSOrigin checks that an origin is of the form scheme://host[:port].
+func validateCORSOrigin(origin string) error {
+	u, err := url.Parse(origin)
+	if err != nil {
+		return err
+	}
+
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("scheme must be http or https")
+	}
+
+	if u.Host == "" {
+		return fmt.Errorf("missing host")
+	}
+
+	if (u.Path != "" && u.Path != "/") || u.RawQuery != "" || u.Fragment != "" || u.User != nil {
+		return fmt.Errorf("origin must only contain a scheme, host and optional port")
+	}
+
+	return nil
+}
+
+// newLogHandler returns a JSON handler if the format is "json", otherwise a text handler.
+func newLogHandler(w io.Writer, format string, opts *slog.HandlerOptions) slog.Handler {
+	if format == "json" {
+		return slog.NewJSONHandler(w, opts)
+	}
+
+	return slog.NewTextHandler(w, opts)
+}
+
 type logLevelFlag slog.Level
 
 func fromLogLevel(l slog.Level) *logLevelFlag {
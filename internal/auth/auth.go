@@ -0,0 +1,87 @@
+/* SPDX-License-Identifier: AGPL-3.0-or-later
+ *
+ * Copyright 2024 Damian Peckett <damian@pecke.tt>.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package auth
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+)
+
+const realm = "bucketeer"
+
+// Options are options for configuring the authentication middleware.
+type Options struct {
+	// Username and Password enable HTTP basic authentication.
+	Username string
+	Password string
+	// Token enables bearer token authentication.
+	Token string
+	// Skipper defines a function to skip authentication for some requests (eg. health checks).
+	Skipper middleware.Skipper
+}
+
+// Middleware returns an echo middleware that requires requests to present either
+// valid basic auth credentials or a valid bearer token.
+func Middleware(opts Options) echo.MiddlewareFunc {
+	if opts.Skipper == nil {
+		opts.Skipper = middleware.DefaultSkipper
+	}
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if opts.Skipper(c) || opts.authenticated(c.Request()) {
+				return next(c)
+			}
+
+			if opts.Username != "" {
+				c.Response().Header().Set(echo.HeaderWWWAuthenticate, `Basic realm="`+realm+`"`)
+			} else {
+				c.Response().Header().Set(echo.HeaderWWWAuthenticate, `Bearer realm="`+realm+`"`)
+			}
+
+			return echo.NewHTTPError(http.StatusUnauthorized, "Unauthorized")
+		}
+	}
+}
+
+func (opts *Options) authenticated(r *http.Request) bool {
+	if opts.Username != "" {
+		if username, password, ok := r.BasicAuth(); ok &&
+			secureCompare(username, opts.Username) && secureCompare(password, opts.Password) {
+			return true
+		}
+	}
+
+	if opts.Token != "" {
+		scheme, token, ok := strings.Cut(r.Header.Get(echo.HeaderAuthorization), " ")
+		if ok && strings.EqualFold(scheme, "Bearer") && secureCompare(token, opts.Token) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func secureCompare(a, b string) bool {
+	return subtle.ConstantTimeCompare([]byte(a), []byte(b)) == 1
+}
@@ -23,4 +23,5 @@ var (
 	TelemetryURL   = "http://localhost:16322/api"
 	TelemetryToken = ""
 	Version        = "dev"
+	Commit         = ""
 )
@@ -19,17 +19,27 @@
 package download_test
 
 import (
+	"archive/tar"
 	"archive/zip"
 	"bytes"
+	"compress/gzip"
 	"context"
 	"crypto/rand"
 	"crypto/sha256"
 	"encoding/hex"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
+	"mime"
+	"mime/multipart"
 	"net/http"
 	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -45,8 +55,6 @@ import (
 )
 
 func TestDownload(t *testing.T) {
-	logger := slogt.New(t)
-
 	testDir := t.TempDir()
 
 	fsys, err := dirfs.New(testDir)
@@ -66,11 +74,933 @@ func TestDownload(t *testing.T) {
 	err = f.Close()
 	require.NoError(t, err)
 
+	baseURL := startServer(t, fsys, nil)
+
+	t.Run("Download File", func(t *testing.T) {
+		expectedSum, err := fileChecksum(fsys, "test/folder/file.bin")
+		require.NoError(t, err)
+
+		// Download the file
+		h := sha256.New()
+
+		err = downloadFile(context.Background(), baseURL, "test/folder/file.bin", nil, h)
+		require.NoError(t, err)
+
+		actualSum := hex.EncodeToString(h.Sum(nil))
+
+		assert.Equal(t, expectedSum, actualSum)
+	})
+
+	t.Run("Not Modified", func(t *testing.T) {
+		downloadURL := fmt.Sprintf("%s/files/download/%s", baseURL, url.QueryEscape("test/folder/file.bin"))
+
+		resp, err := http.DefaultClient.Head(downloadURL)
+		require.NoError(t, err)
+		resp.Body.Close()
+
+		etag := resp.Header.Get("ETag")
+		require.NotEmpty(t, etag)
+
+		req, err := http.NewRequest(http.MethodGet, downloadURL, nil)
+		require.NoError(t, err)
+		req.Header.Set("If-None-Match", etag)
+
+		resp, err = http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		resp.Body.Close()
+
+		assert.Equal(t, http.StatusNotModified, resp.StatusCode)
+	})
+
+	t.Run("Multiple Ranges", func(t *testing.T) {
+		req, err := http.NewRequest(http.MethodGet, fmt.Sprintf("%s/files/download/%s", baseURL, url.QueryEscape("test/folder/file.bin")), nil)
+		require.NoError(t, err)
+		req.Header.Set("Range", "bytes=0-99,200-299")
+
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+
+		require.Equal(t, http.StatusPartialContent, resp.StatusCode)
+
+		mediaType, params, err := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+		require.NoError(t, err)
+		require.Equal(t, "multipart/byteranges", mediaType)
+
+		f, err := fsys.Open("test/folder/file.bin")
+		require.NoError(t, err)
+		t.Cleanup(func() {
+			_ = f.Close()
+		})
+
+		expected := make([]byte, 300)
+		_, err = io.ReadFull(f, expected)
+		require.NoError(t, err)
+
+		mr := multipart.NewReader(resp.Body, params["boundary"])
+
+		for _, rng := range []struct{ start, end int }{{0, 99}, {200, 299}} {
+			part, err := mr.NextPart()
+			require.NoError(t, err)
+
+			assert.Equal(t, fmt.Sprintf("bytes %d-%d/%d", rng.start, rng.end, size), part.Header.Get("Content-Range"))
+
+			data, err := io.ReadAll(part)
+			require.NoError(t, err)
+
+			assert.Equal(t, expected[rng.start:rng.end+1], data)
+		}
+
+		_, err = mr.NextPart()
+		assert.ErrorIs(t, err, io.EOF)
+	})
+
+	t.Run("Download Inline", func(t *testing.T) {
+		err := fsys.MkdirAll("inline")
+		require.NoError(t, err)
+
+		f, err := fsys.OpenFile("inline/image.png", writablefs.FlagReadWrite|writablefs.FlagCreate)
+		require.NoError(t, err)
+
+		_, err = f.Write([]byte("\x89PNG\x0D\x0A\x1A\x0A"))
+		require.NoError(t, err)
+		require.NoError(t, f.Close())
+
+		resp, err := http.Get(fmt.Sprintf("%s/files/download/%s?inline=1", baseURL, url.QueryEscape("inline/image.png")))
+		require.NoError(t, err)
+		resp.Body.Close()
+
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, "image/png", resp.Header.Get("Content-Type"))
+		assert.Equal(t, "inline; filename=image.png", resp.Header.Get("Content-Disposition"))
+	})
+
+	t.Run("Download Quoted Filename", func(t *testing.T) {
+		err := fsys.MkdirAll("quoted")
+		require.NoError(t, err)
+
+		f, err := fsys.OpenFile("quoted/my file;.txt", writablefs.FlagReadWrite|writablefs.FlagCreate)
+		require.NoError(t, err)
+
+		_, err = f.Write([]byte("hello"))
+		require.NoError(t, err)
+		require.NoError(t, f.Close())
+
+		for disposition, expected := range map[string]string{
+			"":       `attachment; filename="my file;.txt"`,
+			"inline": `inline; filename="my file;.txt"`,
+		} {
+			resp, err := http.Get(fmt.Sprintf("%s/files/download/%s?disposition=%s", baseURL, url.PathEscape("quoted/my file;.txt"), disposition))
+			require.NoError(t, err)
+			resp.Body.Close()
+
+			assert.Equal(t, http.StatusOK, resp.StatusCode)
+			assert.Equal(t, expected, resp.Header.Get("Content-Disposition"))
+		}
+	})
+
+	t.Run("Download Directory", func(t *testing.T) {
+		var buf bytes.Buffer
+
+		err = downloadFile(context.Background(), baseURL, "test/", nil, &buf)
+		require.NoError(t, err)
+
+		// Check the contents of the zip file
+		r, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+		require.NoError(t, err)
+
+		var names []string
+		for _, f := range r.File {
+			names = append(names, f.Name)
+		}
+
+		assert.Equal(t, []string{"test/", "test/folder/", "test/folder/file.bin"}, names)
+	})
+
+	t.Run("Download Directory As Tarball", func(t *testing.T) {
+		var buf bytes.Buffer
+
+		err = downloadFile(context.Background(), baseURL, "test/", url.Values{"format": {"targz"}}, &buf)
+		require.NoError(t, err)
+
+		// Check the contents of the tarball
+		gr, err := gzip.NewReader(&buf)
+		require.NoError(t, err)
+
+		var names []string
+		tr := tar.NewReader(gr)
+		for {
+			header, err := tr.Next()
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			require.NoError(t, err)
+
+			if header.Typeflag == tar.TypeReg {
+				names = append(names, header.Name)
+			}
+		}
+
+		assert.Equal(t, []string{"folder/file.bin"}, names)
+	})
+
+	t.Run("Download Directory As Tar", func(t *testing.T) {
+		resp, err := http.Get(fmt.Sprintf("%s/files/download/%s?format=tar", baseURL, url.QueryEscape("test/")))
+		require.NoError(t, err)
+		t.Cleanup(func() {
+			require.NoError(t, resp.Body.Close())
+		})
+
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, "application/x-tar", resp.Header.Get("Content-Type"))
+		assert.Equal(t, "attachment; filename=test.tar", resp.Header.Get("Content-Disposition"))
+
+		var names []string
+		tr := tar.NewReader(resp.Body)
+		for {
+			header, err := tr.Next()
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			require.NoError(t, err)
+
+			if header.Typeflag == tar.TypeReg {
+				names = append(names, header.Name)
+			}
+		}
+
+		assert.Equal(t, []string{"folder/file.bin"}, names)
+	})
+
+	t.Run("Not Found", func(t *testing.T) {
+		resp, err := http.Get(fmt.Sprintf("%s/files/download/%s", baseURL, url.QueryEscape("test/missing.bin")))
+		require.NoError(t, err)
+		resp.Body.Close()
+
+		assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+	})
+
+	t.Run("Missing Directory", func(t *testing.T) {
+		// Rather than an empty archive.
+		resp, err := http.Get(fmt.Sprintf("%s/files/download/%s?format=zip", baseURL, url.QueryEscape("test/missing/")))
+		require.NoError(t, err)
+		resp.Body.Close()
+
+		assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+		assert.NotEqual(t, "application/zip", resp.Header.Get("Content-Type"))
+	})
+}
+
+func TestDownloadLargeDirectory(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping large directory download in short mode")
+	}
+
+	testDir := t.TempDir()
+
+	fsys, err := dirfs.New(testDir)
+	require.NoError(t, err)
+
+	err = fsys.MkdirAll("test")
+	require.NoError(t, err)
+
+	// A sparse file larger than 4GB (so that Zip64 extensions are required).
+	size := int64(5000000000)
+	f, err := os.Create(filepath.Join(testDir, "test", "large.bin"))
+	require.NoError(t, err)
+
+	require.NoError(t, f.Truncate(size))
+	require.NoError(t, f.Close())
+
+	baseURL := startServer(t, fsys, nil)
+
+	zipPath := filepath.Join(t.TempDir(), "test.zip")
+
+	zipFile, err := os.Create(zipPath)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_ = zipFile.Close()
+	})
+
+	err = downloadFile(context.Background(), baseURL, "test/", nil, zipFile)
+	require.NoError(t, err)
+
+	r, err := zip.OpenReader(zipPath)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_ = r.Close()
+	})
+
+	require.Len(t, r.File, 2)
+	assert.Equal(t, "test/large.bin", r.File[1].Name)
+	assert.Equal(t, uint64(size), r.File[1].UncompressedSize64)
+
+	// Extract the file (the zip reader will verify the checksum).
+	rc, err := r.File[1].Open()
+	require.NoError(t, err)
+	defer rc.Close()
+
+	n, err := io.Copy(io.Discard, rc)
+	require.NoError(t, err)
+
+	assert.Equal(t, size, n)
+}
+
+func TestDownloadDirectoryCancel(t *testing.T) {
+	testDir := t.TempDir()
+
+	fsys, err := dirfs.New(testDir)
+	require.NoError(t, err)
+
+	require.NoError(t, fsys.MkdirAll("test"))
+
+	// Sparse files, large enough that the archive won't be finished before
+	// the download is cancelled.
+	for i := 0; i < 4; i++ {
+		f, err := os.Create(filepath.Join(testDir, "test", fmt.Sprintf("large-%d.bin", i)))
+		require.NoError(t, err)
+
+		require.NoError(t, f.Truncate(5000000000))
+		require.NoError(t, f.Close())
+	}
+
+	baseURL := startServer(t, fsys, nil)
+
+	transport := &http.Transport{}
+	client := &http.Client{Transport: transport}
+
+	for _, format := range []string{"zip", "targz"} {
+		t.Run(format, func(t *testing.T) {
+			numGoroutines := runtime.NumGoroutine()
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			req, err := http.NewRequestWithContext(ctx, http.MethodGet, fmt.Sprintf("%s/files/download/test/?format=%s", baseURL, format), nil)
+			require.NoError(t, err)
+
+			resp, err := client.Do(req)
+			require.NoError(t, err)
+
+			require.Equal(t, http.StatusOK, resp.StatusCode)
+
+			// Read part of the archive, then go away.
+			_, err = io.CopyN(io.Discard, resp.Body, 1<<20)
+			require.NoError(t, err)
+
+			cancel()
+			_ = resp.Body.Close()
+			transport.CloseIdleConnections()
+
+			// The server should stop archiving (rather than reading the rest of
+			// the directory into the void). Polled here as Eventually runs its
+			// condition in another goroutine, which would be counted.
+			deadline := time.Now().Add(10 * time.Second)
+			for runtime.NumGoroutine() > numGoroutines && time.Now().Before(deadline) {
+				time.Sleep(100 * time.Millisecond)
+			}
+
+			assert.LessOrEqual(t, runtime.NumGoroutine(), numGoroutines)
+		})
+	}
+}
+
+func TestDownloadDirectorySymlinks(t *testing.T) {
+	testDir := t.TempDir()
+
+	fsys, err := dirfs.New(testDir)
+	require.NoError(t, err)
+
+	require.NoError(t, os.MkdirAll(filepath.Join(testDir, "test"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(testDir, "test", "file.txt"), []byte("Hello, World!"), 0o644))
+
+	outsideDir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(outsideDir, "secret.txt"), []byte("Secret"), 0o644))
+
+	require.NoError(t, os.Symlink("file.txt", filepath.Join(testDir, "test", "link.txt")))
+	require.NoError(t, os.Symlink(filepath.Join(outsideDir, "secret.txt"), filepath.Join(testDir, "test", "outside.txt")))
+
+	baseURL := startServer(t, fsys, nil)
+
+	var buf bytes.Buffer
+	err = downloadFile(context.Background(), baseURL, "test/", nil, &buf)
+	require.NoError(t, err)
+
+	r, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	require.NoError(t, err)
+
+	var names []string
+	for _, f := range r.File {
+		names = append(names, f.Name)
+	}
+
+	assert.Equal(t, []string{"test/", "test/file.txt"}, names)
+}
+
+func TestDownloadDirectoryNotModified(t *testing.T) {
+	testDir := t.TempDir()
+
+	fsys, err := dirfs.New(testDir)
+	require.NoError(t, err)
+
+	require.NoError(t, fsys.MkdirAll("test/folder"))
+
+	f, err := fsys.OpenFile("test/folder/file.txt", writablefs.FlagReadWrite|writablefs.FlagCreate)
+	require.NoError(t, err)
+
+	_, err = f.Write([]byte("Hello, World!"))
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	baseURL := startServer(t, fsys, nil)
+
+	get := func(t *testing.T, listingID, ifModifiedSince string) *http.Response {
+		downloadURL := fmt.Sprintf("%s/files/download/%s?id=%s", baseURL, url.QueryEscape("test"), listingID)
+
+		req, err := http.NewRequest(http.MethodGet, downloadURL, nil)
+		require.NoError(t, err)
+
+		if ifModifiedSince != "" {
+			req.Header.Set("If-Modified-Since", ifModifiedSince)
+		}
+
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		t.Cleanup(func() {
+			_ = resp.Body.Close()
+		})
+
+		return resp
+	}
+
+	resp := get(t, "a", "")
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	lastModified := resp.Header.Get("Last-Modified")
+	require.NotEmpty(t, lastModified)
+
+	t.Run("Unchanged", func(t *testing.T) {
+		resp := get(t, "a", lastModified)
+		assert.Equal(t, http.StatusNotModified, resp.StatusCode)
+	})
+
+	t.Run("Changed", func(t *testing.T) {
+		later := time.Now().Add(time.Hour)
+		require.NoError(t, os.Chtimes(filepath.Join(testDir, "test/folder/file.txt"), later, later))
+
+		// A new listing ID, otherwise the cached modification time is used.
+		resp := get(t, "b", lastModified)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, "application/zip", resp.Header.Get("Content-Type"))
+	})
+}
+
+func TestDownloadDirectoryOrder(t *testing.T) {
+	fsys, err := dirfs.New(t.TempDir())
+	require.NoError(t, err)
+
+	// Empty directories should survive a round trip.
+	require.NoError(t, fsys.MkdirAll("test/empty"))
+
+	expectedNames := []string{"test/", "test/empty/"}
+
+	// More files than there are prefetch workers.
+	for i := 0; i < 100; i++ {
+		name := fmt.Sprintf("test/file-%03d.txt", i)
+
+		f, err := fsys.OpenFile(name, writablefs.FlagReadWrite|writablefs.FlagCreate)
+		require.NoError(t, err)
+
+		_, err = f.Write([]byte(name))
+		require.NoError(t, err)
+
+		require.NoError(t, f.Close())
+
+		expectedNames = append(expectedNames, name)
+	}
+
+	baseURL := startServer(t, fsys, nil)
+
+	var buf bytes.Buffer
+	err = downloadFile(context.Background(), baseURL, "test", nil, &buf)
+	require.NoError(t, err)
+
+	r, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	require.NoError(t, err)
+
+	var names []string
+	for _, f := range r.File {
+		names = append(names, f.Name)
+
+		if f.FileInfo().IsDir() {
+			assert.True(t, f.Mode().IsDir())
+			continue
+		}
+
+		rc, err := f.Open()
+		require.NoError(t, err)
+
+		data, err := io.ReadAll(rc)
+		require.NoError(t, err)
+		require.NoError(t, rc.Close())
+
+		assert.Equal(t, f.Name, string(data))
+	}
+
+	assert.Equal(t, expectedNames, names)
+}
+
+func TestDownloadSelection(t *testing.T) {
+	fsys, err := dirfs.New(t.TempDir())
+	require.NoError(t, err)
+
+	for _, name := range []string{"a/x.txt", "a/b/y.txt", "c/z.txt"} {
+		require.NoError(t, fsys.MkdirAll(filepath.Dir(name)))
+
+		f, err := fsys.OpenFile(name, writablefs.FlagReadWrite|writablefs.FlagCreate)
+		require.NoError(t, err)
+
+		_, err = f.Write([]byte(name))
+		require.NoError(t, err)
+
+		require.NoError(t, f.Close())
+	}
+
+	baseURL := startServer(t, fsys, nil)
+
+	downloadSelection := func(t *testing.T, paths []string) *http.Response {
+		body, err := json.Marshal(map[string]any{"paths": paths})
+		require.NoError(t, err)
+
+		resp, err := http.Post(baseURL+"/files/download-zip", "application/json", bytes.NewReader(body))
+		require.NoError(t, err)
+		t.Cleanup(func() {
+			_ = resp.Body.Close()
+		})
+
+		return resp
+	}
+
+	zipNames := func(t *testing.T, resp *http.Response) []string {
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+
+		data, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+
+		r, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+		require.NoError(t, err)
+
+		var names []string
+		for _, f := range r.File {
+			names = append(names, f.Name)
+		}
+
+		return names
+	}
+
+	t.Run("Across Directories", func(t *testing.T) {
+		resp := downloadSelection(t, []string{"a/x.txt", "a/b", "a/b/y.txt", "c/z.txt"})
+
+		assert.Equal(t, []string{"a/b/", "a/b/y.txt", "a/x.txt", "c/z.txt"}, zipNames(t, resp))
+	})
+
+	t.Run("Same Directory", func(t *testing.T) {
+		resp := downloadSelection(t, []string{"a/x.txt", "a/b/y.txt", "a/x.txt"})
+
+		assert.Equal(t, []string{"b/y.txt", "x.txt"}, zipNames(t, resp))
+	})
+
+	t.Run("Outside Bucket", func(t *testing.T) {
+		resp := downloadSelection(t, []string{"a/x.txt", "../secret.txt"})
+
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	})
+
+	t.Run("Not Found", func(t *testing.T) {
+		resp := downloadSelection(t, []string{"a/missing.txt"})
+
+		assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+	})
+}
+
+func TestDownloadChecksumHeader(t *testing.T) {
+	fsys, err := dirfs.New(t.TempDir())
+	require.NoError(t, err)
+
+	for _, name := range []string{"plain.txt", "checksummed.txt"} {
+		f, err := fsys.OpenFile(name, writablefs.FlagReadWrite|writablefs.FlagCreate)
+		require.NoError(t, err)
+
+		_, err = f.Write([]byte("Hello, World!"))
+		require.NoError(t, err)
+
+		require.NoError(t, f.Close())
+	}
+
+	sum := sha256.Sum256([]byte("Hello, World!"))
+	checksum := "sha256:" + hex.EncodeToString(sum[:])
+
+	f, err := fsys.OpenFile("checksummed.txt", writablefs.FlagReadWrite)
+	require.NoError(t, err)
+
+	xattrs, err := f.XAttrs()
+	require.NoError(t, err)
+
+	require.NoError(t, xattrs.Set("bucketeer.checksum", []byte(checksum)))
+	require.NoError(t, xattrs.Sync())
+	require.NoError(t, f.Close())
+
+	baseURL := startServer(t, fsys, nil)
+
+	tests := []struct {
+		name     string
+		path     string
+		expected string
+	}{
+		{name: "Stored Checksum", path: "checksummed.txt", expected: checksum},
+		{name: "No Stored Checksum", path: "plain.txt", expected: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := http.DefaultClient.Get(fmt.Sprintf("%s/files/download/%s", baseURL, url.QueryEscape(tt.path)))
+			require.NoError(t, err)
+			resp.Body.Close()
+
+			require.Equal(t, http.StatusOK, resp.StatusCode)
+			assert.Equal(t, tt.expected, resp.Header.Get("X-Checksum"))
+		})
+	}
+}
+
+func TestDownloadContentEncoding(t *testing.T) {
+	fsys, err := dirfs.New(t.TempDir())
+	require.NoError(t, err)
+
+	data := []byte("Hello, World!")
+
+	var compressed bytes.Buffer
+	zw := gzip.NewWriter(&compressed)
+	_, err = zw.Write(data)
+	require.NoError(t, err)
+	require.NoError(t, zw.Close())
+
+	for name, contentEncoding := range map[string]string{"gzipped.txt": "gzip", "brotli.txt": "br"} {
+		f, err := fsys.OpenFile(name, writablefs.FlagReadWrite|writablefs.FlagCreate)
+		require.NoError(t, err)
+
+		_, err = f.Write(compressed.Bytes())
+		require.NoError(t, err)
+
+		xattrs, err := f.XAttrs()
+		require.NoError(t, err)
+
+		require.NoError(t, xattrs.Set("content-encoding", []byte(contentEncoding)))
+		require.NoError(t, xattrs.Sync())
+		require.NoError(t, f.Close())
+	}
+
+	baseURL := startServer(t, fsys, nil)
+
+	tests := []struct {
+		name             string
+		path             string
+		acceptEncoding   string
+		expectedStatus   int
+		expectedEncoding string
+		expectedBody     []byte
+	}{
+		{name: "Passthrough", path: "gzipped.txt", acceptEncoding: "gzip, deflate", expectedStatus: http.StatusOK, expectedEncoding: "gzip", expectedBody: compressed.Bytes()},
+		{name: "Identity", path: "gzipped.txt", acceptEncoding: "identity", expectedStatus: http.StatusOK, expectedBody: data},
+		{name: "Rejected", path: "gzipped.txt", acceptEncoding: "gzip;q=0", expectedStatus: http.StatusOK, expectedBody: data},
+		{name: "Not Acceptable", path: "brotli.txt", acceptEncoding: "identity", expectedStatus: http.StatusNotAcceptable},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodGet, fmt.Sprintf("%s/files/download/%s", baseURL, url.QueryEscape(tt.path)), nil)
+			require.NoError(t, err)
+
+			// Setting the header ourselves stops the transport from decoding the response.
+			req.Header.Set("Accept-Encoding", tt.acceptEncoding)
+
+			resp, err := http.DefaultClient.Do(req)
+			require.NoError(t, err)
+			defer resp.Body.Close()
+
+			require.Equal(t, tt.expectedStatus, resp.StatusCode)
+
+			if tt.expectedStatus != http.StatusOK {
+				return
+			}
+
+			assert.Equal(t, tt.expectedEncoding, resp.Header.Get("Content-Encoding"))
+			assert.Equal(t, "text/plain; charset=utf-8", resp.Header.Get("Content-Type"))
+
+			body, err := io.ReadAll(resp.Body)
+			require.NoError(t, err)
+
+			assert.Equal(t, tt.expectedBody, body)
+		})
+	}
+}
+
+func TestDownloadRange(t *testing.T) {
+	testDir := t.TempDir()
+
+	fsys, err := dirfs.New(testDir)
+	require.NoError(t, err)
+
+	data := make([]byte, 100000)
+	_, err = rand.Read(data)
+	require.NoError(t, err)
+
+	require.NoError(t, os.WriteFile(filepath.Join(testDir, "video.mp4"), data, 0o644))
+
+	rangeReader := &testRangeReader{dir: testDir}
+
+	baseURL := startServer(t, fsys, &download.ServerOptions{
+		RangeReader: rangeReader,
+	})
+
+	req, err := http.NewRequest(http.MethodGet, baseURL+"/files/download/video.mp4", nil)
+	require.NoError(t, err)
+
+	req.Header.Set("Range", "bytes=-1000")
+
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	require.Equal(t, http.StatusPartialContent, resp.StatusCode)
+
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+
+	assert.Equal(t, data[len(data)-1000:], body)
+	assert.Equal(t, []string{"video.mp4"}, rangeReader.Opened())
+
+	t.Run("Whole File", func(t *testing.T) {
+		rangeReader.mu.Lock()
+		rangeReader.opened = nil
+		rangeReader.mu.Unlock()
+
+		resp, err := http.Get(baseURL + "/files/download/video.mp4")
+		require.NoError(t, err)
+		defer resp.Body.Close()
+
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+
+		body, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+
+		assert.Equal(t, data, body)
+		assert.Empty(t, rangeReader.Opened())
+	})
+}
+
+func TestDownloadRateLimit(t *testing.T) {
+	fsys, err := dirfs.New(t.TempDir())
+	require.NoError(t, err)
+
+	f, err := fsys.OpenFile("file.bin", writablefs.FlagReadWrite|writablefs.FlagCreate)
+	require.NoError(t, err)
+
+	size := int64(200000)
+	_, err = io.CopyN(f, rand.Reader, size)
+	require.NoError(t, err)
+
+	require.NoError(t, f.Close())
+
+	// Half the file can be sent immediately (the initial burst), the rest should
+	// take about a second.
+	baseURL := startServer(t, fsys, &download.ServerOptions{
+		RateLimit: size / 2,
+	})
+
+	var buf bytes.Buffer
+	start := time.Now()
+	err = downloadFile(context.Background(), baseURL, "file.bin", nil, &buf)
+	require.NoError(t, err)
+
+	assert.Equal(t, size, int64(buf.Len()))
+	assert.GreaterOrEqual(t, time.Since(start), 900*time.Millisecond)
+}
+
+func TestDownloadPathPrefix(t *testing.T) {
+	fsys, err := dirfs.New(t.TempDir())
+	require.NoError(t, err)
+
+	f, err := fsys.OpenFile("file.txt", writablefs.FlagReadWrite|writablefs.FlagCreate)
+	require.NoError(t, err)
+
+	_, err = f.Write([]byte("Hello, World!"))
+	require.NoError(t, err)
+
+	require.NoError(t, f.Close())
+
+	baseURL := startServer(t, fsys, &download.ServerOptions{
+		PathPrefix: "bucketeer/files",
+	})
+
+	resp, err := http.DefaultClient.Get(baseURL + "/bucketeer/files/download/file.txt")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+
+	assert.Equal(t, "Hello, World!", string(body))
+
+	t.Run("Default Prefix", func(t *testing.T) {
+		resp, err := http.DefaultClient.Get(baseURL + "/files/download/file.txt")
+		require.NoError(t, err)
+		resp.Body.Close()
+
+		assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+	})
+}
+
+func TestDownloadNoAutoArchive(t *testing.T) {
+	fsys, err := dirfs.New(t.TempDir())
+	require.NoError(t, err)
+
+	require.NoError(t, fsys.MkdirAll("test"))
+
+	f, err := fsys.OpenFile("test/file.txt", writablefs.FlagReadWrite|writablefs.FlagCreate)
+	require.NoError(t, err)
+
+	_, err = f.Write([]byte("Hello, World!"))
+	require.NoError(t, err)
+
+	require.NoError(t, f.Close())
+
+	baseURL := startServer(t, fsys, &download.ServerOptions{
+		NoAutoArchive: true,
+	})
+
+	resp, err := http.DefaultClient.Get(baseURL + "/files/download/test/")
+	require.NoError(t, err)
+	resp.Body.Close()
+
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	assert.NotEqual(t, "application/zip", resp.Header.Get("Content-Type"))
+
+	t.Run("Explicit Format", func(t *testing.T) {
+		var buf bytes.Buffer
+		err := downloadFile(context.Background(), baseURL, "test/", url.Values{"format": {"zip"}}, &buf)
+		require.NoError(t, err)
+
+		r, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+		require.NoError(t, err)
+
+		assert.Len(t, r.File, 2)
+	})
+
+	t.Run("File", func(t *testing.T) {
+		resp, err := http.DefaultClient.Get(baseURL + "/files/download/test/file.txt")
+		require.NoError(t, err)
+		resp.Body.Close()
+
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+	})
+}
+
+func TestDownloadArchiveFilename(t *testing.T) {
+	fsys, err := dirfs.New(t.TempDir())
+	require.NoError(t, err)
+
+	require.NoError(t, fsys.MkdirAll("test"))
+
+	f, err := fsys.OpenFile("test/file.txt", writablefs.FlagReadWrite|writablefs.FlagCreate)
+	require.NoError(t, err)
+
+	_, err = f.Write([]byte("Hello, World!"))
+	require.NoError(t, err)
+
+	require.NoError(t, f.Close())
+
+	baseURL := startServer(t, fsys, &download.ServerOptions{
+		BucketName: "my-bucket",
+	})
+
+	contentDisposition := func(t *testing.T, path string, query url.Values) string {
+		resp, err := http.Get(baseURL + "/files/download/" + path + "?" + query.Encode())
+		require.NoError(t, err)
+		t.Cleanup(func() {
+			require.NoError(t, resp.Body.Close())
+		})
+
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+
+		_, err = io.Copy(io.Discard, resp.Body)
+		require.NoError(t, err)
+
+		return resp.Header.Get("Content-Disposition")
+	}
+
+	t.Run("Default", func(t *testing.T) {
+		assert.Equal(t, "attachment; filename=test.zip", contentDisposition(t, "test/", url.Values{"format": {"zip"}}))
+	})
+
+	t.Run("Root", func(t *testing.T) {
+		assert.Equal(t, "attachment; filename=my-bucket.zip", contentDisposition(t, "", url.Values{"format": {"zip"}}))
+		assert.Equal(t, "attachment; filename=my-bucket.tar", contentDisposition(t, "", url.Values{"format": {"tar"}}))
+	})
+
+	t.Run("Custom", func(t *testing.T) {
+		assert.Equal(t, "attachment; filename=photos.zip", contentDisposition(t, "test/", url.Values{"filename": {"photos"}}))
+		assert.Equal(t, "attachment; filename=photos.ZIP", contentDisposition(t, "test/", url.Values{"filename": {"photos.ZIP"}}))
+		assert.Equal(t, `attachment; filename="my photos.tar.gz"`, contentDisposition(t, "test/", url.Values{"format": {"targz"}, "filename": {"my photos"}}))
+	})
+
+	t.Run("Invalid", func(t *testing.T) {
+		for _, filename := range []string{"a/b", `a\b`, "..", " "} {
+			resp, err := http.Get(baseURL + "/files/download/test/?" + url.Values{"filename": {filename}}.Encode())
+			require.NoError(t, err)
+			resp.Body.Close()
+
+			assert.Equal(t, http.StatusBadRequest, resp.StatusCode, filename)
+		}
+	})
+
+	t.Run("Selection", func(t *testing.T) {
+		body, err := json.Marshal(map[string]any{"paths": []string{"test/file.txt"}})
+		require.NoError(t, err)
+
+		resp, err := http.Post(baseURL+"/files/download-zip?filename=selected", "application/json", bytes.NewReader(body))
+		require.NoError(t, err)
+		defer resp.Body.Close()
+
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, "attachment; filename=selected.zip", resp.Header.Get("Content-Disposition"))
+	})
+}
+
+func TestShare(t *testing.T) {
+	fsys, err := dirfs.New(t.TempDir())
+	require.NoError(t, err)
+
+	f, err := fsys.OpenFile("file.txt", writablefs.FlagReadWrite|writablefs.FlagCreate)
+	require.NoError(t, err)
+
+	_, err = f.Write([]byte("Hello, World!"))
+	require.NoError(t, err)
+
+	require.NoError(t, f.Close())
+
+	logger := slogt.New(t)
+
 	e := echo.New()
 	e.HideBanner = true
 
-	downloadServerPath, downloadServer := download.NewServer(logger, fsys)
-	e.Any(downloadServerPath+"*", echo.WrapHandler(downloadServer))
+	_, downloadServer := download.NewServer(logger, fsys, nil)
+
+	sharePath, sharedPath, shareServer := download.NewShareServer(logger, downloadServer.(*download.Server), nil)
+	e.Any(sharePath, echo.WrapHandler(shareServer))
+	e.Any(sharedPath+"*", echo.WrapHandler(shareServer))
 
 	go func() {
 		if err := e.StartH2CServer(":0", &http2.Server{}); err != nil && !errors.Is(err, http.ErrServerClosed) {
@@ -81,43 +1011,111 @@ func TestDownload(t *testing.T) {
 		require.NoError(t, e.Close())
 	})
 
-	err = util.WaitForServerReady(e, 10*time.Second)
-	require.NoError(t, err)
+	require.NoError(t, util.WaitForServerReady(e, 10*time.Second))
 
 	baseURL := fmt.Sprintf("http://%s", e.Listener.Addr().String())
 
-	t.Run("Download File", func(t *testing.T) {
-		expectedSum, err := fileChecksum(fsys, "test/folder/file.bin")
+	share := func(body string) (*http.Response, string) {
+		resp, err := http.DefaultClient.Post(baseURL+"/api/v1alpha1/fs/share", "application/json", strings.NewReader(body))
 		require.NoError(t, err)
+		defer resp.Body.Close()
 
-		// Download the file
-		h := sha256.New()
+		var shareResp struct {
+			URL string `json:"url"`
+		}
+		if resp.StatusCode == http.StatusOK {
+			require.NoError(t, json.NewDecoder(resp.Body).Decode(&shareResp))
+		}
 
-		err = downloadFile(context.Background(), baseURL, "test/folder/file.bin", h)
+		return resp, shareResp.URL
+	}
+
+	get := func(method, u string) (int, string) {
+		req, err := http.NewRequest(method, baseURL+u, nil)
 		require.NoError(t, err)
 
-		actualSum := hex.EncodeToString(h.Sum(nil))
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		defer resp.Body.Close()
 
-		assert.Equal(t, expectedSum, actualSum)
+		body, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+
+		return resp.StatusCode, string(body)
+	}
+
+	t.Run("Single Use", func(t *testing.T) {
+		resp, sharedURL := share(`{"path": "file.txt"}`)
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		require.True(t, strings.HasPrefix(sharedURL, "/shared/"))
+
+		status, _ := get(http.MethodHead, sharedURL)
+		assert.Equal(t, http.StatusOK, status)
+
+		status, body := get(http.MethodGet, sharedURL)
+		require.Equal(t, http.StatusOK, status)
+		assert.Equal(t, "Hello, World!", body)
+
+		status, _ = get(http.MethodGet, sharedURL)
+		assert.Equal(t, http.StatusGone, status)
 	})
 
-	t.Run("Download Directory", func(t *testing.T) {
-		var buf bytes.Buffer
+	t.Run("Expired", func(t *testing.T) {
+		resp, sharedURL := share(`{"path": "file.txt", "expiry": "1s"}`)
+		require.Equal(t, http.StatusOK, resp.StatusCode)
 
-		err = downloadFile(context.Background(), baseURL, "test/", &buf)
-		require.NoError(t, err)
+		time.Sleep(2 * time.Second)
 
-		// Check the contents of the zip file
-		r, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
-		require.NoError(t, err)
+		status, _ := get(http.MethodGet, sharedURL)
+		assert.Equal(t, http.StatusGone, status)
+	})
+
+	t.Run("Tampered", func(t *testing.T) {
+		resp, sharedURL := share(`{"path": "file.txt"}`)
+		require.Equal(t, http.StatusOK, resp.StatusCode)
 
-		assert.Len(t, r.File, 1)
-		assert.Equal(t, "test/folder/file.bin", r.File[0].Name)
+		payload, sig, ok := strings.Cut(strings.TrimPrefix(sharedURL, "/shared/"), ".")
+		require.True(t, ok)
+
+		status, _ := get(http.MethodGet, "/shared/"+payload+"x."+sig)
+		assert.Equal(t, http.StatusForbidden, status)
+	})
+
+	t.Run("Not Found", func(t *testing.T) {
+		resp, _ := share(`{"path": "missing.txt"}`)
+		assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+	})
+}
+
+func startServer(t *testing.T, fsys writablefs.FS, opts *download.ServerOptions) string {
+	logger := slogt.New(t)
+
+	e := echo.New()
+	e.HideBanner = true
+
+	downloadServerPath, downloadServer := download.NewServer(logger, fsys, opts)
+	e.Any(downloadServerPath+"*", echo.WrapHandler(downloadServer))
+
+	go func() {
+		if err := e.StartH2CServer(":0", &http2.Server{}); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logger.Error("failed to start server", "error", err)
+		}
+	}()
+	t.Cleanup(func() {
+		require.NoError(t, e.Close())
 	})
+
+	err := util.WaitForServerReady(e, 10*time.Second)
+	require.NoError(t, err)
+
+	return fmt.Sprintf("http://%s", e.Listener.Addr().String())
 }
 
-func downloadFile(ctx context.Context, baseURL, path string, w io.Writer) error {
+func downloadFile(ctx context.Context, baseURL, path string, query url.Values, w io.Writer) error {
 	downloadURL := fmt.Sprintf("%s/files/download/%s", baseURL, url.QueryEscape(path))
+	if len(query) > 0 {
+		downloadURL += "?" + query.Encode()
+	}
 
 	resp, err := http.DefaultClient.Get(downloadURL)
 	if err != nil {
@@ -149,3 +1147,25 @@ func fileChecksum(fsys writablefs.FS, path string) (string, error) {
 
 	return hex.EncodeToString(h.Sum(nil)), nil
 }
+
+// testRangeReader records the files opened for range requests.
+type testRangeReader struct {
+	dir    string
+	mu     sync.Mutex
+	opened []string
+}
+
+func (r *testRangeReader) OpenRange(_ context.Context, path string) (io.ReadSeekCloser, error) {
+	r.mu.Lock()
+	r.opened = append(r.opened, path)
+	r.mu.Unlock()
+
+	return os.Open(filepath.Join(r.dir, path))
+}
+
+func (r *testRangeReader) Opened() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.opened
+}
@@ -0,0 +1,65 @@
+/* SPDX-License-Identifier: AGPL-3.0-or-later
+ *
+ * Copyright 2024 Damian Peckett <damian@pecke.tt>.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package download
+
+import (
+	"context"
+	"io"
+	"path"
+	"strings"
+
+	"github.com/bucket-sailor/bucketeer/internal/util/s3client"
+	"github.com/bucket-sailor/writablefs/s3fs"
+	"github.com/minio/minio-go/v7"
+)
+
+// RangeReader is implemented by storage that can efficiently read part of a
+// file, without reading it from the start (eg. when a media player seeks).
+type RangeReader interface {
+	// OpenRange opens a file for reading, seeking must only fetch the data
+	// that is subsequently read.
+	OpenRange(ctx context.Context, path string) (io.ReadSeekCloser, error)
+}
+
+// S3RangeReader reads objects in an S3 bucket with ranged GET requests.
+type S3RangeReader struct {
+	client     *minio.Client
+	bucketName string
+}
+
+// NewS3RangeReader creates a new range reader for the bucket described by opts.
+func NewS3RangeReader(opts s3fs.Options, pathStyle bool) (*S3RangeReader, error) {
+	client, err := s3client.New(opts, pathStyle)
+	if err != nil {
+		return nil, err
+	}
+
+	return &S3RangeReader{
+		client:     client,
+		bucketName: opts.BucketName,
+	}, nil
+}
+
+func (r *S3RangeReader) OpenRange(ctx context.Context, filePath string) (io.ReadSeekCloser, error) {
+	key := strings.TrimPrefix(path.Clean("/"+filePath), "/")
+
+	// Objects are fetched lazily, a read following a seek issues a new GET
+	// starting at the offset (rather than reading and discarding the data).
+	return r.client.GetObject(ctx, r.bucketName, key, minio.GetObjectOptions{})
+}
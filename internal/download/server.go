@@ -19,34 +19,124 @@
 package download
 
 import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
+	"io/fs"
 	"log/slog"
+	"mime"
 	"net/http"
+	"path"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"time"
+	"unicode"
 
+	"github.com/bucket-sailor/bucketeer/internal/metrics"
+	"github.com/bucket-sailor/bucketeer/internal/telemetry"
 	"github.com/bucket-sailor/writablefs"
+	"github.com/hashicorp/golang-lru/v2/expirable"
+	"golang.org/x/time/rate"
 )
 
+const (
+	// xAttrChecksum is the extended attribute used to store a file's checksum.
+	xAttrChecksum = "bucketeer.checksum"
+	// xAttrContentEncoding is the extended attribute used to store the
+	// Content-Encoding of a pre-compressed file (eg. set when it was uploaded).
+	xAttrContentEncoding = "content-encoding"
+	// maxDownloadZipRequestBytes limits the size of a selection download request.
+	maxDownloadZipRequestBytes = 1 << 20 // 1MiB
+	// modTimeCacheMaxSize and modTimeCacheTTL bound how many directory
+	// modification times are cached, and for how long.
+	modTimeCacheMaxSize = 100
+	modTimeCacheTTL     = 30 * time.Second
+	// defaultPathPrefix is the route prefix the server is mounted beneath.
+	defaultPathPrefix = "/files/"
+	// defaultBucketName is used to name archives of the root directory if
+	// the bucket name isn't known.
+	defaultBucketName = "bucket"
+	// maxArchiveFilenameLength limits the length of a requested archive name.
+	maxArchiveFilenameLength = 255
+)
+
+// errInvalidFilename is returned when a requested archive filename is unusable.
+var errInvalidFilename = errors.New("invalid filename")
+
+// ServerOptions are options for configuring the behavior of the download server.
+type ServerOptions struct {
+	// RateLimit is the maximum number of bytes per second served across all
+	// downloads (zero means unlimited).
+	RateLimit int64
+	// TelemetryReporter, if set, is used to report the size and duration of downloads.
+	TelemetryReporter telemetry.Reporter
+	// PathPrefix is the route prefix the server is mounted beneath (defaults
+	// to "/files/"), files are served from PathPrefix + "download/".
+	PathPrefix string
+	// NoAutoArchive, if set, rejects requests to download a directory unless
+	// an archive format is explicitly requested (eg. ?format=zip).
+	NoAutoArchive bool
+	// RangeReader, if set, is used to serve range requests (eg. a video being
+	// seeked) directly from the underlying storage.
+	RangeReader RangeReader
+	// BucketName is used to name archives of the root directory (defaults to
+	// "bucket").
+	BucketName string
+}
+
 type Server struct {
 	http.Handler
 	logger *slog.Logger
 	fsys   writablefs.FS
+	// limiter is shared by all downloads, nil if unlimited.
+	limiter           *rate.Limiter
+	telemetryReporter telemetry.Reporter
+	// modTimeCache holds the latest modification time within recently
+	// downloaded directories, keyed by path and listing ID.
+	modTimeCache *expirable.LRU[string, time.Time]
+	// pathPrefix always begins and ends with a slash.
+	pathPrefix    string
+	noAutoArchive bool
+	rangeReader   RangeReader
+	bucketName    string
 }
 
-func NewServer(logger *slog.Logger, fsys writablefs.FS) (string, http.Handler) {
+func NewServer(logger *slog.Logger, fsys writablefs.FS, opts *ServerOptions) (string, http.Handler) {
 	s := &Server{
-		logger: logger.WithGroup("download"),
-		fsys:   fsys,
+		logger:       logger.WithGroup("download"),
+		fsys:         fsys,
+		modTimeCache: expirable.NewLRU[string, time.Time](modTimeCacheMaxSize, nil, modTimeCacheTTL),
+		pathPrefix:   defaultPathPrefix,
+		bucketName:   defaultBucketName,
+	}
+
+	if opts != nil {
+		s.limiter = newRateLimiter(opts.RateLimit)
+		s.telemetryReporter = opts.TelemetryReporter
+		s.noAutoArchive = opts.NoAutoArchive
+		s.rangeReader = opts.RangeReader
+
+		if opts.BucketName != "" {
+			s.bucketName = opts.BucketName
+		}
+
+		if pathPrefix := strings.Trim(opts.PathPrefix, "/"); pathPrefix != "" {
+			s.pathPrefix = "/" + pathPrefix + "/"
+		}
 	}
 
 	mux := http.NewServeMux()
 	s.Handler = mux
 
-	mux.HandleFunc("/files/", s.handleDownload)
+	mux.HandleFunc(s.pathPrefix, s.handleDownload)
+	mux.HandleFunc(s.pathPrefix+"download-zip", s.handleDownloadZip)
 
-	return "/files/", s
+	return s.pathPrefix, s
 }
 
 func (s *Server) handleDownload(w http.ResponseWriter, r *http.Request) {
@@ -55,10 +145,21 @@ func (s *Server) handleDownload(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	path := strings.TrimPrefix(r.URL.Path, "/files/download/")
+	w = s.wrapResponseWriter(w, r)
+	defer s.reportDownload(w, time.Now())
 
+	s.serve(w, r, strings.TrimPrefix(r.URL.Path, s.pathPrefix+"download/"))
+}
+
+// serve writes the file at path to the response, directories are archived.
+func (s *Server) serve(w http.ResponseWriter, r *http.Request, path string) {
 	fi, err := s.fsys.Stat(path)
 	if err != nil {
+		if errors.Is(err, writablefs.ErrNotExist) {
+			http.Error(w, "File not found", http.StatusNotFound)
+			return
+		}
+
 		http.Error(w, "Error getting file info", http.StatusInternalServerError)
 		return
 	}
@@ -82,33 +183,521 @@ func (s *Server) handleDownload(w http.ResponseWriter, r *http.Request) {
 	}
 	defer f.Close()
 
-	// Force download when viewing in browser.
-	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%s", fi.Name()))
+	contentEncoding := storedContentEncoding(f)
+
+	query := r.URL.Query()
+	if query.Get("inline") == "1" || query.Get("disposition") == "inline" {
+		// Sniffing encoded content would only tell us the type of the encoding.
+		contentType := typeByExtension(fi.Name())
+		if contentEncoding == "" {
+			contentType, err = detectContentType(f, fi.Name())
+			if err != nil {
+				http.Error(w, "Error reading file", http.StatusInternalServerError)
+				return
+			}
+		}
+
+		w.Header().Set("Content-Disposition", contentDisposition("inline", fi.Name()))
+		w.Header().Set("Content-Type", contentType)
+		// Don't allow scripts in user content (eg. HTML files) to run in our origin.
+		w.Header().Set("Content-Security-Policy", "sandbox")
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+	} else {
+		// Force download when viewing in browser.
+		w.Header().Set("Content-Disposition", attachment(fi.Name()))
+
+		if contentEncoding != "" {
+			w.Header().Set("Content-Type", typeByExtension(fi.Name()))
+		}
+	}
 
-	http.ServeContent(w, r, fi.Name(), fi.ModTime(), f)
+	if contentEncoding != "" {
+		w.Header().Add("Vary", "Accept-Encoding")
+
+		if !acceptsEncoding(r.Header.Get("Accept-Encoding"), contentEncoding) {
+			s.serveDecoded(w, r, f, contentEncoding)
+			return
+		}
+
+		// Pass the stored encoding through so clients can decode it transparently.
+		w.Header().Set("Content-Encoding", contentEncoding)
+	}
+
+	checksum := storedChecksum(f)
+
+	// Allow clients to verify what they received (only if we already know the
+	// checksum, computing it on the fly would require reading the file twice).
+	if _, _, found := strings.Cut(checksum, ":"); found {
+		w.Header().Set("X-Checksum", checksum)
+	}
+
+	// ServeContent will handle If-None-Match for us.
+	w.Header().Set("ETag", etag(checksum, fi))
+
+	var content io.ReadSeeker = f
+	if r.Header.Get("Range") != "" && s.rangeReader != nil {
+		// Only fetch the requested range, rather than everything before it.
+		rc, err := s.rangeReader.OpenRange(r.Context(), path)
+		if err != nil {
+			http.Error(w, "Error opening file", http.StatusInternalServerError)
+			return
+		}
+		defer rc.Close()
+
+		content = rc
+	}
+
+	http.ServeContent(w, r, fi.Name(), fi.ModTime(), content)
+}
+
+// detectContentType sniffs the content type from the first 512 bytes of the
+// file, falling back to the file extension if the content is not recognized.
+func detectContentType(f writablefs.File, name string) (string, error) {
+	buf := make([]byte, 512)
+	n, err := f.ReadAt(buf, 0)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return "", err
+	}
+
+	contentType := http.DetectContentType(buf[:n])
+	if contentType == "application/octet-stream" {
+		contentType = typeByExtension(name)
+	}
+
+	return contentType, nil
+}
+
+// typeByExtension returns the content type for a file extension, or
+// application/octet-stream if it is not recognized.
+func typeByExtension(name string) string {
+	if contentType := mime.TypeByExtension(filepath.Ext(name)); contentType != "" {
+		return contentType
+	}
+
+	return "application/octet-stream"
+}
+
+// storedContentEncoding returns the Content-Encoding stored when the file was
+// uploaded, or an empty string if the file isn't encoded.
+func storedContentEncoding(f writablefs.File) string {
+	xattrs, err := f.XAttrs()
+	if err != nil {
+		return ""
+	}
+
+	contentEncoding, err := xattrs.Get(xAttrContentEncoding)
+	if err != nil {
+		return ""
+	}
+
+	contentEncoding = bytes.TrimSpace(contentEncoding)
+	if strings.EqualFold(string(contentEncoding), "identity") {
+		return ""
+	}
+
+	return strings.ToLower(string(contentEncoding))
+}
+
+// acceptsEncoding reports whether an Accept-Encoding header allows the
+// given content coding (as per RFC 9110, section 12.5.3).
+func acceptsEncoding(header, contentEncoding string) bool {
+	// No header means any coding is acceptable.
+	if header == "" {
+		return true
+	}
+
+	acceptsAny := false
+	for _, part := range strings.Split(header, ",") {
+		coding, params, _ := strings.Cut(part, ";")
+		coding = strings.ToLower(strings.TrimSpace(coding))
+
+		accepted := true
+		if name, value, found := strings.Cut(strings.TrimSpace(params), "="); found && strings.TrimSpace(name) == "q" {
+			q, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+			accepted = err == nil && q > 0
+		}
+
+		switch coding {
+		case contentEncoding:
+			return accepted
+		case "*":
+			acceptsAny = accepted
+		}
+	}
+
+	return acceptsAny
+}
+
+// serveDecoded decodes an encoded file on the fly, for clients that don't
+// accept its stored encoding.
+func (s *Server) serveDecoded(w http.ResponseWriter, r *http.Request, f writablefs.File, contentEncoding string) {
+	if contentEncoding != "gzip" {
+		w.Header().Del("Content-Disposition")
+		http.Error(w, fmt.Sprintf("File is only available with %s encoding", contentEncoding), http.StatusNotAcceptable)
+		return
+	}
+
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		w.Header().Del("Content-Disposition")
+		http.Error(w, "Error decoding file", http.StatusInternalServerError)
+		return
+	}
+	defer zr.Close()
+
+	// The decoded size isn't known up front, so ranges aren't supported.
+	w.Header().Set("Accept-Ranges", "none")
+	w.WriteHeader(http.StatusOK)
+
+	if r.Method == http.MethodHead {
+		return
+	}
+
+	if _, err := io.Copy(w, zr); err != nil {
+		s.logger.Warn("Error decoding file", "error", err)
+	}
+}
+
+// storedChecksum returns the checksum (in the form algorithm:hex) stored when
+// the file was uploaded, or an empty string if there isn't one.
+func storedChecksum(f writablefs.File) string {
+	xattrs, err := f.XAttrs()
+	if err != nil {
+		return ""
+	}
+
+	checksum, err := xattrs.Get(xAttrChecksum)
+	if err != nil {
+		return ""
+	}
+
+	return string(checksum)
+}
+
+// etag returns a strong ETag if the file has a stored checksum, otherwise
+// a weak ETag derived from the file size and modification time.
+func etag(checksum string, fi writablefs.FileInfo) string {
+	if checksum != "" {
+		return fmt.Sprintf("%q", checksum)
+	}
+
+	return fmt.Sprintf("W/\"%x-%x\"", fi.Size(), fi.ModTime().UnixNano())
 }
 
 func (s *Server) handleDownloadDirectory(w http.ResponseWriter, r *http.Request, path string, fi writablefs.FileInfo) {
-	s.logger.Debug("Download directory", "path", path)
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		if s.noAutoArchive {
+			http.Error(w, "Path is a directory, specify an archive format (eg. ?format=zip) to download it", http.StatusBadRequest)
+			return
+		}
 
-	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%s.zip", fi.Name()))
-	w.Header().Set("Content-Type", "application/zip")
+		// Zip is the most widely supported format for browser users.
+		format = "zip"
+	}
+
+	if format != "zip" && format != "tar" && format != "targz" {
+		http.Error(w, "Unsupported archive format", http.StatusBadRequest)
+		return
+	}
+
+	defaultName := fi.Name()
+	if isRoot(path) {
+		defaultName = s.bucketName
+	}
+
+	filename, err := archiveFilename(r.URL.Query().Get("filename"), defaultName, archiveExtensions[format])
+	if err != nil {
+		http.Error(w, "Invalid filename", http.StatusBadRequest)
+		return
+	}
+
+	modTime, err := s.dirModTime(r.Context(), path, r.URL.Query().Get("id"))
+	if err != nil {
+		http.Error(w, "Error getting directory info", http.StatusInternalServerError)
+		return
+	}
+
+	// Archives are expensive to generate, so avoid it if the client's copy is
+	// still up to date.
+	if !modTime.IsZero() {
+		if ims, err := http.ParseTime(r.Header.Get("If-Modified-Since")); err == nil && !modTime.Truncate(time.Second).After(ims) {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+
+		w.Header().Set("Last-Modified", modTime.UTC().Format(http.TimeFormat))
+	}
+
+	s.logger.Debug("Download directory", "path", path, "format", format)
+
+	switch format {
+	case "tar", "targz":
+		archiveFS, ok := s.fsys.(writablefs.ArchiveFS)
+		if !ok {
+			http.Error(w, "Archive not supported", http.StatusInternalServerError)
+			return
+		}
+
+		tr, err := archiveFS.Archive(path)
+		if err != nil {
+			http.Error(w, "Error archiving directory", http.StatusInternalServerError)
+			return
+		}
+		defer tr.Close()
+
+		if format == "tar" {
+			w.Header().Set("Content-Disposition", attachment(filename))
+			w.Header().Set("Content-Type", "application/x-tar")
+
+			// The archive is already a tar stream, so it can be served as is.
+			if _, err := io.Copy(w, &contextReader{ctx: r.Context(), r: tr}); err != nil {
+				http.Error(w, "Error creating tarball", http.StatusInternalServerError)
+			}
+			return
+		}
+
+		w.Header().Set("Content-Disposition", attachment(filename))
+		w.Header().Set("Content-Type", "application/gzip")
+
+		// The archive is already a tar stream, so we just need to compress it.
+		gw := gzip.NewWriter(w)
+		if _, err := io.Copy(gw, &contextReader{ctx: r.Context(), r: tr}); err != nil {
+			http.Error(w, "Error creating tarball", http.StatusInternalServerError)
+			return
+		}
+
+		if err := gw.Close(); err != nil {
+			http.Error(w, "Error creating tarball", http.StatusInternalServerError)
+		}
+	default:
+		w.Header().Set("Content-Disposition", attachment(filename))
+		w.Header().Set("Content-Type", "application/zip")
+
+		dirName := filepath.Base(path)
+		if err := zipDirectory(r.Context(), s.logger, w, s.fsys, path, dirName); err != nil {
+			http.Error(w, "Error creating zip", http.StatusInternalServerError)
+		}
+	}
+}
+
+// archiveExtensions are the file extensions of each archive format.
+var archiveExtensions = map[string]string{
+	"zip":   ".zip",
+	"tar":   ".tar",
+	"targz": ".tar.gz",
+}
+
+// archiveFilename returns the filename to download an archive as, either the
+// one requested by the client or defaultName. The extension is appended if
+// it's missing.
+func archiveFilename(requested, defaultName, ext string) (string, error) {
+	name := strings.TrimSpace(requested)
+	if requested == "" {
+		name = defaultName
+	} else if strings.ContainsAny(name, `/\`) {
+		return "", errInvalidFilename
+	}
 
-	archiveFS, ok := s.fsys.(writablefs.ArchiveFS)
-	if !ok {
-		http.Error(w, "Archive not supported", http.StatusInternalServerError)
+	// Control characters (eg. newlines) have no place in a header.
+	name = strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) {
+			return -1
+		}
+
+		return r
+	}, name)
+
+	if name == "" || name == "." || name == ".." || len(name) > maxArchiveFilenameLength {
+		if requested != "" {
+			return "", errInvalidFilename
+		}
+
+		name = defaultBucketName
+	}
+
+	if !strings.HasSuffix(strings.ToLower(name), ext) {
+		name += ext
+	}
+
+	return name, nil
+}
+
+// attachment returns a Content-Disposition header value for downloading a file
+// with the given name (quoted or encoded as needed).
+func attachment(filename string) string {
+	return contentDisposition("attachment", filename)
+}
+
+// contentDisposition returns a Content-Disposition header value of the given
+// type (eg. "inline") for a file with the given name.
+func contentDisposition(dispositionType, filename string) string {
+	return mime.FormatMediaType(dispositionType, map[string]string{"filename": filename})
+}
+
+// isRoot returns true if p refers to the root directory of the filesystem.
+func isRoot(p string) bool {
+	p = strings.Trim(p, "/")
+	return p == "" || p == "."
+}
+
+// dirModTime returns the latest modification time of the directory at root
+// and everything beneath it. Results are briefly cached, as a client will
+// typically download a directory using the listing ID it was shown.
+func (s *Server) dirModTime(ctx context.Context, root, listingID string) (time.Time, error) {
+	key := root + "\x00" + listingID
+	if modTime, ok := s.modTimeCache.Get(key); ok {
+		return modTime, nil
+	}
+
+	var modTime time.Time
+	err := fs.WalkDir(s.fsys, path.Clean(root), func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		fi, err := d.Info()
+		if err != nil {
+			return err
+		}
+
+		if fi.ModTime().After(modTime) {
+			modTime = fi.ModTime()
+		}
+
+		return nil
+	})
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	s.modTimeCache.Add(key, modTime)
+
+	return modTime, nil
+}
+
+// downloadZipRequest is the body of a request to download a selection of files.
+type downloadZipRequest struct {
+	Paths []string `json:"paths"`
+}
+
+func (s *Server) handleDownloadZip(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w = s.wrapResponseWriter(w, r)
+	defer s.reportDownload(w, time.Now())
+
+	var req downloadZipRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxDownloadZipRequestBytes)).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if len(req.Paths) == 0 {
+		http.Error(w, "No paths specified", http.StatusBadRequest)
+		return
+	}
+
+	paths := make([]string, 0, len(req.Paths))
+	for _, p := range req.Paths {
+		p = path.Clean(p)
+		if !fs.ValidPath(p) {
+			http.Error(w, "Invalid path", http.StatusBadRequest)
+			return
+		}
+
+		paths = append(paths, p)
+	}
+
+	s.logger.Debug("Download selection", "paths", paths)
+
+	filename, err := archiveFilename(r.URL.Query().Get("filename"), "download", archiveExtensions["zip"])
+	if err != nil {
+		http.Error(w, "Invalid filename", http.StatusBadRequest)
 		return
 	}
 
-	tr, err := archiveFS.Archive(path)
+	entries, err := selectionEntries(r.Context(), s.logger, s.fsys, paths)
 	if err != nil {
-		http.Error(w, "Error archiving directory", http.StatusInternalServerError)
+		if errors.Is(err, writablefs.ErrNotExist) {
+			http.Error(w, "File not found", http.StatusNotFound)
+			return
+		}
+
+		http.Error(w, "Error getting file info", http.StatusInternalServerError)
 		return
 	}
-	defer tr.Close()
 
-	dirName := filepath.Base(path)
-	if err := tarToZip(w, tr, dirName); err != nil {
+	w.Header().Set("Content-Disposition", attachment(filename))
+	w.Header().Set("Content-Type", "application/zip")
+
+	if err := writeZip(r.Context(), w, s.fsys, entries); err != nil {
 		http.Error(w, "Error creating zip", http.StatusInternalServerError)
 	}
 }
+
+// wrapResponseWriter adds metrics and rate limiting (if enabled) to a response.
+func (s *Server) wrapResponseWriter(w http.ResponseWriter, r *http.Request) http.ResponseWriter {
+	w = &countingResponseWriter{ResponseWriter: w}
+
+	if s.limiter != nil {
+		w = &rateLimitedResponseWriter{
+			ResponseWriter: w,
+			ctx:            r.Context(),
+			limiter:        s.limiter,
+		}
+	}
+
+	return w
+}
+
+// reportDownload reports the size and duration of a download to telemetry,
+// nothing is reported if no content was served (eg. for HEAD requests).
+func (s *Server) reportDownload(w http.ResponseWriter, start time.Time) {
+	if rlw, ok := w.(*rateLimitedResponseWriter); ok {
+		w = rlw.ResponseWriter
+	}
+
+	cw, ok := w.(*countingResponseWriter)
+	if !ok || cw.written == 0 {
+		return
+	}
+
+	telemetry.ReportTransfer(s.telemetryReporter, telemetry.EventDownloadComplete, cw.written, time.Since(start))
+}
+
+// countingResponseWriter records the number of bytes served.
+type countingResponseWriter struct {
+	http.ResponseWriter
+	written int64
+}
+
+func (w *countingResponseWriter) Write(p []byte) (int, error) {
+	n, err := w.ResponseWriter.Write(p)
+	w.written += int64(n)
+	metrics.DownloadBytesServed.Add(float64(n))
+	return n, err
+}
+
+// contextReader stops reading once ctx is cancelled, so that archiving stops
+// promptly when the client goes away (rather than reading the rest of the
+// directory from the underlying storage).
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (r *contextReader) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	return r.r.Read(p)
+}
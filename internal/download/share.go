@@ -0,0 +1,318 @@
+/* SPDX-License-Identifier: AGPL-3.0-or-later
+ *
+ * Copyright 2024 Damian Peckett <damian@pecke.tt>.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package download
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bucket-sailor/bucketeer/internal/util"
+	"github.com/bucket-sailor/writablefs"
+)
+
+const (
+	defaultShareExpiry    = time.Hour
+	defaultMaxShareExpiry = 7 * 24 * time.Hour
+	// maxShareRequestBytes limits the size of a share request.
+	maxShareRequestBytes = 1 << 16 // 64KiB
+	shareKeySize         = 32
+)
+
+var (
+	errInvalidShareToken = errors.New("invalid share token")
+	errExpiredShareToken = errors.New("share link has expired")
+)
+
+// ShareServerOptions are options for configuring the behavior of the share server.
+type ShareServerOptions struct {
+	// Key is used to sign share links. If empty a random key is generated, so
+	// links won't survive a restart or work across multiple instances.
+	Key []byte
+	// MaxExpiry is the maximum lifetime of a share link (defaults to 7 days).
+	MaxExpiry time.Duration
+}
+
+// ShareServer creates signed, single use download links that can be handed
+// to someone without credentials.
+type ShareServer struct {
+	http.Handler
+	logger    *slog.Logger
+	downloads *Server
+	key       []byte
+	maxExpiry time.Duration
+	used      *usedNonces
+}
+
+// NewShareServer creates a new share server, files are served by downloads.
+// It returns the path of the endpoint that creates share links, and the path
+// prefix that share links are served beneath.
+func NewShareServer(logger *slog.Logger, downloads *Server, opts *ShareServerOptions) (sharePath, sharedPath string, h http.Handler) {
+	s := &ShareServer{
+		logger:    logger.WithGroup("share"),
+		downloads: downloads,
+		maxExpiry: defaultMaxShareExpiry,
+		used:      newUsedNonces(),
+	}
+
+	if opts != nil {
+		s.key = opts.Key
+
+		if opts.MaxExpiry > 0 {
+			s.maxExpiry = opts.MaxExpiry
+		}
+	}
+
+	if len(s.key) == 0 {
+		s.key = []byte(util.GenerateID(shareKeySize))
+	}
+
+	mux := http.NewServeMux()
+	s.Handler = mux
+
+	mux.HandleFunc("/api/v1alpha1/fs/share", s.handleShare)
+	mux.HandleFunc("/shared/", s.handleShared)
+
+	return "/api/v1alpha1/fs/share", "/shared/", s
+}
+
+// shareRequest is the body of a request to create a share link.
+type shareRequest struct {
+	Path string `json:"path"`
+	// Expiry is a duration (eg. 24h), defaults to an hour.
+	Expiry string `json:"expiry,omitempty"`
+}
+
+type shareResponse struct {
+	URL       string    `json:"url"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+// shareToken is the signed payload of a share link.
+type shareToken struct {
+	// Prefix is the prefix the server was mounted beneath (eg. a bucket's
+	// prefix), so that a link can't be used to download from another bucket.
+	Prefix    string `json:"m,omitempty"`
+	Path      string `json:"p"`
+	ExpiresAt int64  `json:"e"`
+	Nonce     string `json:"n"`
+}
+
+func (s *ShareServer) handleShare(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req shareRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxShareRequestBytes)).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if req.Path == "" {
+		http.Error(w, "Missing path", http.StatusBadRequest)
+		return
+	}
+	p := path.Clean(req.Path)
+
+	expiry := defaultShareExpiry
+	if req.Expiry != "" {
+		var err error
+		expiry, err = time.ParseDuration(req.Expiry)
+		if err != nil || expiry <= 0 {
+			http.Error(w, "Invalid expiry", http.StatusBadRequest)
+			return
+		}
+	}
+
+	if expiry > s.maxExpiry {
+		expiry = s.maxExpiry
+	}
+
+	if _, err := s.downloads.fsys.Stat(p); err != nil {
+		if errors.Is(err, writablefs.ErrNotExist) {
+			http.Error(w, "File not found", http.StatusNotFound)
+			return
+		}
+
+		http.Error(w, "Error getting file info", http.StatusInternalServerError)
+		return
+	}
+
+	expiresAt := time.Now().Add(expiry).Truncate(time.Second)
+
+	prefix := mountPrefix(r)
+
+	token, err := s.sign(shareToken{
+		Prefix:    prefix,
+		Path:      p,
+		ExpiresAt: expiresAt.Unix(),
+		Nonce:     util.GenerateID(16),
+	})
+	if err != nil {
+		http.Error(w, "Error signing share link", http.StatusInternalServerError)
+		return
+	}
+
+	s.logger.Debug("Share", "path", p, "expiresAt", expiresAt)
+
+	resp := shareResponse{
+		URL:       prefix + "/shared/" + token,
+		ExpiresAt: expiresAt.UTC(),
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(&resp); err != nil {
+		s.logger.Warn("Error writing share response", "error", err)
+	}
+}
+
+func (s *ShareServer) handleShared(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	token, err := s.verify(strings.TrimPrefix(r.URL.Path, "/shared/"))
+	if err == nil && token.Prefix != mountPrefix(r) {
+		err = errInvalidShareToken
+	}
+	if err != nil {
+		if errors.Is(err, errExpiredShareToken) {
+			http.Error(w, "Link has expired", http.StatusGone)
+			return
+		}
+
+		http.Error(w, "Invalid link", http.StatusForbidden)
+		return
+	}
+
+	// Checking a link (eg. by a chat app generating a preview) doesn't use it up.
+	if r.Method == http.MethodGet && !s.used.consume(token.Nonce, time.Unix(token.ExpiresAt, 0)) {
+		http.Error(w, "Link has already been used", http.StatusGone)
+		return
+	}
+
+	w = s.downloads.wrapResponseWriter(w, r)
+	defer s.downloads.reportDownload(w, time.Now())
+
+	s.downloads.serve(w, r, token.Path)
+}
+
+// sign encodes the token and appends its signature.
+func (s *ShareServer) sign(token shareToken) (string, error) {
+	payload, err := json.Marshal(&token)
+	if err != nil {
+		return "", err
+	}
+
+	encoded := base64.RawURLEncoding.EncodeToString(payload)
+
+	return encoded + "." + base64.RawURLEncoding.EncodeToString(s.mac(encoded)), nil
+}
+
+// verify checks the signature and expiry of an encoded token.
+func (s *ShareServer) verify(encoded string) (*shareToken, error) {
+	payload, sig, ok := strings.Cut(encoded, ".")
+	if !ok {
+		return nil, errInvalidShareToken
+	}
+
+	decodedSig, err := base64.RawURLEncoding.DecodeString(sig)
+	if err != nil || !hmac.Equal(decodedSig, s.mac(payload)) {
+		return nil, errInvalidShareToken
+	}
+
+	decodedPayload, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil {
+		return nil, errInvalidShareToken
+	}
+
+	var token shareToken
+	if err := json.Unmarshal(decodedPayload, &token); err != nil {
+		return nil, errInvalidShareToken
+	}
+
+	if time.Now().After(time.Unix(token.ExpiresAt, 0)) {
+		return nil, errExpiredShareToken
+	}
+
+	return &token, nil
+}
+
+func (s *ShareServer) mac(payload string) []byte {
+	h := hmac.New(sha256.New, s.key)
+	_, _ = h.Write([]byte(payload))
+	return h.Sum(nil)
+}
+
+// mountPrefix returns the part of the request path that was stripped before
+// it reached the handler (eg. a bucket's prefix).
+func mountPrefix(r *http.Request) string {
+	u, err := url.ParseRequestURI(r.RequestURI)
+	if err != nil {
+		return ""
+	}
+
+	return strings.TrimSuffix(u.Path, r.URL.Path)
+}
+
+// usedNonces records the nonces of share links that have been used, until
+// the links expire (after which they would be rejected anyway).
+type usedNonces struct {
+	mu     sync.Mutex
+	nonces map[string]time.Time
+}
+
+func newUsedNonces() *usedNonces {
+	return &usedNonces{
+		nonces: make(map[string]time.Time),
+	}
+}
+
+// consume marks a nonce as used, returning false if it already had been.
+func (u *usedNonces) consume(nonce string, expiresAt time.Time) bool {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	now := time.Now()
+	for n, exp := range u.nonces {
+		if now.After(exp) {
+			delete(u.nonces, n)
+		}
+	}
+
+	if _, ok := u.nonces[nonce]; ok {
+		return false
+	}
+
+	u.nonces[nonce] = expiresAt
+
+	return true
+}
@@ -19,51 +19,324 @@
 package download
 
 import (
-	"archive/tar"
 	"archive/zip"
+	"context"
 	"errors"
 	"io"
-	"path/filepath"
+	"io/fs"
+	"log/slog"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/bucket-sailor/writablefs"
 )
 
-func tarToZip(w io.Writer, r io.Reader, prefix string) error {
-	zw := zip.NewWriter(w)
-	defer zw.Close()
+const (
+	// numPrefetchWorkers is the maximum number of files that will be opened
+	// and read ahead of the file currently being written to the archive.
+	numPrefetchWorkers = 8
+	// prefetchSizeBytes is how much of each file is read ahead, this hides the
+	// latency of opening small files (which dominates on S3) without buffering
+	// large files in memory.
+	prefetchSizeBytes = 1 << 20 // 1MiB
+)
+
+type archiveEntry struct {
+	path string
+	// name is the name of the entry within the archive.
+	name string
+	fi   fs.FileInfo
+}
+
+// zipName returns the name of the entry within a zip archive, directories
+// are distinguished by a trailing slash.
+func (e archiveEntry) zipName() string {
+	if e.fi.IsDir() {
+		return e.name + "/"
+	}
+
+	return e.name
+}
+
+// sortEntries sorts entries by name, so that archives are reproducible and
+// directories always precede their contents.
+func sortEntries(entries []archiveEntry) {
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].zipName() < entries[j].zipName()
+	})
+}
+
+type prefetchedFile struct {
+	f    writablefs.File
+	head []byte
+	err  error
+}
 
-	tr := tar.NewReader(r)
-	for {
-		header, err := tr.Next()
+// zipDirectory writes a zip archive of the directory at root to w, it stops
+// as soon as ctx is cancelled (eg. the client disconnected).
+func zipDirectory(ctx context.Context, logger *slog.Logger, w io.Writer, fsys writablefs.FS, root, prefix string) error {
+	entries, err := walkEntries(ctx, logger, fsys, root, prefix)
+	if err != nil {
+		return err
+	}
+
+	sortEntries(entries)
+
+	return writeZip(ctx, w, fsys, entries)
+}
+
+// walkEntries returns the regular files and directories beneath root, named
+// relative to root (and joined with prefix). Directories are included so that
+// empty directories are preserved. Symlinks are skipped, as they could point
+// outside of the bucket.
+func walkEntries(ctx context.Context, logger *slog.Logger, fsys writablefs.FS, root, prefix string) ([]archiveEntry, error) {
+	root = path.Clean(root)
+
+	var entries []archiveEntry
+	err := fs.WalkDir(fsys, root, func(p string, d fs.DirEntry, err error) error {
 		if err != nil {
-			if errors.Is(err, io.EOF) {
-				break
-			}
+			return err
+		}
 
+		// Walking a large bucket can take a while, so don't carry on if nobody
+		// is waiting for the result.
+		if err := ctx.Err(); err != nil {
 			return err
 		}
 
-		if header.Typeflag != tar.TypeReg {
-			continue
+		if d.Type()&fs.ModeSymlink != 0 {
+			logger.Info("Skipping symlink", "path", p)
+			return nil
+		}
+
+		if !d.IsDir() && !d.Type().IsRegular() {
+			return nil
+		}
+
+		var name string
+		if p != root {
+			name = p
+			if root != "." {
+				name = strings.TrimPrefix(name, root+"/")
+			}
 		}
 
-		name := header.Name
 		if prefix != "" {
-			name = filepath.Join(prefix, name)
+			name = path.Join(prefix, name)
+		}
+
+		// The root itself, unless it's named by the prefix.
+		if name == "" {
+			return nil
 		}
 
-		f, err := zw.CreateHeader(&zip.FileHeader{
-			Name:               name,
-			Method:             zip.Deflate,
-			Modified:           header.ModTime,
-			UncompressedSize64: uint64(header.Size),
-		})
+		fi, err := d.Info()
 		if err != nil {
 			return err
 		}
 
-		if _, err := io.Copy(f, tr); err != nil {
+		entries = append(entries, archiveEntry{path: p, name: name, fi: fi})
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return entries, nil
+}
+
+// selectionEntries returns the files for a selection of paths (directories are
+// included recursively). Entries are named relative to the deepest directory
+// containing every selected path, and duplicates are removed.
+func selectionEntries(ctx context.Context, logger *slog.Logger, fsys writablefs.FS, paths []string) ([]archiveEntry, error) {
+	parent := path.Dir(paths[0])
+	for _, p := range paths[1:] {
+		parent = commonDir(parent, path.Dir(p))
+	}
+
+	relName := func(p string) string {
+		if parent == "." {
+			return p
+		}
+
+		return strings.TrimPrefix(p, parent+"/")
+	}
+
+	var entries []archiveEntry
+	seen := make(map[string]bool)
+	for _, p := range paths {
+		fi, err := fsys.Stat(p)
+		if err != nil {
+			return nil, err
+		}
+
+		var selected []archiveEntry
+		if fi.IsDir() {
+			prefix := relName(p)
+			if p == "." {
+				prefix = ""
+			}
+
+			selected, err = walkEntries(ctx, logger, fsys, p, prefix)
+			if err != nil {
+				return nil, err
+			}
+		} else {
+			selected = []archiveEntry{{path: p, name: relName(p), fi: fi}}
+		}
+
+		for _, entry := range selected {
+			if seen[entry.path] {
+				continue
+			}
+			seen[entry.path] = true
+
+			entries = append(entries, entry)
+		}
+	}
+
+	sortEntries(entries)
+
+	return entries, nil
+}
+
+// commonDir returns the deepest directory that contains both a and b.
+func commonDir(a, b string) string {
+	for a != "." && a != b && !strings.HasPrefix(b, a+"/") {
+		a = path.Dir(a)
+	}
+
+	return a
+}
+
+// writeZip writes a zip archive of the given entries to w. File contents are
+// prefetched concurrently but entries are always written in order.
+// Entries are streamed (with data descriptors), archive/zip will emit the
+// required Zip64 extra fields and end of central directory records for files
+// larger than 4GB, and for archives containing more than 65535 entries.
+// Nothing more is prefetched or written once ctx is cancelled.
+func writeZip(ctx context.Context, w io.Writer, fsys writablefs.FS, entries []archiveEntry) error {
+	results := make([]chan *prefetchedFile, len(entries))
+	for i := range results {
+		results[i] = make(chan *prefetchedFile, 1)
+	}
+
+	// slots bounds the number of files that are open / prefetched at once.
+	slots := make(chan struct{}, numPrefetchWorkers)
+	done := make(chan struct{})
+
+	var launched int
+	dispatcherDone := make(chan struct{})
+	go func() {
+		defer close(dispatcherDone)
+
+		for i, entry := range entries {
+			select {
+			case slots <- struct{}{}:
+			case <-done:
+				return
+			case <-ctx.Done():
+				return
+			}
+
+			launched++
+
+			go func(i int, entry archiveEntry) {
+				results[i] <- prefetch(fsys, entry)
+			}(i, entry)
+		}
+	}()
+
+	zw := zip.NewWriter(w)
+
+	var i int
+	defer func() {
+		// Release any files that were prefetched but never written.
+		close(done)
+		<-dispatcherDone
+
+		for ; i < launched; i++ {
+			if pf := <-results[i]; pf.f != nil {
+				_ = pf.f.Close()
+			}
+		}
+	}()
+
+	for ; i < len(entries); i++ {
+		var pf *prefetchedFile
+		select {
+		case pf = <-results[i]:
+		case <-ctx.Done():
+			// The dispatcher may have stopped before launching this entry.
+			return ctx.Err()
+		}
+
+		err := writeZipEntry(ctx, zw, entries[i], pf)
+		<-slots
+		if err != nil {
+			i++
 			return err
 		}
 	}
 
 	return zw.Close()
 }
+
+func prefetch(fsys writablefs.FS, entry archiveEntry) *prefetchedFile {
+	if entry.fi.IsDir() {
+		return &prefetchedFile{}
+	}
+
+	f, err := fsys.OpenFile(entry.path, writablefs.FlagReadOnly)
+	if err != nil {
+		return &prefetchedFile{err: err}
+	}
+
+	head := make([]byte, min(entry.fi.Size(), prefetchSizeBytes))
+	n, err := io.ReadFull(f, head)
+	if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrUnexpectedEOF) {
+		_ = f.Close()
+
+		return &prefetchedFile{err: err}
+	}
+
+	return &prefetchedFile{f: f, head: head[:n]}
+}
+
+func writeZipEntry(ctx context.Context, zw *zip.Writer, entry archiveEntry, pf *prefetchedFile) error {
+	if pf.err != nil {
+		return pf.err
+	}
+
+	if entry.fi.IsDir() {
+		header := &zip.FileHeader{
+			Name:     entry.zipName(),
+			Method:   zip.Store,
+			Modified: entry.fi.ModTime(),
+		}
+		header.SetMode(entry.fi.Mode())
+
+		_, err := zw.CreateHeader(header)
+		return err
+	}
+	defer pf.f.Close()
+
+	w, err := zw.CreateHeader(&zip.FileHeader{
+		Name:               entry.name,
+		Method:             zip.Deflate,
+		Modified:           entry.fi.ModTime(),
+		UncompressedSize64: uint64(entry.fi.Size()),
+	})
+	if err != nil {
+		return err
+	}
+
+	if _, err := w.Write(pf.head); err != nil {
+		return err
+	}
+
+	_, err = io.Copy(w, &contextReader{ctx: ctx, r: pf.f})
+	return err
+}
@@ -0,0 +1,238 @@
+/* SPDX-License-Identifier: AGPL-3.0-or-later
+ *
+ * Copyright 2024 Damian Peckett <damian@pecke.tt>.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package filesystem
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"sync"
+	"time"
+
+	"github.com/bucket-sailor/bucketeer/internal/gen/filesystem/v1alpha1"
+	"github.com/hashicorp/golang-lru/v2/expirable"
+	"github.com/redis/go-redis/v9"
+	"google.golang.org/protobuf/proto"
+)
+
+// ListingCache stores directory listings, keyed by listing ID, so that
+// subsequent paginated requests return a consistent view of the directory.
+type ListingCache interface {
+	// Get returns the cached listing with the given ID.
+	Get(ctx context.Context, id string) ([]*v1alpha1.ReadDirResponse_FileInfoWithIndex, bool, error)
+	// Add adds a listing of the directory dir to the cache.
+	Add(ctx context.Context, dir, id string, files []*v1alpha1.ReadDirResponse_FileInfoWithIndex) error
+	// Invalidate removes all cached listings of the directory dir.
+	Invalidate(ctx context.Context, dir string) error
+}
+
+// LRUListingCache is an in-memory listing cache.
+type LRUListingCache struct {
+	lru *expirable.LRU[string, []*v1alpha1.ReadDirResponse_FileInfoWithIndex]
+	// mu serializes adds and invalidations, so that a listing can't be
+	// added to the index after it has been invalidated.
+	mu sync.Mutex
+	// indexMu guards the index, it is also taken by the eviction callback
+	// (which runs with the LRU lock held), so mu must never be taken after it.
+	indexMu sync.Mutex
+	// idsByDir is a secondary index from (cleaned) directory to listing IDs.
+	idsByDir map[string]map[string]struct{}
+	// dirByID is the reverse of idsByDir, used when listings are evicted.
+	dirByID map[string]string
+}
+
+func NewLRUListingCache(size int, ttl time.Duration) *LRUListingCache {
+	c := &LRUListingCache{
+		idsByDir: make(map[string]map[string]struct{}),
+		dirByID:  make(map[string]string),
+	}
+
+	c.lru = expirable.NewLRU[string, []*v1alpha1.ReadDirResponse_FileInfoWithIndex](size, c.onEvict, ttl)
+
+	return c
+}
+
+func (c *LRUListingCache) Get(_ context.Context, id string) ([]*v1alpha1.ReadDirResponse_FileInfoWithIndex, bool, error) {
+	files, ok := c.lru.Get(id)
+	return files, ok, nil
+}
+
+func (c *LRUListingCache) Add(_ context.Context, dir, id string, files []*v1alpha1.ReadDirResponse_FileInfoWithIndex) error {
+	dir = path.Clean(dir)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.indexMu.Lock()
+	if _, ok := c.idsByDir[dir]; !ok {
+		c.idsByDir[dir] = make(map[string]struct{})
+	}
+	c.idsByDir[dir][id] = struct{}{}
+	c.dirByID[id] = dir
+	c.indexMu.Unlock()
+
+	c.lru.Add(id, files)
+
+	return nil
+}
+
+func (c *LRUListingCache) Invalidate(_ context.Context, dir string) error {
+	dir = path.Clean(dir)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// Copied, as removing the listings from the index modifies the map.
+	c.indexMu.Lock()
+	ids := make([]string, 0, len(c.idsByDir[dir]))
+	for id := range c.idsByDir[dir] {
+		ids = append(ids, id)
+	}
+	for _, id := range ids {
+		c.removeFromIndex(id)
+	}
+	c.indexMu.Unlock()
+
+	for _, id := range ids {
+		c.lru.Remove(id)
+	}
+
+	return nil
+}
+
+func (c *LRUListingCache) onEvict(id string, _ []*v1alpha1.ReadDirResponse_FileInfoWithIndex) {
+	c.indexMu.Lock()
+	defer c.indexMu.Unlock()
+
+	c.removeFromIndex(id)
+}
+
+// removeFromIndex removes a listing from the index, indexMu must be held.
+func (c *LRUListingCache) removeFromIndex(id string) {
+	dir, ok := c.dirByID[id]
+	if !ok {
+		return
+	}
+
+	delete(c.dirByID, id)
+	delete(c.idsByDir[dir], id)
+	if len(c.idsByDir[dir]) == 0 {
+		delete(c.idsByDir, dir)
+	}
+}
+
+// RedisListingCache is a listing cache stored in Redis, this allows listings
+// to be shared between multiple instances of bucketeer.
+type RedisListingCache struct {
+	client redis.UniversalClient
+	ttl    time.Duration
+}
+
+// NewRedisListingCache creates a new listing cache, listings expire after ttl
+// (if zero, the default of 5 minutes is used).
+func NewRedisListingCache(client redis.UniversalClient, ttl time.Duration) *RedisListingCache {
+	if ttl <= 0 {
+		ttl = defaultReadDirCacheTTL
+	}
+
+	return &RedisListingCache{
+		client: client,
+		ttl:    ttl,
+	}
+}
+
+func (c *RedisListingCache) Get(ctx context.Context, id string) ([]*v1alpha1.ReadDirResponse_FileInfoWithIndex, bool, error) {
+	data, err := c.client.Get(ctx, redisKey(id)).Bytes()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return nil, false, nil
+		}
+
+		return nil, false, fmt.Errorf("error getting listing from redis: %w", err)
+	}
+
+	var resp v1alpha1.ReadDirResponse
+	if err := proto.Unmarshal(data, &resp); err != nil {
+		return nil, false, fmt.Errorf("error unmarshalling listing: %w", err)
+	}
+
+	return resp.Files, true, nil
+}
+
+func (c *RedisListingCache) Add(ctx context.Context, dir, id string, files []*v1alpha1.ReadDirResponse_FileInfoWithIndex) error {
+	data, err := proto.Marshal(&v1alpha1.ReadDirResponse{
+		Id:    id,
+		Files: files,
+	})
+	if err != nil {
+		return fmt.Errorf("error marshalling listing: %w", err)
+	}
+
+	indexKey := redisIndexKey(dir)
+
+	_, err = c.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Set(ctx, redisKey(id), data, c.ttl)
+		pipe.SAdd(ctx, indexKey, id)
+		// The index only needs to live as long as the newest listing.
+		pipe.Expire(ctx, indexKey, c.ttl)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("error adding listing to redis: %w", err)
+	}
+
+	return nil
+}
+
+func (c *RedisListingCache) Invalidate(ctx context.Context, dir string) error {
+	indexKey := redisIndexKey(dir)
+
+	ids, err := c.client.SMembers(ctx, indexKey).Result()
+	if err != nil {
+		return fmt.Errorf("error getting listing index from redis: %w", err)
+	}
+
+	if len(ids) == 0 {
+		return nil
+	}
+
+	// Only the members we've seen are removed from the index, so that
+	// listings added concurrently aren't left unindexed.
+	_, err = c.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, id := range ids {
+			pipe.Del(ctx, redisKey(id))
+			pipe.SRem(ctx, indexKey, id)
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("error invalidating listings in redis: %w", err)
+	}
+
+	return nil
+}
+
+func redisKey(id string) string {
+	return "bucketeer:listing:" + id
+}
+
+func redisIndexKey(dir string) string {
+	return "bucketeer:listing-index:" + path.Clean(dir)
+}
@@ -0,0 +1,100 @@
+/* SPDX-License-Identifier: AGPL-3.0-or-later
+ *
+ * Copyright 2024 Damian Peckett <damian@pecke.tt>.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package filesystem
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+
+	"github.com/bucket-sailor/writablefs"
+)
+
+// Capabilities describes the operations supported by a filesystem, so that
+// clients can hide actions that would otherwise fail at runtime.
+type Capabilities struct {
+	// Rename is true if directories can be renamed in place, otherwise they
+	// are copied and the originals removed.
+	Rename bool `json:"rename"`
+	// Archive is true if directories can be downloaded as a tarball.
+	Archive bool `json:"archive"`
+	// Presign is true if presigned download URLs can be generated.
+	Presign bool `json:"presign"`
+	// XAttrs is true if extended attributes (eg. checksums) can be stored.
+	XAttrs bool `json:"xattrs"`
+	// ContentType is true if the content type given on upload is stored
+	// with the file and served by the underlying storage.
+	ContentType bool `json:"contentType"`
+	// ReadOnly is true if the server doesn't allow modifications.
+	ReadOnly bool `json:"readOnly"`
+}
+
+type CapabilitiesServer struct {
+	http.Handler
+	logger       *slog.Logger
+	capabilities Capabilities
+}
+
+// NewCapabilitiesServer creates a new server reporting the capabilities of
+// fsys, opts should be the same options given to the filesystem server.
+func NewCapabilitiesServer(logger *slog.Logger, fsys writablefs.FS, opts *ServerOptions) (string, http.Handler) {
+	var baseOpts ServerOptions
+	if opts != nil {
+		baseOpts = *opts
+	}
+
+	if baseOpts.Presigner == nil {
+		baseOpts.Presigner, _ = fsys.(Presigner)
+	}
+
+	_, archive := fsys.(writablefs.ArchiveFS)
+
+	s := &CapabilitiesServer{
+		logger: logger.WithGroup("fs"),
+		capabilities: Capabilities{
+			Rename:  !baseOpts.ObjectStore,
+			Archive: archive,
+			Presign: baseOpts.Presigner != nil,
+			// Every writablefs filesystem supports extended attributes, object
+			// stores keep them as object metadata.
+			XAttrs:      true,
+			ContentType: baseOpts.ObjectStore,
+			ReadOnly:    baseOpts.ReadOnly,
+		},
+	}
+
+	mux := http.NewServeMux()
+	s.Handler = mux
+
+	mux.HandleFunc("/api/v1alpha1/fs/capabilities", s.handleCapabilities)
+
+	return "/api/v1alpha1/fs/capabilities", s
+}
+
+func (s *CapabilitiesServer) handleCapabilities(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(&s.capabilities); err != nil {
+		s.logger.Warn("Error writing capabilities", "error", err)
+	}
+}
@@ -0,0 +1,159 @@
+/* SPDX-License-Identifier: AGPL-3.0-or-later
+ *
+ * Copyright 2024 Damian Peckett <damian@pecke.tt>.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+package filesystem
+
+import (
+	"context"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/bucket-sailor/bucketeer/internal/gen/filesystem/v1alpha1"
+	"github.com/bucket-sailor/bucketeer/internal/util/s3client"
+	"github.com/bucket-sailor/writablefs"
+	"github.com/bucket-sailor/writablefs/s3fs"
+	"github.com/minio/minio-go/v7"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// maxReadDirPageSize is the maximum number of entries returned in a single
+// page (the most S3 will return in a single request).
+const maxReadDirPageSize = 1000
+
+// DirPager is implemented by filesystems that can list a directory one page at
+// a time, without materializing the entire listing.
+type DirPager interface {
+	// ReadDirPage returns up to limit entries of a directory (sorted by name),
+	// starting after the position identified by token. The returned token is
+	// empty once there are no more entries.
+	ReadDirPage(ctx context.Context, dir, token string, limit int) ([]*v1alpha1.FileInfo, string, error)
+}
+
+// S3DirPager lists directories in an S3 bucket using continuation tokens.
+type S3DirPager struct {
+	client     minio.Core
+	bucketName string
+}
+
+// NewS3DirPager creates a new directory pager for the bucket described by opts.
+func NewS3DirPager(opts s3fs.Options, pathStyle bool) (*S3DirPager, error) {
+	client, err := s3client.New(opts, pathStyle)
+	if err != nil {
+		return nil, err
+	}
+
+	return &S3DirPager{
+		client:     minio.Core{Client: client},
+		bucketName: opts.BucketName,
+	}, nil
+}
+
+func (p *S3DirPager) ReadDirPage(ctx context.Context, dir, token string, limit int) ([]*v1alpha1.FileInfo, string, error) {
+	prefix := strings.TrimPrefix(path.Clean("/"+dir), "/")
+	if prefix != "" {
+		prefix += "/"
+	}
+
+	result, err := p.client.ListObjectsV2(p.bucketName, prefix, "", token, "/", limit)
+	if err != nil {
+		return nil, "", err
+	}
+
+	var exists bool
+	files := make([]*v1alpha1.FileInfo, 0, len(result.Contents)+len(result.CommonPrefixes))
+	for _, obj := range result.Contents {
+		// Skip the directory itself (not all S3 implementations will return it).
+		if obj.Key == prefix {
+			exists = true
+			continue
+		}
+
+		files = append(files, &v1alpha1.FileInfo{
+			Name:    strings.TrimPrefix(obj.Key, prefix),
+			Size:    obj.Size,
+			ModTime: timestamppb.New(obj.LastModified),
+		})
+	}
+
+	for _, commonPrefix := range result.CommonPrefixes {
+		files = append(files, &v1alpha1.FileInfo{
+			Name:  strings.TrimSuffix(strings.TrimPrefix(commonPrefix.Prefix, prefix), "/"),
+			IsDir: true,
+		})
+	}
+
+	// Directories only exist implicitly in S3, so an empty first page without a
+	// directory marker means there is nothing there.
+	if token == "" && prefix != "" && len(files) == 0 && !exists {
+		return nil, "", writablefs.ErrNotExist
+	}
+
+	// Objects and common prefixes are returned separately.
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].Name < files[j].Name
+	})
+
+	var nextToken string
+	if result.IsTruncated {
+		nextToken = result.NextContinuationToken
+	}
+
+	return files, nextToken, nil
+}
+
+// fsDirPager pages through a directory listing of any filesystem. The whole
+// directory is still listed for each page, so it's only suitable for
+// filesystems where that is cheap (eg. local directories).
+type fsDirPager struct {
+	fsys writablefs.FS
+}
+
+func (p *fsDirPager) ReadDirPage(_ context.Context, dir, token string, limit int) ([]*v1alpha1.FileInfo, string, error) {
+	entries, err := p.fsys.ReadDir(dir)
+	if err != nil {
+		return nil, "", err
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Name() < entries[j].Name()
+	})
+
+	// The token is the name of the last entry of the previous page.
+	start := sort.Search(len(entries), func(i int) bool {
+		return token == "" || entries[i].Name() > token
+	})
+
+	end := min(start+limit, len(entries))
+
+	files := make([]*v1alpha1.FileInfo, 0, end-start)
+	for _, entry := range entries[start:end] {
+		fi, err := toFileInfo(entry)
+		if err != nil {
+			return nil, "", err
+		}
+
+		files = append(files, fi)
+	}
+
+	var nextToken string
+	if end < len(entries) {
+		nextToken = entries[end-1].Name()
+	}
+
+	return files, nextToken, nil
+}
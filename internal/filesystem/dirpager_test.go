@@ -0,0 +1,101 @@
+/* SPDX-License-Identifier: AGPL-3.0-or-later
+ *
+ * Copyright 2024 Damian Peckett <damian@pecke.tt>.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+package filesystem_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/bucket-sailor/bucketeer/internal/filesystem"
+	"github.com/bucket-sailor/writablefs"
+	"github.com/bucket-sailor/writablefs/s3fs"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestS3DirPager(t *testing.T) {
+	// A minimal fake of the S3 ListObjectsV2 API.
+	pages := map[string]string{
+		"": `<Contents><Key>dir/</Key><Size>0</Size></Contents>
+<Contents><Key>dir/b.txt</Key><LastModified>2024-01-01T00:00:00.000Z</LastModified><Size>3</Size></Contents>
+<CommonPrefixes><Prefix>dir/a/</Prefix></CommonPrefixes>
+<IsTruncated>true</IsTruncated><NextContinuationToken>page-2</NextContinuationToken>`,
+		"page-2": `<Contents><Key>dir/c.txt</Key><LastModified>2024-01-01T00:00:00.000Z</LastModified><Size>5</Size></Contents>
+<IsTruncated>false</IsTruncated>`,
+	}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		if r.URL.Path != "/my-bucket/" || q.Get("list-type") != "2" || q.Get("delimiter") != "/" {
+			http.Error(w, "Unexpected request", http.StatusBadRequest)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/xml")
+
+		if q.Get("prefix") != "dir/" {
+			fmt.Fprint(w, `<ListBucketResult><Name>my-bucket</Name><IsTruncated>false</IsTruncated></ListBucketResult>`)
+			return
+		}
+
+		page, ok := pages[q.Get("continuation-token")]
+		if !ok {
+			http.Error(w, "Unknown continuation token", http.StatusBadRequest)
+			return
+		}
+
+		fmt.Fprintf(w, `<ListBucketResult><Name>my-bucket</Name><Prefix>dir/</Prefix><Delimiter>/</Delimiter>%s</ListBucketResult>`, page)
+	}))
+	t.Cleanup(srv.Close)
+
+	pager, err := filesystem.NewS3DirPager(s3fs.Options{
+		EndpointURL: srv.URL,
+		Region:      "us-east-1",
+		Credentials: credentials.NewStaticV4("access", "secret", ""),
+		BucketName:  "my-bucket",
+	}, true)
+	require.NoError(t, err)
+
+	ctx := context.Background()
+
+	files, token, err := pager.ReadDirPage(ctx, "dir", "", 2)
+	require.NoError(t, err)
+
+	require.Len(t, files, 2)
+	assert.Equal(t, "a", files[0].Name)
+	assert.True(t, files[0].IsDir)
+	assert.Equal(t, "b.txt", files[1].Name)
+	assert.Equal(t, int64(3), files[1].Size)
+	assert.Equal(t, "page-2", token)
+
+	files, token, err = pager.ReadDirPage(ctx, "dir", token, 2)
+	require.NoError(t, err)
+
+	require.Len(t, files, 1)
+	assert.Equal(t, "c.txt", files[0].Name)
+	assert.Empty(t, token)
+
+	t.Run("Not Found", func(t *testing.T) {
+		_, _, err := pager.ReadDirPage(ctx, "missing", "", 2)
+		require.ErrorIs(t, err, writablefs.ErrNotExist)
+	})
+}
@@ -0,0 +1,103 @@
+/* SPDX-License-Identifier: AGPL-3.0-or-later
+ *
+ * Copyright 2024 Damian Peckett <damian@pecke.tt>.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package filesystem
+
+import (
+	"errors"
+	"fmt"
+
+	"connectrpc.com/connect"
+	"github.com/bucket-sailor/writablefs"
+)
+
+// xAttrChecksum is the extended attribute used to store a file's checksum.
+const xAttrChecksum = "bucketeer.checksum"
+
+// etag returns a token identifying the current contents of a file, it matches
+// the ETag returned when downloading the file. A strong token is derived from
+// the checksum stored on upload if available, otherwise a weak token is derived
+// from the size and modification time. Directories don't have a token.
+func etag(fsys writablefs.FS, p string, fi writablefs.FileInfo) string {
+	if fi.IsDir() {
+		return ""
+	}
+
+	if f, err := fsys.OpenFile(p, writablefs.FlagReadOnly); err == nil {
+		defer f.Close()
+
+		if xattrs, err := f.XAttrs(); err == nil {
+			if checksum, err := xattrs.Get(xAttrChecksum); err == nil && len(checksum) > 0 {
+				return fmt.Sprintf("%q", string(checksum))
+			}
+		}
+	}
+
+	return fmt.Sprintf("W/\"%x-%x\"", fi.Size(), fi.ModTime().UnixNano())
+}
+
+// clearChecksum removes the checksum stored on a file, which is stale once the
+// file has been overwritten (the file would otherwise keep its old etag).
+func clearChecksum(f writablefs.File) error {
+	xattrs, err := f.XAttrs()
+	if err != nil {
+		// Nothing can have been stored.
+		return nil
+	}
+
+	// Only remove it if it's there, on some filesystems (eg. S3) every change
+	// to the metadata is a request.
+	if _, err := xattrs.Get(xAttrChecksum); err != nil {
+		return nil
+	}
+
+	if err := xattrs.Remove(xAttrChecksum); err != nil {
+		return err
+	}
+
+	return xattrs.Sync()
+}
+
+// checkIfMatch returns a FailedPrecondition error if the file at p doesn't
+// match the expected etag. If the file has no etag the check is skipped.
+func (s *Server) checkIfMatch(p, ifMatch string) error {
+	if ifMatch == "" {
+		return nil
+	}
+
+	fi, err := s.fsys.Stat(p)
+	if err != nil {
+		if errors.Is(err, writablefs.ErrNotExist) {
+			return connect.NewError(connect.CodeFailedPrecondition, fmt.Errorf("destination does not exist"))
+		}
+
+		return connect.NewError(connect.CodeInternal, err)
+	}
+
+	current := etag(s.fsys, p, fi)
+	if current == "" {
+		s.logger.Debug("No etag available, ignoring if match", "path", p)
+		return nil
+	}
+
+	if current != ifMatch {
+		return connect.NewError(connect.CodeFailedPrecondition, fmt.Errorf("destination has been modified"))
+	}
+
+	return nil
+}
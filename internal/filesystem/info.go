@@ -0,0 +1,103 @@
+/* SPDX-License-Identifier: AGPL-3.0-or-later
+ *
+ * Copyright 2024 Damian Peckett <damian@pecke.tt>.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package filesystem
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"path"
+	"strconv"
+
+	"github.com/bucket-sailor/writablefs"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+type InfoServer struct {
+	http.Handler
+	logger *slog.Logger
+	fsys   writablefs.FS
+}
+
+// NewInfoServer creates a new server for retrieving file info without a
+// connect client (eg. HEAD requests from sync tools).
+func NewInfoServer(logger *slog.Logger, fsys writablefs.FS) (string, http.Handler) {
+	s := &InfoServer{
+		logger: logger.WithGroup("fs"),
+		fsys:   fsys,
+	}
+
+	mux := http.NewServeMux()
+	s.Handler = mux
+
+	mux.HandleFunc("/api/v1alpha1/fs/info", s.handleInfo)
+
+	return "/api/v1alpha1/fs/info", s
+}
+
+func (s *InfoServer) handleInfo(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	p := r.URL.Query().Get("path")
+	if p == "" {
+		http.Error(w, "Missing path", http.StatusBadRequest)
+		return
+	}
+	p = path.Clean(p)
+
+	fi, err := s.fsys.Stat(p)
+	if err != nil {
+		if errors.Is(err, writablefs.ErrNotExist) {
+			http.Error(w, "File not found", http.StatusNotFound)
+			return
+		}
+
+		http.Error(w, "Error getting file info", http.StatusInternalServerError)
+		return
+	}
+
+	info := newFileInfo(s.fsys, p, fi)
+
+	w.Header().Set("Last-Modified", fi.ModTime().UTC().Format(http.TimeFormat))
+	if info.Etag != "" {
+		w.Header().Set("ETag", info.Etag)
+	}
+
+	// The headers carry everything a HEAD request needs, Content-Length is the
+	// size of the file rather than of the (omitted) body.
+	if r.Method == http.MethodHead {
+		w.Header().Set("Content-Length", strconv.FormatInt(fi.Size(), 10))
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	body, err := protojson.Marshal(info)
+	if err != nil {
+		http.Error(w, "Error encoding file info", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if _, err := w.Write(body); err != nil {
+		s.logger.Warn("Error writing file info", "error", err)
+	}
+}
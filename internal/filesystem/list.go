@@ -0,0 +1,248 @@
+/* SPDX-License-Identifier: AGPL-3.0-or-later
+ *
+ * Copyright 2024 Damian Peckett <damian@pecke.tt>.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package filesystem
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+
+	"connectrpc.com/connect"
+	"github.com/bucket-sailor/bucketeer/internal/gen/filesystem/v1alpha1"
+	"github.com/bucket-sailor/writablefs"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+// contentTypeNDJSON is the content type of streamed listings, one JSON
+// encoded FileInfo per line.
+const contentTypeNDJSON = "application/x-ndjson"
+
+// ListHandler returns a handler for listing directories with a plain GET
+// request (eg. from generic HTTP clients). By default the paginated, cached
+// listing of the ReadDir RPC is returned, clients that accept
+// application/x-ndjson instead receive each entry as it is read, so that large
+// directories can be rendered incrementally.
+func (s *Server) ListHandler() (string, http.Handler) {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("/api/v1alpha1/fs/list", s.handleList)
+
+	return "/api/v1alpha1/fs/list", mux
+}
+
+func (s *Server) handleList(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	query := r.URL.Query()
+
+	filter := query.Get("filter")
+	if filter != "" {
+		if _, err := path.Match(filter, ""); err != nil {
+			http.Error(w, "Invalid filter", http.StatusBadRequest)
+			return
+		}
+	}
+
+	if acceptsNDJSON(r) {
+		s.streamList(w, r, path.Clean(query.Get("path")), filter)
+		return
+	}
+
+	req := &v1alpha1.ReadDirRequest{
+		Path:   query.Get("path"),
+		Id:     query.Get("id"),
+		Filter: filter,
+	}
+
+	for param, index := range map[string]*int64{"start": &req.StartIndex, "stop": &req.StopIndex} {
+		if value := query.Get(param); value != "" {
+			var err error
+			*index, err = strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				http.Error(w, fmt.Sprintf("Invalid %s index", param), http.StatusBadRequest)
+				return
+			}
+		}
+	}
+
+	resp, err := s.ReadDir(r.Context(), connect.NewRequest(req))
+	if err != nil {
+		switch connect.CodeOf(err) {
+		case connect.CodeNotFound:
+			http.Error(w, "Directory not found", http.StatusNotFound)
+		case connect.CodeInvalidArgument:
+			http.Error(w, "Invalid index range", http.StatusBadRequest)
+		default:
+			s.logger.Warn("Error listing directory", "path", req.Path, "error", err)
+
+			http.Error(w, "Error listing directory", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	body, err := protojson.Marshal(resp.Msg)
+	if err != nil {
+		http.Error(w, "Error encoding listing", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if _, err := w.Write(body); err != nil {
+		s.logger.Warn("Error writing listing", "error", err)
+	}
+}
+
+// streamList writes the entries of dir as they are read, nothing is cached
+// and entries are in the order the filesystem returns them. The status code
+// is sent along with the first page, so errors after that point can only be
+// reported in the stream itself (as a final {"error": "..."} line).
+func (s *Server) streamList(w http.ResponseWriter, r *http.Request, dir, filter string) {
+	flusher, _ := w.(http.Flusher)
+
+	var started bool
+	err := s.readDirPages(r.Context(), dir, func(files []*v1alpha1.FileInfo) error {
+		if !started {
+			w.Header().Set("Content-Type", contentTypeNDJSON)
+			w.Header().Set("X-Content-Type-Options", "nosniff")
+			w.WriteHeader(http.StatusOK)
+			started = true
+		}
+
+		for _, fi := range files {
+			if filter != "" {
+				// Pattern has already been validated.
+				if matched, _ := path.Match(filter, fi.Name); !matched {
+					continue
+				}
+			}
+
+			line, err := protojson.Marshal(fi)
+			if err != nil {
+				return err
+			}
+
+			if _, err := w.Write(append(line, '\n')); err != nil {
+				return err
+			}
+		}
+
+		if flusher != nil {
+			flusher.Flush()
+		}
+
+		return nil
+	})
+	if err != nil {
+		if !started {
+			if errors.Is(err, writablefs.ErrNotExist) {
+				http.Error(w, "Directory not found", http.StatusNotFound)
+				return
+			}
+
+			s.logger.Warn("Error listing directory", "path", dir, "error", err)
+
+			http.Error(w, "Error listing directory", http.StatusInternalServerError)
+			return
+		}
+
+		// The client has most likely gone away.
+		if r.Context().Err() != nil {
+			return
+		}
+
+		s.logger.Warn("Error streaming directory listing", "path", dir, "error", err)
+
+		_, _ = w.Write([]byte(`{"error":"Error listing directory"}` + "\n"))
+	}
+}
+
+// readDirPages calls fn with each page of the listing of dir. fn is called at
+// least once (with an empty page for an empty directory).
+func (s *Server) readDirPages(ctx context.Context, dir string, fn func([]*v1alpha1.FileInfo) error) error {
+	// Slicing pages out of a full listing would list the directory again for
+	// every page, so list it once and convert it a page at a time instead.
+	if _, ok := s.dirPager.(*fsDirPager); ok {
+		entries, err := s.fsys.ReadDir(dir)
+		if err != nil {
+			return err
+		}
+
+		for start := 0; start == 0 || start < len(entries); start += maxReadDirPageSize {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+
+			page := entries[start:min(start+maxReadDirPageSize, len(entries))]
+
+			files := make([]*v1alpha1.FileInfo, 0, len(page))
+			for _, entry := range page {
+				fi, err := toFileInfo(entry)
+				if err != nil {
+					return err
+				}
+
+				files = append(files, fi)
+			}
+
+			if err := fn(files); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+
+	var token string
+	for {
+		files, nextToken, err := s.dirPager.ReadDirPage(ctx, dir, token, maxReadDirPageSize)
+		if err != nil {
+			return err
+		}
+
+		if err := fn(files); err != nil {
+			return err
+		}
+
+		if nextToken == "" {
+			return nil
+		}
+
+		token = nextToken
+	}
+}
+
+// acceptsNDJSON returns true if the client asked for a streamed listing.
+func acceptsNDJSON(r *http.Request) bool {
+	for _, accept := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType, _, err := mime.ParseMediaType(strings.TrimSpace(accept))
+		if err == nil && mediaType == contentTypeNDJSON {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,64 @@
+/* SPDX-License-Identifier: AGPL-3.0-or-later
+ *
+ * Copyright 2024 Damian Peckett <damian@pecke.tt>.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package filesystem
+
+import (
+	"context"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/bucket-sailor/bucketeer/internal/util/s3client"
+	"github.com/bucket-sailor/writablefs/s3fs"
+	"github.com/minio/minio-go/v7"
+)
+
+// Presigner is implemented by filesystems that can generate presigned URLs,
+// allowing files to be downloaded directly from the underlying storage.
+type Presigner interface {
+	Presign(ctx context.Context, path string, expiry time.Duration) (*url.URL, error)
+}
+
+// S3Presigner generates presigned URLs for objects in an S3 bucket.
+type S3Presigner struct {
+	client     *minio.Client
+	bucketName string
+}
+
+// NewS3Presigner creates a new presigner for the bucket described by opts. If
+// pathStyle is true, presigned URLs will always use path-style addressing
+// (endpoint/bucket/key), otherwise the style is chosen based on the endpoint.
+func NewS3Presigner(opts s3fs.Options, pathStyle bool) (*S3Presigner, error) {
+	client, err := s3client.New(opts, pathStyle)
+	if err != nil {
+		return nil, err
+	}
+
+	return &S3Presigner{
+		client:     client,
+		bucketName: opts.BucketName,
+	}, nil
+}
+
+func (p *S3Presigner) Presign(ctx context.Context, filePath string, expiry time.Duration) (*url.URL, error) {
+	key := strings.TrimPrefix(path.Clean("/"+filePath), "/")
+
+	return p.client.PresignedGetObject(ctx, p.bucketName, key, expiry, nil)
+}
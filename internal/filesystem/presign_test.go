@@ -0,0 +1,63 @@
+/* SPDX-License-Identifier: AGPL-3.0-or-later
+ *
+ * Copyright 2024 Damian Peckett <damian@pecke.tt>.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package filesystem_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bucket-sailor/bucketeer/internal/filesystem"
+	"github.com/bucket-sailor/writablefs/s3fs"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestS3PresignerPathStyle(t *testing.T) {
+	opts := s3fs.Options{
+		EndpointURL: "https://s3.amazonaws.com",
+		Region:      "us-east-1",
+		Credentials: credentials.NewStaticV4("access", "secret", ""),
+		BucketName:  "my-bucket",
+	}
+
+	t.Run("Auto", func(t *testing.T) {
+		presigner, err := filesystem.NewS3Presigner(opts, false)
+		require.NoError(t, err)
+
+		u, err := presigner.Presign(context.Background(), "dir/file.txt", time.Hour)
+		require.NoError(t, err)
+
+		assert.True(t, strings.HasPrefix(u.Host, "my-bucket."), u.Host)
+		assert.Equal(t, "/dir/file.txt", u.Path)
+	})
+
+	t.Run("Path Style", func(t *testing.T) {
+		presigner, err := filesystem.NewS3Presigner(opts, true)
+		require.NoError(t, err)
+
+		u, err := presigner.Presign(context.Background(), "dir/file.txt", time.Hour)
+		require.NoError(t, err)
+
+		assert.NotContains(t, u.Host, "my-bucket")
+		assert.Equal(t, "/my-bucket/dir/file.txt", u.Path)
+	})
+}
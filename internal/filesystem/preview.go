@@ -0,0 +1,141 @@
+/* SPDX-License-Identifier: AGPL-3.0-or-later
+ *
+ * Copyright 2024 Damian Peckett <damian@pecke.tt>.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+package filesystem
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/bucket-sailor/writablefs"
+)
+
+const (
+	defaultPreviewBytes = 256 * 1024 // 256KB
+	maxPreviewBytes     = 1024 * 1024
+	// sniffLen is the number of bytes used to detect binary files (the same
+	// as http.DetectContentType).
+	sniffLen = 512
+)
+
+type PreviewServer struct {
+	http.Handler
+	logger *slog.Logger
+	fsys   writablefs.FS
+}
+
+// NewPreviewServer creates a new server for previewing the beginning of text
+// files, without downloading the entire file.
+func NewPreviewServer(logger *slog.Logger, fsys writablefs.FS) (string, http.Handler) {
+	s := &PreviewServer{
+		logger: logger.WithGroup("fs"),
+		fsys:   fsys,
+	}
+
+	mux := http.NewServeMux()
+	s.Handler = mux
+
+	mux.HandleFunc("/api/v1alpha1/fs/preview", s.handlePreview)
+
+	return "/api/v1alpha1/fs/preview", s
+}
+
+func (s *PreviewServer) handlePreview(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	p := r.URL.Query().Get("path")
+	if p == "" {
+		http.Error(w, "Missing path", http.StatusBadRequest)
+		return
+	}
+	p = path.Clean(p)
+
+	maxBytes := int64(defaultPreviewBytes)
+	if maxBytesParam := r.URL.Query().Get("maxBytes"); maxBytesParam != "" {
+		var err error
+		maxBytes, err = strconv.ParseInt(maxBytesParam, 10, 64)
+		if err != nil || maxBytes <= 0 {
+			http.Error(w, "Invalid maxBytes", http.StatusBadRequest)
+			return
+		}
+
+		maxBytes = min(maxBytes, maxPreviewBytes)
+	}
+
+	fi, err := s.fsys.Stat(p)
+	if err != nil {
+		if errors.Is(err, writablefs.ErrNotExist) {
+			http.Error(w, "File not found", http.StatusNotFound)
+			return
+		}
+
+		http.Error(w, "Error getting file info", http.StatusInternalServerError)
+		return
+	}
+
+	if fi.IsDir() {
+		http.Error(w, "Cannot preview a directory", http.StatusBadRequest)
+		return
+	}
+
+	f, err := s.fsys.OpenFile(p, writablefs.FlagReadOnly)
+	if err != nil {
+		http.Error(w, "Error opening file", http.StatusInternalServerError)
+		return
+	}
+	defer f.Close()
+
+	// Only read the prefix we need, rather than the entire file.
+	buf, err := io.ReadAll(io.NewSectionReader(f, 0, min(maxBytes, fi.Size())))
+	if err != nil {
+		http.Error(w, "Error reading file", http.StatusInternalServerError)
+		return
+	}
+
+	if isBinary(buf[:min(len(buf), sniffLen)]) {
+		http.Error(w, "File does not appear to be text", http.StatusUnsupportedMediaType)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	if fi.Size() > maxBytes {
+		w.Header().Set("X-Truncated", "true")
+	}
+
+	if _, err := w.Write(buf); err != nil {
+		s.logger.Warn("Error writing preview", "error", err)
+	}
+}
+
+// isBinary guesses whether a file is binary from its first few bytes.
+func isBinary(sniff []byte) bool {
+	if bytes.IndexByte(sniff, 0) != -1 {
+		return true
+	}
+
+	return !strings.HasPrefix(http.DetectContentType(sniff), "text/")
+}
@@ -0,0 +1,93 @@
+/* SPDX-License-Identifier: AGPL-3.0-or-later
+ *
+ * Copyright 2024 Damian Peckett <damian@pecke.tt>.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package filesystem
+
+import (
+	"errors"
+	"net/http"
+	"path"
+
+	"github.com/bucket-sailor/writablefs"
+)
+
+// RemoveHandler returns a handler for removing files and directories with a
+// plain DELETE request (eg. from generic HTTP clients), honoring the same
+// options as the RemoveAll RPC (eg. trash mode).
+func (s *Server) RemoveHandler() (string, http.Handler) {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("/api/v1alpha1/fs", s.handleRemove)
+
+	return "/api/v1alpha1/fs", mux
+}
+
+func (s *Server) handleRemove(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if s.readOnly {
+		http.Error(w, "Server is in read-only mode", http.StatusForbidden)
+		return
+	}
+
+	p := r.URL.Query().Get("path")
+	if p == "" {
+		http.Error(w, "Missing path", http.StatusBadRequest)
+		return
+	}
+	p = path.Clean(p)
+
+	// Guard against accidentally removing the entire bucket.
+	if p == "." || p == "/" {
+		http.Error(w, "Refusing to remove the root directory", http.StatusBadRequest)
+		return
+	}
+
+	if _, err := s.fsys.Stat(p); err != nil {
+		if errors.Is(err, writablefs.ErrNotExist) {
+			http.Error(w, "File not found", http.StatusNotFound)
+			return
+		}
+
+		http.Error(w, "Error getting file info", http.StatusInternalServerError)
+		return
+	}
+
+	if err := s.remove(r.Context(), p); err != nil {
+		// It may have been removed by someone else in the meantime.
+		if errors.Is(err, writablefs.ErrNotExist) {
+			http.Error(w, "File not found", http.StatusNotFound)
+			return
+		} else if errors.Is(err, errContainsTrash) {
+			http.Error(w, "Refusing to remove a directory containing the trash", http.StatusConflict)
+			return
+		}
+
+		s.logger.Warn("Error removing file", "path", p, "error", err)
+
+		http.Error(w, "Error removing file", http.StatusInternalServerError)
+		return
+	}
+
+	s.Changed(r.Context(), path.Dir(p))
+
+	w.WriteHeader(http.StatusNoContent)
+}
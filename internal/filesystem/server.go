@@ -22,43 +22,140 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io"
+	"io/fs"
 	"log/slog"
 	"net/http"
+	"path"
+	"sort"
+	"strings"
 	"time"
 
 	"connectrpc.com/connect"
 	"github.com/bucket-sailor/bucketeer/internal/gen/filesystem/v1alpha1"
 	"github.com/bucket-sailor/bucketeer/internal/gen/filesystem/v1alpha1/v1alpha1connect"
+	"github.com/bucket-sailor/bucketeer/internal/metrics"
 	"github.com/bucket-sailor/bucketeer/internal/util"
 	"github.com/bucket-sailor/writablefs"
-	"github.com/hashicorp/golang-lru/v2/expirable"
 	"google.golang.org/protobuf/types/known/emptypb"
 	"google.golang.org/protobuf/types/known/timestamppb"
 	"google.golang.org/protobuf/types/known/wrapperspb"
 )
 
 const (
-	readDirCacheMaxSize = 100
-	readDirCacheTTL     = 5 * time.Minute
+	// defaultReadDirCacheMaxSize and defaultReadDirCacheTTL bound how many
+	// directory listings are cached, and for how long.
+	defaultReadDirCacheMaxSize = 100
+	defaultReadDirCacheTTL     = 5 * time.Minute
+	defaultPresignExpiry       = time.Hour
+	defaultMaxPresignExpiry    = 7 * 24 * time.Hour // The S3 maximum.
+	maxRemoveBatchSize         = 1000
 )
 
+// errReadOnly is returned by mutating operations when the server is read-only.
+var errReadOnly = errors.New("server is in read-only mode")
+
+// ServerOptions are options for configuring the behavior of the filesystem server.
+type ServerOptions struct {
+	// ReadDirCache is the cache used for directory listings, if nil an in-memory cache will be used.
+	ReadDirCache ListingCache
+	// ReadDirCacheMaxSize is the maximum number of listings held by the
+	// in-memory cache (defaults to 100). Each listing holds the info of every
+	// file in a directory, so very large directories use a lot of memory.
+	ReadDirCacheMaxSize int
+	// ReadDirCacheTTL is how long listings are held by the in-memory cache
+	// (defaults to 5 minutes).
+	ReadDirCacheTTL time.Duration
+	// ReadOnly disables all operations that modify the filesystem.
+	ReadOnly bool
+	// Presigner is used to generate presigned URLs, if nil the filesystem
+	// itself will be used (if it implements Presigner).
+	Presigner Presigner
+	// MaxPresignExpiry is the maximum lifetime of a presigned URL (defaults to 7 days).
+	MaxPresignExpiry time.Duration
+	// DirPager is used to list directories a page at a time, if nil the
+	// filesystem itself will be used (if it implements DirPager), otherwise
+	// each page is sliced from a full listing.
+	DirPager DirPager
+	// Watcher is notified of changes made through the server (optional).
+	Watcher *Watcher
+	// TrashPrefix enables trash mode, removed files and directories are moved
+	// under this prefix (eg. ".trash/") instead of being deleted.
+	TrashPrefix string
+	// ObjectStore indicates the filesystem is backed by an object store (eg.
+	// S3), which can't rename directories in place but does store content types.
+	ObjectStore bool
+}
+
 type Server struct {
 	http.Handler
-	logger *slog.Logger
-	fsys   writablefs.FS
-	// Cache for directory listings (in the future this should support being stored in Redis etc.).
-	readDirCache *expirable.LRU[string, []*v1alpha1.ReadDirResponse_FileInfoWithIndex]
+	logger   *slog.Logger
+	fsys     writablefs.FS
+	readOnly bool
+	// Cache for directory listings.
+	readDirCache ListingCache
+	// presigner is nil if presigning is not supported.
+	presigner        Presigner
+	maxPresignExpiry time.Duration
+	dirPager         DirPager
+	watcher          *Watcher
+	// trashPrefix is empty if trash mode is disabled.
+	trashPrefix string
 }
 
-func NewServer(logger *slog.Logger, fsys writablefs.FS) (string, http.Handler) {
+// NewServer creates a new filesystem server.
+func NewServer(logger *slog.Logger, fsys writablefs.FS, opts *ServerOptions) (string, http.Handler) {
+	var baseOpts ServerOptions
+	if opts != nil {
+		baseOpts = *opts
+	}
+
+	if baseOpts.ReadDirCacheMaxSize <= 0 {
+		baseOpts.ReadDirCacheMaxSize = defaultReadDirCacheMaxSize
+	}
+
+	if baseOpts.ReadDirCacheTTL <= 0 {
+		baseOpts.ReadDirCacheTTL = defaultReadDirCacheTTL
+	}
+
+	if baseOpts.ReadDirCache == nil {
+		baseOpts.ReadDirCache = NewLRUListingCache(baseOpts.ReadDirCacheMaxSize, baseOpts.ReadDirCacheTTL)
+	}
+
+	if baseOpts.Presigner == nil {
+		baseOpts.Presigner, _ = fsys.(Presigner)
+	}
+
+	if baseOpts.DirPager == nil {
+		if dirPager, ok := fsys.(DirPager); ok {
+			baseOpts.DirPager = dirPager
+		} else {
+			baseOpts.DirPager = &fsDirPager{fsys: fsys}
+		}
+	}
+
+	if baseOpts.MaxPresignExpiry <= 0 {
+		baseOpts.MaxPresignExpiry = defaultMaxPresignExpiry
+	}
+
 	s := &Server{
-		logger:       logger.WithGroup("fs"),
-		fsys:         fsys,
-		readDirCache: expirable.NewLRU[string, []*v1alpha1.ReadDirResponse_FileInfoWithIndex](readDirCacheMaxSize, nil, readDirCacheTTL),
+		logger:           logger.WithGroup("fs"),
+		fsys:             fsys,
+		readOnly:         baseOpts.ReadOnly,
+		readDirCache:     baseOpts.ReadDirCache,
+		presigner:        baseOpts.Presigner,
+		maxPresignExpiry: baseOpts.MaxPresignExpiry,
+		dirPager:         baseOpts.DirPager,
+		watcher:          baseOpts.Watcher,
+	}
+
+	// The root can't be the trash, as everything would already be in it.
+	if trashPrefix := path.Clean(strings.Trim(baseOpts.TrashPrefix, "/")); trashPrefix != "." {
+		s.trashPrefix = trashPrefix
 	}
 
 	var path string
-	path, s.Handler = v1alpha1connect.NewFilesystemHandler(s)
+	path, s.Handler = v1alpha1connect.NewFilesystemHandler(s, connect.WithInterceptors(metrics.NewInterceptor()))
 
 	s.Handler = http.StripPrefix("/api", s.Handler)
 
@@ -66,6 +163,12 @@ func NewServer(logger *slog.Logger, fsys writablefs.FS) (string, http.Handler) {
 }
 
 func (s *Server) ReadDir(ctx context.Context, req *connect.Request[v1alpha1.ReadDirRequest]) (*connect.Response[v1alpha1.ReadDirResponse], error) {
+	if req.Msg.Filter != "" {
+		if _, err := path.Match(req.Msg.Filter, ""); err != nil {
+			return nil, connect.NewError(connect.CodeInvalidArgument, fmt.Errorf("invalid filter: %w", err))
+		}
+	}
+
 	populateCache := func(id string) ([]*v1alpha1.ReadDirResponse_FileInfoWithIndex, error) {
 		entries, err := s.fsys.ReadDir(req.Msg.Path)
 		if err != nil {
@@ -76,20 +179,37 @@ func (s *Server) ReadDir(ctx context.Context, req *connect.Request[v1alpha1.Read
 			return nil, err
 		}
 
-		files := make([]*v1alpha1.ReadDirResponse_FileInfoWithIndex, len(entries))
-		for i, entry := range entries {
+		fileInfos := make([]*v1alpha1.FileInfo, 0, len(entries))
+		for _, entry := range entries {
+			if req.Msg.Filter != "" {
+				// Pattern has already been validated.
+				if matched, _ := path.Match(req.Msg.Filter, entry.Name()); !matched {
+					continue
+				}
+			}
+
 			fi, err := toFileInfo(entry)
 			if err != nil {
 				return nil, err
 			}
 
+			fileInfos = append(fileInfos, fi)
+		}
+
+		// Sort before assigning indexes so that pagination is stable.
+		sortFileInfos(fileInfos, req.Msg.SortBy, req.Msg.Order)
+
+		files := make([]*v1alpha1.ReadDirResponse_FileInfoWithIndex, len(fileInfos))
+		for i, fi := range fileInfos {
 			files[i] = &v1alpha1.ReadDirResponse_FileInfoWithIndex{
 				Index:    int64(i),
 				FileInfo: fi,
 			}
 		}
 
-		s.readDirCache.Add(id, files)
+		if err := s.readDirCache.Add(ctx, listingDir(req.Msg.Path), listingCacheKey(id, req.Msg.Filter, req.Msg.SortBy, req.Msg.Order), files); err != nil {
+			return nil, err
+		}
 
 		return files, nil
 	}
@@ -111,7 +231,11 @@ func (s *Server) ReadDir(ctx context.Context, req *connect.Request[v1alpha1.Read
 		}
 	} else {
 		var ok bool
-		files, ok = s.readDirCache.Get(id)
+		files, ok, err = s.readDirCache.Get(ctx, listingCacheKey(id, req.Msg.Filter, req.Msg.SortBy, req.Msg.Order))
+		if err != nil {
+			return nil, connect.NewError(connect.CodeInternal, err)
+		}
+
 		if !ok {
 			files, err = populateCache(id)
 			if err != nil {
@@ -159,6 +283,29 @@ func (s *Server) ReadDir(ctx context.Context, req *connect.Request[v1alpha1.Read
 	}, nil
 }
 
+func (s *Server) ReadDirPage(ctx context.Context, req *connect.Request[v1alpha1.ReadDirPageRequest]) (*connect.Response[v1alpha1.ReadDirPageResponse], error) {
+	limit := int(req.Msg.Limit)
+	if limit <= 0 || limit > maxReadDirPageSize {
+		limit = maxReadDirPageSize
+	}
+
+	files, nextToken, err := s.dirPager.ReadDirPage(ctx, req.Msg.Path, req.Msg.Token, limit)
+	if err != nil {
+		if errors.Is(err, writablefs.ErrNotExist) {
+			return nil, connect.NewError(connect.CodeNotFound, fmt.Errorf("unable to list directory: %w", err))
+		}
+
+		return nil, connect.NewError(connect.CodeInternal, fmt.Errorf("unable to list directory: %w", err))
+	}
+
+	return &connect.Response[v1alpha1.ReadDirPageResponse]{
+		Msg: &v1alpha1.ReadDirPageResponse{
+			Files:     files,
+			NextToken: nextToken,
+		},
+	}, nil
+}
+
 func (s *Server) Stat(ctx context.Context, req *connect.Request[wrapperspb.StringValue]) (*connect.Response[v1alpha1.FileInfo], error) {
 	fi, err := s.fsys.Stat(req.Msg.Value)
 	if err != nil {
@@ -170,35 +317,560 @@ func (s *Server) Stat(ctx context.Context, req *connect.Request[wrapperspb.Strin
 	}
 
 	return &connect.Response[v1alpha1.FileInfo]{
-		Msg: &v1alpha1.FileInfo{
-			Name:    fi.Name(),
-			IsDir:   fi.IsDir(),
-			Size:    fi.Size(),
-			ModTime: timestamppb.New(fi.ModTime()),
-		},
+		Msg: newFileInfo(s.fsys, req.Msg.Value, fi),
 	}, nil
 }
 
+// newFileInfo returns the file info (including the etag) of the file at p.
+func newFileInfo(fsys writablefs.FS, p string, fi writablefs.FileInfo) *v1alpha1.FileInfo {
+	return &v1alpha1.FileInfo{
+		Name:    fi.Name(),
+		IsDir:   fi.IsDir(),
+		Size:    fi.Size(),
+		ModTime: timestamppb.New(fi.ModTime()),
+		Etag:    etag(fsys, p, fi),
+	}
+}
+
 func (s *Server) MkdirAll(ctx context.Context, req *connect.Request[wrapperspb.StringValue]) (*connect.Response[emptypb.Empty], error) {
+	if s.readOnly {
+		return nil, connect.NewError(connect.CodePermissionDenied, errReadOnly)
+	}
+
 	if err := s.fsys.MkdirAll(req.Msg.Value); err != nil {
 		return nil, connect.NewError(connect.CodeInternal, err)
 	}
 
+	s.Changed(ctx, path.Dir(req.Msg.Value))
+
+	return &connect.Response[emptypb.Empty]{
+		Msg: &emptypb.Empty{},
+	}, nil
+}
+
+func (s *Server) Touch(ctx context.Context, req *connect.Request[v1alpha1.TouchRequest]) (*connect.Response[emptypb.Empty], error) {
+	if s.readOnly {
+		return nil, connect.NewError(connect.CodePermissionDenied, errReadOnly)
+	}
+
+	filePath := path.Clean(req.Msg.Path)
+	if req.Msg.Path == "" || filePath == "." || filePath == "/" {
+		return nil, connect.NewError(connect.CodeInvalidArgument, fmt.Errorf("invalid path"))
+	}
+
+	if fi, err := s.fsys.Stat(filePath); err == nil {
+		if fi.IsDir() {
+			return nil, connect.NewError(connect.CodeAlreadyExists, fmt.Errorf("a directory already exists at this path"))
+		}
+
+		if !req.Msg.Force {
+			return nil, connect.NewError(connect.CodeAlreadyExists, fmt.Errorf("file already exists"))
+		}
+	} else if !errors.Is(err, writablefs.ErrNotExist) {
+		return nil, connect.NewError(connect.CodeInternal, err)
+	}
+
+	// Some filesystems won't create missing parent directories for us.
+	if err := s.fsys.MkdirAll(path.Dir(filePath)); err != nil {
+		return nil, connect.NewError(connect.CodeInternal, fmt.Errorf("error creating parent directory: %w", err))
+	}
+
+	f, err := s.fsys.OpenFile(filePath, writablefs.FlagWriteOnly|writablefs.FlagCreate)
+	if err != nil {
+		return nil, connect.NewError(connect.CodeInternal, fmt.Errorf("error creating file: %w", err))
+	}
+
+	// Opening an existing file doesn't truncate it.
+	if err := f.Truncate(0); err != nil {
+		_ = f.Close()
+		return nil, connect.NewError(connect.CodeInternal, fmt.Errorf("error truncating file: %w", err))
+	}
+
+	if err := clearChecksum(f); err != nil {
+		_ = f.Close()
+		return nil, connect.NewError(connect.CodeInternal, fmt.Errorf("error clearing checksum: %w", err))
+	}
+
+	if err := f.Close(); err != nil {
+		return nil, connect.NewError(connect.CodeInternal, fmt.Errorf("error creating file: %w", err))
+	}
+
+	s.Changed(ctx, path.Dir(filePath))
+
 	return &connect.Response[emptypb.Empty]{
 		Msg: &emptypb.Empty{},
 	}, nil
 }
 
 func (s *Server) RemoveAll(ctx context.Context, req *connect.Request[wrapperspb.StringValue]) (*connect.Response[emptypb.Empty], error) {
-	if err := s.fsys.RemoveAll(req.Msg.Value); err != nil {
+	if s.readOnly {
+		return nil, connect.NewError(connect.CodePermissionDenied, errReadOnly)
+	}
+
+	// Not all filesystems report removing a missing path as an error.
+	if _, err := s.fsys.Stat(req.Msg.Value); err != nil {
+		if errors.Is(err, writablefs.ErrNotExist) {
+			return nil, connect.NewError(connect.CodeNotFound, err)
+		}
+
+		return nil, connect.NewError(connect.CodeInternal, err)
+	}
+
+	if err := s.remove(ctx, req.Msg.Value); err != nil {
+		if errors.Is(err, writablefs.ErrNotExist) {
+			return nil, connect.NewError(connect.CodeNotFound, err)
+		} else if errors.Is(err, errContainsTrash) {
+			return nil, connect.NewError(connect.CodeFailedPrecondition, err)
+		}
+
+		return nil, connect.NewError(connect.CodeInternal, err)
+	}
+
+	s.Changed(ctx, path.Dir(req.Msg.Value))
+
+	return &connect.Response[emptypb.Empty]{
+		Msg: &emptypb.Empty{},
+	}, nil
+}
+
+func (s *Server) RemoveBatch(ctx context.Context, req *connect.Request[v1alpha1.RemoveBatchRequest]) (*connect.Response[v1alpha1.RemoveBatchResponse], error) {
+	if s.readOnly {
+		return nil, connect.NewError(connect.CodePermissionDenied, errReadOnly)
+	}
+
+	if len(req.Msg.Paths) > maxRemoveBatchSize {
+		return nil, connect.NewError(connect.CodeInvalidArgument, fmt.Errorf("too many paths (max %d)", maxRemoveBatchSize))
+	}
+
+	results := make([]*v1alpha1.RemoveBatchResponse_Result, 0, len(req.Msg.Paths))
+	for _, p := range req.Msg.Paths {
+		if err := ctx.Err(); err != nil {
+			return nil, connect.NewError(connect.CodeCanceled, err)
+		}
+
+		result := &v1alpha1.RemoveBatchResponse_Result{
+			Path: path.Clean(p),
+		}
+
+		// Guard against accidentally removing the entire bucket.
+		if p == "" || result.Path == "." || result.Path == "/" {
+			result.Error = "refusing to remove the root directory"
+		} else if err := s.remove(ctx, result.Path); err != nil {
+			result.Error = err.Error()
+		} else {
+			result.Ok = true
+
+			s.Changed(ctx, path.Dir(result.Path))
+		}
+
+		results = append(results, result)
+	}
+
+	return &connect.Response[v1alpha1.RemoveBatchResponse]{
+		Msg: &v1alpha1.RemoveBatchResponse{
+			Results: results,
+		},
+	}, nil
+}
+
+func (s *Server) Copy(ctx context.Context, req *connect.Request[v1alpha1.CopyRequest]) (*connect.Response[emptypb.Empty], error) {
+	if s.readOnly {
+		return nil, connect.NewError(connect.CodePermissionDenied, errReadOnly)
+	}
+
+	if req.Msg.SrcPath == "" || req.Msg.DstPath == "" {
+		return nil, connect.NewError(connect.CodeInvalidArgument, fmt.Errorf("missing required arguments"))
+	}
+
+	srcPath := path.Clean(req.Msg.SrcPath)
+	dstPath := path.Clean(req.Msg.DstPath)
+
+	if isWithin(dstPath, srcPath) {
+		return nil, connect.NewError(connect.CodeInvalidArgument, fmt.Errorf("cannot copy a file or directory into itself"))
+	}
+
+	if _, err := s.fsys.Stat(srcPath); err != nil {
+		if errors.Is(err, writablefs.ErrNotExist) {
+			return nil, connect.NewError(connect.CodeNotFound, err)
+		}
+
+		return nil, connect.NewError(connect.CodeInternal, err)
+	}
+
+	if err := s.checkIfMatch(dstPath, req.Msg.IfMatch); err != nil {
+		return nil, err
+	}
+
+	if !req.Msg.Force && req.Msg.IfMatch == "" {
+		if _, err := s.fsys.Stat(dstPath); err == nil {
+			return nil, connect.NewError(connect.CodeAlreadyExists, fmt.Errorf("destination already exists"))
+		} else if !errors.Is(err, writablefs.ErrNotExist) {
+			return nil, connect.NewError(connect.CodeInternal, err)
+		}
+	}
+
+	if err := s.copyTree(ctx, srcPath, dstPath); err != nil {
+		return nil, connect.NewError(connect.CodeInternal, fmt.Errorf("error copying: %w", err))
+	}
+
+	s.Changed(ctx, path.Dir(dstPath))
+
+	return &connect.Response[emptypb.Empty]{
+		Msg: &emptypb.Empty{},
+	}, nil
+}
+
+// copyTree recursively copies the file or directory at srcPath to dstPath.
+func (s *Server) copyTree(ctx context.Context, srcPath, dstPath string) error {
+	return fs.WalkDir(s.fsys, srcPath, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		relPath := strings.TrimPrefix(strings.TrimPrefix(p, srcPath), "/")
+		targetPath := path.Join(dstPath, relPath)
+
+		if d.IsDir() {
+			return s.fsys.MkdirAll(targetPath)
+		}
+
+		if err := s.fsys.MkdirAll(path.Dir(targetPath)); err != nil {
+			return err
+		}
+
+		return copyFile(s.fsys, p, targetPath)
+	})
+}
+
+func (s *Server) Rename(ctx context.Context, req *connect.Request[v1alpha1.RenameRequest]) (*connect.Response[emptypb.Empty], error) {
+	if s.readOnly {
+		return nil, connect.NewError(connect.CodePermissionDenied, errReadOnly)
+	}
+
+	if req.Msg.OldPath == "" || req.Msg.NewPath == "" {
+		return nil, connect.NewError(connect.CodeInvalidArgument, fmt.Errorf("missing required arguments"))
+	}
+
+	oldPath := path.Clean(req.Msg.OldPath)
+	newPath := path.Clean(req.Msg.NewPath)
+
+	if listingDir(oldPath) == "." {
+		return nil, connect.NewError(connect.CodeInvalidArgument, fmt.Errorf("refusing to rename the root directory"))
+	}
+
+	if isWithin(newPath, oldPath) {
+		return nil, connect.NewError(connect.CodeInvalidArgument, fmt.Errorf("cannot rename a file or directory into itself"))
+	}
+
+	if _, err := s.fsys.Stat(oldPath); err != nil {
+		if errors.Is(err, writablefs.ErrNotExist) {
+			return nil, connect.NewError(connect.CodeNotFound, err)
+		}
+
+		return nil, connect.NewError(connect.CodeInternal, err)
+	}
+
+	if err := s.checkIfMatch(newPath, req.Msg.IfMatch); err != nil {
+		return nil, err
+	}
+
+	if !req.Msg.Force && req.Msg.IfMatch == "" {
+		if _, err := s.fsys.Stat(newPath); err == nil {
+			return nil, connect.NewError(connect.CodeAlreadyExists, fmt.Errorf("new path already exists"))
+		} else if !errors.Is(err, writablefs.ErrNotExist) {
+			return nil, connect.NewError(connect.CodeInternal, err)
+		}
+	}
+
+	// Some filesystems won't create missing parent directories for us.
+	if err := s.fsys.MkdirAll(path.Dir(newPath)); err != nil {
+		return nil, connect.NewError(connect.CodeInternal, fmt.Errorf("error creating parent directory: %w", err))
+	}
+
+	if err := s.fsys.Rename(oldPath, newPath); err != nil {
 		return nil, connect.NewError(connect.CodeInternal, err)
 	}
 
+	s.Changed(ctx, path.Dir(oldPath), path.Dir(newPath))
+
 	return &connect.Response[emptypb.Empty]{
 		Msg: &emptypb.Empty{},
 	}, nil
 }
 
+func (s *Server) Move(ctx context.Context, req *connect.Request[v1alpha1.MoveRequest]) (*connect.Response[emptypb.Empty], error) {
+	if s.readOnly {
+		return nil, connect.NewError(connect.CodePermissionDenied, errReadOnly)
+	}
+
+	if req.Msg.SrcPath == "" || req.Msg.DstPath == "" {
+		return nil, connect.NewError(connect.CodeInvalidArgument, fmt.Errorf("missing required arguments"))
+	}
+
+	srcPath := path.Clean(req.Msg.SrcPath)
+	dstPath := path.Clean(req.Msg.DstPath)
+
+	// Guard against accidentally moving (and so removing) the entire bucket.
+	if listingDir(srcPath) == "." {
+		return nil, connect.NewError(connect.CodeInvalidArgument, fmt.Errorf("refusing to move the root directory"))
+	}
+
+	if isWithin(dstPath, srcPath) {
+		return nil, connect.NewError(connect.CodeInvalidArgument, fmt.Errorf("cannot move a file or directory into itself"))
+	}
+
+	if _, err := s.fsys.Stat(srcPath); err != nil {
+		if errors.Is(err, writablefs.ErrNotExist) {
+			return nil, connect.NewError(connect.CodeNotFound, err)
+		}
+
+		return nil, connect.NewError(connect.CodeInternal, err)
+	}
+
+	if err := s.checkIfMatch(dstPath, req.Msg.IfMatch); err != nil {
+		return nil, err
+	}
+
+	if !req.Msg.Force && req.Msg.IfMatch == "" {
+		if _, err := s.fsys.Stat(dstPath); err == nil {
+			return nil, connect.NewError(connect.CodeAlreadyExists, fmt.Errorf("destination already exists"))
+		} else if !errors.Is(err, writablefs.ErrNotExist) {
+			return nil, connect.NewError(connect.CodeInternal, err)
+		}
+	}
+
+	if err := s.move(ctx, srcPath, dstPath); err != nil {
+		return nil, connect.NewError(connect.CodeInternal, err)
+	}
+
+	s.Changed(ctx, path.Dir(srcPath), path.Dir(dstPath))
+
+	return &connect.Response[emptypb.Empty]{
+		Msg: &emptypb.Empty{},
+	}, nil
+}
+
+// move renames srcPath to dstPath, if the filesystem can't rename it (eg. a
+// directory on S3) it is copied and the source is then removed.
+func (s *Server) move(ctx context.Context, srcPath, dstPath string) error {
+	// Some filesystems won't create missing parent directories for us.
+	if err := s.fsys.MkdirAll(path.Dir(dstPath)); err != nil {
+		return fmt.Errorf("error creating parent directory: %w", err)
+	}
+
+	if err := s.fsys.Rename(srcPath, dstPath); err != nil {
+		s.logger.Debug("Rename failed, falling back to copy and remove",
+			"srcPath", srcPath, "dstPath", dstPath, "error", err)
+
+		// The source is left untouched if the copy fails.
+		if err := s.copyTree(ctx, srcPath, dstPath); err != nil {
+			return fmt.Errorf("error copying: %w", err)
+		}
+
+		if err := s.fsys.RemoveAll(srcPath); err != nil {
+			return fmt.Errorf("error removing source: %w", err)
+		}
+	}
+
+	return nil
+}
+
+func (s *Server) Usage(ctx context.Context, req *connect.Request[wrapperspb.StringValue]) (*connect.Response[v1alpha1.UsageResponse], error) {
+	root := path.Clean(req.Msg.Value)
+
+	var usage v1alpha1.UsageResponse
+
+	// WalkDir only reads a single directory at a time, so we never hold the whole tree in memory.
+	err := fs.WalkDir(s.fsys, root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		if d.IsDir() {
+			if p != root {
+				usage.DirCount++
+			}
+
+			return nil
+		}
+
+		fi, err := d.Info()
+		if err != nil {
+			return err
+		}
+
+		usage.FileCount++
+		usage.TotalBytes += fi.Size()
+
+		return nil
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, writablefs.ErrNotExist):
+			return nil, connect.NewError(connect.CodeNotFound, err)
+		case errors.Is(err, context.DeadlineExceeded):
+			return nil, connect.NewError(connect.CodeDeadlineExceeded, err)
+		case errors.Is(err, context.Canceled):
+			return nil, connect.NewError(connect.CodeCanceled, err)
+		default:
+			return nil, connect.NewError(connect.CodeInternal, err)
+		}
+	}
+
+	return &connect.Response[v1alpha1.UsageResponse]{
+		Msg: &usage,
+	}, nil
+}
+
+func (s *Server) Presign(ctx context.Context, req *connect.Request[v1alpha1.PresignRequest]) (*connect.Response[v1alpha1.PresignResponse], error) {
+	if s.presigner == nil {
+		return nil, connect.NewError(connect.CodeUnimplemented, fmt.Errorf("filesystem does not support presigned urls"))
+	}
+
+	if req.Msg.Path == "" {
+		return nil, connect.NewError(connect.CodeInvalidArgument, fmt.Errorf("missing required arguments"))
+	}
+
+	expiry := defaultPresignExpiry
+	if req.Msg.Expiry != nil {
+		if err := req.Msg.Expiry.CheckValid(); err != nil {
+			return nil, connect.NewError(connect.CodeInvalidArgument, fmt.Errorf("invalid expiry: %w", err))
+		}
+
+		expiry = req.Msg.Expiry.AsDuration()
+		if expiry <= 0 {
+			return nil, connect.NewError(connect.CodeInvalidArgument, fmt.Errorf("expiry must be positive"))
+		}
+	}
+
+	if expiry > s.maxPresignExpiry {
+		expiry = s.maxPresignExpiry
+	}
+
+	fi, err := s.fsys.Stat(req.Msg.Path)
+	if err != nil {
+		if errors.Is(err, writablefs.ErrNotExist) {
+			return nil, connect.NewError(connect.CodeNotFound, err)
+		}
+
+		return nil, connect.NewError(connect.CodeInternal, err)
+	}
+
+	if fi.IsDir() {
+		return nil, connect.NewError(connect.CodeInvalidArgument, fmt.Errorf("cannot presign a directory"))
+	}
+
+	expiresAt := time.Now().Add(expiry)
+
+	u, err := s.presigner.Presign(ctx, req.Msg.Path, expiry)
+	if err != nil {
+		return nil, connect.NewError(connect.CodeInternal, fmt.Errorf("error presigning url: %w", err))
+	}
+
+	return &connect.Response[v1alpha1.PresignResponse]{
+		Msg: &v1alpha1.PresignResponse{
+			Url:       u.String(),
+			ExpiresAt: timestamppb.New(expiresAt),
+		},
+	}, nil
+}
+
+func copyFile(fsys writablefs.FS, srcPath, dstPath string) error {
+	src, err := fsys.OpenFile(srcPath, writablefs.FlagReadOnly)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	dst, err := fsys.OpenFile(dstPath, writablefs.FlagWriteOnly|writablefs.FlagCreate)
+	if err != nil {
+		return err
+	}
+	defer dst.Close()
+
+	// In case we are overwriting an existing file.
+	if err := dst.Truncate(0); err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(dst, src); err != nil {
+		return err
+	}
+
+	return clearChecksum(dst)
+}
+
+// Changed invalidates any cached listings of the given directories and tells
+// anyone watching them that their contents may have changed.
+func (s *Server) Changed(ctx context.Context, dirs ...string) {
+	for _, dir := range dirs {
+		if err := s.readDirCache.Invalidate(ctx, listingDir(dir)); err != nil {
+			s.logger.Warn("Failed to invalidate cached listings", "dir", dir, "error", err)
+		}
+
+		s.watcher.Notify(dir)
+	}
+}
+
+// listingDir normalizes a directory path so that equivalent paths (eg. "",
+// "/" and ".") share the same cached listings.
+func listingDir(dir string) string {
+	return path.Clean(strings.TrimLeft(dir, "/"))
+}
+
+// isWithin reports whether p is dir, or is inside of it. Leading slashes are
+// ignored, as the filesystems treat "/a" and "a" as the same path.
+func isWithin(p, dir string) bool {
+	p, dir = listingDir(p), listingDir(dir)
+
+	return dir == "." || p == dir || strings.HasPrefix(p, dir+"/")
+}
+
+// listingCacheKey returns the cache key for a listing, so that listings
+// with different filters or orders don't collide.
+func listingCacheKey(id, filter string, sortBy v1alpha1.SortBy, order v1alpha1.SortOrder) string {
+	key := fmt.Sprintf("%s:%d:%d", id, sortBy, order)
+	if filter == "" {
+		return key
+	}
+
+	return key + ":" + filter
+}
+
+func sortFileInfos(fileInfos []*v1alpha1.FileInfo, sortBy v1alpha1.SortBy, order v1alpha1.SortOrder) {
+	less := func(a, b *v1alpha1.FileInfo) bool {
+		switch sortBy {
+		case v1alpha1.SortBy_SIZE:
+			if a.Size != b.Size {
+				return a.Size < b.Size
+			}
+		case v1alpha1.SortBy_MOD_TIME:
+			if !a.ModTime.AsTime().Equal(b.ModTime.AsTime()) {
+				return a.ModTime.AsTime().Before(b.ModTime.AsTime())
+			}
+		}
+
+		// Fallback to sorting by name.
+		return a.Name < b.Name
+	}
+
+	sort.SliceStable(fileInfos, func(i, j int) bool {
+		if order == v1alpha1.SortOrder_DESCENDING {
+			return less(fileInfos[j], fileInfos[i])
+		}
+
+		return less(fileInfos[i], fileInfos[j])
+	})
+}
+
 func toFileInfo(entry writablefs.DirEntry) (*v1alpha1.FileInfo, error) {
 	resp := &v1alpha1.FileInfo{
 		Name:  entry.Name(),
@@ -0,0 +1,1310 @@
+/* SPDX-License-Identifier: AGPL-3.0-or-later
+ *
+ * Copyright 2024 Damian Peckett <damian@pecke.tt>.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package filesystem_test
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"connectrpc.com/connect"
+	"github.com/bucket-sailor/bucketeer/internal/filesystem"
+	"github.com/bucket-sailor/bucketeer/internal/gen/filesystem/v1alpha1"
+	"github.com/bucket-sailor/bucketeer/internal/gen/filesystem/v1alpha1/v1alpha1connect"
+	"github.com/bucket-sailor/bucketeer/internal/util"
+	"github.com/bucket-sailor/writablefs"
+	"github.com/bucket-sailor/writablefs/dirfs"
+	"github.com/labstack/echo/v4"
+	"github.com/neilotoole/slogt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/http2"
+	"google.golang.org/protobuf/types/known/emptypb"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+func TestRename(t *testing.T) {
+	baseURL, serverDir := startServer(t, nil)
+
+	require.NoError(t, os.MkdirAll(filepath.Join(serverDir, "a"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(serverDir, "a", "b.txt"), []byte("hello"), 0o644))
+
+	ctx := context.Background()
+	client := v1alpha1connect.NewFilesystemClient(http.DefaultClient, baseURL+"/api/")
+
+	t.Run("Missing Parent Directories", func(t *testing.T) {
+		_, err := client.Rename(ctx, connect.NewRequest(&v1alpha1.RenameRequest{
+			OldPath: "a/b.txt",
+			NewPath: "c/d/b.txt",
+		}))
+		require.NoError(t, err)
+
+		assert.NoFileExists(t, filepath.Join(serverDir, "a", "b.txt"))
+
+		data, err := os.ReadFile(filepath.Join(serverDir, "c", "d", "b.txt"))
+		require.NoError(t, err)
+		assert.Equal(t, "hello", string(data))
+	})
+
+	t.Run("Not Found", func(t *testing.T) {
+		_, err := client.Rename(ctx, connect.NewRequest(&v1alpha1.RenameRequest{
+			OldPath: "a/b.txt",
+			NewPath: "e/b.txt",
+		}))
+		require.Error(t, err)
+		assert.Equal(t, connect.CodeNotFound, connect.CodeOf(err))
+	})
+
+	require.NoError(t, os.WriteFile(filepath.Join(serverDir, "a", "old.txt"), []byte("old"), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(serverDir, "a", "new.txt"), []byte("new"), 0o644))
+
+	t.Run("Already Exists", func(t *testing.T) {
+		_, err := client.Rename(ctx, connect.NewRequest(&v1alpha1.RenameRequest{
+			OldPath: "a/old.txt",
+			NewPath: "a/new.txt",
+		}))
+		require.Error(t, err)
+		assert.Equal(t, connect.CodeAlreadyExists, connect.CodeOf(err))
+
+		data, err := os.ReadFile(filepath.Join(serverDir, "a", "new.txt"))
+		require.NoError(t, err)
+		assert.Equal(t, "new", string(data))
+	})
+
+	t.Run("Force", func(t *testing.T) {
+		_, err := client.Rename(ctx, connect.NewRequest(&v1alpha1.RenameRequest{
+			OldPath: "a/old.txt",
+			NewPath: "a/new.txt",
+			Force:   true,
+		}))
+		require.NoError(t, err)
+
+		assert.NoFileExists(t, filepath.Join(serverDir, "a", "old.txt"))
+
+		data, err := os.ReadFile(filepath.Join(serverDir, "a", "new.txt"))
+		require.NoError(t, err)
+		assert.Equal(t, "old", string(data))
+	})
+
+	t.Run("Into Itself", func(t *testing.T) {
+		for _, newPath := range []string{"a/sub", "/a/sub", "a"} {
+			_, err := client.Rename(ctx, connect.NewRequest(&v1alpha1.RenameRequest{
+				OldPath: "a",
+				NewPath: newPath,
+			}))
+			require.Error(t, err, newPath)
+			assert.Equal(t, connect.CodeInvalidArgument, connect.CodeOf(err), newPath)
+		}
+
+		assert.DirExists(t, filepath.Join(serverDir, "a"))
+	})
+
+	t.Run("Root", func(t *testing.T) {
+		for _, oldPath := range []string{"/", ".", "//"} {
+			_, err := client.Rename(ctx, connect.NewRequest(&v1alpha1.RenameRequest{
+				OldPath: oldPath,
+				NewPath: "backup",
+			}))
+			require.Error(t, err, oldPath)
+			assert.Equal(t, connect.CodeInvalidArgument, connect.CodeOf(err), oldPath)
+		}
+
+		assert.FileExists(t, filepath.Join(serverDir, "a", "new.txt"))
+	})
+}
+
+func TestReadDirPage(t *testing.T) {
+	baseURL, serverDir := startServer(t, nil)
+
+	require.NoError(t, os.MkdirAll(filepath.Join(serverDir, "dir", "b"), 0o755))
+	for _, name := range []string{"a.txt", "c.txt", "d.txt", "e.txt"} {
+		require.NoError(t, os.WriteFile(filepath.Join(serverDir, "dir", name), []byte(name), 0o644))
+	}
+
+	ctx := context.Background()
+	client := v1alpha1connect.NewFilesystemClient(http.DefaultClient, baseURL+"/api/")
+
+	var listed []string
+	var token string
+	for pages := 0; ; pages++ {
+		require.Less(t, pages, 3)
+
+		resp, err := client.ReadDirPage(ctx, connect.NewRequest(&v1alpha1.ReadDirPageRequest{
+			Path:  "dir",
+			Token: token,
+			Limit: 2,
+		}))
+		require.NoError(t, err)
+
+		require.LessOrEqual(t, len(resp.Msg.Files), 2)
+		for _, fi := range resp.Msg.Files {
+			listed = append(listed, fi.Name)
+			assert.Equal(t, fi.Name == "b", fi.IsDir)
+		}
+
+		token = resp.Msg.NextToken
+		if token == "" {
+			break
+		}
+	}
+
+	assert.Equal(t, []string{"a.txt", "b", "c.txt", "d.txt", "e.txt"}, listed)
+
+	t.Run("Not Found", func(t *testing.T) {
+		_, err := client.ReadDirPage(ctx, connect.NewRequest(&v1alpha1.ReadDirPageRequest{
+			Path: "missing",
+		}))
+		require.Error(t, err)
+		assert.Equal(t, connect.CodeNotFound, connect.CodeOf(err))
+	})
+}
+
+func TestReadDirIndices(t *testing.T) {
+	baseURL, serverDir := startServer(t, nil)
+
+	require.NoError(t, os.MkdirAll(filepath.Join(serverDir, "dir"), 0o755))
+	for _, name := range []string{"a.txt", "b.txt", "c.txt"} {
+		require.NoError(t, os.WriteFile(filepath.Join(serverDir, "dir", name), []byte(name), 0o644))
+	}
+
+	ctx := context.Background()
+	client := v1alpha1connect.NewFilesystemClient(http.DefaultClient, baseURL+"/api/")
+
+	readDir := func(startIndex, stopIndex int64) ([]string, error) {
+		resp, err := client.ReadDir(ctx, connect.NewRequest(&v1alpha1.ReadDirRequest{
+			Path:       "dir",
+			StartIndex: startIndex,
+			StopIndex:  stopIndex,
+		}))
+		if err != nil {
+			return nil, err
+		}
+
+		var names []string
+		for _, fi := range resp.Msg.Files {
+			names = append(names, fi.FileInfo.Name)
+		}
+
+		return names, nil
+	}
+
+	t.Run("Start Beyond Length", func(t *testing.T) {
+		names, err := readDir(5, 10)
+		require.NoError(t, err)
+		assert.Empty(t, names)
+	})
+
+	t.Run("Stop Beyond Length", func(t *testing.T) {
+		names, err := readDir(1, 10)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"b.txt", "c.txt"}, names)
+	})
+
+	t.Run("Equal Indices", func(t *testing.T) {
+		names, err := readDir(1, 1)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"b.txt"}, names)
+	})
+
+	t.Run("Start After Stop", func(t *testing.T) {
+		_, err := readDir(2, 1)
+		require.Error(t, err)
+		assert.Equal(t, connect.CodeInvalidArgument, connect.CodeOf(err))
+	})
+}
+
+func TestReadDirInvalidation(t *testing.T) {
+	baseURL, serverDir := startServer(t, nil)
+
+	require.NoError(t, os.MkdirAll(filepath.Join(serverDir, "dir"), 0o755))
+	for _, name := range []string{"a.txt", "b.txt"} {
+		require.NoError(t, os.WriteFile(filepath.Join(serverDir, "dir", name), []byte(name), 0o644))
+	}
+
+	ctx := context.Background()
+	client := v1alpha1connect.NewFilesystemClient(http.DefaultClient, baseURL+"/api/")
+
+	readDir := func(id string) (string, []string) {
+		resp, err := client.ReadDir(ctx, connect.NewRequest(&v1alpha1.ReadDirRequest{
+			Id:   id,
+			Path: "dir",
+		}))
+		require.NoError(t, err)
+
+		var names []string
+		for _, fi := range resp.Msg.Files {
+			names = append(names, fi.FileInfo.Name)
+		}
+
+		return resp.Msg.Id, names
+	}
+
+	id, names := readDir("")
+	assert.Equal(t, []string{"a.txt", "b.txt"}, names)
+
+	t.Run("Remove", func(t *testing.T) {
+		_, err := client.RemoveAll(ctx, connect.NewRequest(wrapperspb.String("dir/a.txt")))
+		require.NoError(t, err)
+
+		_, names := readDir(id)
+		assert.Equal(t, []string{"b.txt"}, names)
+	})
+
+	t.Run("Mkdir", func(t *testing.T) {
+		_, err := client.MkdirAll(ctx, connect.NewRequest(wrapperspb.String("dir/c")))
+		require.NoError(t, err)
+
+		_, names := readDir(id)
+		assert.Equal(t, []string{"b.txt", "c"}, names)
+	})
+
+	t.Run("Rename", func(t *testing.T) {
+		_, err := client.Rename(ctx, connect.NewRequest(&v1alpha1.RenameRequest{
+			OldPath: "dir/b.txt",
+			NewPath: "other/b.txt",
+		}))
+		require.NoError(t, err)
+
+		_, names := readDir(id)
+		assert.Equal(t, []string{"c"}, names)
+	})
+}
+
+func TestReadDirOrder(t *testing.T) {
+	baseURL, serverDir := startServer(t, nil)
+
+	require.NoError(t, os.MkdirAll(filepath.Join(serverDir, "dir"), 0o755))
+	for name, size := range map[string]int{"a.txt": 3, "b.txt": 1, "c.txt": 2} {
+		require.NoError(t, os.WriteFile(filepath.Join(serverDir, "dir", name), make([]byte, size), 0o644))
+	}
+
+	ctx := context.Background()
+	client := v1alpha1connect.NewFilesystemClient(http.DefaultClient, baseURL+"/api/")
+
+	readDir := func(id string, sortBy v1alpha1.SortBy, order v1alpha1.SortOrder) (string, []string) {
+		resp, err := client.ReadDir(ctx, connect.NewRequest(&v1alpha1.ReadDirRequest{
+			Id:     id,
+			Path:   "dir",
+			SortBy: sortBy,
+			Order:  order,
+		}))
+		require.NoError(t, err)
+
+		var names []string
+		for _, fi := range resp.Msg.Files {
+			names = append(names, fi.FileInfo.Name)
+		}
+
+		return resp.Msg.Id, names
+	}
+
+	id, names := readDir("", v1alpha1.SortBy_NAME, v1alpha1.SortOrder_ASCENDING)
+	assert.Equal(t, []string{"a.txt", "b.txt", "c.txt"}, names)
+
+	// The same listing, in different orders.
+	_, names = readDir(id, v1alpha1.SortBy_NAME, v1alpha1.SortOrder_DESCENDING)
+	assert.Equal(t, []string{"c.txt", "b.txt", "a.txt"}, names)
+
+	_, names = readDir(id, v1alpha1.SortBy_SIZE, v1alpha1.SortOrder_ASCENDING)
+	assert.Equal(t, []string{"b.txt", "c.txt", "a.txt"}, names)
+
+	_, names = readDir(id, v1alpha1.SortBy_NAME, v1alpha1.SortOrder_ASCENDING)
+	assert.Equal(t, []string{"a.txt", "b.txt", "c.txt"}, names)
+}
+
+func TestReadDirCacheTTL(t *testing.T) {
+	baseURL, serverDir := startServer(t, &filesystem.ServerOptions{
+		ReadDirCacheTTL: 500 * time.Millisecond,
+	})
+
+	require.NoError(t, os.MkdirAll(filepath.Join(serverDir, "dir"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(serverDir, "dir", "a.txt"), []byte("a"), 0o644))
+
+	ctx := context.Background()
+	client := v1alpha1connect.NewFilesystemClient(http.DefaultClient, baseURL+"/api/")
+
+	readDir := func(id string) (string, int) {
+		resp, err := client.ReadDir(ctx, connect.NewRequest(&v1alpha1.ReadDirRequest{
+			Id:   id,
+			Path: "dir",
+		}))
+		require.NoError(t, err)
+
+		return resp.Msg.Id, len(resp.Msg.Files)
+	}
+
+	id, n := readDir("")
+	require.Equal(t, 1, n)
+
+	// Changed outside of bucketeer, so the cached listing isn't invalidated.
+	require.NoError(t, os.WriteFile(filepath.Join(serverDir, "dir", "b.txt"), []byte("b"), 0o644))
+
+	_, n = readDir(id)
+	assert.Equal(t, 1, n)
+
+	assert.Eventually(t, func() bool {
+		_, n := readDir(id)
+		return n == 2
+	}, 5*time.Second, 100*time.Millisecond)
+}
+
+func TestList(t *testing.T) {
+	baseURL, serverDir := startServer(t, nil)
+
+	require.NoError(t, os.MkdirAll(filepath.Join(serverDir, "dir", "b"), 0o755))
+	for _, name := range []string{"a.txt", "c.txt", "d.log"} {
+		require.NoError(t, os.WriteFile(filepath.Join(serverDir, "dir", name), []byte(name), 0o644))
+	}
+
+	list := func(accept string, query url.Values) *http.Response {
+		req, err := http.NewRequest(http.MethodGet, baseURL+"/api/v1alpha1/fs/list?"+query.Encode(), nil)
+		require.NoError(t, err)
+
+		if accept != "" {
+			req.Header.Set("Accept", accept)
+		}
+
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		t.Cleanup(func() {
+			resp.Body.Close()
+		})
+
+		return resp
+	}
+
+	readLines := func(t *testing.T, resp *http.Response) map[string]bool {
+		listed := map[string]bool{}
+
+		scanner := bufio.NewScanner(resp.Body)
+		for scanner.Scan() {
+			var fi map[string]any
+			require.NoError(t, json.Unmarshal(scanner.Bytes(), &fi))
+
+			isDir, _ := fi["isDir"].(bool)
+			listed[fi["name"].(string)] = isDir
+		}
+		require.NoError(t, scanner.Err())
+
+		return listed
+	}
+
+	t.Run("Stream", func(t *testing.T) {
+		resp := list("application/x-ndjson", url.Values{"path": {"dir"}})
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, "application/x-ndjson", resp.Header.Get("Content-Type"))
+
+		assert.Equal(t, map[string]bool{"a.txt": false, "b": true, "c.txt": false, "d.log": false}, readLines(t, resp))
+	})
+
+	t.Run("Stream Filter", func(t *testing.T) {
+		resp := list("application/json, application/x-ndjson;q=0.9", url.Values{"path": {"dir"}, "filter": {"*.txt"}})
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+
+		assert.Equal(t, map[string]bool{"a.txt": false, "c.txt": false}, readLines(t, resp))
+	})
+
+	t.Run("Paginated", func(t *testing.T) {
+		resp := list("", url.Values{"path": {"dir"}, "start": {"1"}, "stop": {"2"}})
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, "application/json", resp.Header.Get("Content-Type"))
+
+		var listing struct {
+			ID    string `json:"id"`
+			Files []struct {
+				Index    string `json:"index"`
+				FileInfo struct {
+					Name string `json:"name"`
+				} `json:"fileInfo"`
+			} `json:"files"`
+		}
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&listing))
+
+		require.NotEmpty(t, listing.ID)
+		require.Len(t, listing.Files, 2)
+		assert.Equal(t, "b", listing.Files[0].FileInfo.Name)
+		assert.Equal(t, "c.txt", listing.Files[1].FileInfo.Name)
+	})
+
+	t.Run("Not Found", func(t *testing.T) {
+		for _, accept := range []string{"", "application/x-ndjson"} {
+			resp := list(accept, url.Values{"path": {"missing"}})
+			assert.Equal(t, http.StatusNotFound, resp.StatusCode, accept)
+		}
+	})
+
+	t.Run("Invalid Filter", func(t *testing.T) {
+		resp := list("application/x-ndjson", url.Values{"path": {"dir"}, "filter": {"["}})
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	})
+}
+
+func TestRemove(t *testing.T) {
+	baseURL, serverDir := startServer(t, nil)
+
+	require.NoError(t, os.MkdirAll(filepath.Join(serverDir, "dir"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(serverDir, "dir", "a.txt"), []byte("a"), 0o644))
+
+	remove := func(p string) int {
+		req, err := http.NewRequest(http.MethodDelete, baseURL+"/api/v1alpha1/fs?path="+url.QueryEscape(p), nil)
+		require.NoError(t, err)
+
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		resp.Body.Close()
+
+		return resp.StatusCode
+	}
+
+	assert.Equal(t, http.StatusNoContent, remove("dir"))
+	assert.NoDirExists(t, filepath.Join(serverDir, "dir"))
+
+	t.Run("Not Found", func(t *testing.T) {
+		assert.Equal(t, http.StatusNotFound, remove("missing.txt"))
+	})
+
+	t.Run("RPC Not Found", func(t *testing.T) {
+		client := v1alpha1connect.NewFilesystemClient(http.DefaultClient, baseURL+"/api/")
+
+		_, err := client.RemoveAll(context.Background(), connect.NewRequest(wrapperspb.String("missing.txt")))
+		require.Error(t, err)
+		assert.Equal(t, connect.CodeNotFound, connect.CodeOf(err))
+	})
+
+	t.Run("Root", func(t *testing.T) {
+		assert.Equal(t, http.StatusBadRequest, remove("/"))
+		assert.DirExists(t, serverDir)
+	})
+}
+
+func TestRemoveBatch(t *testing.T) {
+	baseURL, serverDir := startServer(t, nil)
+
+	require.NoError(t, os.MkdirAll(filepath.Join(serverDir, "dir"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(serverDir, "dir", "a.txt"), []byte("a"), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(serverDir, "b.txt"), []byte("b"), 0o644))
+
+	ctx := context.Background()
+	client := v1alpha1connect.NewFilesystemClient(http.DefaultClient, baseURL+"/api/")
+
+	resp, err := client.RemoveBatch(ctx, connect.NewRequest(&v1alpha1.RemoveBatchRequest{
+		Paths: []string{"dir/", "b.txt", "/"},
+	}))
+	require.NoError(t, err)
+
+	require.Len(t, resp.Msg.Results, 3)
+
+	assert.Equal(t, "dir", resp.Msg.Results[0].Path)
+	assert.True(t, resp.Msg.Results[0].Ok)
+	assert.True(t, resp.Msg.Results[1].Ok)
+	assert.False(t, resp.Msg.Results[2].Ok)
+	assert.NotEmpty(t, resp.Msg.Results[2].Error)
+
+	assert.NoDirExists(t, filepath.Join(serverDir, "dir"))
+	assert.NoFileExists(t, filepath.Join(serverDir, "b.txt"))
+	assert.DirExists(t, serverDir)
+
+	t.Run("Too Many Paths", func(t *testing.T) {
+		_, err := client.RemoveBatch(ctx, connect.NewRequest(&v1alpha1.RemoveBatchRequest{
+			Paths: make([]string, 1001),
+		}))
+		require.Error(t, err)
+		assert.Equal(t, connect.CodeInvalidArgument, connect.CodeOf(err))
+	})
+}
+
+func TestTouch(t *testing.T) {
+	baseURL, serverDir := startServer(t, nil)
+
+	ctx := context.Background()
+	client := v1alpha1connect.NewFilesystemClient(http.DefaultClient, baseURL+"/api/")
+
+	t.Run("Create", func(t *testing.T) {
+		_, err := client.Touch(ctx, connect.NewRequest(&v1alpha1.TouchRequest{
+			Path: "some/dir/../dir/.keep",
+		}))
+		require.NoError(t, err)
+
+		fi, err := os.Stat(filepath.Join(serverDir, "some", "dir", ".keep"))
+		require.NoError(t, err)
+		assert.Zero(t, fi.Size())
+	})
+
+	require.NoError(t, os.WriteFile(filepath.Join(serverDir, "existing.txt"), []byte("Hello, World!"), 0o644))
+
+	t.Run("Already Exists", func(t *testing.T) {
+		_, err := client.Touch(ctx, connect.NewRequest(&v1alpha1.TouchRequest{
+			Path: "existing.txt",
+		}))
+		require.Error(t, err)
+		assert.Equal(t, connect.CodeAlreadyExists, connect.CodeOf(err))
+
+		data, err := os.ReadFile(filepath.Join(serverDir, "existing.txt"))
+		require.NoError(t, err)
+		assert.Equal(t, "Hello, World!", string(data))
+	})
+
+	t.Run("Force", func(t *testing.T) {
+		_, err := client.Touch(ctx, connect.NewRequest(&v1alpha1.TouchRequest{
+			Path:  "existing.txt",
+			Force: true,
+		}))
+		require.NoError(t, err)
+
+		fi, err := os.Stat(filepath.Join(serverDir, "existing.txt"))
+		require.NoError(t, err)
+		assert.Zero(t, fi.Size())
+	})
+
+	t.Run("Directory", func(t *testing.T) {
+		_, err := client.Touch(ctx, connect.NewRequest(&v1alpha1.TouchRequest{
+			Path:  "some/dir",
+			Force: true,
+		}))
+		require.Error(t, err)
+		assert.Equal(t, connect.CodeAlreadyExists, connect.CodeOf(err))
+	})
+}
+
+func TestCopy(t *testing.T) {
+	baseURL, serverDir := startServer(t, nil)
+
+	for _, dir := range []string{"src", "existing"} {
+		require.NoError(t, os.MkdirAll(filepath.Join(serverDir, dir, "sub"), 0o755))
+		require.NoError(t, os.WriteFile(filepath.Join(serverDir, dir, "sub", dir+".txt"), []byte(dir), 0o644))
+	}
+
+	ctx := context.Background()
+	client := v1alpha1connect.NewFilesystemClient(http.DefaultClient, baseURL+"/api/")
+
+	t.Run("Directory", func(t *testing.T) {
+		_, err := client.Copy(ctx, connect.NewRequest(&v1alpha1.CopyRequest{
+			SrcPath: "src",
+			DstPath: "other/src",
+		}))
+		require.NoError(t, err)
+
+		data, err := os.ReadFile(filepath.Join(serverDir, "other", "src", "sub", "src.txt"))
+		require.NoError(t, err)
+		assert.Equal(t, "src", string(data))
+
+		assert.FileExists(t, filepath.Join(serverDir, "src", "sub", "src.txt"))
+	})
+
+	t.Run("Already Exists", func(t *testing.T) {
+		_, err := client.Copy(ctx, connect.NewRequest(&v1alpha1.CopyRequest{
+			SrcPath: "src",
+			DstPath: "existing",
+		}))
+		require.Error(t, err)
+		assert.Equal(t, connect.CodeAlreadyExists, connect.CodeOf(err))
+	})
+
+	t.Run("Into Itself", func(t *testing.T) {
+		for _, dstPath := range []string{"src/sub", "/src/sub", "src"} {
+			_, err := client.Copy(ctx, connect.NewRequest(&v1alpha1.CopyRequest{
+				SrcPath: "src",
+				DstPath: dstPath,
+			}))
+			require.Error(t, err)
+			assert.Equal(t, connect.CodeInvalidArgument, connect.CodeOf(err))
+		}
+
+		assert.NoDirExists(t, filepath.Join(serverDir, "src", "sub", "sub"))
+	})
+
+	t.Run("Root", func(t *testing.T) {
+		_, err := client.Copy(ctx, connect.NewRequest(&v1alpha1.CopyRequest{
+			SrcPath: "/",
+			DstPath: "backup",
+		}))
+		require.Error(t, err)
+		assert.Equal(t, connect.CodeInvalidArgument, connect.CodeOf(err))
+	})
+}
+
+func TestMove(t *testing.T) {
+	baseURL, serverDir := startServer(t, nil)
+
+	for _, dir := range []string{"src", "existing"} {
+		require.NoError(t, os.MkdirAll(filepath.Join(serverDir, dir, "sub"), 0o755))
+		require.NoError(t, os.WriteFile(filepath.Join(serverDir, dir, "sub", dir+".txt"), []byte(dir), 0o644))
+	}
+
+	ctx := context.Background()
+	client := v1alpha1connect.NewFilesystemClient(http.DefaultClient, baseURL+"/api/")
+
+	t.Run("Directory", func(t *testing.T) {
+		_, err := client.Move(ctx, connect.NewRequest(&v1alpha1.MoveRequest{
+			SrcPath: "src",
+			DstPath: "other/prefix/src",
+		}))
+		require.NoError(t, err)
+
+		data, err := os.ReadFile(filepath.Join(serverDir, "other", "prefix", "src", "sub", "src.txt"))
+		require.NoError(t, err)
+		assert.Equal(t, "src", string(data))
+
+		_, err = os.Stat(filepath.Join(serverDir, "src"))
+		assert.True(t, os.IsNotExist(err))
+	})
+
+	t.Run("Already Exists", func(t *testing.T) {
+		_, err := client.Move(ctx, connect.NewRequest(&v1alpha1.MoveRequest{
+			SrcPath: "other/prefix/src",
+			DstPath: "existing",
+		}))
+		require.Error(t, err)
+		assert.Equal(t, connect.CodeAlreadyExists, connect.CodeOf(err))
+	})
+
+	t.Run("Copy And Remove", func(t *testing.T) {
+		// Renaming onto a non-empty directory fails, so the contents are
+		// copied instead.
+		_, err := client.Move(ctx, connect.NewRequest(&v1alpha1.MoveRequest{
+			SrcPath: "other/prefix/src",
+			DstPath: "existing",
+			Force:   true,
+		}))
+		require.NoError(t, err)
+
+		for _, name := range []string{"src.txt", "existing.txt"} {
+			_, err := os.Stat(filepath.Join(serverDir, "existing", "sub", name))
+			require.NoError(t, err)
+		}
+
+		_, err = os.Stat(filepath.Join(serverDir, "other", "prefix", "src"))
+		assert.True(t, os.IsNotExist(err))
+	})
+
+	t.Run("Into Itself", func(t *testing.T) {
+		_, err := client.Move(ctx, connect.NewRequest(&v1alpha1.MoveRequest{
+			SrcPath: "existing",
+			DstPath: "existing/sub",
+		}))
+		require.Error(t, err)
+		assert.Equal(t, connect.CodeInvalidArgument, connect.CodeOf(err))
+	})
+
+	t.Run("Into Itself With Leading Slash", func(t *testing.T) {
+		_, err := client.Move(ctx, connect.NewRequest(&v1alpha1.MoveRequest{
+			SrcPath: "existing",
+			DstPath: "/existing/sub",
+		}))
+		require.Error(t, err)
+		assert.Equal(t, connect.CodeInvalidArgument, connect.CodeOf(err))
+	})
+
+	t.Run("Root", func(t *testing.T) {
+		for _, srcPath := range []string{"/", ".", "//"} {
+			_, err := client.Move(ctx, connect.NewRequest(&v1alpha1.MoveRequest{
+				SrcPath: srcPath,
+				DstPath: "backup",
+			}))
+			require.Error(t, err)
+			assert.Equal(t, connect.CodeInvalidArgument, connect.CodeOf(err))
+		}
+
+		assert.DirExists(t, filepath.Join(serverDir, "existing"))
+		assert.NoDirExists(t, filepath.Join(serverDir, "backup"))
+	})
+
+	t.Run("Not Found", func(t *testing.T) {
+		_, err := client.Move(ctx, connect.NewRequest(&v1alpha1.MoveRequest{
+			SrcPath: "missing",
+			DstPath: "elsewhere",
+		}))
+		require.Error(t, err)
+		assert.Equal(t, connect.CodeNotFound, connect.CodeOf(err))
+	})
+}
+
+func TestTrash(t *testing.T) {
+	baseURL, serverDir := startServer(t, &filesystem.ServerOptions{
+		TrashPrefix: ".trash/",
+	})
+
+	require.NoError(t, os.MkdirAll(filepath.Join(serverDir, "dir", "sub"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(serverDir, "dir", "sub", "test.txt"), []byte("test"), 0o644))
+
+	ctx := context.Background()
+	client := v1alpha1connect.NewFilesystemClient(http.DefaultClient, baseURL+"/api/")
+
+	var trashPath string
+
+	t.Run("Remove", func(t *testing.T) {
+		_, err := client.RemoveAll(ctx, connect.NewRequest(wrapperspb.String("dir/sub")))
+		require.NoError(t, err)
+
+		_, err = os.Stat(filepath.Join(serverDir, "dir", "sub"))
+		assert.True(t, os.IsNotExist(err))
+
+		matches, err := filepath.Glob(filepath.Join(serverDir, ".trash", "dir", "sub~*"))
+		require.NoError(t, err)
+		require.Len(t, matches, 1)
+
+		data, err := os.ReadFile(filepath.Join(matches[0], "test.txt"))
+		require.NoError(t, err)
+		assert.Equal(t, "test", string(data))
+
+		trashPath, err = filepath.Rel(serverDir, matches[0])
+		require.NoError(t, err)
+	})
+
+	t.Run("Restore", func(t *testing.T) {
+		resp, err := client.Restore(ctx, connect.NewRequest(&v1alpha1.RestoreRequest{
+			Path: trashPath,
+		}))
+		require.NoError(t, err)
+
+		assert.Equal(t, "dir/sub", resp.Msg.Path)
+
+		data, err := os.ReadFile(filepath.Join(serverDir, "dir", "sub", "test.txt"))
+		require.NoError(t, err)
+		assert.Equal(t, "test", string(data))
+	})
+
+	t.Run("Not In Trash", func(t *testing.T) {
+		_, err := client.Restore(ctx, connect.NewRequest(&v1alpha1.RestoreRequest{
+			Path: "dir/sub",
+		}))
+		require.Error(t, err)
+		assert.Equal(t, connect.CodeInvalidArgument, connect.CodeOf(err))
+	})
+
+	t.Run("Empty Trash", func(t *testing.T) {
+		_, err := client.RemoveAll(ctx, connect.NewRequest(wrapperspb.String("dir")))
+		require.NoError(t, err)
+
+		_, err = client.EmptyTrash(ctx, connect.NewRequest(&emptypb.Empty{}))
+		require.NoError(t, err)
+
+		_, err = os.Stat(filepath.Join(serverDir, ".trash"))
+		assert.True(t, os.IsNotExist(err))
+	})
+
+	t.Run("Contains Trash", func(t *testing.T) {
+		baseURL, serverDir := startServer(t, &filesystem.ServerOptions{
+			TrashPrefix: "data/.trash",
+		})
+
+		require.NoError(t, os.MkdirAll(filepath.Join(serverDir, "data", ".trash"), 0o755))
+		require.NoError(t, os.WriteFile(filepath.Join(serverDir, "data", "test.txt"), []byte("test"), 0o644))
+
+		client := v1alpha1connect.NewFilesystemClient(http.DefaultClient, baseURL+"/api/")
+
+		for _, p := range []string{"data", "/data"} {
+			_, err := client.RemoveAll(ctx, connect.NewRequest(wrapperspb.String(p)))
+			require.Error(t, err, p)
+			assert.Equal(t, connect.CodeFailedPrecondition, connect.CodeOf(err), p)
+		}
+
+		assert.FileExists(t, filepath.Join(serverDir, "data", "test.txt"))
+		assert.DirExists(t, filepath.Join(serverDir, "data", ".trash"))
+	})
+
+	t.Run("Disabled", func(t *testing.T) {
+		baseURL, _ := startServer(t, nil)
+
+		client := v1alpha1connect.NewFilesystemClient(http.DefaultClient, baseURL+"/api/")
+
+		_, err := client.EmptyTrash(ctx, connect.NewRequest(&emptypb.Empty{}))
+		require.Error(t, err)
+		assert.Equal(t, connect.CodeFailedPrecondition, connect.CodeOf(err))
+	})
+}
+
+func TestIfMatch(t *testing.T) {
+	baseURL, serverDir := startServer(t, nil)
+
+	for _, name := range []string{"src.txt", "dst.txt"} {
+		require.NoError(t, os.WriteFile(filepath.Join(serverDir, name), []byte(name), 0o644))
+	}
+
+	ctx := context.Background()
+	client := v1alpha1connect.NewFilesystemClient(http.DefaultClient, baseURL+"/api/")
+
+	statResp, err := client.Stat(ctx, connect.NewRequest(wrapperspb.String("dst.txt")))
+	require.NoError(t, err)
+
+	etag := statResp.Msg.Etag
+	require.NotEmpty(t, etag)
+
+	t.Run("Copy Mismatch", func(t *testing.T) {
+		_, err := client.Copy(ctx, connect.NewRequest(&v1alpha1.CopyRequest{
+			SrcPath: "src.txt",
+			DstPath: "dst.txt",
+			IfMatch: `W/"0-0"`,
+		}))
+		require.Error(t, err)
+		assert.Equal(t, connect.CodeFailedPrecondition, connect.CodeOf(err))
+
+		data, err := os.ReadFile(filepath.Join(serverDir, "dst.txt"))
+		require.NoError(t, err)
+		assert.Equal(t, "dst.txt", string(data))
+	})
+
+	t.Run("Rename Missing Destination", func(t *testing.T) {
+		_, err := client.Rename(ctx, connect.NewRequest(&v1alpha1.RenameRequest{
+			OldPath: "src.txt",
+			NewPath: "missing.txt",
+			IfMatch: etag,
+		}))
+		require.Error(t, err)
+		assert.Equal(t, connect.CodeFailedPrecondition, connect.CodeOf(err))
+	})
+
+	t.Run("Copy Match", func(t *testing.T) {
+		_, err := client.Copy(ctx, connect.NewRequest(&v1alpha1.CopyRequest{
+			SrcPath: "src.txt",
+			DstPath: "dst.txt",
+			IfMatch: etag,
+		}))
+		require.NoError(t, err)
+
+		data, err := os.ReadFile(filepath.Join(serverDir, "dst.txt"))
+		require.NoError(t, err)
+		assert.Equal(t, "src.txt", string(data))
+	})
+}
+
+func TestStaleChecksum(t *testing.T) {
+	baseURL, serverDir := startServer(t, nil)
+
+	ctx := context.Background()
+	client := v1alpha1connect.NewFilesystemClient(http.DefaultClient, baseURL+"/api/")
+
+	fsys, err := dirfs.New(serverDir)
+	require.NoError(t, err)
+
+	// As stored by the checksum server.
+	storeChecksum := func(t *testing.T, p string) {
+		f, err := fsys.OpenFile(p, writablefs.FlagReadWrite)
+		require.NoError(t, err)
+		defer f.Close()
+
+		xattrs, err := f.XAttrs()
+		require.NoError(t, err)
+
+		require.NoError(t, xattrs.Set("bucketeer.checksum", []byte("sha256:0000")))
+		require.NoError(t, xattrs.Sync())
+	}
+
+	statEtag := func(t *testing.T, p string) string {
+		resp, err := client.Stat(ctx, connect.NewRequest(wrapperspb.String(p)))
+		require.NoError(t, err)
+
+		return resp.Msg.Etag
+	}
+
+	for _, name := range []string{"src.txt", "dst.txt"} {
+		require.NoError(t, os.WriteFile(filepath.Join(serverDir, name), []byte(name), 0o644))
+	}
+
+	t.Run("Touch", func(t *testing.T) {
+		storeChecksum(t, "dst.txt")
+		require.Equal(t, `"sha256:0000"`, statEtag(t, "dst.txt"))
+
+		_, err := client.Touch(ctx, connect.NewRequest(&v1alpha1.TouchRequest{
+			Path:  "dst.txt",
+			Force: true,
+		}))
+		require.NoError(t, err)
+
+		assert.True(t, strings.HasPrefix(statEtag(t, "dst.txt"), "W/"))
+	})
+
+	t.Run("Copy", func(t *testing.T) {
+		storeChecksum(t, "dst.txt")
+
+		_, err := client.Copy(ctx, connect.NewRequest(&v1alpha1.CopyRequest{
+			SrcPath: "src.txt",
+			DstPath: "dst.txt",
+			Force:   true,
+		}))
+		require.NoError(t, err)
+
+		assert.True(t, strings.HasPrefix(statEtag(t, "dst.txt"), "W/"))
+	})
+}
+
+func TestInfo(t *testing.T) {
+	baseURL, serverDir := startServer(t, nil)
+
+	require.NoError(t, os.WriteFile(filepath.Join(serverDir, "a.txt"), []byte("hello"), 0o644))
+
+	modTime := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	require.NoError(t, os.Chtimes(filepath.Join(serverDir, "a.txt"), modTime, modTime))
+
+	infoURL := func(p string) string {
+		return baseURL + "/api/v1alpha1/fs/info?path=" + url.QueryEscape(p)
+	}
+
+	t.Run("Head", func(t *testing.T) {
+		resp, err := http.Head(infoURL("a.txt"))
+		require.NoError(t, err)
+		defer resp.Body.Close()
+
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, int64(5), resp.ContentLength)
+		assert.Equal(t, modTime.Format(http.TimeFormat), resp.Header.Get("Last-Modified"))
+
+		body, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		assert.Empty(t, body)
+	})
+
+	t.Run("Get", func(t *testing.T) {
+		resp, err := http.Get(infoURL("a.txt"))
+		require.NoError(t, err)
+		defer resp.Body.Close()
+
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, modTime.Format(http.TimeFormat), resp.Header.Get("Last-Modified"))
+
+		var info map[string]any
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&info))
+		assert.Equal(t, "a.txt", info["name"])
+		assert.Equal(t, "5", info["size"])
+	})
+
+	t.Run("Not Found", func(t *testing.T) {
+		for _, method := range []string{http.MethodGet, http.MethodHead} {
+			req, err := http.NewRequest(method, infoURL("missing.txt"), nil)
+			require.NoError(t, err)
+
+			resp, err := http.DefaultClient.Do(req)
+			require.NoError(t, err)
+			resp.Body.Close()
+
+			assert.Equal(t, http.StatusNotFound, resp.StatusCode, method)
+		}
+	})
+}
+
+func TestCapabilities(t *testing.T) {
+	baseURL, _ := startServer(t, &filesystem.ServerOptions{
+		ReadOnly: true,
+	})
+
+	resp, err := http.Get(baseURL + "/api/v1alpha1/fs/capabilities")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	var capabilities filesystem.Capabilities
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&capabilities))
+
+	assert.Equal(t, filesystem.Capabilities{
+		Rename:   true,
+		Archive:  true,
+		XAttrs:   true,
+		ReadOnly: true,
+	}, capabilities)
+}
+
+func TestPreview(t *testing.T) {
+	baseURL, serverDir := startServer(t, nil)
+
+	text := strings.Repeat("Hello, World!\n", 1000)
+	require.NoError(t, os.WriteFile(filepath.Join(serverDir, "test.txt"), []byte(text), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(serverDir, "test.bin"), []byte{0x00, 0x01, 0x02, 0xff}, 0o644))
+
+	preview := func(t *testing.T, query string) (*http.Response, string) {
+		resp, err := http.Get(baseURL + "/api/v1alpha1/fs/preview?" + query)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+
+		body, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+
+		return resp, string(body)
+	}
+
+	t.Run("Whole File", func(t *testing.T) {
+		resp, body := preview(t, "path=test.txt")
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+
+		assert.Equal(t, "text/plain; charset=utf-8", resp.Header.Get("Content-Type"))
+		assert.Empty(t, resp.Header.Get("X-Truncated"))
+		assert.Equal(t, text, body)
+	})
+
+	t.Run("Truncated", func(t *testing.T) {
+		resp, body := preview(t, "path=test.txt&maxBytes=100")
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+
+		assert.Equal(t, "true", resp.Header.Get("X-Truncated"))
+		assert.Equal(t, text[:100], body)
+	})
+
+	t.Run("Binary", func(t *testing.T) {
+		resp, _ := preview(t, "path=test.bin")
+		assert.Equal(t, http.StatusUnsupportedMediaType, resp.StatusCode)
+	})
+
+	t.Run("Invalid Max Bytes", func(t *testing.T) {
+		resp, _ := preview(t, "path=test.txt&maxBytes=-1")
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	})
+
+	t.Run("Not Found", func(t *testing.T) {
+		resp, _ := preview(t, "path=missing.txt")
+		assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+	})
+}
+
+func TestWatch(t *testing.T) {
+	baseURL, serverDir := startServer(t, nil)
+
+	require.NoError(t, os.MkdirAll(filepath.Join(serverDir, "dir"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(serverDir, "dir", "a.txt"), []byte("a"), 0o644))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, baseURL+"/api/v1alpha1/fs/watch?path=dir", nil)
+	require.NoError(t, err)
+
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_ = resp.Body.Close()
+	})
+
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+
+	type event struct {
+		event string
+		data  filesystem.WatchEvent
+	}
+
+	events := make(chan event)
+	go func() {
+		defer close(events)
+
+		var ev event
+		scanner := bufio.NewScanner(resp.Body)
+		for scanner.Scan() {
+			line := scanner.Text()
+			switch {
+			case strings.HasPrefix(line, "event: "):
+				ev.event = strings.TrimPrefix(line, "event: ")
+			case strings.HasPrefix(line, "data: "):
+				_ = json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &ev.data)
+			case line == "":
+				events <- ev
+				ev = event{}
+			}
+		}
+	}()
+
+	waitForEvent := func(t *testing.T, expected event) {
+		timeout := time.After(5 * time.Second)
+		for {
+			select {
+			case ev, ok := <-events:
+				require.True(t, ok, "event stream closed")
+				if ev == expected {
+					return
+				}
+			case <-timeout:
+				t.Fatalf("timed out waiting for event: %v", expected)
+			}
+		}
+	}
+
+	client := v1alpha1connect.NewFilesystemClient(http.DefaultClient, baseURL+"/api/")
+
+	_, err = client.MkdirAll(ctx, connect.NewRequest(wrapperspb.String("dir/sub")))
+	require.NoError(t, err)
+
+	waitForEvent(t, event{event: "added", data: filesystem.WatchEvent{Name: "sub", IsDir: true}})
+
+	// Changes made outside of the server are picked up by polling.
+	require.NoError(t, os.WriteFile(filepath.Join(serverDir, "dir", "b.txt"), []byte("b"), 0o644))
+
+	waitForEvent(t, event{event: "added", data: filesystem.WatchEvent{Name: "b.txt"}})
+
+	require.NoError(t, os.WriteFile(filepath.Join(serverDir, "dir", "a.txt"), []byte("aaa"), 0o644))
+
+	waitForEvent(t, event{event: "modified", data: filesystem.WatchEvent{Name: "a.txt"}})
+
+	_, err = client.RemoveAll(ctx, connect.NewRequest(wrapperspb.String("dir/a.txt")))
+	require.NoError(t, err)
+
+	waitForEvent(t, event{event: "removed", data: filesystem.WatchEvent{Name: "a.txt"}})
+
+	t.Run("Not Found", func(t *testing.T) {
+		resp, err := http.Get(baseURL + "/api/v1alpha1/fs/watch?path=missing")
+		require.NoError(t, err)
+		defer resp.Body.Close()
+
+		assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+	})
+}
+
+func TestWatchSharedPoll(t *testing.T) {
+	logger := slogt.New(t)
+
+	serverDir := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(serverDir, "dir"), 0o755))
+
+	dirFS, err := dirfs.New(serverDir)
+	require.NoError(t, err)
+
+	fsys := &readDirCountingFS{FS: dirFS}
+
+	// Only poll when notified.
+	watcher := filesystem.NewWatcher(logger, fsys, time.Hour)
+
+	_, watchServer := filesystem.NewWatchServer(logger, watcher)
+
+	srv := httptest.NewServer(watchServer)
+	t.Cleanup(srv.Close)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	// Leading and trailing slashes don't change which directory is watched.
+	dirs := []string{"dir", "/dir", "dir/"}
+	clients := len(dirs)
+
+	added := make(chan struct{}, clients)
+	for _, dir := range dirs {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL+"/api/v1alpha1/fs/watch?path="+url.QueryEscape(dir), nil)
+		require.NoError(t, err)
+
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		t.Cleanup(func() {
+			_ = resp.Body.Close()
+		})
+
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+
+		go func() {
+			scanner := bufio.NewScanner(resp.Body)
+			for scanner.Scan() {
+				if scanner.Text() == "event: added" {
+					added <- struct{}{}
+					return
+				}
+			}
+		}()
+	}
+
+	require.NoError(t, os.WriteFile(filepath.Join(serverDir, "dir", "a.txt"), []byte("a"), 0o644))
+
+	watcher.Notify("/dir")
+
+	for i := 0; i < clients; i++ {
+		select {
+		case <-added:
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for event")
+		}
+	}
+
+	// One listing per client when it connects, and one shared listing after
+	// the notification.
+	assert.Equal(t, int32(clients+1), fsys.readDirs.Load())
+}
+
+type readDirCountingFS struct {
+	writablefs.FS
+	readDirs atomic.Int32
+}
+
+func (fsys *readDirCountingFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	fsys.readDirs.Add(1)
+
+	return fsys.FS.ReadDir(name)
+}
+
+func startServer(t *testing.T, opts *filesystem.ServerOptions) (string, string) {
+	logger := slogt.New(t)
+
+	serverDir := t.TempDir()
+
+	fsys, err := dirfs.New(serverDir)
+	require.NoError(t, err)
+
+	e := echo.New()
+	e.HideBanner = true
+
+	var baseOpts filesystem.ServerOptions
+	if opts != nil {
+		baseOpts = *opts
+	}
+
+	if baseOpts.Watcher == nil {
+		baseOpts.Watcher = filesystem.NewWatcher(logger, fsys, 100*time.Millisecond)
+	}
+
+	filesystemServerPath, filesystemServer := filesystem.NewServer(logger, fsys, &baseOpts)
+	e.Any(filesystemServerPath+"*", echo.WrapHandler(filesystemServer))
+
+	removeServerPath, removeServer := filesystemServer.(*filesystem.Server).RemoveHandler()
+	e.Any(removeServerPath, echo.WrapHandler(removeServer))
+
+	listServerPath, listServer := filesystemServer.(*filesystem.Server).ListHandler()
+	e.Any(listServerPath, echo.WrapHandler(listServer))
+
+	infoServerPath, infoServer := filesystem.NewInfoServer(logger, fsys)
+	e.Any(infoServerPath, echo.WrapHandler(infoServer))
+
+	capabilitiesServerPath, capabilitiesServer := filesystem.NewCapabilitiesServer(logger, fsys, &baseOpts)
+	e.Any(capabilitiesServerPath, echo.WrapHandler(capabilitiesServer))
+
+	previewServerPath, previewServer := filesystem.NewPreviewServer(logger, fsys)
+	e.Any(previewServerPath, echo.WrapHandler(previewServer))
+
+	watchServerPath, watchServer := filesystem.NewWatchServer(logger, baseOpts.Watcher)
+	e.Any(watchServerPath, echo.WrapHandler(watchServer))
+
+	go func() {
+		if err := e.StartH2CServer(":0", &http2.Server{}); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logger.Error("failed to start server", "error", err)
+		}
+	}()
+	t.Cleanup(func() {
+		require.NoError(t, e.Close())
+	})
+
+	err = util.WaitForServerReady(e, 10*time.Second)
+	require.NoError(t, err)
+
+	return fmt.Sprintf("http://%s", e.Listener.Addr().String()), serverDir
+}
@@ -0,0 +1,190 @@
+/* SPDX-License-Identifier: AGPL-3.0-or-later
+ *
+ * Copyright 2024 Damian Peckett <damian@pecke.tt>.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package filesystem
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+	"time"
+
+	"connectrpc.com/connect"
+	"github.com/bucket-sailor/bucketeer/internal/gen/filesystem/v1alpha1"
+	"github.com/bucket-sailor/writablefs"
+	"google.golang.org/protobuf/types/known/emptypb"
+)
+
+const (
+	// trashTimeFormat is the format of the timestamp appended to trashed paths.
+	trashTimeFormat = "20060102T150405.000000000Z"
+	// trashTimeSeparator separates a trashed path from its timestamp.
+	trashTimeSeparator = "~"
+)
+
+var (
+	// errTrashDisabled is returned by the trash operations when trash mode is off.
+	errTrashDisabled = errors.New("trash is not enabled")
+	// errContainsTrash is returned when removing a directory that contains the
+	// trash, it can't be moved into itself and deleting it would lose the trash.
+	errContainsTrash = errors.New("refusing to remove a directory containing the trash")
+)
+
+// remove deletes the file or directory at p, or if trash mode is enabled
+// moves it under the trash prefix. Anything already in the trash is deleted.
+func (s *Server) remove(ctx context.Context, p string) error {
+	p = path.Clean(p)
+
+	if s.trashPrefix == "" || s.inTrash(p) {
+		return s.fsys.RemoveAll(p)
+	}
+
+	if p == "." || p == "/" {
+		return fmt.Errorf("refusing to move the root directory to the trash")
+	}
+
+	if isWithin(s.trashPrefix, p) {
+		return errContainsTrash
+	}
+
+	// Removing something that doesn't exist isn't an error.
+	if _, err := s.fsys.Stat(p); err != nil {
+		if errors.Is(err, writablefs.ErrNotExist) {
+			return nil
+		}
+
+		return err
+	}
+
+	trashPath := path.Join(s.trashPrefix, strings.TrimPrefix(p, "/")) +
+		trashTimeSeparator + time.Now().UTC().Format(trashTimeFormat)
+
+	if err := s.move(ctx, p, trashPath); err != nil {
+		return fmt.Errorf("error moving to trash: %w", err)
+	}
+
+	s.Changed(ctx, path.Dir(trashPath))
+
+	return nil
+}
+
+// inTrash returns true if p is the trash directory or is contained within it.
+func (s *Server) inTrash(p string) bool {
+	p = strings.TrimPrefix(p, "/")
+	return p == s.trashPrefix || strings.HasPrefix(p, s.trashPrefix+"/")
+}
+
+// originalPath returns the path a trashed file or directory was removed from.
+func (s *Server) originalPath(trashPath string) (string, error) {
+	trashPath = strings.TrimPrefix(trashPath, "/")
+	if !strings.HasPrefix(trashPath, s.trashPrefix+"/") {
+		return "", fmt.Errorf("path is not in the trash")
+	}
+
+	p := strings.TrimPrefix(trashPath, s.trashPrefix+"/")
+
+	i := strings.LastIndex(p, trashTimeSeparator)
+	if i <= 0 {
+		return "", fmt.Errorf("path is not a trashed file or directory")
+	}
+
+	if _, err := time.Parse(trashTimeFormat, p[i+len(trashTimeSeparator):]); err != nil {
+		return "", fmt.Errorf("path is not a trashed file or directory")
+	}
+
+	return p[:i], nil
+}
+
+func (s *Server) Restore(ctx context.Context, req *connect.Request[v1alpha1.RestoreRequest]) (*connect.Response[v1alpha1.RestoreResponse], error) {
+	if s.readOnly {
+		return nil, connect.NewError(connect.CodePermissionDenied, errReadOnly)
+	}
+
+	if s.trashPrefix == "" {
+		return nil, connect.NewError(connect.CodeFailedPrecondition, errTrashDisabled)
+	}
+
+	if req.Msg.Path == "" {
+		return nil, connect.NewError(connect.CodeInvalidArgument, fmt.Errorf("missing required arguments"))
+	}
+
+	srcPath := path.Clean(req.Msg.Path)
+
+	dstPath, err := s.originalPath(srcPath)
+	if err != nil {
+		return nil, connect.NewError(connect.CodeInvalidArgument, err)
+	}
+
+	if req.Msg.DstPath != "" {
+		dstPath = path.Clean(req.Msg.DstPath)
+	}
+
+	if s.inTrash(dstPath) {
+		return nil, connect.NewError(connect.CodeInvalidArgument, fmt.Errorf("cannot restore into the trash"))
+	}
+
+	if _, err := s.fsys.Stat(srcPath); err != nil {
+		if errors.Is(err, writablefs.ErrNotExist) {
+			return nil, connect.NewError(connect.CodeNotFound, err)
+		}
+
+		return nil, connect.NewError(connect.CodeInternal, err)
+	}
+
+	if !req.Msg.Force {
+		if _, err := s.fsys.Stat(dstPath); err == nil {
+			return nil, connect.NewError(connect.CodeAlreadyExists, fmt.Errorf("destination already exists"))
+		} else if !errors.Is(err, writablefs.ErrNotExist) {
+			return nil, connect.NewError(connect.CodeInternal, err)
+		}
+	}
+
+	if err := s.move(ctx, srcPath, dstPath); err != nil {
+		return nil, connect.NewError(connect.CodeInternal, err)
+	}
+
+	s.Changed(ctx, path.Dir(srcPath), path.Dir(dstPath))
+
+	return &connect.Response[v1alpha1.RestoreResponse]{
+		Msg: &v1alpha1.RestoreResponse{
+			Path: dstPath,
+		},
+	}, nil
+}
+
+func (s *Server) EmptyTrash(ctx context.Context, req *connect.Request[emptypb.Empty]) (*connect.Response[emptypb.Empty], error) {
+	if s.readOnly {
+		return nil, connect.NewError(connect.CodePermissionDenied, errReadOnly)
+	}
+
+	if s.trashPrefix == "" {
+		return nil, connect.NewError(connect.CodeFailedPrecondition, errTrashDisabled)
+	}
+
+	if err := s.fsys.RemoveAll(s.trashPrefix); err != nil {
+		return nil, connect.NewError(connect.CodeInternal, err)
+	}
+
+	s.Changed(ctx, path.Dir(s.trashPrefix))
+
+	return &connect.Response[emptypb.Empty]{
+		Msg: &emptypb.Empty{},
+	}, nil
+}
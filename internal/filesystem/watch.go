@@ -0,0 +1,342 @@
+/* SPDX-License-Identifier: AGPL-3.0-or-later
+ *
+ * Copyright 2024 Damian Peckett <damian@pecke.tt>.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+package filesystem
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/bucket-sailor/writablefs"
+)
+
+const defaultWatchPollInterval = 10 * time.Second
+
+// Watcher tracks clients watching directories for changes. None of the
+// supported filesystems provide native change notifications, so directories
+// are polled periodically and the listings diffed. Each watched directory is
+// polled once, however many clients are watching it. Changes made through the
+// filesystem server are reported immediately.
+type Watcher struct {
+	logger       *slog.Logger
+	fsys         writablefs.FS
+	pollInterval time.Duration
+	mu           sync.Mutex
+	// dirs is keyed by the (cleaned) directory being watched.
+	dirs map[string]*watchedDir
+}
+
+// watchedDir is a directory with at least one subscriber.
+type watchedDir struct {
+	subscribers map[chan struct{}]struct{}
+	// listing is the most recent listing of the directory, it is replaced
+	// rather than modified so can be shared between subscribers.
+	listing map[string]watchedEntry
+	// gen is incremented whenever a listing is started, and listingGen is the
+	// generation of the stored listing, so a slow listing can't overwrite a
+	// newer one.
+	gen        uint64
+	listingGen uint64
+	// refreshCh asks the poller to list the directory immediately.
+	refreshCh chan struct{}
+	done      chan struct{}
+}
+
+// NewWatcher creates a new directory watcher, if pollInterval is zero a
+// default of 10 seconds is used.
+func NewWatcher(logger *slog.Logger, fsys writablefs.FS, pollInterval time.Duration) *Watcher {
+	if pollInterval <= 0 {
+		pollInterval = defaultWatchPollInterval
+	}
+
+	return &Watcher{
+		logger:       logger.WithGroup("fs"),
+		fsys:         fsys,
+		pollInterval: pollInterval,
+		dirs:         make(map[string]*watchedDir),
+	}
+}
+
+// Notify tells anyone watching dir that its contents may have changed.
+func (w *Watcher) Notify(dir string) {
+	if w == nil {
+		return
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if wd, ok := w.dirs[listingDir(dir)]; ok {
+		// Don't block, a pending refresh is as good as a new one.
+		select {
+		case wd.refreshCh <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// subscribe registers interest in dir, starting a poller for it if it isn't
+// already being watched. The returned channel receives a value whenever the
+// shared listing of dir has been updated.
+func (w *Watcher) subscribe(dir string) (*watchedDir, chan struct{}, func()) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	wd, ok := w.dirs[dir]
+	if !ok {
+		wd = &watchedDir{
+			subscribers: make(map[chan struct{}]struct{}),
+			refreshCh:   make(chan struct{}, 1),
+			done:        make(chan struct{}),
+		}
+		w.dirs[dir] = wd
+
+		go w.poll(dir, wd)
+	}
+
+	ch := make(chan struct{}, 1)
+	wd.subscribers[ch] = struct{}{}
+
+	return wd, ch, func() {
+		w.mu.Lock()
+		defer w.mu.Unlock()
+
+		delete(wd.subscribers, ch)
+		if len(wd.subscribers) == 0 {
+			delete(w.dirs, dir)
+			close(wd.done)
+		}
+	}
+}
+
+// poll periodically refreshes the listing of dir until it is no longer being
+// watched.
+func (w *Watcher) poll(dir string, wd *watchedDir) {
+	ticker := time.NewTicker(w.pollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-wd.done:
+			return
+		case <-ticker.C:
+		case <-wd.refreshCh:
+		}
+
+		if _, err := w.refresh(dir, wd); err != nil && !errors.Is(err, writablefs.ErrNotExist) {
+			w.logger.Warn("Error listing watched directory", "path", dir, "error", err)
+		}
+	}
+}
+
+// refresh lists dir, stores the listing (unless a newer one has already been
+// stored) and notifies subscribers. It returns the stored listing. If the
+// directory no longer exists an empty listing is stored and ErrNotExist is
+// returned.
+func (w *Watcher) refresh(dir string, wd *watchedDir) (map[string]watchedEntry, error) {
+	w.mu.Lock()
+	wd.gen++
+	gen := wd.gen
+	w.mu.Unlock()
+
+	listing, err := w.list(dir)
+	if err != nil {
+		if !errors.Is(err, writablefs.ErrNotExist) {
+			return nil, err
+		}
+
+		listing = map[string]watchedEntry{}
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if gen > wd.listingGen {
+		wd.listing = listing
+		wd.listingGen = gen
+
+		for ch := range wd.subscribers {
+			// Don't block, a pending notification is as good as a new one.
+			select {
+			case ch <- struct{}{}:
+			default:
+			}
+		}
+	}
+
+	return wd.listing, err
+}
+
+// current returns the most recent listing of a watched directory.
+func (w *Watcher) current(wd *watchedDir) map[string]watchedEntry {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return wd.listing
+}
+
+// watchedEntry is the state of a directory entry used to detect modifications.
+type watchedEntry struct {
+	isDir   bool
+	size    int64
+	modTime time.Time
+}
+
+func (w *Watcher) list(dir string) (map[string]watchedEntry, error) {
+	entries, err := w.fsys.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	listing := make(map[string]watchedEntry, len(entries))
+	for _, entry := range entries {
+		we := watchedEntry{isDir: entry.IsDir()}
+
+		if fi, err := entry.Info(); err == nil {
+			we.size = fi.Size()
+			we.modTime = fi.ModTime()
+		}
+
+		listing[entry.Name()] = we
+	}
+
+	return listing, nil
+}
+
+// WatchEvent is sent to clients when a directory entry changes.
+type WatchEvent struct {
+	Name  string `json:"name"`
+	IsDir bool   `json:"isDir"`
+}
+
+type WatchServer struct {
+	http.Handler
+	logger  *slog.Logger
+	watcher *Watcher
+}
+
+// NewWatchServer creates a new server that streams directory change
+// notifications as server-sent events.
+func NewWatchServer(logger *slog.Logger, watcher *Watcher) (string, http.Handler) {
+	s := &WatchServer{
+		logger:  logger.WithGroup("fs"),
+		watcher: watcher,
+	}
+
+	mux := http.NewServeMux()
+	s.Handler = mux
+
+	mux.HandleFunc("/api/v1alpha1/fs/watch", s.handleWatch)
+
+	return "/api/v1alpha1/fs/watch", s
+}
+
+func (s *WatchServer) handleWatch(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming not supported", http.StatusInternalServerError)
+		return
+	}
+
+	dir := listingDir(r.URL.Query().Get("path"))
+
+	// Subscribe before the initial listing so no changes are missed.
+	wd, notifyCh, unsubscribe := s.watcher.subscribe(dir)
+	defer unsubscribe()
+
+	listing, err := s.watcher.refresh(dir, wd)
+	if err != nil {
+		if errors.Is(err, writablefs.ErrNotExist) {
+			http.Error(w, "Directory not found", http.StatusNotFound)
+			return
+		}
+
+		s.logger.Warn("Error listing watched directory", "path", dir, "error", err)
+
+		http.Error(w, "Error listing directory", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-notifyCh:
+		}
+
+		current := s.watcher.current(wd)
+
+		if err := writeWatchEvents(w, listing, current); err != nil {
+			s.logger.Debug("Error writing watch events", "path", dir, "error", err)
+			return
+		}
+		flusher.Flush()
+
+		listing = current
+	}
+}
+
+// writeWatchEvents writes an event for every difference between two listings.
+func writeWatchEvents(w http.ResponseWriter, previous, current map[string]watchedEntry) error {
+	for name, entry := range current {
+		prev, ok := previous[name]
+		if !ok {
+			if err := writeWatchEvent(w, "added", name, entry); err != nil {
+				return err
+			}
+		} else if prev != entry {
+			if err := writeWatchEvent(w, "modified", name, entry); err != nil {
+				return err
+			}
+		}
+	}
+
+	for name, entry := range previous {
+		if _, ok := current[name]; !ok {
+			if err := writeWatchEvent(w, "removed", name, entry); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func writeWatchEvent(w http.ResponseWriter, event, name string, entry watchedEntry) error {
+	data, err := json.Marshal(WatchEvent{Name: name, IsDir: entry.isDir})
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, data)
+	return err
+}
@@ -54,33 +54,92 @@ const (
 const (
 	// FilesystemReadDirProcedure is the fully-qualified name of the Filesystem's ReadDir RPC.
 	FilesystemReadDirProcedure = "/bucketeer.filesystem.v1alpha1.Filesystem/ReadDir"
+	// FilesystemReadDirPageProcedure is the fully-qualified name of the Filesystem's ReadDirPage RPC.
+	FilesystemReadDirPageProcedure = "/bucketeer.filesystem.v1alpha1.Filesystem/ReadDirPage"
 	// FilesystemStatProcedure is the fully-qualified name of the Filesystem's Stat RPC.
 	FilesystemStatProcedure = "/bucketeer.filesystem.v1alpha1.Filesystem/Stat"
 	// FilesystemMkdirAllProcedure is the fully-qualified name of the Filesystem's MkdirAll RPC.
 	FilesystemMkdirAllProcedure = "/bucketeer.filesystem.v1alpha1.Filesystem/MkdirAll"
+	// FilesystemTouchProcedure is the fully-qualified name of the Filesystem's Touch RPC.
+	FilesystemTouchProcedure = "/bucketeer.filesystem.v1alpha1.Filesystem/Touch"
 	// FilesystemRemoveAllProcedure is the fully-qualified name of the Filesystem's RemoveAll RPC.
 	FilesystemRemoveAllProcedure = "/bucketeer.filesystem.v1alpha1.Filesystem/RemoveAll"
+	// FilesystemRemoveBatchProcedure is the fully-qualified name of the Filesystem's RemoveBatch RPC.
+	FilesystemRemoveBatchProcedure = "/bucketeer.filesystem.v1alpha1.Filesystem/RemoveBatch"
+	// FilesystemCopyProcedure is the fully-qualified name of the Filesystem's Copy RPC.
+	FilesystemCopyProcedure = "/bucketeer.filesystem.v1alpha1.Filesystem/Copy"
+	// FilesystemRenameProcedure is the fully-qualified name of the Filesystem's Rename RPC.
+	FilesystemRenameProcedure = "/bucketeer.filesystem.v1alpha1.Filesystem/Rename"
+	// FilesystemMoveProcedure is the fully-qualified name of the Filesystem's Move RPC.
+	FilesystemMoveProcedure = "/bucketeer.filesystem.v1alpha1.Filesystem/Move"
+	// FilesystemUsageProcedure is the fully-qualified name of the Filesystem's Usage RPC.
+	FilesystemUsageProcedure = "/bucketeer.filesystem.v1alpha1.Filesystem/Usage"
+	// FilesystemPresignProcedure is the fully-qualified name of the Filesystem's Presign RPC.
+	FilesystemPresignProcedure = "/bucketeer.filesystem.v1alpha1.Filesystem/Presign"
+	// FilesystemRestoreProcedure is the fully-qualified name of the Filesystem's Restore RPC.
+	FilesystemRestoreProcedure = "/bucketeer.filesystem.v1alpha1.Filesystem/Restore"
+	// FilesystemEmptyTrashProcedure is the fully-qualified name of the Filesystem's EmptyTrash RPC.
+	FilesystemEmptyTrashProcedure = "/bucketeer.filesystem.v1alpha1.Filesystem/EmptyTrash"
 )
 
 // These variables are the protoreflect.Descriptor objects for the RPCs defined in this package.
 var (
-	filesystemServiceDescriptor         = v1alpha1.File_filesystem_v1alpha1_filesystem_proto.Services().ByName("Filesystem")
-	filesystemReadDirMethodDescriptor   = filesystemServiceDescriptor.Methods().ByName("ReadDir")
-	filesystemStatMethodDescriptor      = filesystemServiceDescriptor.Methods().ByName("Stat")
-	filesystemMkdirAllMethodDescriptor  = filesystemServiceDescriptor.Methods().ByName("MkdirAll")
-	filesystemRemoveAllMethodDescriptor = filesystemServiceDescriptor.Methods().ByName("RemoveAll")
+	filesystemServiceDescriptor           = v1alpha1.File_filesystem_v1alpha1_filesystem_proto.Services().ByName("Filesystem")
+	filesystemReadDirMethodDescriptor     = filesystemServiceDescriptor.Methods().ByName("ReadDir")
+	filesystemReadDirPageMethodDescriptor = filesystemServiceDescriptor.Methods().ByName("ReadDirPage")
+	filesystemStatMethodDescriptor        = filesystemServiceDescriptor.Methods().ByName("Stat")
+	filesystemMkdirAllMethodDescriptor    = filesystemServiceDescriptor.Methods().ByName("MkdirAll")
+	filesystemTouchMethodDescriptor       = filesystemServiceDescriptor.Methods().ByName("Touch")
+	filesystemRemoveAllMethodDescriptor   = filesystemServiceDescriptor.Methods().ByName("RemoveAll")
+	filesystemRemoveBatchMethodDescriptor = filesystemServiceDescriptor.Methods().ByName("RemoveBatch")
+	filesystemCopyMethodDescriptor        = filesystemServiceDescriptor.Methods().ByName("Copy")
+	filesystemRenameMethodDescriptor      = filesystemServiceDescriptor.Methods().ByName("Rename")
+	filesystemMoveMethodDescriptor        = filesystemServiceDescriptor.Methods().ByName("Move")
+	filesystemUsageMethodDescriptor       = filesystemServiceDescriptor.Methods().ByName("Usage")
+	filesystemPresignMethodDescriptor     = filesystemServiceDescriptor.Methods().ByName("Presign")
+	filesystemRestoreMethodDescriptor     = filesystemServiceDescriptor.Methods().ByName("Restore")
+	filesystemEmptyTrashMethodDescriptor  = filesystemServiceDescriptor.Methods().ByName("EmptyTrash")
 )
 
 // FilesystemClient is a client for the bucketeer.filesystem.v1alpha1.Filesystem service.
 type FilesystemClient interface {
 	// ReadDir returns a list of files in a directory.
 	ReadDir(context.Context, *connect.Request[v1alpha1.ReadDirRequest]) (*connect.Response[v1alpha1.ReadDirResponse], error)
+	// ReadDirPage returns a single page of a directory listing (sorted by name),
+	// without listing the entire directory up front. This is better suited to
+	// very large directories than ReadDir.
+	ReadDirPage(context.Context, *connect.Request[v1alpha1.ReadDirPageRequest]) (*connect.Response[v1alpha1.ReadDirPageResponse], error)
 	// Stat returns information about a file or directory.
 	Stat(context.Context, *connect.Request[wrapperspb.StringValue]) (*connect.Response[v1alpha1.FileInfo], error)
 	// MkdirAll creates a directory and any necessary parents.
 	MkdirAll(context.Context, *connect.Request[wrapperspb.StringValue]) (*connect.Response[emptypb.Empty], error)
-	// RemoveAll removes a directory and any children it contains.
+	// Touch creates an empty file and any necessary parent directories.
+	Touch(context.Context, *connect.Request[v1alpha1.TouchRequest]) (*connect.Response[emptypb.Empty], error)
+	// RemoveAll removes a directory and any children it contains. If the
+	// server has trash enabled it is moved to the trash instead.
 	RemoveAll(context.Context, *connect.Request[wrapperspb.StringValue]) (*connect.Response[emptypb.Empty], error)
+	// RemoveBatch removes multiple files or directories, reporting the result
+	// for each path.
+	RemoveBatch(context.Context, *connect.Request[v1alpha1.RemoveBatchRequest]) (*connect.Response[v1alpha1.RemoveBatchResponse], error)
+	// Copy copies a file or directory (recursively) to a new location.
+	Copy(context.Context, *connect.Request[v1alpha1.CopyRequest]) (*connect.Response[emptypb.Empty], error)
+	// Rename moves a file or directory to a new location, creating any
+	// necessary parent directories.
+	Rename(context.Context, *connect.Request[v1alpha1.RenameRequest]) (*connect.Response[emptypb.Empty], error)
+	// Move moves a file or directory to a new location, if the filesystem
+	// can't rename it (eg. a directory on S3) it is copied and the source is
+	// then removed.
+	Move(context.Context, *connect.Request[v1alpha1.MoveRequest]) (*connect.Response[emptypb.Empty], error)
+	// Usage returns the total size of a directory and its children.
+	Usage(context.Context, *connect.Request[wrapperspb.StringValue]) (*connect.Response[v1alpha1.UsageResponse], error)
+	// Presign returns a presigned URL that can be used to download a file
+	// directly from the underlying storage.
+	Presign(context.Context, *connect.Request[v1alpha1.PresignRequest]) (*connect.Response[v1alpha1.PresignResponse], error)
+	// Restore moves a file or directory out of the trash, by default back to
+	// where it was removed from.
+	Restore(context.Context, *connect.Request[v1alpha1.RestoreRequest]) (*connect.Response[v1alpha1.RestoreResponse], error)
+	// EmptyTrash permanently removes everything in the trash.
+	EmptyTrash(context.Context, *connect.Request[emptypb.Empty]) (*connect.Response[emptypb.Empty], error)
 }
 
 // NewFilesystemClient constructs a client for the bucketeer.filesystem.v1alpha1.Filesystem service.
@@ -99,6 +158,12 @@ func NewFilesystemClient(httpClient connect.HTTPClient, baseURL string, opts ...
 			connect.WithSchema(filesystemReadDirMethodDescriptor),
 			connect.WithClientOptions(opts...),
 		),
+		readDirPage: connect.NewClient[v1alpha1.ReadDirPageRequest, v1alpha1.ReadDirPageResponse](
+			httpClient,
+			baseURL+FilesystemReadDirPageProcedure,
+			connect.WithSchema(filesystemReadDirPageMethodDescriptor),
+			connect.WithClientOptions(opts...),
+		),
 		stat: connect.NewClient[wrapperspb.StringValue, v1alpha1.FileInfo](
 			httpClient,
 			baseURL+FilesystemStatProcedure,
@@ -111,21 +176,85 @@ func NewFilesystemClient(httpClient connect.HTTPClient, baseURL string, opts ...
 			connect.WithSchema(filesystemMkdirAllMethodDescriptor),
 			connect.WithClientOptions(opts...),
 		),
+		touch: connect.NewClient[v1alpha1.TouchRequest, emptypb.Empty](
+			httpClient,
+			baseURL+FilesystemTouchProcedure,
+			connect.WithSchema(filesystemTouchMethodDescriptor),
+			connect.WithClientOptions(opts...),
+		),
 		removeAll: connect.NewClient[wrapperspb.StringValue, emptypb.Empty](
 			httpClient,
 			baseURL+FilesystemRemoveAllProcedure,
 			connect.WithSchema(filesystemRemoveAllMethodDescriptor),
 			connect.WithClientOptions(opts...),
 		),
+		removeBatch: connect.NewClient[v1alpha1.RemoveBatchRequest, v1alpha1.RemoveBatchResponse](
+			httpClient,
+			baseURL+FilesystemRemoveBatchProcedure,
+			connect.WithSchema(filesystemRemoveBatchMethodDescriptor),
+			connect.WithClientOptions(opts...),
+		),
+		copy: connect.NewClient[v1alpha1.CopyRequest, emptypb.Empty](
+			httpClient,
+			baseURL+FilesystemCopyProcedure,
+			connect.WithSchema(filesystemCopyMethodDescriptor),
+			connect.WithClientOptions(opts...),
+		),
+		rename: connect.NewClient[v1alpha1.RenameRequest, emptypb.Empty](
+			httpClient,
+			baseURL+FilesystemRenameProcedure,
+			connect.WithSchema(filesystemRenameMethodDescriptor),
+			connect.WithClientOptions(opts...),
+		),
+		move: connect.NewClient[v1alpha1.MoveRequest, emptypb.Empty](
+			httpClient,
+			baseURL+FilesystemMoveProcedure,
+			connect.WithSchema(filesystemMoveMethodDescriptor),
+			connect.WithClientOptions(opts...),
+		),
+		usage: connect.NewClient[wrapperspb.StringValue, v1alpha1.UsageResponse](
+			httpClient,
+			baseURL+FilesystemUsageProcedure,
+			connect.WithSchema(filesystemUsageMethodDescriptor),
+			connect.WithClientOptions(opts...),
+		),
+		presign: connect.NewClient[v1alpha1.PresignRequest, v1alpha1.PresignResponse](
+			httpClient,
+			baseURL+FilesystemPresignProcedure,
+			connect.WithSchema(filesystemPresignMethodDescriptor),
+			connect.WithClientOptions(opts...),
+		),
+		restore: connect.NewClient[v1alpha1.RestoreRequest, v1alpha1.RestoreResponse](
+			httpClient,
+			baseURL+FilesystemRestoreProcedure,
+			connect.WithSchema(filesystemRestoreMethodDescriptor),
+			connect.WithClientOptions(opts...),
+		),
+		emptyTrash: connect.NewClient[emptypb.Empty, emptypb.Empty](
+			httpClient,
+			baseURL+FilesystemEmptyTrashProcedure,
+			connect.WithSchema(filesystemEmptyTrashMethodDescriptor),
+			connect.WithClientOptions(opts...),
+		),
 	}
 }
 
 // filesystemClient implements FilesystemClient.
 type filesystemClient struct {
-	readDir   *connect.Client[v1alpha1.ReadDirRequest, v1alpha1.ReadDirResponse]
-	stat      *connect.Client[wrapperspb.StringValue, v1alpha1.FileInfo]
-	mkdirAll  *connect.Client[wrapperspb.StringValue, emptypb.Empty]
-	removeAll *connect.Client[wrapperspb.StringValue, emptypb.Empty]
+	readDir     *connect.Client[v1alpha1.ReadDirRequest, v1alpha1.ReadDirResponse]
+	readDirPage *connect.Client[v1alpha1.ReadDirPageRequest, v1alpha1.ReadDirPageResponse]
+	stat        *connect.Client[wrapperspb.StringValue, v1alpha1.FileInfo]
+	mkdirAll    *connect.Client[wrapperspb.StringValue, emptypb.Empty]
+	touch       *connect.Client[v1alpha1.TouchRequest, emptypb.Empty]
+	removeAll   *connect.Client[wrapperspb.StringValue, emptypb.Empty]
+	removeBatch *connect.Client[v1alpha1.RemoveBatchRequest, v1alpha1.RemoveBatchResponse]
+	copy        *connect.Client[v1alpha1.CopyRequest, emptypb.Empty]
+	rename      *connect.Client[v1alpha1.RenameRequest, emptypb.Empty]
+	move        *connect.Client[v1alpha1.MoveRequest, emptypb.Empty]
+	usage       *connect.Client[wrapperspb.StringValue, v1alpha1.UsageResponse]
+	presign     *connect.Client[v1alpha1.PresignRequest, v1alpha1.PresignResponse]
+	restore     *connect.Client[v1alpha1.RestoreRequest, v1alpha1.RestoreResponse]
+	emptyTrash  *connect.Client[emptypb.Empty, emptypb.Empty]
 }
 
 // ReadDir calls bucketeer.filesystem.v1alpha1.Filesystem.ReadDir.
@@ -133,6 +262,11 @@ func (c *filesystemClient) ReadDir(ctx context.Context, req *connect.Request[v1a
 	return c.readDir.CallUnary(ctx, req)
 }
 
+// ReadDirPage calls bucketeer.filesystem.v1alpha1.Filesystem.ReadDirPage.
+func (c *filesystemClient) ReadDirPage(ctx context.Context, req *connect.Request[v1alpha1.ReadDirPageRequest]) (*connect.Response[v1alpha1.ReadDirPageResponse], error) {
+	return c.readDirPage.CallUnary(ctx, req)
+}
+
 // Stat calls bucketeer.filesystem.v1alpha1.Filesystem.Stat.
 func (c *filesystemClient) Stat(ctx context.Context, req *connect.Request[wrapperspb.StringValue]) (*connect.Response[v1alpha1.FileInfo], error) {
 	return c.stat.CallUnary(ctx, req)
@@ -143,21 +277,95 @@ func (c *filesystemClient) MkdirAll(ctx context.Context, req *connect.Request[wr
 	return c.mkdirAll.CallUnary(ctx, req)
 }
 
+// Touch calls bucketeer.filesystem.v1alpha1.Filesystem.Touch.
+func (c *filesystemClient) Touch(ctx context.Context, req *connect.Request[v1alpha1.TouchRequest]) (*connect.Response[emptypb.Empty], error) {
+	return c.touch.CallUnary(ctx, req)
+}
+
 // RemoveAll calls bucketeer.filesystem.v1alpha1.Filesystem.RemoveAll.
 func (c *filesystemClient) RemoveAll(ctx context.Context, req *connect.Request[wrapperspb.StringValue]) (*connect.Response[emptypb.Empty], error) {
 	return c.removeAll.CallUnary(ctx, req)
 }
 
+// RemoveBatch calls bucketeer.filesystem.v1alpha1.Filesystem.RemoveBatch.
+func (c *filesystemClient) RemoveBatch(ctx context.Context, req *connect.Request[v1alpha1.RemoveBatchRequest]) (*connect.Response[v1alpha1.RemoveBatchResponse], error) {
+	return c.removeBatch.CallUnary(ctx, req)
+}
+
+// Copy calls bucketeer.filesystem.v1alpha1.Filesystem.Copy.
+func (c *filesystemClient) Copy(ctx context.Context, req *connect.Request[v1alpha1.CopyRequest]) (*connect.Response[emptypb.Empty], error) {
+	return c.copy.CallUnary(ctx, req)
+}
+
+// Rename calls bucketeer.filesystem.v1alpha1.Filesystem.Rename.
+func (c *filesystemClient) Rename(ctx context.Context, req *connect.Request[v1alpha1.RenameRequest]) (*connect.Response[emptypb.Empty], error) {
+	return c.rename.CallUnary(ctx, req)
+}
+
+// Move calls bucketeer.filesystem.v1alpha1.Filesystem.Move.
+func (c *filesystemClient) Move(ctx context.Context, req *connect.Request[v1alpha1.MoveRequest]) (*connect.Response[emptypb.Empty], error) {
+	return c.move.CallUnary(ctx, req)
+}
+
+// Usage calls bucketeer.filesystem.v1alpha1.Filesystem.Usage.
+func (c *filesystemClient) Usage(ctx context.Context, req *connect.Request[wrapperspb.StringValue]) (*connect.Response[v1alpha1.UsageResponse], error) {
+	return c.usage.CallUnary(ctx, req)
+}
+
+// Presign calls bucketeer.filesystem.v1alpha1.Filesystem.Presign.
+func (c *filesystemClient) Presign(ctx context.Context, req *connect.Request[v1alpha1.PresignRequest]) (*connect.Response[v1alpha1.PresignResponse], error) {
+	return c.presign.CallUnary(ctx, req)
+}
+
+// Restore calls bucketeer.filesystem.v1alpha1.Filesystem.Restore.
+func (c *filesystemClient) Restore(ctx context.Context, req *connect.Request[v1alpha1.RestoreRequest]) (*connect.Response[v1alpha1.RestoreResponse], error) {
+	return c.restore.CallUnary(ctx, req)
+}
+
+// EmptyTrash calls bucketeer.filesystem.v1alpha1.Filesystem.EmptyTrash.
+func (c *filesystemClient) EmptyTrash(ctx context.Context, req *connect.Request[emptypb.Empty]) (*connect.Response[emptypb.Empty], error) {
+	return c.emptyTrash.CallUnary(ctx, req)
+}
+
 // FilesystemHandler is an implementation of the bucketeer.filesystem.v1alpha1.Filesystem service.
 type FilesystemHandler interface {
 	// ReadDir returns a list of files in a directory.
 	ReadDir(context.Context, *connect.Request[v1alpha1.ReadDirRequest]) (*connect.Response[v1alpha1.ReadDirResponse], error)
+	// ReadDirPage returns a single page of a directory listing (sorted by name),
+	// without listing the entire directory up front. This is better suited to
+	// very large directories than ReadDir.
+	ReadDirPage(context.Context, *connect.Request[v1alpha1.ReadDirPageRequest]) (*connect.Response[v1alpha1.ReadDirPageResponse], error)
 	// Stat returns information about a file or directory.
 	Stat(context.Context, *connect.Request[wrapperspb.StringValue]) (*connect.Response[v1alpha1.FileInfo], error)
 	// MkdirAll creates a directory and any necessary parents.
 	MkdirAll(context.Context, *connect.Request[wrapperspb.StringValue]) (*connect.Response[emptypb.Empty], error)
-	// RemoveAll removes a directory and any children it contains.
+	// Touch creates an empty file and any necessary parent directories.
+	Touch(context.Context, *connect.Request[v1alpha1.TouchRequest]) (*connect.Response[emptypb.Empty], error)
+	// RemoveAll removes a directory and any children it contains. If the
+	// server has trash enabled it is moved to the trash instead.
 	RemoveAll(context.Context, *connect.Request[wrapperspb.StringValue]) (*connect.Response[emptypb.Empty], error)
+	// RemoveBatch removes multiple files or directories, reporting the result
+	// for each path.
+	RemoveBatch(context.Context, *connect.Request[v1alpha1.RemoveBatchRequest]) (*connect.Response[v1alpha1.RemoveBatchResponse], error)
+	// Copy copies a file or directory (recursively) to a new location.
+	Copy(context.Context, *connect.Request[v1alpha1.CopyRequest]) (*connect.Response[emptypb.Empty], error)
+	// Rename moves a file or directory to a new location, creating any
+	// necessary parent directories.
+	Rename(context.Context, *connect.Request[v1alpha1.RenameRequest]) (*connect.Response[emptypb.Empty], error)
+	// Move moves a file or directory to a new location, if the filesystem
+	// can't rename it (eg. a directory on S3) it is copied and the source is
+	// then removed.
+	Move(context.Context, *connect.Request[v1alpha1.MoveRequest]) (*connect.Response[emptypb.Empty], error)
+	// Usage returns the total size of a directory and its children.
+	Usage(context.Context, *connect.Request[wrapperspb.StringValue]) (*connect.Response[v1alpha1.UsageResponse], error)
+	// Presign returns a presigned URL that can be used to download a file
+	// directly from the underlying storage.
+	Presign(context.Context, *connect.Request[v1alpha1.PresignRequest]) (*connect.Response[v1alpha1.PresignResponse], error)
+	// Restore moves a file or directory out of the trash, by default back to
+	// where it was removed from.
+	Restore(context.Context, *connect.Request[v1alpha1.RestoreRequest]) (*connect.Response[v1alpha1.RestoreResponse], error)
+	// EmptyTrash permanently removes everything in the trash.
+	EmptyTrash(context.Context, *connect.Request[emptypb.Empty]) (*connect.Response[emptypb.Empty], error)
 }
 
 // NewFilesystemHandler builds an HTTP handler from the service implementation. It returns the path
@@ -172,6 +380,12 @@ func NewFilesystemHandler(svc FilesystemHandler, opts ...connect.HandlerOption)
 		connect.WithSchema(filesystemReadDirMethodDescriptor),
 		connect.WithHandlerOptions(opts...),
 	)
+	filesystemReadDirPageHandler := connect.NewUnaryHandler(
+		FilesystemReadDirPageProcedure,
+		svc.ReadDirPage,
+		connect.WithSchema(filesystemReadDirPageMethodDescriptor),
+		connect.WithHandlerOptions(opts...),
+	)
 	filesystemStatHandler := connect.NewUnaryHandler(
 		FilesystemStatProcedure,
 		svc.Stat,
@@ -184,22 +398,96 @@ func NewFilesystemHandler(svc FilesystemHandler, opts ...connect.HandlerOption)
 		connect.WithSchema(filesystemMkdirAllMethodDescriptor),
 		connect.WithHandlerOptions(opts...),
 	)
+	filesystemTouchHandler := connect.NewUnaryHandler(
+		FilesystemTouchProcedure,
+		svc.Touch,
+		connect.WithSchema(filesystemTouchMethodDescriptor),
+		connect.WithHandlerOptions(opts...),
+	)
 	filesystemRemoveAllHandler := connect.NewUnaryHandler(
 		FilesystemRemoveAllProcedure,
 		svc.RemoveAll,
 		connect.WithSchema(filesystemRemoveAllMethodDescriptor),
 		connect.WithHandlerOptions(opts...),
 	)
+	filesystemRemoveBatchHandler := connect.NewUnaryHandler(
+		FilesystemRemoveBatchProcedure,
+		svc.RemoveBatch,
+		connect.WithSchema(filesystemRemoveBatchMethodDescriptor),
+		connect.WithHandlerOptions(opts...),
+	)
+	filesystemCopyHandler := connect.NewUnaryHandler(
+		FilesystemCopyProcedure,
+		svc.Copy,
+		connect.WithSchema(filesystemCopyMethodDescriptor),
+		connect.WithHandlerOptions(opts...),
+	)
+	filesystemRenameHandler := connect.NewUnaryHandler(
+		FilesystemRenameProcedure,
+		svc.Rename,
+		connect.WithSchema(filesystemRenameMethodDescriptor),
+		connect.WithHandlerOptions(opts...),
+	)
+	filesystemMoveHandler := connect.NewUnaryHandler(
+		FilesystemMoveProcedure,
+		svc.Move,
+		connect.WithSchema(filesystemMoveMethodDescriptor),
+		connect.WithHandlerOptions(opts...),
+	)
+	filesystemUsageHandler := connect.NewUnaryHandler(
+		FilesystemUsageProcedure,
+		svc.Usage,
+		connect.WithSchema(filesystemUsageMethodDescriptor),
+		connect.WithHandlerOptions(opts...),
+	)
+	filesystemPresignHandler := connect.NewUnaryHandler(
+		FilesystemPresignProcedure,
+		svc.Presign,
+		connect.WithSchema(filesystemPresignMethodDescriptor),
+		connect.WithHandlerOptions(opts...),
+	)
+	filesystemRestoreHandler := connect.NewUnaryHandler(
+		FilesystemRestoreProcedure,
+		svc.Restore,
+		connect.WithSchema(filesystemRestoreMethodDescriptor),
+		connect.WithHandlerOptions(opts...),
+	)
+	filesystemEmptyTrashHandler := connect.NewUnaryHandler(
+		FilesystemEmptyTrashProcedure,
+		svc.EmptyTrash,
+		connect.WithSchema(filesystemEmptyTrashMethodDescriptor),
+		connect.WithHandlerOptions(opts...),
+	)
 	return "/bucketeer.filesystem.v1alpha1.Filesystem/", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		switch r.URL.Path {
 		case FilesystemReadDirProcedure:
 			filesystemReadDirHandler.ServeHTTP(w, r)
+		case FilesystemReadDirPageProcedure:
+			filesystemReadDirPageHandler.ServeHTTP(w, r)
 		case FilesystemStatProcedure:
 			filesystemStatHandler.ServeHTTP(w, r)
 		case FilesystemMkdirAllProcedure:
 			filesystemMkdirAllHandler.ServeHTTP(w, r)
+		case FilesystemTouchProcedure:
+			filesystemTouchHandler.ServeHTTP(w, r)
 		case FilesystemRemoveAllProcedure:
 			filesystemRemoveAllHandler.ServeHTTP(w, r)
+		case FilesystemRemoveBatchProcedure:
+			filesystemRemoveBatchHandler.ServeHTTP(w, r)
+		case FilesystemCopyProcedure:
+			filesystemCopyHandler.ServeHTTP(w, r)
+		case FilesystemRenameProcedure:
+			filesystemRenameHandler.ServeHTTP(w, r)
+		case FilesystemMoveProcedure:
+			filesystemMoveHandler.ServeHTTP(w, r)
+		case FilesystemUsageProcedure:
+			filesystemUsageHandler.ServeHTTP(w, r)
+		case FilesystemPresignProcedure:
+			filesystemPresignHandler.ServeHTTP(w, r)
+		case FilesystemRestoreProcedure:
+			filesystemRestoreHandler.ServeHTTP(w, r)
+		case FilesystemEmptyTrashProcedure:
+			filesystemEmptyTrashHandler.ServeHTTP(w, r)
 		default:
 			http.NotFound(w, r)
 		}
@@ -213,6 +501,10 @@ func (UnimplementedFilesystemHandler) ReadDir(context.Context, *connect.Request[
 	return nil, connect.NewError(connect.CodeUnimplemented, errors.New("bucketeer.filesystem.v1alpha1.Filesystem.ReadDir is not implemented"))
 }
 
+func (UnimplementedFilesystemHandler) ReadDirPage(context.Context, *connect.Request[v1alpha1.ReadDirPageRequest]) (*connect.Response[v1alpha1.ReadDirPageResponse], error) {
+	return nil, connect.NewError(connect.CodeUnimplemented, errors.New("bucketeer.filesystem.v1alpha1.Filesystem.ReadDirPage is not implemented"))
+}
+
 func (UnimplementedFilesystemHandler) Stat(context.Context, *connect.Request[wrapperspb.StringValue]) (*connect.Response[v1alpha1.FileInfo], error) {
 	return nil, connect.NewError(connect.CodeUnimplemented, errors.New("bucketeer.filesystem.v1alpha1.Filesystem.Stat is not implemented"))
 }
@@ -221,6 +513,42 @@ func (UnimplementedFilesystemHandler) MkdirAll(context.Context, *connect.Request
 	return nil, connect.NewError(connect.CodeUnimplemented, errors.New("bucketeer.filesystem.v1alpha1.Filesystem.MkdirAll is not implemented"))
 }
 
+func (UnimplementedFilesystemHandler) Touch(context.Context, *connect.Request[v1alpha1.TouchRequest]) (*connect.Response[emptypb.Empty], error) {
+	return nil, connect.NewError(connect.CodeUnimplemented, errors.New("bucketeer.filesystem.v1alpha1.Filesystem.Touch is not implemented"))
+}
+
 func (UnimplementedFilesystemHandler) RemoveAll(context.Context, *connect.Request[wrapperspb.StringValue]) (*connect.Response[emptypb.Empty], error) {
 	return nil, connect.NewError(connect.CodeUnimplemented, errors.New("bucketeer.filesystem.v1alpha1.Filesystem.RemoveAll is not implemented"))
 }
+
+func (UnimplementedFilesystemHandler) RemoveBatch(context.Context, *connect.Request[v1alpha1.RemoveBatchRequest]) (*connect.Response[v1alpha1.RemoveBatchResponse], error) {
+	return nil, connect.NewError(connect.CodeUnimplemented, errors.New("bucketeer.filesystem.v1alpha1.Filesystem.RemoveBatch is not implemented"))
+}
+
+func (UnimplementedFilesystemHandler) Copy(context.Context, *connect.Request[v1alpha1.CopyRequest]) (*connect.Response[emptypb.Empty], error) {
+	return nil, connect.NewError(connect.CodeUnimplemented, errors.New("bucketeer.filesystem.v1alpha1.Filesystem.Copy is not implemented"))
+}
+
+func (UnimplementedFilesystemHandler) Rename(context.Context, *connect.Request[v1alpha1.RenameRequest]) (*connect.Response[emptypb.Empty], error) {
+	return nil, connect.NewError(connect.CodeUnimplemented, errors.New("bucketeer.filesystem.v1alpha1.Filesystem.Rename is not implemented"))
+}
+
+func (UnimplementedFilesystemHandler) Move(context.Context, *connect.Request[v1alpha1.MoveRequest]) (*connect.Response[emptypb.Empty], error) {
+	return nil, connect.NewError(connect.CodeUnimplemented, errors.New("bucketeer.filesystem.v1alpha1.Filesystem.Move is not implemented"))
+}
+
+func (UnimplementedFilesystemHandler) Usage(context.Context, *connect.Request[wrapperspb.StringValue]) (*connect.Response[v1alpha1.UsageResponse], error) {
+	return nil, connect.NewError(connect.CodeUnimplemented, errors.New("bucketeer.filesystem.v1alpha1.Filesystem.Usage is not implemented"))
+}
+
+func (UnimplementedFilesystemHandler) Presign(context.Context, *connect.Request[v1alpha1.PresignRequest]) (*connect.Response[v1alpha1.PresignResponse], error) {
+	return nil, connect.NewError(connect.CodeUnimplemented, errors.New("bucketeer.filesystem.v1alpha1.Filesystem.Presign is not implemented"))
+}
+
+func (UnimplementedFilesystemHandler) Restore(context.Context, *connect.Request[v1alpha1.RestoreRequest]) (*connect.Response[v1alpha1.RestoreResponse], error) {
+	return nil, connect.NewError(connect.CodeUnimplemented, errors.New("bucketeer.filesystem.v1alpha1.Filesystem.Restore is not implemented"))
+}
+
+func (UnimplementedFilesystemHandler) EmptyTrash(context.Context, *connect.Request[emptypb.Empty]) (*connect.Response[emptypb.Empty], error) {
+	return nil, connect.NewError(connect.CodeUnimplemented, errors.New("bucketeer.filesystem.v1alpha1.Filesystem.EmptyTrash is not implemented"))
+}
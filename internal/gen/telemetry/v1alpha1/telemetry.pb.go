@@ -171,7 +171,8 @@ type TelemetryEvent struct {
 	sizeCache     protoimpl.SizeCache
 	unknownFields protoimpl.UnknownFields
 
-	// The session ID associated with the event.
+	// The session ID associated with the event. The session id is short-lived and not persisted.
+	// It is only used to link events together (as there might be a relationship between them).
 	SessionId string `protobuf:"bytes,1,opt,name=session_id,json=sessionId,proto3" json:"session_id,omitempty"`
 	// Timestamp when the event occurred.
 	Timestamp *timestamppb.Timestamp `protobuf:"bytes,2,opt,name=timestamp,proto3" json:"timestamp,omitempty"`
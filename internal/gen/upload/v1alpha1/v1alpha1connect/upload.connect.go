@@ -56,11 +56,18 @@ const (
 	UploadNewProcedure = "/bucketeer.upload.v1alpha1.Upload/New"
 	// UploadAbortProcedure is the fully-qualified name of the Upload's Abort RPC.
 	UploadAbortProcedure = "/bucketeer.upload.v1alpha1.Upload/Abort"
+	// UploadAbortSessionProcedure is the fully-qualified name of the Upload's AbortSession RPC.
+	UploadAbortSessionProcedure = "/bucketeer.upload.v1alpha1.Upload/AbortSession"
 	// UploadCompleteProcedure is the fully-qualified name of the Upload's Complete RPC.
 	UploadCompleteProcedure = "/bucketeer.upload.v1alpha1.Upload/Complete"
 	// UploadPollForCompletionProcedure is the fully-qualified name of the Upload's PollForCompletion
 	// RPC.
 	UploadPollForCompletionProcedure = "/bucketeer.upload.v1alpha1.Upload/PollForCompletion"
+	// UploadProgressProcedure is the fully-qualified name of the Upload's Progress RPC.
+	UploadProgressProcedure = "/bucketeer.upload.v1alpha1.Upload/Progress"
+	// UploadGetReceivedRangesProcedure is the fully-qualified name of the Upload's GetReceivedRanges
+	// RPC.
+	UploadGetReceivedRangesProcedure = "/bucketeer.upload.v1alpha1.Upload/GetReceivedRanges"
 )
 
 // These variables are the protoreflect.Descriptor objects for the RPCs defined in this package.
@@ -68,24 +75,37 @@ var (
 	uploadServiceDescriptor                 = v1alpha1.File_upload_v1alpha1_upload_proto.Services().ByName("Upload")
 	uploadNewMethodDescriptor               = uploadServiceDescriptor.Methods().ByName("New")
 	uploadAbortMethodDescriptor             = uploadServiceDescriptor.Methods().ByName("Abort")
+	uploadAbortSessionMethodDescriptor      = uploadServiceDescriptor.Methods().ByName("AbortSession")
 	uploadCompleteMethodDescriptor          = uploadServiceDescriptor.Methods().ByName("Complete")
 	uploadPollForCompletionMethodDescriptor = uploadServiceDescriptor.Methods().ByName("PollForCompletion")
+	uploadProgressMethodDescriptor          = uploadServiceDescriptor.Methods().ByName("Progress")
+	uploadGetReceivedRangesMethodDescriptor = uploadServiceDescriptor.Methods().ByName("GetReceivedRanges")
 )
 
 // UploadClient is a client for the bucketeer.upload.v1alpha1.Upload service.
 type UploadClient interface {
 	// New initiates a new upload and returns a unique identifier for the upload.
-	New(context.Context, *connect.Request[v1alpha1.NewRequest]) (*connect.Response[wrapperspb.StringValue], error)
+	New(context.Context, *connect.Request[v1alpha1.NewRequest]) (*connect.Response[v1alpha1.NewResponse], error)
 	// Abort aborts an upload and cleans up any resources associated with it.
 	Abort(context.Context, *connect.Request[wrapperspb.StringValue]) (*connect.Response[emptypb.Empty], error)
+	// AbortSession aborts every upload created with the given session ID (eg.
+	// when a browser tab is closed), uploads that are already being completed
+	// are not affected.
+	AbortSession(context.Context, *connect.Request[wrapperspb.StringValue]) (*connect.Response[emptypb.Empty], error)
 	// Complete begins the process of completing an upload, data isn't guaranteed
 	// to be flushed to disk until PollForCompletion() returns a status of
 	// COMPLETED. We split this into two calls to allow for the possibility of a
 	// long-running completion process (eg. transferring to remote storage).
-	Complete(context.Context, *connect.Request[wrapperspb.StringValue]) (*connect.Response[emptypb.Empty], error)
+	Complete(context.Context, *connect.Request[v1alpha1.CompleteRequest]) (*connect.Response[emptypb.Empty], error)
 	// PollForCompletion polls for the completion of an upload (eg. has it been
 	// fully flushed to disk?)
 	PollForCompletion(context.Context, *connect.Request[wrapperspb.StringValue]) (*connect.Response[v1alpha1.CompleteResponse], error)
+	// Progress returns the number of bytes received so far for an upload, and
+	// once completion has begun, the number of bytes copied to the destination.
+	Progress(context.Context, *connect.Request[wrapperspb.StringValue]) (*connect.Response[v1alpha1.ProgressResponse], error)
+	// GetReceivedRanges returns the byte ranges of an upload that have been
+	// received so far, so that an interrupted upload can be resumed.
+	GetReceivedRanges(context.Context, *connect.Request[wrapperspb.StringValue]) (*connect.Response[v1alpha1.ReceivedRangesResponse], error)
 }
 
 // NewUploadClient constructs a client for the bucketeer.upload.v1alpha1.Upload service. By default,
@@ -98,7 +118,7 @@ type UploadClient interface {
 func NewUploadClient(httpClient connect.HTTPClient, baseURL string, opts ...connect.ClientOption) UploadClient {
 	baseURL = strings.TrimRight(baseURL, "/")
 	return &uploadClient{
-		new: connect.NewClient[v1alpha1.NewRequest, wrapperspb.StringValue](
+		new: connect.NewClient[v1alpha1.NewRequest, v1alpha1.NewResponse](
 			httpClient,
 			baseURL+UploadNewProcedure,
 			connect.WithSchema(uploadNewMethodDescriptor),
@@ -110,7 +130,13 @@ func NewUploadClient(httpClient connect.HTTPClient, baseURL string, opts ...conn
 			connect.WithSchema(uploadAbortMethodDescriptor),
 			connect.WithClientOptions(opts...),
 		),
-		complete: connect.NewClient[wrapperspb.StringValue, emptypb.Empty](
+		abortSession: connect.NewClient[wrapperspb.StringValue, emptypb.Empty](
+			httpClient,
+			baseURL+UploadAbortSessionProcedure,
+			connect.WithSchema(uploadAbortSessionMethodDescriptor),
+			connect.WithClientOptions(opts...),
+		),
+		complete: connect.NewClient[v1alpha1.CompleteRequest, emptypb.Empty](
 			httpClient,
 			baseURL+UploadCompleteProcedure,
 			connect.WithSchema(uploadCompleteMethodDescriptor),
@@ -122,19 +148,34 @@ func NewUploadClient(httpClient connect.HTTPClient, baseURL string, opts ...conn
 			connect.WithSchema(uploadPollForCompletionMethodDescriptor),
 			connect.WithClientOptions(opts...),
 		),
+		progress: connect.NewClient[wrapperspb.StringValue, v1alpha1.ProgressResponse](
+			httpClient,
+			baseURL+UploadProgressProcedure,
+			connect.WithSchema(uploadProgressMethodDescriptor),
+			connect.WithClientOptions(opts...),
+		),
+		getReceivedRanges: connect.NewClient[wrapperspb.StringValue, v1alpha1.ReceivedRangesResponse](
+			httpClient,
+			baseURL+UploadGetReceivedRangesProcedure,
+			connect.WithSchema(uploadGetReceivedRangesMethodDescriptor),
+			connect.WithClientOptions(opts...),
+		),
 	}
 }
 
 // uploadClient implements UploadClient.
 type uploadClient struct {
-	new               *connect.Client[v1alpha1.NewRequest, wrapperspb.StringValue]
+	new               *connect.Client[v1alpha1.NewRequest, v1alpha1.NewResponse]
 	abort             *connect.Client[wrapperspb.StringValue, emptypb.Empty]
-	complete          *connect.Client[wrapperspb.StringValue, emptypb.Empty]
+	abortSession      *connect.Client[wrapperspb.StringValue, emptypb.Empty]
+	complete          *connect.Client[v1alpha1.CompleteRequest, emptypb.Empty]
 	pollForCompletion *connect.Client[wrapperspb.StringValue, v1alpha1.CompleteResponse]
+	progress          *connect.Client[wrapperspb.StringValue, v1alpha1.ProgressResponse]
+	getReceivedRanges *connect.Client[wrapperspb.StringValue, v1alpha1.ReceivedRangesResponse]
 }
 
 // New calls bucketeer.upload.v1alpha1.Upload.New.
-func (c *uploadClient) New(ctx context.Context, req *connect.Request[v1alpha1.NewRequest]) (*connect.Response[wrapperspb.StringValue], error) {
+func (c *uploadClient) New(ctx context.Context, req *connect.Request[v1alpha1.NewRequest]) (*connect.Response[v1alpha1.NewResponse], error) {
 	return c.new.CallUnary(ctx, req)
 }
 
@@ -143,8 +184,13 @@ func (c *uploadClient) Abort(ctx context.Context, req *connect.Request[wrappersp
 	return c.abort.CallUnary(ctx, req)
 }
 
+// AbortSession calls bucketeer.upload.v1alpha1.Upload.AbortSession.
+func (c *uploadClient) AbortSession(ctx context.Context, req *connect.Request[wrapperspb.StringValue]) (*connect.Response[emptypb.Empty], error) {
+	return c.abortSession.CallUnary(ctx, req)
+}
+
 // Complete calls bucketeer.upload.v1alpha1.Upload.Complete.
-func (c *uploadClient) Complete(ctx context.Context, req *connect.Request[wrapperspb.StringValue]) (*connect.Response[emptypb.Empty], error) {
+func (c *uploadClient) Complete(ctx context.Context, req *connect.Request[v1alpha1.CompleteRequest]) (*connect.Response[emptypb.Empty], error) {
 	return c.complete.CallUnary(ctx, req)
 }
 
@@ -153,20 +199,40 @@ func (c *uploadClient) PollForCompletion(ctx context.Context, req *connect.Reque
 	return c.pollForCompletion.CallUnary(ctx, req)
 }
 
+// Progress calls bucketeer.upload.v1alpha1.Upload.Progress.
+func (c *uploadClient) Progress(ctx context.Context, req *connect.Request[wrapperspb.StringValue]) (*connect.Response[v1alpha1.ProgressResponse], error) {
+	return c.progress.CallUnary(ctx, req)
+}
+
+// GetReceivedRanges calls bucketeer.upload.v1alpha1.Upload.GetReceivedRanges.
+func (c *uploadClient) GetReceivedRanges(ctx context.Context, req *connect.Request[wrapperspb.StringValue]) (*connect.Response[v1alpha1.ReceivedRangesResponse], error) {
+	return c.getReceivedRanges.CallUnary(ctx, req)
+}
+
 // UploadHandler is an implementation of the bucketeer.upload.v1alpha1.Upload service.
 type UploadHandler interface {
 	// New initiates a new upload and returns a unique identifier for the upload.
-	New(context.Context, *connect.Request[v1alpha1.NewRequest]) (*connect.Response[wrapperspb.StringValue], error)
+	New(context.Context, *connect.Request[v1alpha1.NewRequest]) (*connect.Response[v1alpha1.NewResponse], error)
 	// Abort aborts an upload and cleans up any resources associated with it.
 	Abort(context.Context, *connect.Request[wrapperspb.StringValue]) (*connect.Response[emptypb.Empty], error)
+	// AbortSession aborts every upload created with the given session ID (eg.
+	// when a browser tab is closed), uploads that are already being completed
+	// are not affected.
+	AbortSession(context.Context, *connect.Request[wrapperspb.StringValue]) (*connect.Response[emptypb.Empty], error)
 	// Complete begins the process of completing an upload, data isn't guaranteed
 	// to be flushed to disk until PollForCompletion() returns a status of
 	// COMPLETED. We split this into two calls to allow for the possibility of a
 	// long-running completion process (eg. transferring to remote storage).
-	Complete(context.Context, *connect.Request[wrapperspb.StringValue]) (*connect.Response[emptypb.Empty], error)
+	Complete(context.Context, *connect.Request[v1alpha1.CompleteRequest]) (*connect.Response[emptypb.Empty], error)
 	// PollForCompletion polls for the completion of an upload (eg. has it been
 	// fully flushed to disk?)
 	PollForCompletion(context.Context, *connect.Request[wrapperspb.StringValue]) (*connect.Response[v1alpha1.CompleteResponse], error)
+	// Progress returns the number of bytes received so far for an upload, and
+	// once completion has begun, the number of bytes copied to the destination.
+	Progress(context.Context, *connect.Request[wrapperspb.StringValue]) (*connect.Response[v1alpha1.ProgressResponse], error)
+	// GetReceivedRanges returns the byte ranges of an upload that have been
+	// received so far, so that an interrupted upload can be resumed.
+	GetReceivedRanges(context.Context, *connect.Request[wrapperspb.StringValue]) (*connect.Response[v1alpha1.ReceivedRangesResponse], error)
 }
 
 // NewUploadHandler builds an HTTP handler from the service implementation. It returns the path on
@@ -187,6 +253,12 @@ func NewUploadHandler(svc UploadHandler, opts ...connect.HandlerOption) (string,
 		connect.WithSchema(uploadAbortMethodDescriptor),
 		connect.WithHandlerOptions(opts...),
 	)
+	uploadAbortSessionHandler := connect.NewUnaryHandler(
+		UploadAbortSessionProcedure,
+		svc.AbortSession,
+		connect.WithSchema(uploadAbortSessionMethodDescriptor),
+		connect.WithHandlerOptions(opts...),
+	)
 	uploadCompleteHandler := connect.NewUnaryHandler(
 		UploadCompleteProcedure,
 		svc.Complete,
@@ -199,16 +271,34 @@ func NewUploadHandler(svc UploadHandler, opts ...connect.HandlerOption) (string,
 		connect.WithSchema(uploadPollForCompletionMethodDescriptor),
 		connect.WithHandlerOptions(opts...),
 	)
+	uploadProgressHandler := connect.NewUnaryHandler(
+		UploadProgressProcedure,
+		svc.Progress,
+		connect.WithSchema(uploadProgressMethodDescriptor),
+		connect.WithHandlerOptions(opts...),
+	)
+	uploadGetReceivedRangesHandler := connect.NewUnaryHandler(
+		UploadGetReceivedRangesProcedure,
+		svc.GetReceivedRanges,
+		connect.WithSchema(uploadGetReceivedRangesMethodDescriptor),
+		connect.WithHandlerOptions(opts...),
+	)
 	return "/bucketeer.upload.v1alpha1.Upload/", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		switch r.URL.Path {
 		case UploadNewProcedure:
 			uploadNewHandler.ServeHTTP(w, r)
 		case UploadAbortProcedure:
 			uploadAbortHandler.ServeHTTP(w, r)
+		case UploadAbortSessionProcedure:
+			uploadAbortSessionHandler.ServeHTTP(w, r)
 		case UploadCompleteProcedure:
 			uploadCompleteHandler.ServeHTTP(w, r)
 		case UploadPollForCompletionProcedure:
 			uploadPollForCompletionHandler.ServeHTTP(w, r)
+		case UploadProgressProcedure:
+			uploadProgressHandler.ServeHTTP(w, r)
+		case UploadGetReceivedRangesProcedure:
+			uploadGetReceivedRangesHandler.ServeHTTP(w, r)
 		default:
 			http.NotFound(w, r)
 		}
@@ -218,7 +308,7 @@ func NewUploadHandler(svc UploadHandler, opts ...connect.HandlerOption) (string,
 // UnimplementedUploadHandler returns CodeUnimplemented from all methods.
 type UnimplementedUploadHandler struct{}
 
-func (UnimplementedUploadHandler) New(context.Context, *connect.Request[v1alpha1.NewRequest]) (*connect.Response[wrapperspb.StringValue], error) {
+func (UnimplementedUploadHandler) New(context.Context, *connect.Request[v1alpha1.NewRequest]) (*connect.Response[v1alpha1.NewResponse], error) {
 	return nil, connect.NewError(connect.CodeUnimplemented, errors.New("bucketeer.upload.v1alpha1.Upload.New is not implemented"))
 }
 
@@ -226,10 +316,22 @@ func (UnimplementedUploadHandler) Abort(context.Context, *connect.Request[wrappe
 	return nil, connect.NewError(connect.CodeUnimplemented, errors.New("bucketeer.upload.v1alpha1.Upload.Abort is not implemented"))
 }
 
-func (UnimplementedUploadHandler) Complete(context.Context, *connect.Request[wrapperspb.StringValue]) (*connect.Response[emptypb.Empty], error) {
+func (UnimplementedUploadHandler) AbortSession(context.Context, *connect.Request[wrapperspb.StringValue]) (*connect.Response[emptypb.Empty], error) {
+	return nil, connect.NewError(connect.CodeUnimplemented, errors.New("bucketeer.upload.v1alpha1.Upload.AbortSession is not implemented"))
+}
+
+func (UnimplementedUploadHandler) Complete(context.Context, *connect.Request[v1alpha1.CompleteRequest]) (*connect.Response[emptypb.Empty], error) {
 	return nil, connect.NewError(connect.CodeUnimplemented, errors.New("bucketeer.upload.v1alpha1.Upload.Complete is not implemented"))
 }
 
 func (UnimplementedUploadHandler) PollForCompletion(context.Context, *connect.Request[wrapperspb.StringValue]) (*connect.Response[v1alpha1.CompleteResponse], error) {
 	return nil, connect.NewError(connect.CodeUnimplemented, errors.New("bucketeer.upload.v1alpha1.Upload.PollForCompletion is not implemented"))
 }
+
+func (UnimplementedUploadHandler) Progress(context.Context, *connect.Request[wrapperspb.StringValue]) (*connect.Response[v1alpha1.ProgressResponse], error) {
+	return nil, connect.NewError(connect.CodeUnimplemented, errors.New("bucketeer.upload.v1alpha1.Upload.Progress is not implemented"))
+}
+
+func (UnimplementedUploadHandler) GetReceivedRanges(context.Context, *connect.Request[wrapperspb.StringValue]) (*connect.Response[v1alpha1.ReceivedRangesResponse], error) {
+	return nil, connect.NewError(connect.CodeUnimplemented, errors.New("bucketeer.upload.v1alpha1.Upload.GetReceivedRanges is not implemented"))
+}
@@ -0,0 +1,77 @@
+/* SPDX-License-Identifier: AGPL-3.0-or-later
+ *
+ * Copyright 2024 Damian Peckett <damian@pecke.tt>.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package health
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/bucket-sailor/writablefs"
+)
+
+// LivenessHandler reports that the server is up.
+func LivenessHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		_, _ = w.Write([]byte("OK"))
+	}
+}
+
+// ReadinessHandler reports whether the filesystems are reachable, by performing
+// a lightweight stat of each root directory.
+func ReadinessHandler(logger *slog.Logger, timeout time.Duration, filesystems ...writablefs.FS) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+
+		// Stat doesn't accept a context, so run it in the background.
+		errCh := make(chan error, len(filesystems))
+		for _, fsys := range filesystems {
+			go func(fsys writablefs.FS) {
+				_, err := fsys.Stat(".")
+				errCh <- err
+			}(fsys)
+		}
+
+		var err error
+		for range filesystems {
+			select {
+			case err = <-errCh:
+			case <-ctx.Done():
+				err = ctx.Err()
+			}
+
+			if err != nil {
+				break
+			}
+		}
+
+		if err != nil {
+			logger.Warn("Readiness check failed", "error", err)
+
+			http.Error(w, "Filesystem unavailable", http.StatusServiceUnavailable)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		_, _ = w.Write([]byte("OK"))
+	}
+}
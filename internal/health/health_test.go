@@ -0,0 +1,87 @@
+/* SPDX-License-Identifier: AGPL-3.0-or-later
+ *
+ * Copyright 2024 Damian Peckett <damian@pecke.tt>.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package health_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/bucket-sailor/bucketeer/internal/health"
+	"github.com/bucket-sailor/writablefs"
+	"github.com/bucket-sailor/writablefs/dirfs"
+	"github.com/neilotoole/slogt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadinessHandler(t *testing.T) {
+	logger := slogt.New(t)
+
+	t.Run("Ready", func(t *testing.T) {
+		fsys, err := dirfs.New(t.TempDir())
+		require.NoError(t, err)
+
+		rec := httptest.NewRecorder()
+		health.ReadinessHandler(logger, time.Second, fsys).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+
+		assert.Equal(t, http.StatusOK, rec.Code)
+	})
+
+	t.Run("Unavailable", func(t *testing.T) {
+		fsys, err := dirfs.New(filepath.Join(t.TempDir(), "missing"))
+		require.NoError(t, err)
+
+		rec := httptest.NewRecorder()
+		health.ReadinessHandler(logger, time.Second, fsys).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+
+		assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+	})
+
+	t.Run("One Unavailable", func(t *testing.T) {
+		fsys, err := dirfs.New(t.TempDir())
+		require.NoError(t, err)
+
+		missingFS, err := dirfs.New(filepath.Join(t.TempDir(), "missing"))
+		require.NoError(t, err)
+
+		rec := httptest.NewRecorder()
+		health.ReadinessHandler(logger, time.Second, fsys, missingFS).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+
+		assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+	})
+
+	t.Run("Timeout", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		health.ReadinessHandler(logger, 50*time.Millisecond, &slowFS{}).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+
+		assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+	})
+}
+
+type slowFS struct {
+	writablefs.FS
+}
+
+func (fsys *slowFS) Stat(path string) (writablefs.FileInfo, error) {
+	time.Sleep(time.Second)
+	return nil, nil
+}
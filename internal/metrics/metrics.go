@@ -0,0 +1,88 @@
+/* SPDX-License-Identifier: AGPL-3.0-or-later
+ *
+ * Copyright 2024 Damian Peckett <damian@pecke.tt>.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package metrics
+
+import (
+	"context"
+	"net/http"
+
+	"connectrpc.com/connect"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "bucketeer"
+
+var (
+	// CompletionQueueLength is the number of uploads waiting to be (or currently being) completed.
+	CompletionQueueLength = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "upload",
+		Name:      "completion_queue_length",
+		Help:      "The number of uploads waiting to be, or currently being, completed.",
+	})
+	// ChunksInFlight is the number of upload chunks currently being received.
+	ChunksInFlight = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "upload",
+		Name:      "chunks_in_flight",
+		Help:      "The number of upload chunks currently being received.",
+	})
+	// ChunkBytesWritten is the total number of bytes written to staged uploads.
+	ChunkBytesWritten = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "upload",
+		Name:      "chunk_bytes_written_total",
+		Help:      "The total number of bytes written to staged uploads.",
+	})
+	// DownloadBytesServed is the total number of bytes sent to clients downloading files and archives.
+	DownloadBytesServed = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "download",
+		Name:      "bytes_served_total",
+		Help:      "The total number of bytes sent to clients downloading files and archives.",
+	})
+	// RPCErrors is the number of failed RPCs by procedure and error code.
+	RPCErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "rpc",
+		Name:      "errors_total",
+		Help:      "The number of failed RPCs by procedure and error code.",
+	}, []string{"procedure", "code"})
+)
+
+// Handler returns a http handler that exposes the metrics in the Prometheus text format.
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
+
+// NewInterceptor returns a connect interceptor that records RPC errors.
+func NewInterceptor() connect.Interceptor {
+	return connect.UnaryInterceptorFunc(func(next connect.UnaryFunc) connect.UnaryFunc {
+		return func(ctx context.Context, req connect.AnyRequest) (connect.AnyResponse, error) {
+			resp, err := next(ctx, req)
+			if err != nil {
+				RPCErrors.WithLabelValues(req.Spec().Procedure, connect.CodeOf(err).String()).Inc()
+			}
+
+			return resp, err
+		}
+	})
+}
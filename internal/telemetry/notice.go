@@ -0,0 +1,53 @@
+/* SPDX-License-Identifier: AGPL-3.0-or-later
+ *
+ * Copyright 2024 Damian Peckett <damian@pecke.tt>.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package telemetry
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+const notice = `Bucketeer can optionally report anonymous crash and usage data: the application
+version, operating system, architecture, memory size, CPU model and count, S3
+provider, and any errors from the web interface. Telemetry is disabled by
+default, to help improve Bucketeer enable it with --telemetry (or
+BUCKETEER_TELEMETRY=1).`
+
+// ShowNoticeOnce writes the telemetry notice to w, unless it has already been
+// shown (as recorded by the presence of the marker file).
+func ShowNoticeOnce(w io.Writer, markerPath string) error {
+	if _, err := os.Stat(markerPath); err == nil {
+		return nil
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	if _, err := fmt.Fprintln(w, notice); err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(markerPath), 0o755); err != nil {
+		return err
+	}
+
+	return os.WriteFile(markerPath, nil, 0o644)
+}
@@ -0,0 +1,41 @@
+/* SPDX-License-Identifier: AGPL-3.0-or-later
+ *
+ * Copyright 2024 Damian Peckett <damian@pecke.tt>.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package telemetry_test
+
+import (
+	"bytes"
+	"path/filepath"
+	"testing"
+
+	"github.com/bucket-sailor/bucketeer/internal/telemetry"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestShowNoticeOnce(t *testing.T) {
+	markerPath := filepath.Join(t.TempDir(), "bucketeer", "telemetry-notice")
+
+	var buf bytes.Buffer
+	require.NoError(t, telemetry.ShowNoticeOnce(&buf, markerPath))
+	assert.Contains(t, buf.String(), "--telemetry")
+
+	buf.Reset()
+	require.NoError(t, telemetry.ShowNoticeOnce(&buf, markerPath))
+	assert.Empty(t, buf.String())
+}
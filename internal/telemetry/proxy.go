@@ -27,6 +27,7 @@ import (
 	"github.com/bucket-sailor/bucketeer/internal/constants"
 	"github.com/bucket-sailor/bucketeer/internal/gen/telemetry/v1alpha1"
 	"github.com/bucket-sailor/bucketeer/internal/gen/telemetry/v1alpha1/v1alpha1connect"
+	"github.com/bucket-sailor/bucketeer/internal/metrics"
 	"google.golang.org/protobuf/types/known/emptypb"
 )
 
@@ -44,7 +45,7 @@ func NewProxyServer(logger *slog.Logger, reporter Reporter) (string, http.Handle
 	}
 
 	var path string
-	path, s.Handler = v1alpha1connect.NewTelemetryHandler(s)
+	path, s.Handler = v1alpha1connect.NewTelemetryHandler(s, connect.WithInterceptors(metrics.NewInterceptor()))
 
 	s.Handler = http.StripPrefix("/api", s.Handler)
 
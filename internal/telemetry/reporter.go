@@ -22,7 +22,6 @@ import (
 	"context"
 	"io"
 	"log/slog"
-	"os"
 
 	"connectrpc.com/connect"
 	"github.com/bucket-sailor/bucketeer/internal/constants"
@@ -32,11 +31,6 @@ import (
 	"google.golang.org/protobuf/types/known/timestamppb"
 )
 
-const (
-	// If set to any non-empty value, telemetry reporting will be disabled.
-	telemetryOptOutEnvVar = "BUCKETEER_NO_TELEMETRY"
-)
-
 type Reporter interface {
 	io.Closer
 	ReportStart(ctx context.Context, endpointURL string) error
@@ -51,9 +45,9 @@ type RemoteReporter struct {
 	processID string
 }
 
-func NewRemoteReporter(ctx context.Context, logger *slog.Logger, httpClient connect.HTTPClient, baseURL string) Reporter {
-	enabled := os.Getenv(telemetryOptOutEnvVar) == ""
-
+// NewRemoteReporter creates a new reporter that sends events to the telemetry
+// server at baseURL, events are only sent if enabled is true (telemetry is opt-in).
+func NewRemoteReporter(ctx context.Context, logger *slog.Logger, httpClient connect.HTTPClient, baseURL string, enabled bool) Reporter {
 	logger = logger.WithGroup("telemetry")
 	if !enabled {
 		logger.Info("Telemetry reporting is disabled")
@@ -20,10 +20,15 @@ package telemetry
 
 import (
 	"fmt"
+	"net"
 	"net/url"
 	"strings"
 )
 
+// selfHostedProvider is reported for endpoints that aren't addressed by a
+// public domain name (eg. IP addresses, or "minio" on a docker network).
+const selfHostedProvider = "self-hosted"
+
 // StripS3EndpointURL removes user identifiable information from an S3 endpoint URL.
 func StripS3EndpointURL(endpointURL string) (string, error) {
 	u, err := url.Parse(endpointURL)
@@ -31,9 +36,20 @@ func StripS3EndpointURL(endpointURL string) (string, error) {
 		return "", err
 	}
 
-	hostParts := strings.Split(u.Host, ".")
+	// Hostname() strips the port and the brackets around IPv6 addresses.
+	host := strings.TrimSuffix(u.Hostname(), ".")
+	if host == "" {
+		return "", fmt.Errorf("missing host")
+	}
+
+	// Even a partial IP address could identify the user.
+	if net.ParseIP(host) != nil {
+		return selfHostedProvider, nil
+	}
+
+	hostParts := strings.Split(host, ".")
 	if len(hostParts) < 2 {
-		return "", fmt.Errorf("invalid domain structure")
+		return selfHostedProvider, nil
 	}
 
 	return strings.Join(hostParts[len(hostParts)-2:], "."), nil
@@ -0,0 +1,53 @@
+/* SPDX-License-Identifier: AGPL-3.0-or-later
+ *
+ * Copyright 2024 Damian Peckett <damian@pecke.tt>.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package telemetry_test
+
+import (
+	"testing"
+
+	"github.com/bucket-sailor/bucketeer/internal/telemetry"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStripS3EndpointURL(t *testing.T) {
+	for _, tc := range []struct {
+		endpointURL string
+		expected    string
+	}{
+		{"https://s3.us-east-1.amazonaws.com", "amazonaws.com"},
+		{"https://my-bucket.s3.us-east-1.amazonaws.com:443", "amazonaws.com"},
+		{"https://storage.googleapis.com.", "googleapis.com"},
+		{"http://192.168.1.10:9000", "self-hosted"},
+		{"http://[fd00::1]:9000", "self-hosted"},
+		{"http://[::1]", "self-hosted"},
+		{"http://localhost:9000", "self-hosted"},
+		{"http://minio:9000", "self-hosted"},
+	} {
+		provider, err := telemetry.StripS3EndpointURL(tc.endpointURL)
+		require.NoError(t, err)
+
+		assert.Equal(t, tc.expected, provider, tc.endpointURL)
+	}
+
+	t.Run("Missing Host", func(t *testing.T) {
+		_, err := telemetry.StripS3EndpointURL("not a url")
+		require.Error(t, err)
+	})
+}
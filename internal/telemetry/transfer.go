@@ -0,0 +1,49 @@
+/* SPDX-License-Identifier: AGPL-3.0-or-later
+ *
+ * Copyright 2024 Damian Peckett <damian@pecke.tt>.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package telemetry
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/bucket-sailor/bucketeer/internal/gen/telemetry/v1alpha1"
+)
+
+// Names of transfer events.
+const (
+	EventUploadComplete   = "UploadComplete"
+	EventDownloadComplete = "DownloadComplete"
+)
+
+// ReportTransfer reports the size and duration of a completed upload or
+// download. For privacy reasons, no paths or file names are included.
+// Events are reported in the background so as not to delay the transfer.
+func ReportTransfer(reporter Reporter, name string, bytes int64, duration time.Duration) {
+	if reporter == nil {
+		return
+	}
+
+	go reporter.ReportEvent(&v1alpha1.TelemetryEvent{
+		Name: name,
+		Values: map[string]string{
+			"bytes":      strconv.FormatInt(bytes, 10),
+			"durationMs": strconv.FormatInt(duration.Milliseconds(), 10),
+		},
+	})
+}
@@ -0,0 +1,57 @@
+/* SPDX-License-Identifier: AGPL-3.0-or-later
+ *
+ * Copyright 2024 Damian Peckett <damian@pecke.tt>.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package telemetry_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/bucket-sailor/bucketeer/internal/gen/telemetry/v1alpha1"
+	"github.com/bucket-sailor/bucketeer/internal/telemetry"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReportTransfer(t *testing.T) {
+	mockReporter := &mockTelemetryReporter{}
+
+	events := make(chan *v1alpha1.TelemetryEvent, 1)
+	mockReporter.On("ReportEvent", mock.Anything).Run(func(args mock.Arguments) {
+		events <- args.Get(0).(*v1alpha1.TelemetryEvent)
+	}).Return()
+
+	telemetry.ReportTransfer(mockReporter, telemetry.EventUploadComplete, 1024, 1500*time.Millisecond)
+
+	var event *v1alpha1.TelemetryEvent
+	select {
+	case event = <-events:
+	case <-time.After(10 * time.Second):
+		require.FailNow(t, "timed out waiting for event")
+	}
+
+	assert.Equal(t, telemetry.EventUploadComplete, event.Name)
+	assert.Equal(t, map[string]string{
+		"bytes":      "1024",
+		"durationMs": "1500",
+	}, event.Values)
+
+	// A nil reporter is a no-op.
+	telemetry.ReportTransfer(nil, telemetry.EventDownloadComplete, 1024, time.Second)
+}
@@ -0,0 +1,158 @@
+/* SPDX-License-Identifier: AGPL-3.0-or-later
+ *
+ * Copyright 2024 Damian Peckett <damian@pecke.tt>.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package upload
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"path/filepath"
+
+	"github.com/bucket-sailor/bucketeer/internal/util"
+	"github.com/bucket-sailor/writablefs"
+)
+
+// cacheStatus is the response body of the cache status endpoint.
+type cacheStatus struct {
+	// TotalBytes is the size of the filesystem containing the cache directory.
+	TotalBytes uint64 `json:"totalBytes"`
+	// FreeBytes is the space available for staging uploads.
+	FreeBytes uint64 `json:"freeBytes"`
+	// InFlightUploads is the number of staged uploads that haven't completed.
+	InFlightUploads int `json:"inFlightUploads"`
+}
+
+type CacheStatusServer struct {
+	http.Handler
+	logger   *slog.Logger
+	cacheFS  writablefs.FS
+	cacheDir string
+}
+
+// NewCacheStatusServer creates a new server reporting the free space of the
+// upload cache, only the CacheDir option is used.
+func NewCacheStatusServer(logger *slog.Logger, cacheFS writablefs.FS, opts *ServerOptions) (string, http.Handler) {
+	s := &CacheStatusServer{
+		logger:  logger.WithGroup("upload"),
+		cacheFS: cacheFS,
+	}
+
+	if opts != nil {
+		s.cacheDir = opts.CacheDir
+	}
+
+	mux := http.NewServeMux()
+	s.Handler = mux
+
+	mux.HandleFunc("/api/v1alpha1/fs/cache-status", s.handleCacheStatus)
+
+	return "/api/v1alpha1/fs/cache-status", s
+}
+
+func (s *CacheStatusServer) handleCacheStatus(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if s.cacheDir == "" {
+		http.Error(w, "Cache directory not configured", http.StatusNotImplemented)
+		return
+	}
+
+	var status cacheStatus
+
+	var err error
+	status.TotalBytes, status.FreeBytes, err = util.DiskSpace(s.cacheDir)
+	if err != nil {
+		s.logger.Warn("Error getting cache free space", "error", err)
+
+		http.Error(w, "Error getting free space", http.StatusInternalServerError)
+		return
+	}
+
+	status.InFlightUploads, err = s.countInFlightUploads()
+	if err != nil {
+		s.logger.Warn("Error counting in-flight uploads", "error", err)
+
+		http.Error(w, "Error counting in-flight uploads", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+
+	if err := json.NewEncoder(w).Encode(&status); err != nil {
+		s.logger.Warn("Error writing cache status", "error", err)
+	}
+}
+
+// countInFlightUploads returns the number of staged uploads that haven't
+// completed (or failed).
+func (s *CacheStatusServer) countInFlightUploads() (int, error) {
+	entries, err := s.cacheFS.ReadDir(cacheDir)
+	if err != nil {
+		if errors.Is(err, writablefs.ErrNotExist) {
+			return 0, nil
+		}
+
+		return 0, fmt.Errorf("error reading cache directory: %w", err)
+	}
+
+	var n int
+	for _, entry := range entries {
+		complete, err := s.isComplete(filepath.Join(cacheDir, entry.Name()))
+		if err != nil {
+			// Probably removed while we were counting.
+			if errors.Is(err, writablefs.ErrNotExist) {
+				continue
+			}
+
+			return 0, err
+		}
+
+		if !complete {
+			n++
+		}
+	}
+
+	return n, nil
+}
+
+func (s *CacheStatusServer) isComplete(cachePath string) (bool, error) {
+	f, err := s.cacheFS.OpenFile(cachePath, writablefs.FlagReadOnly)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+
+	xattrs, err := f.XAttrs()
+	if err != nil {
+		return false, fmt.Errorf("error getting xattrs: %w", err)
+	}
+
+	complete, err := xattrs.Get(xAttrComplete)
+	if err != nil && !errors.Is(err, writablefs.ErrNoSuchAttr) {
+		return false, fmt.Errorf("error getting complete xattr: %w", err)
+	}
+
+	return string(complete) == "true", nil
+}
@@ -19,50 +19,265 @@
 package upload
 
 import (
+	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding"
+	"encoding/base64"
 	"encoding/hex"
+	"errors"
 	"fmt"
+	"hash"
+	"hash/crc32"
 	"io"
+	"strconv"
 	"strings"
 
+	"github.com/bucket-sailor/writablefs"
 	"github.com/cespare/xxhash/v2"
+	"github.com/minio/minio-go/v7"
+	"github.com/zeebo/xxh3"
 )
 
+// Supported checksum algorithms.
 const (
-	algorithmXXH64 = "xxh64"
+	AlgorithmXXH64 = "xxh64"
+	// AlgorithmXXH3 is the 128-bit variant of XXH3.
+	AlgorithmXXH3   = "xxh3"
+	AlgorithmSHA256 = "sha256"
+	AlgorithmMD5    = "md5"
+	AlgorithmCRC32C = "crc32c"
 )
 
 func verifyChecksum(r io.Reader, expected string) error {
-	var algorithm string
-	if strings.Contains(expected, ":") {
-		parts := strings.SplitN(expected, ":", 2)
-		if len(parts) != 2 {
-			return fmt.Errorf("invalid checksum format: %s", expected)
-		}
+	actual, err := checksum(r, checksumAlgorithm(expected))
+	if err != nil {
+		return err
+	}
+
+	return compareChecksums(expected, actual)
+}
 
-		algorithm = parts[0]
+func compareChecksums(expected, actual string) error {
+	if actual != expected {
+		return fmt.Errorf("checksum mismatch: expected %s, got %s", expected, actual)
 	}
 
-	actual, err := checksum(r, algorithm)
+	return nil
+}
+
+// validateChecksum checks that a checksum is of the form algorithm:hex, with a
+// supported algorithm and a digest of the right length.
+func validateChecksum(checksum string) error {
+	algorithm, digest, found := strings.Cut(checksum, ":")
+	if !found {
+		return fmt.Errorf("invalid checksum %q: expected algorithm:hex", checksum)
+	}
+
+	h, err := newHash(algorithm)
 	if err != nil {
 		return err
 	}
 
-	if actual != expected {
-		return fmt.Errorf("checksum mismatch: expected %s, got %s", expected, actual)
+	if decoded, err := hex.DecodeString(digest); err != nil || len(decoded) != h.Size() {
+		return fmt.Errorf("invalid %s checksum: expected %d hex characters", algorithm, h.Size()*2)
 	}
 
 	return nil
 }
 
+// checksumAlgorithm returns the algorithm prefix of an "algorithm:hex" checksum.
+func checksumAlgorithm(checksum string) string {
+	algorithm, _, found := strings.Cut(checksum, ":")
+	if !found {
+		return ""
+	}
+
+	return algorithm
+}
+
+// checksumFromS3 maps the checksum S3 has stored for an object into the
+// "algorithm:hex" format, returning an empty string if there is no usable
+// checksum. Checksums of multipart objects are of the parts rather than the
+// object's contents, so they are ignored.
+func checksumFromS3(info minio.ObjectInfo) string {
+	for _, stored := range []struct {
+		algorithm string
+		value     string
+	}{
+		{AlgorithmSHA256, info.ChecksumSHA256},
+		{AlgorithmCRC32C, info.ChecksumCRC32C},
+	} {
+		if stored.value == "" || strings.Contains(stored.value, "-") {
+			continue
+		}
+
+		digest, err := base64.StdEncoding.DecodeString(stored.value)
+		if err != nil {
+			continue
+		}
+
+		return fmt.Sprintf("%s:%s", stored.algorithm, hex.EncodeToString(digest))
+	}
+
+	// The ETag of an object uploaded in a single part is its MD5 digest, unless
+	// it's encrypted with KMS or a customer provided key.
+	encrypted := info.Metadata.Get("X-Amz-Server-Side-Encryption") == "aws:kms" ||
+		info.Metadata.Get("X-Amz-Server-Side-Encryption-Customer-Algorithm") != ""
+	if !encrypted && len(info.ETag) == hex.EncodedLen(md5.Size) {
+		if _, err := hex.DecodeString(info.ETag); err == nil {
+			return fmt.Sprintf("%s:%s", AlgorithmMD5, strings.ToLower(info.ETag))
+		}
+	}
+
+	return ""
+}
+
 func checksum(r io.Reader, algorithm string) (string, error) {
-	if algorithm != algorithmXXH64 {
-		return "", fmt.Errorf("unsupported checksum algorithm: %s", algorithm)
+	h, err := newHash(algorithm)
+	if err != nil {
+		return "", err
 	}
 
-	h := xxhash.New()
 	if _, err := io.Copy(h, r); err != nil {
 		return "", err
 	}
 
-	return fmt.Sprintf("xxh64:%s", hex.EncodeToString(h.Sum(nil))), nil
+	return fmt.Sprintf("%s:%s", algorithm, hex.EncodeToString(h.Sum(nil))), nil
+}
+
+// checksumSectionSize is how much of a file is hashed between checks for
+// cancellation.
+const checksumSectionSize = 4 << 20 // 4MiB
+
+// checksumReaderAt returns the checksum of the first size bytes of r. It's read
+// a section at a time, so that it stops early if ctx is cancelled.
+func checksumReaderAt(ctx context.Context, r io.ReaderAt, size int64, algorithm string) (string, error) {
+	h, err := newHash(algorithm)
+	if err != nil {
+		return "", err
+	}
+
+	for offset := int64(0); offset < size; offset += checksumSectionSize {
+		if err := ctx.Err(); err != nil {
+			return "", err
+		}
+
+		if _, err := io.Copy(h, io.NewSectionReader(r, offset, min(checksumSectionSize, size-offset))); err != nil {
+			return "", err
+		}
+	}
+
+	return fmt.Sprintf("%s:%s", algorithm, hex.EncodeToString(h.Sum(nil))), nil
+}
+
+func newHash(algorithm string) (hash.Hash, error) {
+	switch algorithm {
+	case AlgorithmXXH64:
+		return xxhash.New(), nil
+	case AlgorithmXXH3:
+		return &xxh3Hash{Hasher: xxh3.New()}, nil
+	case AlgorithmSHA256:
+		return sha256.New(), nil
+	case AlgorithmMD5:
+		return md5.New(), nil
+	case AlgorithmCRC32C:
+		return crc32.New(crc32.MakeTable(crc32.Castagnoli)), nil
+	default:
+		return nil, fmt.Errorf("unsupported checksum algorithm: %q", algorithm)
+	}
+}
+
+// xxh3Hash produces the 128-bit XXH3 digest (the embedded hasher's Sum is
+// of the 64-bit variant).
+type xxh3Hash struct {
+	*xxh3.Hasher
+}
+
+func (h *xxh3Hash) Size() int { return 16 }
+
+func (h *xxh3Hash) Sum(b []byte) []byte {
+	sum := h.Sum128().Bytes()
+	return append(b, sum[:]...)
+}
+
+// streamingHash is a checksum computed incrementally as chunks arrive in
+// order. Its state is persisted in the cache file's xattrs between chunks so
+// that completion doesn't need to re-read the whole file.
+type streamingHash struct {
+	hash.Hash
+	algorithm string
+	// offset is the number of bytes (from the start of the file) hashed so far.
+	offset int64
+}
+
+// loadStreamingHash restores the streaming hash for an upload.
+func loadStreamingHash(xattrs writablefs.ExtendedAttributes) (*streamingHash, error) {
+	expectedChecksum, err := xattrs.Get(xAttrChecksum)
+	if err != nil {
+		return nil, fmt.Errorf("error getting checksum xattr: %w", err)
+	}
+
+	algorithm := checksumAlgorithm(string(expectedChecksum))
+
+	h, err := newHash(algorithm)
+	if err != nil {
+		return nil, err
+	}
+
+	// The state of some hashes (eg. xxh3) can't be persisted.
+	if _, ok := h.(encoding.BinaryUnmarshaler); !ok {
+		return nil, fmt.Errorf("checksum algorithm %q doesn't support streaming", algorithm)
+	}
+
+	sh := &streamingHash{Hash: h, algorithm: algorithm}
+
+	offset, err := xattrs.Get(xAttrHashOffset)
+	if err != nil {
+		// Nothing has been hashed yet.
+		if errors.Is(err, writablefs.ErrNoSuchAttr) {
+			return sh, nil
+		}
+
+		return nil, fmt.Errorf("error getting hash offset xattr: %w", err)
+	}
+
+	sh.offset, err = strconv.ParseInt(string(offset), 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing hash offset xattr: %w", err)
+	}
+
+	state, err := xattrs.Get(xAttrHashState)
+	if err != nil {
+		return nil, fmt.Errorf("error getting hash state xattr: %w", err)
+	}
+
+	if err := h.(encoding.BinaryUnmarshaler).UnmarshalBinary(state); err != nil {
+		return nil, fmt.Errorf("error restoring hash state: %w", err)
+	}
+
+	return sh, nil
+}
+
+// save persists the state of the streaming hash.
+func (sh *streamingHash) save(xattrs writablefs.ExtendedAttributes) error {
+	state, err := sh.Hash.(encoding.BinaryMarshaler).MarshalBinary()
+	if err != nil {
+		return fmt.Errorf("error saving hash state: %w", err)
+	}
+
+	if err := xattrs.Set(xAttrHashState, state); err != nil {
+		return fmt.Errorf("error setting hash state xattr: %w", err)
+	}
+
+	if err := xattrs.Set(xAttrHashOffset, []byte(strconv.FormatInt(sh.offset, 10))); err != nil {
+		return fmt.Errorf("error setting hash offset xattr: %w", err)
+	}
+
+	return nil
+}
+
+// checksum returns the checksum of the data hashed so far.
+func (sh *streamingHash) checksum() string {
+	return fmt.Sprintf("%s:%s", sh.algorithm, hex.EncodeToString(sh.Sum(nil)))
 }
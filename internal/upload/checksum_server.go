@@ -0,0 +1,187 @@
+/* SPDX-License-Identifier: AGPL-3.0-or-later
+ *
+ * Copyright 2024 Damian Peckett <damian@pecke.tt>.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package upload
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/bucket-sailor/writablefs"
+	"github.com/hashicorp/golang-lru/v2/expirable"
+)
+
+const (
+	// checksumCacheMaxSize and checksumCacheTTL bound how many computed
+	// checksums are cached, and for how long.
+	checksumCacheMaxSize = 1000
+	checksumCacheTTL     = time.Hour
+	// defaultChecksumAlgorithm is used if the request doesn't specify one.
+	defaultChecksumAlgorithm = AlgorithmSHA256
+)
+
+type ChecksumServer struct {
+	http.Handler
+	logger   *slog.Logger
+	fsys     writablefs.FS
+	readOnly bool
+	// cache holds recently computed checksums, keyed by path, algorithm and
+	// the size / modification time of the file (so that changes are noticed).
+	cache *expirable.LRU[string, string]
+}
+
+// NewChecksumServer creates a new server for computing the checksums of
+// existing files on demand (eg. for integrity audits). Checksums are stored
+// on the file (unless the server is read-only), only the ReadOnly option is
+// used.
+func NewChecksumServer(logger *slog.Logger, fsys writablefs.FS, opts *ServerOptions) (string, http.Handler) {
+	s := &ChecksumServer{
+		logger: logger.WithGroup("checksum"),
+		fsys:   fsys,
+		cache:  expirable.NewLRU[string, string](checksumCacheMaxSize, nil, checksumCacheTTL),
+	}
+
+	if opts != nil {
+		s.readOnly = opts.ReadOnly
+	}
+
+	mux := http.NewServeMux()
+	s.Handler = mux
+
+	mux.HandleFunc("/api/v1alpha1/fs/checksum", s.handleChecksum)
+
+	return "/api/v1alpha1/fs/checksum", s
+}
+
+type checksumResponse struct {
+	Algorithm string `json:"algorithm"`
+	Hex       string `json:"hex"`
+}
+
+func (s *ChecksumServer) handleChecksum(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	query := r.URL.Query()
+
+	p := query.Get("path")
+	if p == "" {
+		http.Error(w, "Missing path", http.StatusBadRequest)
+		return
+	}
+	p = path.Clean(p)
+
+	algorithm := strings.ToLower(query.Get("algorithm"))
+	if algorithm == "" {
+		algorithm = defaultChecksumAlgorithm
+	}
+
+	if _, err := newHash(algorithm); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	fi, err := s.fsys.Stat(p)
+	if err != nil {
+		if errors.Is(err, writablefs.ErrNotExist) {
+			http.Error(w, "File not found", http.StatusNotFound)
+			return
+		}
+
+		http.Error(w, "Error getting file info", http.StatusInternalServerError)
+		return
+	}
+
+	if fi.IsDir() {
+		http.Error(w, "Path is a directory", http.StatusBadRequest)
+		return
+	}
+
+	sum, ok := s.cache.Get(checksumCacheKey(p, algorithm, fi))
+	if !ok {
+		sum, err = s.compute(p, algorithm)
+		if err != nil {
+			if errors.Is(err, writablefs.ErrNotExist) {
+				http.Error(w, "File not found", http.StatusNotFound)
+				return
+			}
+
+			s.logger.Error("Error computing checksum", "path", p, "error", err)
+
+			http.Error(w, "Error computing checksum", http.StatusInternalServerError)
+			return
+		}
+
+		s.cache.Add(checksumCacheKey(p, algorithm, fi), sum)
+
+		s.store(p, algorithm, sum)
+	}
+
+	resp := checksumResponse{
+		Algorithm: algorithm,
+		Hex:       strings.TrimPrefix(sum, algorithm+":"),
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(&resp); err != nil {
+		s.logger.Warn("Error writing checksum response", "error", err)
+	}
+}
+
+func (s *ChecksumServer) compute(p, algorithm string) (string, error) {
+	s.logger.Debug("Computing checksum", "path", p, "algorithm", algorithm)
+
+	f, err := s.fsys.OpenFile(p, writablefs.FlagReadOnly)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	return checksum(f, algorithm)
+}
+
+// store records the checksum on the file, so that downloads can report it.
+func (s *ChecksumServer) store(p, algorithm, sum string) {
+	if s.readOnly {
+		return
+	}
+
+	// Not all filesystems support metadata, so this isn't fatal.
+	if err := setMetadata(s.fsys, p, map[string]string{xAttrChecksum: sum}); err != nil {
+		s.logger.Warn("Error storing checksum", "path", p, "error", err)
+		return
+	}
+
+	// Some filesystems (eg. S3) update the modification time when metadata
+	// is changed, which would otherwise invalidate the cached result.
+	if fi, err := s.fsys.Stat(p); err == nil {
+		s.cache.Add(checksumCacheKey(p, algorithm, fi), sum)
+	}
+}
+
+func checksumCacheKey(p, algorithm string, fi writablefs.FileInfo) string {
+	return fmt.Sprintf("%s\x00%s\x00%d\x00%d", p, algorithm, fi.Size(), fi.ModTime().UnixNano())
+}
@@ -19,6 +19,9 @@
 package upload
 
 import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
 	"context"
 	"errors"
 	"fmt"
@@ -27,27 +30,92 @@ import (
 	"mime/multipart"
 	"net/http"
 	"path/filepath"
+	"strconv"
+	"strings"
 	"sync"
+	"time"
 
+	"github.com/bucket-sailor/bucketeer/internal/metrics"
 	"github.com/bucket-sailor/bucketeer/internal/util/contentrange"
-	"github.com/bucket-sailor/rangelock"
 	"github.com/bucket-sailor/writablefs"
 	"github.com/google/uuid"
 )
 
+// errChunkConflict is returned when a chunk overlaps a previously received
+// range but contains different data.
+var errChunkConflict = errors.New("chunk conflicts with previously received data")
+
+// errChunkOutOfRange is returned when a chunk extends beyond the declared size
+// of the upload.
+var errChunkOutOfRange = errors.New("chunk extends beyond the declared upload size")
+
+// errChunkSizeMismatch is returned when the total size in a chunk's
+// Content-Range header doesn't match the declared size of the upload.
+var errChunkSizeMismatch = errors.New("content-range total does not match the declared upload size")
+
+// errMissingContentRange is returned when neither a chunk nor the request
+// carries a Content-Range header.
+var errMissingContentRange = errors.New("missing content-range header")
+
+// errInvalidContentRange is returned when a chunk's Content-Range header can't
+// be parsed.
+var errInvalidContentRange = errors.New("invalid content-range header")
+
+// errUnsupportedContentEncoding is returned when a chunk is encoded with
+// something other than gzip.
+var errUnsupportedContentEncoding = errors.New("unsupported content-encoding")
+
+// errInvalidChunkEncoding is returned when an encoded chunk can't be decoded.
+var errInvalidChunkEncoding = errors.New("error decoding chunk")
+
+// errShortChunk is returned when a chunk contains less data than its
+// Content-Range header declares (eg. the client disconnected mid-part).
+var errShortChunk = errors.New("chunk is shorter than its content-range")
+
+// errLockTimeout is returned when an overlapping chunk holds the range lock for
+// too long (eg. because the client uploading it went away).
+var errLockTimeout = errors.New("timed out waiting for an overlapping chunk")
+
+const (
+	defaultLockTimeout = 60 * time.Second
+	// lockRetryAfter is how long clients are asked to wait before retrying a
+	// chunk that timed out waiting for a lock.
+	lockRetryAfter = 5 * time.Second
+)
+
+// errReadOnly is returned when attempting to upload to a read-only server.
+var errReadOnly = errors.New("server is in read-only mode")
+
 type ChunkServer struct {
 	http.Handler
-	logger     *slog.Logger
-	fsys       writablefs.FS
-	cacheFS    writablefs.FS
-	rangeLocks sync.Map
+	logger      *slog.Logger
+	fsys        writablefs.FS
+	cacheFS     writablefs.FS
+	readOnly    bool
+	rangeLocks  *RangeLocks
+	lockTimeout time.Duration
+	// receivedMu serializes updates to the received ranges xattr.
+	receivedMu sync.Mutex
 }
 
-func NewChunkServer(logger *slog.Logger, fsys, cacheFS writablefs.FS) (string, http.Handler) {
+// NewChunkServer creates a new chunk server, only the ReadOnly, RangeLocks and
+// LockTimeout options are used.
+func NewChunkServer(logger *slog.Logger, fsys, cacheFS writablefs.FS, opts *ServerOptions) (string, http.Handler) {
 	s := &ChunkServer{
-		logger:  logger.WithGroup("upload"),
-		fsys:    fsys,
-		cacheFS: cacheFS,
+		logger:      logger.WithGroup("upload"),
+		fsys:        fsys,
+		cacheFS:     cacheFS,
+		readOnly:    opts != nil && opts.ReadOnly,
+		rangeLocks:  NewRangeLocks(),
+		lockTimeout: defaultLockTimeout,
+	}
+
+	if opts != nil && opts.RangeLocks != nil {
+		s.rangeLocks = opts.RangeLocks
+	}
+
+	if opts != nil && opts.LockTimeout > 0 {
+		s.lockTimeout = opts.LockTimeout
 	}
 
 	mux := http.NewServeMux()
@@ -59,11 +127,24 @@ func NewChunkServer(logger *slog.Logger, fsys, cacheFS writablefs.FS) (string, h
 }
 
 func (s *ChunkServer) handleUpload(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodGet || r.Method == http.MethodHead {
+		s.handleRead(w, r)
+		return
+	}
+
 	if r.Method != http.MethodPatch {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
+	if s.readOnly {
+		http.Error(w, "Server is in read-only mode", http.StatusForbidden)
+		return
+	}
+
+	metrics.ChunksInFlight.Inc()
+	defer metrics.ChunksInFlight.Dec()
+
 	multipartReader, err := r.MultipartReader()
 	if err != nil {
 		http.Error(w, "Error reading multipart request", http.StatusInternalServerError)
@@ -84,15 +165,15 @@ func (s *ChunkServer) handleUpload(w http.ResponseWriter, r *http.Request) {
 		if part.FormName() == "file" {
 			// Fallback to the global content range header if the part doesn't have one.
 			// Setting part headers from JS is a bit of a pain, so this is a workaround
-			// for cases with a single part.
+			// for cases with a single part (the request must then have the header).
 			if part.Header.Get("Content-Range") != "" {
 				if err := s.processChunk(r.Context(), part, part.Header.Get("Content-Range")); err != nil {
-					http.Error(w, "Error processing chunk: "+err.Error(), http.StatusInternalServerError)
+					chunkError(w, err)
 					return
 				}
 			} else {
 				if err := s.processChunk(r.Context(), part, r.Header.Get("Content-Range")); err != nil {
-					http.Error(w, "Error processing chunk: "+err.Error(), http.StatusInternalServerError)
+					chunkError(w, err)
 					return
 				}
 
@@ -117,6 +198,20 @@ func (s *ChunkServer) processChunk(ctx context.Context, part *multipart.Part, co
 		return fmt.Errorf("invalid upload id: %w", err)
 	}
 
+	if contentRangeHeader == "" {
+		return errMissingContentRange
+	}
+
+	rng, err := contentrange.Parse(contentRangeHeader)
+	if err != nil {
+		return fmt.Errorf("%w: %w", errInvalidContentRange, err)
+	}
+
+	body, err := decodeChunk(part)
+	if err != nil {
+		return err
+	}
+
 	cachePath := filepath.Join(cacheDir, uploadID)
 
 	f, err := s.cacheFS.OpenFile(cachePath, writablefs.FlagReadWrite|writablefs.FlagCreate)
@@ -125,25 +220,237 @@ func (s *ChunkServer) processChunk(ctx context.Context, part *multipart.Part, co
 	}
 	defer f.Close()
 
-	rng, err := contentrange.Parse(contentRangeHeader)
-	if err != nil {
-		return fmt.Errorf("error parsing content range: %w", err)
+	// The client is only signalling the total size, there is no data to write.
+	if rng.Start == -1 {
+		return nil
 	}
 
 	s.logger.Debug("Upload", "id", uploadID, "start", rng.Start, "end", rng.End)
 
-	lock, _ := s.rangeLocks.LoadOrStore(uploadID, rangelock.New())
+	lock := s.rangeLocks.Get(uploadID)
+
+	lockCtx, cancel := context.WithTimeout(ctx, s.lockTimeout)
+	defer cancel()
 
-	id, err := lock.(*rangelock.RangeLock).Lock(ctx, rng.Start, rng.End)
+	id, err := lock.Lock(lockCtx, rng.Start, rng.End)
 	if err != nil {
+		if errors.Is(err, context.DeadlineExceeded) && ctx.Err() == nil {
+			s.logger.Warn("Timed out waiting for chunk lock", "id", uploadID, "start", rng.Start, "end", rng.End)
+
+			return errLockTimeout
+		}
+
 		return fmt.Errorf("error acquiring lock: %w", err)
 	}
-	defer lock.(*rangelock.RangeLock).Unlock(id)
+	defer lock.Unlock(id)
+
+	xattrs, err := f.XAttrs()
+	if err != nil {
+		return fmt.Errorf("error getting xattrs: %w", err)
+	}
 
-	_, err = io.Copy(io.NewOffsetWriter(f, rng.Start), part)
+	size, err := getSize(xattrs)
 	if err != nil {
+		return err
+	}
+
+	// A total of "*" (unknown) is allowed, the declared size is authoritative.
+	if rng.Total != -1 && rng.Total != size {
+		return errChunkSizeMismatch
+	}
+
+	if rng.Start < 0 || rng.End >= size {
+		return errChunkOutOfRange
+	}
+
+	received, err := getReceivedRanges(xattrs)
+	if err != nil {
+		return err
+	}
+
+	// If this chunk carries on from where the previously hashed data ends, we
+	// can update the checksum as it is written.
+	r := body
+	sh, err := loadStreamingHash(xattrs)
+	if err != nil {
+		s.logger.Debug("Unable to stream checksum", "id", uploadID, "error", err)
+	} else if sh.offset == rng.Start {
+		r = io.TeeReader(body, sh)
+	} else {
+		sh = nil
+	}
+
+	// Retries may resend previously received data, which is fine as long as it's identical.
+	n, err := io.Copy(&conflictCheckingWriter{f: f, offset: rng.Start, limit: rng.End + 1, received: received}, r)
+	metrics.ChunkBytesWritten.Add(float64(n))
+	if err != nil {
+		var corruptErr flate.CorruptInputError
+		if errors.Is(err, gzip.ErrChecksum) || errors.Is(err, gzip.ErrHeader) || errors.As(err, &corruptErr) {
+			return fmt.Errorf("%w: %w", errInvalidChunkEncoding, err)
+		}
+
 		return fmt.Errorf("error writing to file: %w", err)
 	}
 
+	// Only the declared range is ever recorded as received, so if any of it is
+	// missing the whole chunk must be resent.
+	if n != rng.End-rng.Start+1 {
+		return fmt.Errorf("%w: got %d of %d bytes", errShortChunk, n, rng.End-rng.Start+1)
+	}
+
+	if err := s.recordReceived(f, rng.Start, rng.End); err != nil {
+		return fmt.Errorf("error recording received range: %w", err)
+	}
+
+	if sh != nil {
+		if err := s.recordHashed(f, sh, rng.Start+n); err != nil {
+			return fmt.Errorf("error recording hash state: %w", err)
+		}
+	}
+
 	return nil
 }
+
+// decodeChunk returns a reader for the decoded data of a chunk, chunks may be
+// gzip compressed by the client to save bandwidth.
+func decodeChunk(part *multipart.Part) (io.Reader, error) {
+	switch encoding := strings.ToLower(strings.TrimSpace(part.Header.Get("Content-Encoding"))); encoding {
+	case "", "identity":
+		return part, nil
+	case "gzip":
+		zr, err := gzip.NewReader(part)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", errInvalidChunkEncoding, err)
+		}
+
+		return zr, nil
+	default:
+		return nil, fmt.Errorf("%w: %s", errUnsupportedContentEncoding, encoding)
+	}
+}
+
+// recordHashed persists the streaming hash once it has consumed the data up to
+// the given offset. If another chunk has advanced the hash in the meantime the
+// state is discarded, and completion falls back to re-reading the file.
+func (s *ChunkServer) recordHashed(f writablefs.File, sh *streamingHash, offset int64) error {
+	s.receivedMu.Lock()
+	defer s.receivedMu.Unlock()
+
+	xattrs, err := f.XAttrs()
+	if err != nil {
+		return fmt.Errorf("error getting xattrs: %w", err)
+	}
+
+	current, err := loadStreamingHash(xattrs)
+	if err != nil {
+		return err
+	}
+
+	if current.offset != sh.offset {
+		return nil
+	}
+
+	sh.offset = offset
+
+	if err := sh.save(xattrs); err != nil {
+		return err
+	}
+
+	return xattrs.Sync()
+}
+
+// recordReceived adds the given range to the set of ranges received for the upload.
+func (s *ChunkServer) recordReceived(f writablefs.File, start, end int64) error {
+	s.receivedMu.Lock()
+	defer s.receivedMu.Unlock()
+
+	xattrs, err := f.XAttrs()
+	if err != nil {
+		return fmt.Errorf("error getting xattrs: %w", err)
+	}
+
+	received, err := getReceivedRanges(xattrs)
+	if err != nil {
+		return err
+	}
+
+	received = received.Add(start, end)
+
+	if err := xattrs.Set(xAttrReceived, []byte(received.String())); err != nil {
+		return fmt.Errorf("error setting received xattr: %w", err)
+	}
+
+	return xattrs.Sync()
+}
+
+func chunkError(w http.ResponseWriter, err error) {
+	if errors.Is(err, errLockTimeout) {
+		w.Header().Set("Retry-After", strconv.Itoa(int(lockRetryAfter.Seconds())))
+	}
+
+	http.Error(w, "Error processing chunk: "+err.Error(), chunkErrorStatus(err))
+}
+
+func chunkErrorStatus(err error) int {
+	if errors.Is(err, errChunkConflict) || errors.Is(err, errChunkOutOfRange) ||
+		errors.Is(err, errChunkSizeMismatch) || errors.Is(err, errMissingContentRange) ||
+		errors.Is(err, errInvalidContentRange) || errors.Is(err, errUnsupportedContentEncoding) ||
+		errors.Is(err, errInvalidChunkEncoding) || errors.Is(err, errShortChunk) {
+		return http.StatusBadRequest
+	}
+
+	if errors.Is(err, errLockTimeout) {
+		return http.StatusServiceUnavailable
+	}
+
+	return http.StatusInternalServerError
+}
+
+// conflictCheckingWriter writes data to a file starting at the given offset.
+// Any data that falls within a previously received range is compared against
+// the existing file contents rather than being written.
+type conflictCheckingWriter struct {
+	f      writablefs.File
+	offset int64
+	// limit is the offset at which the chunk ends, writing past it is an error.
+	limit    int64
+	received byteRanges
+}
+
+func (w *conflictCheckingWriter) Write(p []byte) (int, error) {
+	if w.offset+int64(len(p)) > w.limit {
+		return 0, errChunkOutOfRange
+	}
+
+	var written int
+	for len(p) > 0 {
+		n := int64(len(p))
+
+		if rng, ok := w.received.Containing(w.offset); ok {
+			n = min(n, rng.End-w.offset+1)
+
+			existing := make([]byte, n)
+			if _, err := w.f.ReadAt(existing, w.offset); err != nil {
+				return written, err
+			}
+
+			if !bytes.Equal(existing, p[:n]) {
+				return written, errChunkConflict
+			}
+		} else {
+			if next, ok := w.received.Next(w.offset); ok {
+				n = min(n, next.Start-w.offset)
+			}
+
+			if _, err := w.f.WriteAt(p[:n], w.offset); err != nil {
+				return written, err
+			}
+		}
+
+		w.offset += n
+		written += int(n)
+		p = p[n:]
+	}
+
+	return written, nil
+}
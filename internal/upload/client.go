@@ -19,15 +19,23 @@
 package upload
 
 import (
+	"compress/gzip"
 	"context"
 	"crypto/tls"
+	"errors"
 	"fmt"
 	"io"
 	"log/slog"
+	"mime"
 	"mime/multipart"
 	"net/http"
 	"net/textproto"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"connectrpc.com/connect"
@@ -41,16 +49,55 @@ import (
 	"google.golang.org/protobuf/types/known/wrapperspb"
 )
 
+// defaultChunkSizeBytes is the chunk size used if neither the client or
+// server specify one.
+const defaultChunkSizeBytes = 16000000 // 16MB
+
+// Supported chunk compression methods.
+const (
+	CompressionNone = "none"
+	CompressionGzip = "gzip"
+)
+
 // ClientOptions are options for configuring the behavior of the upload client.
 type ClientOptions struct {
 	// NumConnections is the number of concurrent connections to use when uploading chunks.
 	NumConnections int
-	// ChunkSizeBytes is the size of each chunk.
+	// ChunkSizeBytes is the size of each chunk (defaults to the size recommended
+	// by the server).
 	ChunkSizeBytes int64
 	// MaxRetryAttempts is the maximum number of retry attempts to make before giving up.
 	MaxRetryAttempts int
+	// ChecksumAlgorithm is the algorithm used to checksum the uploaded file, one of xxh64,
+	// xxh3 (128-bit), sha256, md5 or crc32c (defaults to xxh64).
+	ChecksumAlgorithm string
+	// DeferChecksum provides the checksum when the upload is completed rather
+	// than when it's created, so that the file is checksummed while its chunks
+	// are uploaded instead of beforehand. Requires a server that supports
+	// deferred checksums.
+	DeferChecksum bool
 	// TLSClientConfig is the optional TLS configuration to use when making requests.
 	TLSClientConfig *tls.Config
+	// NoOverwrite causes uploads to fail rather than overwrite existing files.
+	NoOverwrite bool
+	// SessionID optionally groups uploads together so that they can be aborted
+	// as a whole with AbortSession.
+	SessionID string
+	// Metadata is set on uploaded objects, eg. "Cache-Control" or "x-amz-meta-owner".
+	Metadata map[string]string
+	// OnProgress, if set, is called as each chunk finishes uploading with the
+	// number of bytes uploaded so far. Chunks are uploaded concurrently so it
+	// is called from multiple goroutines, and calls may arrive out of order.
+	OnProgress func(uploaded, total int64)
+	// UploadIDFile, if set, is where the ID of an upload is saved when it is
+	// created (and removed once it completes), so that the upload can be
+	// continued with ResumeUpload if the process dies. As there is a single
+	// file, it's only suitable for clients that upload one file at a time.
+	UploadIDFile string
+	// Compression is used to compress chunks on the wire, one of none or gzip
+	// (defaults to none). The server stores the decompressed data, so this
+	// only saves bandwidth (and only for compressible files).
+	Compression string
 }
 
 type Client struct {
@@ -63,9 +110,9 @@ type Client struct {
 
 func NewClient(logger *slog.Logger, baseURL string, opts *ClientOptions) (*Client, error) {
 	baseOpts := ClientOptions{
-		NumConnections:   1,
-		ChunkSizeBytes:   16000000, // 16MB
-		MaxRetryAttempts: 3,
+		NumConnections:    1,
+		MaxRetryAttempts:  3,
+		ChecksumAlgorithm: AlgorithmXXH64,
 	}
 
 	if opts != nil {
@@ -74,6 +121,14 @@ func NewClient(logger *slog.Logger, baseURL string, opts *ClientOptions) (*Clien
 		}
 	}
 
+	if baseOpts.Compression == "" {
+		baseOpts.Compression = CompressionNone
+	}
+
+	if baseOpts.Compression != CompressionNone && baseOpts.Compression != CompressionGzip {
+		return nil, fmt.Errorf("unsupported compression: %q", baseOpts.Compression)
+	}
+
 	transport := http.DefaultTransport.(*http.Transport).Clone()
 	if baseOpts.TLSClientConfig != nil {
 		transport.TLSClientConfig = baseOpts.TLSClientConfig
@@ -94,39 +149,263 @@ func NewClient(logger *slog.Logger, baseURL string, opts *ClientOptions) (*Clien
 
 // Upload uploads a file to the server, you must provide a ReaderAt so that chunks can be read concurrently.
 func (c *Client) Upload(ctx context.Context, path string, r io.ReaderAt, size int64) error {
-	expectedChecksum, err := checksum(io.NewSectionReader(r, 0, size), algorithmXXH64)
-	if err != nil {
-		return fmt.Errorf("failed to calculate checksum: %w", err)
+	newReq := &v1alpha1.NewRequest{
+		Path:        path,
+		Size:        size,
+		NoOverwrite: c.opts.NoOverwrite,
+		ContentType: mime.TypeByExtension(filepath.Ext(path)),
+		SessionId:   c.opts.SessionID,
+		Metadata:    c.opts.Metadata,
+		// A request that timed out may still have created the upload, the key
+		// makes retrying safe (the server returns the same upload).
+		IdempotencyKey: uuid.New().String(),
 	}
 
-	uploadIDResp, err := c.apiClient.New(ctx, connect.NewRequest(&v1alpha1.NewRequest{
-		Path:     path,
-		Size:     size,
-		Checksum: expectedChecksum,
-	}))
+	if c.opts.DeferChecksum {
+		// The checksum is provided on completion, so that the file can be
+		// checksummed while it's being uploaded.
+		newReq.ChecksumAlgorithm = c.opts.ChecksumAlgorithm
+	} else {
+		expectedChecksum, err := checksumReaderAt(ctx, r, size, c.opts.ChecksumAlgorithm)
+		if err != nil {
+			return fmt.Errorf("failed to calculate checksum: %w", err)
+		}
+
+		newReq.Checksum = expectedChecksum
+	}
+
+	var newResp *connect.Response[v1alpha1.NewResponse]
+	err := retry.Do(
+		func() error {
+			var err error
+			newResp, err = c.apiClient.New(ctx, connect.NewRequest(newReq))
+			if err != nil && !isRetryableCode(connect.CodeOf(err)) {
+				return retry.Unrecoverable(err)
+			}
+
+			return err
+		},
+		retry.Context(ctx),
+		retry.Attempts(uint(c.opts.MaxRetryAttempts)),
+		retry.LastErrorOnly(true),
+		retry.OnRetry(func(_ uint, err error) {
+			c.logger.Warn("Retrying creating upload", "error", err)
+		}),
+	)
 	if err != nil {
 		return fmt.Errorf("failed to create new upload: %w", err)
 	}
 
-	uploadID := uploadIDResp.Msg.Value
+	uploadID := newResp.Msg.Id
 
 	if _, err := uuid.Parse(uploadID); err != nil {
 		return fmt.Errorf("server returned invalid upload ID: %s", uploadID)
 	}
 
+	if err := c.saveUploadID(uploadID); err != nil {
+		return err
+	}
+
+	if !c.opts.DeferChecksum {
+		// The server already has the checksum.
+		if err := c.uploadChunks(ctx, uploadID, r, size, c.chunkSize(newResp.Msg.ChunkSize), noChecksum); err != nil {
+			return err
+		}
+
+		return c.removeUploadID()
+	}
+
+	return c.upload(ctx, uploadID, r, size, c.chunkSize(newResp.Msg.ChunkSize))
+}
+
+// ResumeUpload continues an upload started by Upload (eg. in a process that
+// has since died), only the chunks the server hasn't received are uploaded.
+// If the server doesn't know about the upload (eg. it has been reaped), a new
+// upload to path is started instead.
+func (c *Client) ResumeUpload(ctx context.Context, uploadID, path string, r io.ReaderAt, size int64) error {
+	if _, err := uuid.Parse(uploadID); err != nil {
+		return fmt.Errorf("invalid upload ID: %s", uploadID)
+	}
+
+	progressResp, err := c.apiClient.Progress(ctx, connect.NewRequest(wrapperspb.String(uploadID)))
+	if err != nil {
+		if connect.CodeOf(err) == connect.CodeNotFound {
+			c.logger.Info("Upload not found, starting a new upload", "id", uploadID)
+
+			return c.Upload(ctx, path, r, size)
+		}
+
+		return fmt.Errorf("failed to get upload progress: %w", err)
+	}
+
+	if progressResp.Msg.TotalSize != size {
+		return fmt.Errorf("upload size mismatch: upload has size %d, file has size %d", progressResp.Msg.TotalSize, size)
+	}
+
+	// The process may have died after the upload was completed.
+	pollResp, err := c.apiClient.PollForCompletion(ctx, connect.NewRequest(wrapperspb.String(uploadID)))
+	if err != nil {
+		return fmt.Errorf("failed to poll for completion: %w", err)
+	}
+
+	if pollResp.Msg.Status != v1alpha1.CompletionStatus_PENDING {
+		if err := c.waitForCompletion(ctx, uploadID); err != nil {
+			return err
+		}
+
+		return c.removeUploadID()
+	}
+
+	return c.upload(ctx, uploadID, r, size, c.chunkSize(0))
+}
+
+// LoadUploadID returns the upload ID saved by a client configured with
+// UploadIDFile, or an empty string if there is no upload to resume.
+func LoadUploadID(uploadIDFile string) (string, error) {
+	data, err := os.ReadFile(uploadIDFile)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return "", nil
+		}
+
+		return "", fmt.Errorf("failed to read upload ID file: %w", err)
+	}
+
+	return strings.TrimSpace(string(data)), nil
+}
+
+// upload checksums the file while uploading its chunks, then completes the
+// upload. If the upload was created with a checksum, the server checks that it
+// matches.
+func (c *Client) upload(ctx context.Context, uploadID string, r io.ReaderAt, size, chunkSize int64) error {
+	type checksumResult struct {
+		checksum string
+		err      error
+	}
+
+	// Stop checksumming if the upload fails or is cancelled.
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	checksumCh := make(chan checksumResult, 1)
+	go func() {
+		expectedChecksum, err := checksumReaderAt(ctx, r, size, c.opts.ChecksumAlgorithm)
+		checksumCh <- checksumResult{checksum: expectedChecksum, err: err}
+	}()
+
+	err := c.uploadChunks(ctx, uploadID, r, size, chunkSize, func() (string, error) {
+		result := <-checksumCh
+		if result.err != nil {
+			return "", fmt.Errorf("failed to calculate checksum: %w", result.err)
+		}
+
+		return result.checksum, nil
+	})
+	if err != nil {
+		return err
+	}
+
+	return c.removeUploadID()
+}
+
+// saveUploadID saves the ID of a new upload to the configured file (if any).
+func (c *Client) saveUploadID(uploadID string) error {
+	if c.opts.UploadIDFile == "" {
+		return nil
+	}
+
+	// Write then rename so a crash can't leave a partially written ID behind.
+	tmpPath := c.opts.UploadIDFile + ".tmp"
+	if err := os.WriteFile(tmpPath, []byte(uploadID+"\n"), 0o600); err != nil {
+		return fmt.Errorf("failed to save upload ID: %w", err)
+	}
+
+	if err := os.Rename(tmpPath, c.opts.UploadIDFile); err != nil {
+		return fmt.Errorf("failed to save upload ID: %w", err)
+	}
+
+	return nil
+}
+
+// removeUploadID removes the saved upload ID once the upload has completed.
+func (c *Client) removeUploadID() error {
+	if c.opts.UploadIDFile == "" {
+		return nil
+	}
+
+	if err := os.Remove(c.opts.UploadIDFile); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to remove upload ID file: %w", err)
+	}
+
+	return nil
+}
+
+// AbortSession aborts all the in-progress uploads belonging to the client's session.
+func (c *Client) AbortSession(ctx context.Context) error {
+	if c.opts.SessionID == "" {
+		return fmt.Errorf("no session ID configured")
+	}
+
+	if _, err := c.apiClient.AbortSession(ctx, connect.NewRequest(wrapperspb.String(c.opts.SessionID))); err != nil {
+		return fmt.Errorf("failed to abort session: %w", err)
+	}
+
+	return nil
+}
+
+// chunkSize returns the configured chunk size, falling back to the size
+// recommended by the server (older servers don't recommend a size).
+func (c *Client) chunkSize(recommended int64) int64 {
+	if c.opts.ChunkSizeBytes > 0 {
+		return c.opts.ChunkSizeBytes
+	}
+
+	if recommended > 0 {
+		return recommended
+	}
+
+	return defaultChunkSizeBytes
+}
+
+// noChecksum is used to complete uploads that were created with a checksum.
+func noChecksum() (string, error) {
+	return "", nil
+}
+
+// uploadChunks uploads any chunks the server hasn't already received, then
+// completes the upload with the checksum returned by getChecksum (if any).
+func (c *Client) uploadChunks(ctx context.Context, uploadID string, r io.ReaderAt, size, chunkSize int64, getChecksum func() (string, error)) error {
+	rangesResp, err := c.apiClient.GetReceivedRanges(ctx, connect.NewRequest(&wrapperspb.StringValue{Value: uploadID}))
+	if err != nil {
+		return fmt.Errorf("failed to get received ranges: %w", err)
+	}
+
+	var received byteRanges
+	for _, rng := range rangesResp.Msg.Ranges {
+		received = received.Add(rng.Start, rng.End)
+	}
+
 	type chunk struct {
 		start int64
 		end   int64
 	}
 
+	// Bytes previously received (eg. when resuming) count towards progress.
+	var uploaded atomic.Int64
+
 	var work par.Work
-	for i := int64(0); i < size; i += c.opts.ChunkSizeBytes {
+	for i := int64(0); i < size; i += chunkSize {
 		start := i
-		end := start + c.opts.ChunkSizeBytes - 1
+		end := start + chunkSize - 1
 		if end >= size {
 			end = size - 1
 		}
 
+		if received.Covers(start, end) {
+			uploaded.Add(end - start + 1)
+			continue
+		}
+
 		work.Add(&chunk{
 			start: start,
 			end:   end,
@@ -139,12 +418,23 @@ func (c *Client) Upload(ctx context.Context, path string, r io.ReaderAt, size in
 	var resultMu sync.Mutex
 	var result *multierror.Error
 
+	if c.opts.OnProgress != nil && uploaded.Load() > 0 {
+		c.opts.OnProgress(uploaded.Load(), size)
+	}
+
 	work.Do(c.opts.NumConnections, func(item any) {
 		chk := item.(*chunk)
 		if err := c.uploadChunk(ctx, uploadID, r, chk.start, chk.end, size); err != nil {
 			resultMu.Lock()
 			result = multierror.Append(result, err)
 			resultMu.Unlock()
+
+			return
+		}
+
+		n := uploaded.Add(chk.end - chk.start + 1)
+		if c.opts.OnProgress != nil {
+			c.opts.OnProgress(n, size)
 		}
 	})
 
@@ -152,7 +442,15 @@ func (c *Client) Upload(ctx context.Context, path string, r io.ReaderAt, size in
 		return err
 	}
 
-	_, err = c.apiClient.Complete(ctx, connect.NewRequest(&wrapperspb.StringValue{Value: uploadID}))
+	expectedChecksum, err := getChecksum()
+	if err != nil {
+		return err
+	}
+
+	_, err = c.apiClient.Complete(ctx, connect.NewRequest(&v1alpha1.CompleteRequest{
+		Id:       uploadID,
+		Checksum: expectedChecksum,
+	}))
 	if err != nil {
 		return fmt.Errorf("failed to complete upload: %w", err)
 	}
@@ -173,6 +471,9 @@ func (c *Client) uploadChunk(ctx context.Context, uploadID string, r io.ReaderAt
 				h.Set("Content-Disposition", fmt.Sprintf(`form-data; name="file"; filename="%s"`, uploadID))
 				h.Set("Content-Type", "application/octet-stream")
 				h.Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, end, size))
+				if c.opts.Compression == CompressionGzip {
+					h.Set("Content-Encoding", "gzip")
+				}
 
 				fileWriter, err := multipartWriter.CreatePart(h)
 				if err != nil {
@@ -180,7 +481,7 @@ func (c *Client) uploadChunk(ctx context.Context, uploadID string, r io.ReaderAt
 					return
 				}
 
-				if _, err = io.Copy(fileWriter, io.NewSectionReader(r, start, end-start+1)); err != nil {
+				if err := c.writeChunk(fileWriter, io.NewSectionReader(r, start, end-start+1)); err != nil {
 					pw.CloseWithError(fmt.Errorf("failed to copy file data: %w", err))
 					return
 				}
@@ -208,23 +509,105 @@ func (c *Client) uploadChunk(ctx context.Context, uploadID string, r io.ReaderAt
 					return fmt.Errorf("failed to upload chunk, status code: %d", resp.StatusCode)
 				}
 
-				if resp.StatusCode >= 400 && resp.StatusCode < 500 {
-					return retry.Unrecoverable(fmt.Errorf("failed to upload chunk: %s", string(message)))
+				err = fmt.Errorf("failed to upload chunk: %s", string(message))
+
+				if resp.StatusCode >= 400 && resp.StatusCode < 500 && resp.StatusCode != http.StatusTooManyRequests {
+					return retry.Unrecoverable(err)
 				}
 
-				return fmt.Errorf("failed to upload chunk: %s", string(message))
+				if delay, ok := parseRetryAfter(resp.Header.Get("Retry-After")); ok {
+					return &retryAfterError{err: err, delay: delay}
+				}
+
+				return err
 			}
 
 			return nil
 		},
 		retry.Context(ctx),
 		retry.Attempts(uint(c.opts.MaxRetryAttempts)),
+		retry.DelayType(retryAfterDelay),
 		retry.OnRetry(func(_ uint, err error) {
 			c.logger.Warn("Retrying uploading chunk", "error", err)
 		}),
 	)
 }
 
+// writeChunk writes the chunk's data to a part, compressing it if configured.
+func (c *Client) writeChunk(w io.Writer, r io.Reader) error {
+	if c.opts.Compression != CompressionGzip {
+		_, err := io.Copy(w, r)
+		return err
+	}
+
+	gw := gzip.NewWriter(w)
+	if _, err := io.Copy(gw, r); err != nil {
+		return err
+	}
+
+	return gw.Close()
+}
+
+// isRetryableCode reports whether an RPC that failed with the given code
+// might succeed if retried.
+func isRetryableCode(code connect.Code) bool {
+	switch code {
+	case connect.CodeUnavailable, connect.CodeDeadlineExceeded, connect.CodeAborted:
+		return true
+	default:
+		return false
+	}
+}
+
+// maxRetryAfter caps how long the server can ask the client to wait between
+// attempts.
+const maxRetryAfter = 5 * time.Minute
+
+// retryAfterError is returned when the server asks the client to wait before
+// retrying a request.
+type retryAfterError struct {
+	err   error
+	delay time.Duration
+}
+
+func (e *retryAfterError) Error() string {
+	return e.err.Error()
+}
+
+func (e *retryAfterError) Unwrap() error {
+	return e.err
+}
+
+// retryAfterDelay waits for as long as the server asked (if it did), otherwise
+// it uses the default backoff.
+func retryAfterDelay(n uint, err error, config *retry.Config) time.Duration {
+	var retryAfterErr *retryAfterError
+	if errors.As(err, &retryAfterErr) {
+		return retryAfterErr.delay
+	}
+
+	return retry.CombineDelay(retry.BackOffDelay, retry.RandomDelay)(n, err, config)
+}
+
+// parseRetryAfter parses a Retry-After header, which is either a number of
+// seconds or a HTTP date.
+func parseRetryAfter(header string) (time.Duration, bool) {
+	if header == "" {
+		return 0, false
+	}
+
+	var delay time.Duration
+	if seconds, err := strconv.Atoi(header); err == nil {
+		delay = time.Duration(seconds) * time.Second
+	} else if t, err := http.ParseTime(header); err == nil {
+		delay = time.Until(t)
+	} else {
+		return 0, false
+	}
+
+	return min(max(delay, 0), maxRetryAfter), true
+}
+
 func (c *Client) waitForCompletion(ctx context.Context, uploadID string) error {
 	ctx, cancel := context.WithTimeout(ctx, 5*time.Minute)
 	defer cancel()
@@ -0,0 +1,60 @@
+/* SPDX-License-Identifier: AGPL-3.0-or-later
+ *
+ * Copyright 2024 Damian Peckett <damian@pecke.tt>.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package upload
+
+import (
+	"sync"
+
+	"github.com/bucket-sailor/rangelock"
+)
+
+// RangeLocks holds the per-upload range locks used to serialize overlapping
+// chunk writes. It is shared between the chunk server (which acquires the
+// locks) and the upload server (which releases them once an upload has been
+// aborted or completed).
+type RangeLocks struct {
+	locks sync.Map
+}
+
+// NewRangeLocks creates a new, empty, set of range locks.
+func NewRangeLocks() *RangeLocks {
+	return &RangeLocks{}
+}
+
+// Get returns the range lock for an upload, creating it if necessary.
+func (l *RangeLocks) Get(uploadID string) *rangelock.RangeLock {
+	lock, _ := l.locks.LoadOrStore(uploadID, rangelock.New())
+	return lock.(*rangelock.RangeLock)
+}
+
+// Release forgets the range lock for an upload.
+func (l *RangeLocks) Release(uploadID string) {
+	l.locks.Delete(uploadID)
+}
+
+// Len returns the number of uploads with range locks.
+func (l *RangeLocks) Len() int {
+	var n int
+	l.locks.Range(func(_, _ any) bool {
+		n++
+		return true
+	})
+
+	return n
+}
@@ -0,0 +1,168 @@
+/* SPDX-License-Identifier: AGPL-3.0-or-later
+ *
+ * Copyright 2024 Damian Peckett <damian@pecke.tt>.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package upload
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/bucket-sailor/writablefs"
+	"golang.org/x/net/http/httpguts"
+)
+
+const (
+	// xAttrMetadata holds the JSON encoded destination metadata of an upload.
+	xAttrMetadata = "bucketeer.metadata"
+	// userMetadataPrefix is the header prefix used for user defined metadata.
+	userMetadataPrefix = "x-amz-meta-"
+	// maxMetadataSize is the maximum combined size of metadata keys and values,
+	// S3 limits user metadata to 2KB.
+	maxMetadataSize = 2048
+)
+
+// standardMetadata are the standard headers that can be set on an object.
+var standardMetadata = map[string]bool{
+	"cache-control":       true,
+	"content-disposition": true,
+	"content-encoding":    true,
+	"content-language":    true,
+	"expires":             true,
+}
+
+// normalizeMetadata validates upload metadata and maps it to the extended
+// attribute names stored on the destination.
+func normalizeMetadata(md map[string]string) (map[string]string, error) {
+	if len(md) == 0 {
+		return nil, nil
+	}
+
+	attrs := make(map[string]string, len(md))
+	var size int
+	for key, value := range md {
+		key = strings.ToLower(key)
+		if !httpguts.ValidHeaderFieldName(key) {
+			return nil, fmt.Errorf("invalid metadata key %q", key)
+		}
+
+		if !httpguts.ValidHeaderFieldValue(value) {
+			return nil, fmt.Errorf("invalid value for metadata key %q", key)
+		}
+
+		name := key
+		if strings.HasPrefix(key, userMetadataPrefix) {
+			name = strings.TrimPrefix(key, userMetadataPrefix)
+			if name == "" || strings.HasPrefix(name, "bucketeer.") {
+				return nil, fmt.Errorf("invalid metadata key %q", key)
+			}
+		} else if !standardMetadata[key] {
+			return nil, fmt.Errorf("unsupported metadata key %q", key)
+		}
+
+		if _, ok := attrs[name]; ok {
+			return nil, fmt.Errorf("duplicate metadata key %q", key)
+		}
+
+		attrs[name] = value
+		size += len(name) + len(value)
+	}
+
+	if size > maxMetadataSize {
+		return nil, fmt.Errorf("metadata is too large (max %d bytes)", maxMetadataSize)
+	}
+
+	return attrs, nil
+}
+
+// setMetadata sets extended attributes on a destination file.
+func setMetadata(fsys writablefs.FS, path string, attrs map[string]string) error {
+	f, err := fsys.OpenFile(path, writablefs.FlagReadWrite)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	xattrs, err := f.XAttrs()
+	if err != nil {
+		return err
+	}
+
+	for name, value := range attrs {
+		if err := xattrs.Set(name, []byte(value)); err != nil {
+			return err
+		}
+	}
+
+	return xattrs.Sync()
+}
+
+// clearStoredChecksum removes the checksum stored on a destination file (eg.
+// by the checksum server), which is stale once the file has been overwritten.
+func clearStoredChecksum(f writablefs.File) error {
+	xattrs, err := f.XAttrs()
+	if err != nil {
+		// Nothing can have been stored.
+		return nil
+	}
+
+	// Only remove it if it's there, on some filesystems (eg. S3) every change
+	// to the metadata is a request.
+	if _, err := xattrs.Get(xAttrChecksum); err != nil {
+		return nil
+	}
+
+	if err := xattrs.Remove(xAttrChecksum); err != nil {
+		return err
+	}
+
+	return xattrs.Sync()
+}
+
+// getMetadata returns the destination metadata recorded for an upload.
+func getMetadata(xattrs writablefs.ExtendedAttributes) (map[string]string, error) {
+	attrs := make(map[string]string)
+
+	contentType, err := xattrs.Get(xAttrContentType)
+	if err != nil && !errors.Is(err, writablefs.ErrNoSuchAttr) {
+		return nil, fmt.Errorf("error getting content type xattr: %w", err)
+	}
+
+	if len(contentType) > 0 {
+		attrs[xAttrDstContentType] = string(contentType)
+	}
+
+	metadata, err := xattrs.Get(xAttrMetadata)
+	if err != nil && !errors.Is(err, writablefs.ErrNoSuchAttr) {
+		return nil, fmt.Errorf("error getting metadata xattr: %w", err)
+	}
+
+	if len(metadata) > 0 {
+		var md map[string]string
+		if err := json.Unmarshal(metadata, &md); err != nil {
+			return nil, fmt.Errorf("error decoding metadata xattr: %w", err)
+		}
+
+		for name, value := range md {
+			attrs[name] = value
+		}
+	}
+
+	return attrs, nil
+}
@@ -0,0 +1,243 @@
+/* SPDX-License-Identifier: AGPL-3.0-or-later
+ *
+ * Copyright 2024 Damian Peckett <damian@pecke.tt>.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package upload
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/bucket-sailor/bucketeer/internal/telemetry"
+	"github.com/bucket-sailor/writablefs"
+)
+
+// defaultMaxPutSize is the largest file that can be uploaded with a single
+// PUT request by default (the same as the default chunk size).
+const defaultMaxPutSize = 16000000 // 16MB
+
+type PutServer struct {
+	http.Handler
+	logger            *slog.Logger
+	fsys              writablefs.FS
+	readOnly          bool
+	maxPutSize        int64
+	telemetryReporter telemetry.Reporter
+	onComplete        func(path string)
+}
+
+// NewPutServer creates a new server for uploading small files with a single
+// PUT request, skipping the chunked upload protocol. Files are buffered in
+// memory and written directly to the destination, only the ReadOnly,
+// MaxUploadSize, MaxPutSize, TelemetryReporter and OnComplete options are used.
+func NewPutServer(logger *slog.Logger, fsys writablefs.FS, opts *ServerOptions) (string, http.Handler) {
+	s := &PutServer{
+		logger:     logger.WithGroup("upload"),
+		fsys:       fsys,
+		maxPutSize: defaultMaxPutSize,
+	}
+
+	if opts != nil {
+		s.readOnly = opts.ReadOnly
+		s.telemetryReporter = opts.TelemetryReporter
+		s.onComplete = opts.OnComplete
+
+		if opts.MaxPutSize > 0 {
+			s.maxPutSize = opts.MaxPutSize
+		}
+
+		if opts.MaxUploadSize > 0 {
+			s.maxPutSize = min(s.maxPutSize, opts.MaxUploadSize)
+		}
+	}
+
+	mux := http.NewServeMux()
+	s.Handler = mux
+
+	mux.HandleFunc("/files/upload/", s.handlePut)
+
+	return "/files/upload/", s
+}
+
+func (s *PutServer) handlePut(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPut {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if s.readOnly {
+		http.Error(w, "Server is in read-only mode", http.StatusForbidden)
+		return
+	}
+
+	start := time.Now()
+
+	dstPath, err := cleanDestination(strings.TrimPrefix(r.URL.Path, "/files/upload/"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	expectedChecksums, err := putChecksums(r.Header)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	contentType := r.Header.Get("Content-Type")
+	if contentType != "" {
+		if _, _, err := mime.ParseMediaType(contentType); err != nil {
+			http.Error(w, "Invalid content type", http.StatusBadRequest)
+			return
+		}
+	}
+
+	if r.ContentLength > s.maxPutSize {
+		http.Error(w, fmt.Sprintf("Upload exceeds the maximum of %d bytes, use a chunked upload instead", s.maxPutSize),
+			http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	// Small enough to hold in memory, so nothing is written to the destination
+	// unless the checksums match.
+	data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, s.maxPutSize))
+	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			http.Error(w, fmt.Sprintf("Upload exceeds the maximum of %d bytes, use a chunked upload instead", s.maxPutSize),
+				http.StatusRequestEntityTooLarge)
+			return
+		}
+
+		http.Error(w, "Error reading request body", http.StatusBadRequest)
+		return
+	}
+
+	for _, expected := range expectedChecksums {
+		if err := verifyChecksum(bytes.NewReader(data), expected); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	created := true
+	if _, err := s.fsys.Stat(dstPath); err == nil {
+		// Only create the file if it doesn't already exist.
+		if r.Header.Get("If-None-Match") == "*" {
+			http.Error(w, "Destination already exists", http.StatusPreconditionFailed)
+			return
+		}
+
+		created = false
+	} else if !errors.Is(err, writablefs.ErrNotExist) {
+		http.Error(w, "Error getting file info", http.StatusInternalServerError)
+		return
+	}
+
+	s.logger.Debug("Put", "path", dstPath, "size", len(data))
+
+	if err := s.write(dstPath, data); err != nil {
+		s.logger.Error("Error writing file", "path", dstPath, "error", err)
+
+		http.Error(w, "Error writing file", http.StatusInternalServerError)
+		return
+	}
+
+	if contentType != "" {
+		// Not all filesystems support metadata, so this isn't fatal.
+		if err := setMetadata(s.fsys, dstPath, map[string]string{xAttrDstContentType: contentType}); err != nil {
+			s.logger.Warn("Error setting metadata", "path", dstPath, "error", err)
+		}
+	}
+
+	telemetry.ReportTransfer(s.telemetryReporter, telemetry.EventUploadComplete, int64(len(data)), time.Since(start))
+
+	if s.onComplete != nil {
+		s.onComplete(dstPath)
+	}
+
+	if created {
+		w.WriteHeader(http.StatusCreated)
+	} else {
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func (s *PutServer) write(dstPath string, data []byte) error {
+	// Some filesystems won't create missing parent directories for us.
+	if err := s.fsys.MkdirAll(path.Dir(dstPath)); err != nil {
+		return fmt.Errorf("error creating parent directory: %w", err)
+	}
+
+	f, err := s.fsys.OpenFile(dstPath, writablefs.FlagWriteOnly|writablefs.FlagCreate)
+	if err != nil {
+		return err
+	}
+
+	// Opening an existing file doesn't truncate it.
+	if err := f.Truncate(0); err != nil {
+		_ = f.Close()
+		return err
+	}
+
+	if _, err := f.Write(data); err != nil {
+		_ = f.Close()
+		return err
+	}
+
+	if err := clearStoredChecksum(f); err != nil {
+		_ = f.Close()
+		return err
+	}
+
+	return f.Close()
+}
+
+// putChecksums returns the checksums (in the form algorithm:hex) a PUT request
+// body is expected to match, from the X-Checksum and Content-MD5 headers.
+func putChecksums(header http.Header) ([]string, error) {
+	var checksums []string
+
+	if checksum := strings.ToLower(header.Get("X-Checksum")); checksum != "" {
+		if err := validateChecksum(checksum); err != nil {
+			return nil, err
+		}
+
+		checksums = append(checksums, checksum)
+	}
+
+	if contentMD5 := header.Get("Content-MD5"); contentMD5 != "" {
+		digest, err := base64.StdEncoding.DecodeString(contentMD5)
+		if err != nil || len(digest) != 16 {
+			return nil, fmt.Errorf("invalid content-md5 header")
+		}
+
+		checksums = append(checksums, AlgorithmMD5+":"+hex.EncodeToString(digest))
+	}
+
+	return checksums, nil
+}
@@ -0,0 +1,161 @@
+/* SPDX-License-Identifier: AGPL-3.0-or-later
+ *
+ * Copyright 2024 Damian Peckett <damian@pecke.tt>.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package upload
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/bucket-sailor/writablefs"
+)
+
+// byteRange is an inclusive range of bytes.
+type byteRange struct {
+	Start int64
+	End   int64
+}
+
+// byteRanges is a sorted list of non-overlapping byte ranges.
+type byteRanges []byteRange
+
+func parseByteRanges(data []byte) (byteRanges, error) {
+	var ranges byteRanges
+
+	if len(data) == 0 {
+		return ranges, nil
+	}
+
+	for _, s := range strings.Split(string(data), ",") {
+		startStr, endStr, ok := strings.Cut(s, "-")
+		if !ok {
+			return nil, fmt.Errorf("invalid range: %q", s)
+		}
+
+		start, err := strconv.ParseInt(startStr, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid range start: %w", err)
+		}
+
+		end, err := strconv.ParseInt(endStr, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid range end: %w", err)
+		}
+
+		ranges = ranges.Add(start, end)
+	}
+
+	return ranges, nil
+}
+
+// Add adds a range to the list, merging it with any overlapping or adjacent ranges.
+func (r byteRanges) Add(start, end int64) byteRanges {
+	merged := append(byteRanges{}, r...)
+	merged = append(merged, byteRange{Start: start, End: end})
+
+	sort.Slice(merged, func(i, j int) bool {
+		return merged[i].Start < merged[j].Start
+	})
+
+	result := merged[:1]
+	for _, rng := range merged[1:] {
+		last := &result[len(result)-1]
+		if rng.Start <= last.End+1 {
+			if rng.End > last.End {
+				last.End = rng.End
+			}
+			continue
+		}
+
+		result = append(result, rng)
+	}
+
+	return result
+}
+
+// Containing returns the range that contains the given offset, if any.
+func (r byteRanges) Containing(offset int64) (byteRange, bool) {
+	for _, rng := range r {
+		if offset >= rng.Start && offset <= rng.End {
+			return rng, true
+		}
+	}
+
+	return byteRange{}, false
+}
+
+// Covers returns true if the given range is entirely contained within the ranges.
+func (r byteRanges) Covers(start, end int64) bool {
+	rng, ok := r.Containing(start)
+	return ok && rng.End >= end
+}
+
+// Next returns the first range that starts after the given offset, if any.
+func (r byteRanges) Next(offset int64) (byteRange, bool) {
+	for _, rng := range r {
+		if rng.Start > offset {
+			return rng, true
+		}
+	}
+
+	return byteRange{}, false
+}
+
+// Size returns the total number of bytes covered by the ranges.
+func (r byteRanges) Size() int64 {
+	var size int64
+	for _, rng := range r {
+		size += rng.End - rng.Start + 1
+	}
+
+	return size
+}
+
+func (r byteRanges) String() string {
+	var sb strings.Builder
+	for i, rng := range r {
+		if i > 0 {
+			sb.WriteString(",")
+		}
+		fmt.Fprintf(&sb, "%d-%d", rng.Start, rng.End)
+	}
+
+	return sb.String()
+}
+
+// getReceivedRanges returns the ranges of an upload that have been received so far.
+func getReceivedRanges(xattrs writablefs.ExtendedAttributes) (byteRanges, error) {
+	data, err := xattrs.Get(xAttrReceived)
+	if err != nil {
+		if errors.Is(err, writablefs.ErrNoSuchAttr) {
+			return nil, nil
+		}
+
+		return nil, fmt.Errorf("error getting received xattr: %w", err)
+	}
+
+	received, err := parseByteRanges(data)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing received xattr: %w", err)
+	}
+
+	return received, nil
+}
@@ -20,65 +20,295 @@ package upload
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"log/slog"
+	"mime"
 	"net/http"
+	"path"
 	"path/filepath"
 	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"connectrpc.com/connect"
 	"github.com/bucket-sailor/bucketeer/internal/gen/upload/v1alpha1"
 	"github.com/bucket-sailor/bucketeer/internal/gen/upload/v1alpha1/v1alpha1connect"
+	"github.com/bucket-sailor/bucketeer/internal/metrics"
+	"github.com/bucket-sailor/bucketeer/internal/telemetry"
+	"github.com/bucket-sailor/bucketeer/internal/util"
 	"github.com/bucket-sailor/queue"
 	"github.com/bucket-sailor/writablefs"
 	"github.com/google/uuid"
+	"github.com/hashicorp/golang-lru/v2/expirable"
+	"github.com/jinzhu/copier"
 	"google.golang.org/protobuf/types/known/emptypb"
 	"google.golang.org/protobuf/types/known/wrapperspb"
 )
 
 const (
-	cacheDir      = ".bucketeer"
-	xAttrChecksum = "bucketeer.checksum"
-	xAttrPath     = "bucketeer.path"
-	xAttrComplete = "bucketeer.complete"
-	xAttrError    = "bucketeer.error"
+	// maxSessionIDLength is the maximum length of an upload session ID.
+	maxSessionIDLength = 256
+	// maxIdempotencyKeyLength is the maximum length of an idempotency key.
+	maxIdempotencyKeyLength = 256
+	// maxReapedCompletions is the maximum number of reaped, completed, uploads
+	// that are remembered.
+	maxReapedCompletions = 10000
 )
 
+// idempotencyNamespace is the namespace of the upload IDs derived from
+// idempotency keys.
+var idempotencyNamespace = uuid.MustParse("c3bcad2c-f753-40e5-a72d-653234220d0c")
+
+// errAlreadyCompleted is returned when New is retried with the idempotency key
+// of an upload that has already been completed.
+var errAlreadyCompleted = errors.New("upload for idempotency key has already been completed")
+
+const (
+	cacheDir         = ".bucketeer"
+	xAttrChecksum    = "bucketeer.checksum"
+	xAttrPath        = "bucketeer.path"
+	xAttrSize        = "bucketeer.size"
+	xAttrReceived    = "bucketeer.received"
+	xAttrComplete    = "bucketeer.complete"
+	xAttrError       = "bucketeer.error"
+	xAttrReason      = "bucketeer.reason"
+	xAttrNoOverwrite = "bucketeer.nooverwrite"
+	xAttrHashState   = "bucketeer.hashstate"
+	xAttrHashOffset  = "bucketeer.hashoffset"
+	xAttrCreated     = "bucketeer.created"
+	xAttrContentType = "bucketeer.content-type"
+	xAttrSession     = "bucketeer.session"
+	// xAttrDstContentType is set on the destination, filesystems that store
+	// metadata as HTTP headers (eg. S3) will use it as the content type.
+	xAttrDstContentType = "content-type"
+)
+
+// ServerOptions are options for configuring the behavior of the upload server.
+type ServerOptions struct {
+	// StaleUploadTTL is how long an upload can go without activity before it is reaped.
+	StaleUploadTTL time.Duration
+	// ReapInterval is how often to scan the cache directory for stale uploads.
+	ReapInterval time.Duration
+	// ReadOnly rejects all new uploads and chunks.
+	ReadOnly bool
+	// MaxUploadSize is the largest upload that will be accepted (zero means unlimited).
+	MaxUploadSize int64
+	// MaxPutSize is the largest file that can be uploaded with a single PUT
+	// request (defaults to 16MB), larger files must use chunked uploads.
+	MaxPutSize int64
+	// ChunkSize is the chunk size recommended to clients when an upload is created.
+	ChunkSize int64
+	// CacheDir is the local path of the cache filesystem, it is used to check
+	// there is enough free space for new uploads (if empty, it isn't checked).
+	CacheDir string
+	// RangeLocks are the chunk range locks, shared between the upload and chunk
+	// servers so that locks can be released when an upload is aborted or completed.
+	RangeLocks *RangeLocks
+	// LockTimeout is how long to wait for an overlapping chunk to finish before
+	// asking the client to retry (defaults to 60 seconds).
+	LockTimeout time.Duration
+	// TelemetryReporter, if set, is used to report the size and duration of completed uploads.
+	TelemetryReporter telemetry.Reporter
+	// Workers is the number of uploads that can be completed concurrently
+	// (defaults to the number of CPUs). Each worker may be copying an entire
+	// file to the destination filesystem.
+	Workers int
+	// ChecksumSource, if set, is used to verify completed uploads against the
+	// checksum recorded by the destination filesystem.
+	ChecksumSource ChecksumSource
+	// OnComplete, if set, is called with the destination path of each
+	// successfully completed upload.
+	OnComplete func(path string)
+}
+
 type Server struct {
 	http.Handler
 	logger  *slog.Logger
 	fsys    writablefs.FS
 	cacheFS writablefs.FS
+	opts    *ServerOptions
 	// completionQueue is a queue for processing completions.
 	// We process these outside the request handler as they may
 	// take a some time to complete.
 	completionQueue *queue.Queue
+	// copyProgress tracks the number of bytes copied to the destination
+	// for uploads that are currently being completed.
+	copyProgress sync.Map
+	// idempotencyMu serializes the creation of uploads with idempotency keys,
+	// so that concurrent retries can't both create the upload.
+	idempotencyMu sync.Mutex
+	// reapedCompletions holds the IDs of completed uploads whose cache files
+	// have been reaped, so that their idempotency keys can't be reused.
+	reapedCompletions *expirable.LRU[string, struct{}]
 }
 
-func NewServer(logger *slog.Logger, fsys, cacheFS writablefs.FS) (string, http.Handler) {
+// NewServer creates a new upload server, stale uploads will be reaped in the
+// background until the context is cancelled.
+func NewServer(ctx context.Context, logger *slog.Logger, fsys, cacheFS writablefs.FS, opts *ServerOptions) (string, http.Handler) {
+	baseOpts := ServerOptions{
+		StaleUploadTTL: 24 * time.Hour,
+		ReapInterval:   time.Hour,
+		ChunkSize:      16000000, // 16MB
+	}
+
+	if opts != nil {
+		// Only fails if the types are incompatible.
+		_ = copier.CopyWithOption(&baseOpts, opts, copier.Option{IgnoreEmpty: true})
+
+		// Copier would otherwise copy the locks, rather than sharing them.
+		baseOpts.RangeLocks = opts.RangeLocks
+		baseOpts.TelemetryReporter = opts.TelemetryReporter
+		baseOpts.ChecksumSource = opts.ChecksumSource
+		baseOpts.OnComplete = opts.OnComplete
+	}
+
+	if baseOpts.RangeLocks == nil {
+		baseOpts.RangeLocks = NewRangeLocks()
+	}
+
+	if baseOpts.Workers <= 0 {
+		baseOpts.Workers = runtime.NumCPU()
+	}
+
 	s := &Server{
 		logger:          logger.WithGroup("upload"),
 		fsys:            fsys,
 		cacheFS:         cacheFS,
-		completionQueue: queue.NewQueue(runtime.NumCPU()),
+		opts:            &baseOpts,
+		completionQueue: queue.NewQueue(baseOpts.Workers),
+		// A client retrying New long after completion is no different from one
+		// reusing an old key, so completions needn't be remembered forever.
+		reapedCompletions: expirable.NewLRU[string, struct{}](maxReapedCompletions, nil, baseOpts.StaleUploadTTL),
 	}
 
 	var path string
-	path, s.Handler = v1alpha1connect.NewUploadHandler(s)
+	path, s.Handler = v1alpha1connect.NewUploadHandler(s, connect.WithInterceptors(metrics.NewInterceptor()))
 
 	s.Handler = http.StripPrefix("/api", s.Handler)
 
+	go s.reapStaleUploads(ctx)
+
 	return "/api" + path, s
 }
 
-func (s *Server) New(ctx context.Context, req *connect.Request[v1alpha1.NewRequest]) (*connect.Response[wrapperspb.StringValue], error) {
-	if req.Msg.Size == 0 || req.Msg.Path == "" || req.Msg.Checksum == "" {
+// reportUpload reports the size and duration (from creation) of a completed
+// upload to telemetry.
+func (s *Server) reportUpload(xattrs writablefs.ExtendedAttributes, size int64) {
+	createdAttr, err := xattrs.Get(xAttrCreated)
+	if err != nil {
+		// Uploads created before the attribute was introduced.
+		return
+	}
+
+	created, err := strconv.ParseInt(string(createdAttr), 10, 64)
+	if err != nil {
+		s.logger.Warn("Error parsing created xattr", "error", err)
+		return
+	}
+
+	telemetry.ReportTransfer(s.opts.TelemetryReporter, telemetry.EventUploadComplete, size, time.Since(time.Unix(0, created)))
+}
+
+func (s *Server) New(ctx context.Context, req *connect.Request[v1alpha1.NewRequest]) (*connect.Response[v1alpha1.NewResponse], error) {
+	if s.opts.ReadOnly {
+		return nil, connect.NewError(connect.CodePermissionDenied, errReadOnly)
+	}
+
+	if req.Msg.Size == 0 || req.Msg.Path == "" || (req.Msg.Checksum == "" && req.Msg.ChecksumAlgorithm == "") {
 		return nil, connect.NewError(connect.CodeInvalidArgument, fmt.Errorf("missing required arguments"))
 	}
 
+	expectedChecksum := strings.ToLower(req.Msg.Checksum)
+	if expectedChecksum != "" {
+		// Otherwise a malformed checksum would only be noticed once the upload
+		// had been staged and completed.
+		if err := validateChecksum(expectedChecksum); err != nil {
+			return nil, connect.NewError(connect.CodeInvalidArgument, err)
+		}
+	} else {
+		// If the checksum will be provided on completion, only the algorithm is
+		// known for now (which is enough to checksum chunks as they arrive).
+		if _, err := newHash(req.Msg.ChecksumAlgorithm); err != nil {
+			return nil, connect.NewError(connect.CodeInvalidArgument, err)
+		}
+
+		expectedChecksum = req.Msg.ChecksumAlgorithm + ":"
+	}
+
+	if req.Msg.Size < 0 {
+		return nil, connect.NewError(connect.CodeInvalidArgument, fmt.Errorf("invalid upload size: %d", req.Msg.Size))
+	}
+
+	if s.opts.MaxUploadSize > 0 && req.Msg.Size > s.opts.MaxUploadSize {
+		return nil, connect.NewError(connect.CodeInvalidArgument,
+			fmt.Errorf("upload size %d exceeds the maximum of %d bytes", req.Msg.Size, s.opts.MaxUploadSize))
+	}
+
+	dstPath, err := cleanDestination(req.Msg.Path)
+	if err != nil {
+		return nil, connect.NewError(connect.CodeInvalidArgument, err)
+	}
+
+	if len(req.Msg.SessionId) > maxSessionIDLength {
+		return nil, connect.NewError(connect.CodeInvalidArgument, fmt.Errorf("session ID is too long (max %d bytes)", maxSessionIDLength))
+	}
+
+	if req.Msg.ContentType != "" {
+		if _, _, err := mime.ParseMediaType(req.Msg.ContentType); err != nil {
+			return nil, connect.NewError(connect.CodeInvalidArgument, fmt.Errorf("invalid content type: %w", err))
+		}
+	}
+
+	metadata, err := normalizeMetadata(req.Msg.Metadata)
+	if err != nil {
+		return nil, connect.NewError(connect.CodeInvalidArgument, err)
+	}
+
+	if len(req.Msg.IdempotencyKey) > maxIdempotencyKeyLength {
+		return nil, connect.NewError(connect.CodeInvalidArgument, fmt.Errorf("idempotency key is too long (max %d bytes)", maxIdempotencyKeyLength))
+	}
+
 	uploadID := uuid.New().String()
+	if req.Msg.IdempotencyKey != "" {
+		// Derived from the key, so that a retried request finds the upload
+		// created by the original request.
+		uploadID = uuid.NewSHA1(idempotencyNamespace, []byte(req.Msg.IdempotencyKey)).String()
+
+		s.idempotencyMu.Lock()
+		defer s.idempotencyMu.Unlock()
+
+		exists, err := s.existingUploadMatches(uploadID, dstPath, req.Msg.Size, expectedChecksum)
+		if err != nil {
+			return nil, err
+		}
+
+		if exists {
+			s.logger.Debug("Returning existing upload for idempotency key", "id", uploadID)
+
+			return &connect.Response[v1alpha1.NewResponse]{
+				Msg: &v1alpha1.NewResponse{
+					Id:        uploadID,
+					ChunkSize: s.opts.ChunkSize,
+				},
+			}, nil
+		}
+	}
+
+	if s.opts.CacheDir != "" {
+		// Otherwise the upload would fail part way through with a generic I/O error.
+		if _, free, err := util.DiskSpace(s.opts.CacheDir); err != nil {
+			s.logger.Warn("Error getting cache free space", "error", err)
+		} else if uint64(req.Msg.Size) > free {
+			return nil, connect.NewError(connect.CodeResourceExhausted,
+				fmt.Errorf("not enough free space in the cache directory: upload size %d exceeds %d available bytes", req.Msg.Size, free))
+		}
+	}
 
 	cachePath := filepath.Join(cacheDir, uploadID)
 	f, err := s.cacheFS.OpenFile(cachePath, writablefs.FlagWriteOnly|writablefs.FlagCreate)
@@ -108,24 +338,145 @@ func (s *Server) New(ctx context.Context, req *connect.Request[v1alpha1.NewReque
 		return nil, connect.NewError(connect.CodeInternal, fmt.Errorf("error getting xattrs: %w", err))
 	}
 
-	if err := xattrs.Set(xAttrChecksum, []byte(req.Msg.Checksum)); err != nil {
+	if err := xattrs.Set(xAttrChecksum, []byte(expectedChecksum)); err != nil {
 		return nil, connect.NewError(connect.CodeInternal, fmt.Errorf("error setting checksum xattr: %w", err))
 	}
 
-	if err := xattrs.Set(xAttrPath, []byte(req.Msg.Path)); err != nil {
+	if err := xattrs.Set(xAttrPath, []byte(dstPath)); err != nil {
 		return nil, connect.NewError(connect.CodeInternal, fmt.Errorf("error setting path xattr: %w", err))
 	}
 
+	if err := xattrs.Set(xAttrSize, []byte(strconv.FormatInt(req.Msg.Size, 10))); err != nil {
+		return nil, connect.NewError(connect.CodeInternal, fmt.Errorf("error setting size xattr: %w", err))
+	}
+
+	if err := xattrs.Set(xAttrCreated, []byte(strconv.FormatInt(time.Now().UnixNano(), 10))); err != nil {
+		return nil, connect.NewError(connect.CodeInternal, fmt.Errorf("error setting created xattr: %w", err))
+	}
+
+	if req.Msg.ContentType != "" {
+		if err := xattrs.Set(xAttrContentType, []byte(req.Msg.ContentType)); err != nil {
+			return nil, connect.NewError(connect.CodeInternal, fmt.Errorf("error setting content type xattr: %w", err))
+		}
+	}
+
+	if len(metadata) > 0 {
+		encoded, err := json.Marshal(metadata)
+		if err != nil {
+			return nil, connect.NewError(connect.CodeInternal, fmt.Errorf("error encoding metadata: %w", err))
+		}
+
+		if err := xattrs.Set(xAttrMetadata, encoded); err != nil {
+			return nil, connect.NewError(connect.CodeInternal, fmt.Errorf("error setting metadata xattr: %w", err))
+		}
+	}
+
+	if req.Msg.SessionId != "" {
+		if err := xattrs.Set(xAttrSession, []byte(req.Msg.SessionId)); err != nil {
+			return nil, connect.NewError(connect.CodeInternal, fmt.Errorf("error setting session xattr: %w", err))
+		}
+	}
+
+	if req.Msg.NoOverwrite {
+		if err := xattrs.Set(xAttrNoOverwrite, []byte("true")); err != nil {
+			return nil, connect.NewError(connect.CodeInternal, fmt.Errorf("error setting no overwrite xattr: %w", err))
+		}
+	}
+
 	if err := xattrs.Sync(); err != nil {
 		return nil, connect.NewError(connect.CodeInternal, fmt.Errorf("error syncing xattrs: %w", err))
 	}
 
-	return &connect.Response[wrapperspb.StringValue]{
-		Msg: &wrapperspb.StringValue{Value: uploadID},
+	return &connect.Response[v1alpha1.NewResponse]{
+		Msg: &v1alpha1.NewResponse{
+			Id:        uploadID,
+			ChunkSize: s.opts.ChunkSize,
+		},
 	}, nil
 }
 
+// existingUploadMatches reports whether an upload with the given ID has
+// already been created, returning an error if it was created for a different
+// path, size or checksum (eg. a client reused an idempotency key), or if it has
+// already been completed.
+func (s *Server) existingUploadMatches(uploadID, dstPath string, size int64, expectedChecksum string) (bool, error) {
+	if _, ok := s.reapedCompletions.Get(uploadID); ok {
+		return false, connect.NewError(connect.CodeFailedPrecondition, errAlreadyCompleted)
+	}
+
+	f, err := s.cacheFS.OpenFile(filepath.Join(cacheDir, uploadID), writablefs.FlagReadOnly)
+	if err != nil {
+		if errors.Is(err, writablefs.ErrNotExist) {
+			return false, nil
+		}
+
+		return false, connect.NewError(connect.CodeInternal, fmt.Errorf("error opening cache file: %w", err))
+	}
+	defer f.Close()
+
+	xattrs, err := f.XAttrs()
+	if err != nil {
+		return false, connect.NewError(connect.CodeInternal, fmt.Errorf("error getting xattrs: %w", err))
+	}
+
+	existingPath, err := xattrs.Get(xAttrPath)
+	if err != nil {
+		return false, connect.NewError(connect.CodeInternal, fmt.Errorf("error getting path xattr: %w", err))
+	}
+
+	existingSize, err := getSize(xattrs)
+	if err != nil {
+		return false, connect.NewError(connect.CodeInternal, err)
+	}
+
+	existingChecksum, err := xattrs.Get(xAttrChecksum)
+	if err != nil {
+		return false, connect.NewError(connect.CodeInternal, fmt.Errorf("error getting checksum xattr: %w", err))
+	}
+
+	// A deferred checksum is filled in on completion, so only the algorithm
+	// can be compared.
+	checksumMatches := string(existingChecksum) == expectedChecksum ||
+		(strings.HasSuffix(expectedChecksum, ":") && strings.HasPrefix(string(existingChecksum), expectedChecksum))
+
+	if string(existingPath) != dstPath || existingSize != size || !checksumMatches {
+		return false, connect.NewError(connect.CodeAlreadyExists, fmt.Errorf("idempotency key was used for a different upload"))
+	}
+
+	// The cache file has been truncated (or is about to be), so chunks can no
+	// longer be uploaded to it.
+	if _, ok := s.copyProgress.Load(uploadID); ok {
+		return false, connect.NewError(connect.CodeFailedPrecondition, errAlreadyCompleted)
+	}
+
+	completed, err := isCompleted(xattrs)
+	if err != nil {
+		return false, connect.NewError(connect.CodeInternal, err)
+	}
+
+	if completed {
+		return false, connect.NewError(connect.CodeFailedPrecondition, errAlreadyCompleted)
+	}
+
+	return true, nil
+}
+
+// isCompleted reports whether the completion of an upload has finished
+// (successfully or not).
+func isCompleted(xattrs writablefs.ExtendedAttributes) (bool, error) {
+	complete, err := xattrs.Get(xAttrComplete)
+	if err != nil && !errors.Is(err, writablefs.ErrNoSuchAttr) {
+		return false, fmt.Errorf("error getting complete xattr: %w", err)
+	}
+
+	return string(complete) == "true", nil
+}
+
 func (s *Server) Abort(ctx context.Context, req *connect.Request[wrapperspb.StringValue]) (*connect.Response[emptypb.Empty], error) {
+	if s.opts.ReadOnly {
+		return nil, connect.NewError(connect.CodePermissionDenied, errReadOnly)
+	}
+
 	uploadID := req.Msg.Value
 	if uploadID == "" {
 		return nil, connect.NewError(connect.CodeInvalidArgument, fmt.Errorf("missing required argument"))
@@ -141,11 +492,96 @@ func (s *Server) Abort(ctx context.Context, req *connect.Request[wrapperspb.Stri
 		return nil, connect.NewError(connect.CodeInternal, fmt.Errorf("error removing cache file: %w", err))
 	}
 
+	s.opts.RangeLocks.Release(uploadID)
+
 	return &connect.Response[emptypb.Empty]{}, nil
 }
 
-func (s *Server) Complete(ctx context.Context, req *connect.Request[wrapperspb.StringValue]) (*connect.Response[emptypb.Empty], error) {
-	uploadID := req.Msg.Value
+func (s *Server) AbortSession(ctx context.Context, req *connect.Request[wrapperspb.StringValue]) (*connect.Response[emptypb.Empty], error) {
+	if s.opts.ReadOnly {
+		return nil, connect.NewError(connect.CodePermissionDenied, errReadOnly)
+	}
+
+	sessionID := req.Msg.Value
+	if sessionID == "" {
+		return nil, connect.NewError(connect.CodeInvalidArgument, fmt.Errorf("missing required argument"))
+	}
+
+	entries, err := s.cacheFS.ReadDir(cacheDir)
+	if err != nil {
+		if errors.Is(err, writablefs.ErrNotExist) {
+			return &connect.Response[emptypb.Empty]{}, nil
+		}
+
+		return nil, connect.NewError(connect.CodeInternal, fmt.Errorf("error reading cache directory: %w", err))
+	}
+
+	var aborted int
+	for _, entry := range entries {
+		uploadID := entry.Name()
+
+		// Skip uploads that are pending completion.
+		if _, ok := s.copyProgress.Load(uploadID); ok {
+			continue
+		}
+
+		cachePath := filepath.Join(cacheDir, uploadID)
+
+		uploadSessionID, err := getSessionID(s.cacheFS, cachePath)
+		if err != nil {
+			// Probably removed while we were iterating.
+			if errors.Is(err, writablefs.ErrNotExist) {
+				continue
+			}
+
+			return nil, connect.NewError(connect.CodeInternal, err)
+		}
+
+		if uploadSessionID != sessionID {
+			continue
+		}
+
+		if err := s.cacheFS.RemoveAll(cachePath); err != nil {
+			return nil, connect.NewError(connect.CodeInternal, fmt.Errorf("error removing cache file: %w", err))
+		}
+
+		s.opts.RangeLocks.Release(uploadID)
+
+		aborted++
+	}
+
+	s.logger.Debug("Aborted session", "session", sessionID, "uploads", aborted)
+
+	return &connect.Response[emptypb.Empty]{}, nil
+}
+
+// getSessionID returns the session ID of a staged upload (if any).
+func getSessionID(cacheFS writablefs.FS, cachePath string) (string, error) {
+	f, err := cacheFS.OpenFile(cachePath, writablefs.FlagReadOnly)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	xattrs, err := f.XAttrs()
+	if err != nil {
+		return "", fmt.Errorf("error getting xattrs: %w", err)
+	}
+
+	sessionID, err := xattrs.Get(xAttrSession)
+	if err != nil && !errors.Is(err, writablefs.ErrNoSuchAttr) {
+		return "", fmt.Errorf("error getting session xattr: %w", err)
+	}
+
+	return string(sessionID), nil
+}
+
+func (s *Server) Complete(ctx context.Context, req *connect.Request[v1alpha1.CompleteRequest]) (*connect.Response[emptypb.Empty], error) {
+	if s.opts.ReadOnly {
+		return nil, connect.NewError(connect.CodePermissionDenied, errReadOnly)
+	}
+
+	uploadID := req.Msg.Id
 
 	if _, err := uuid.Parse(uploadID); err != nil {
 		return nil, connect.NewError(connect.CodeInvalidArgument, fmt.Errorf("invalid upload ID: %w", err))
@@ -153,7 +589,27 @@ func (s *Server) Complete(ctx context.Context, req *connect.Request[wrapperspb.S
 
 	cachePath := filepath.Join(cacheDir, uploadID)
 
+	// Fail fast if chunks are missing, rather than reading back (and checksumming)
+	// a partially written file.
+	if err := s.checkFullyReceived(cachePath); err != nil {
+		return nil, err
+	}
+
+	if err := s.setDeferredChecksum(cachePath, req.Msg.Checksum); err != nil {
+		return nil, err
+	}
+
+	// Mark the upload as pending completion (so it won't be reaped).
+	var copied atomic.Int64
+	s.copyProgress.Store(uploadID, &copied)
+
+	metrics.CompletionQueueLength.Inc()
+
 	s.completionQueue.Add(func() error {
+		defer metrics.CompletionQueueLength.Dec()
+		defer s.copyProgress.Delete(uploadID)
+		defer s.opts.RangeLocks.Release(uploadID)
+
 		completeFn := func() error {
 			f, err := s.cacheFS.OpenFile(cachePath, writablefs.FlagReadWrite)
 			if err != nil {
@@ -176,23 +632,77 @@ func (s *Server) Complete(ctx context.Context, req *connect.Request[wrapperspb.S
 				return fmt.Errorf("error getting path xattr: %w", err)
 			}
 
-			if err := verifyChecksum(f, string(expectedChecksum)); err != nil {
-				return fmt.Errorf("checksum mismatch: %w", err)
+			sizeAttr, err := xattrs.Get(xAttrSize)
+			if err != nil {
+				return fmt.Errorf("error getting size xattr: %w", err)
+			}
+
+			size, err := strconv.ParseInt(string(sizeAttr), 10, 64)
+			if err != nil {
+				return fmt.Errorf("error parsing size xattr: %w", err)
+			}
+
+			// If the chunks arrived in order, the checksum was computed as they were
+			// written, otherwise we need to read the whole file back.
+			if sh, err := loadStreamingHash(xattrs); err == nil && sh.offset == size {
+				s.logger.Debug("Using streamed checksum", "id", uploadID)
+
+				if err := compareChecksums(string(expectedChecksum), sh.checksum()); err != nil {
+					return &completionError{reason: v1alpha1.FailureReason_CHECKSUM_MISMATCH, err: fmt.Errorf("checksum mismatch: %w", err)}
+				}
+			} else if err := verifyChecksum(f, string(expectedChecksum)); err != nil {
+				return &completionError{reason: v1alpha1.FailureReason_CHECKSUM_MISMATCH, err: fmt.Errorf("checksum mismatch: %w", err)}
+			}
+
+			noOverwrite, err := xattrs.Get(xAttrNoOverwrite)
+			if err != nil && !errors.Is(err, writablefs.ErrNoSuchAttr) {
+				return fmt.Errorf("error getting no overwrite xattr: %w", err)
+			}
+
+			if string(noOverwrite) == "true" {
+				if _, err := s.fsys.Stat(string(dstPath)); err == nil {
+					return &completionError{reason: v1alpha1.FailureReason_DEST_EXISTS, err: fmt.Errorf("destination already exists: %s", dstPath)}
+				}
 			}
 
 			if err := s.fsys.MkdirAll(filepath.Dir(string(dstPath))); err != nil {
-				return err
+				return &completionError{reason: v1alpha1.FailureReason_WRITE_FAILED, err: err}
 			}
 
-			if err := copyFile(s.cacheFS, cachePath, s.fsys, string(dstPath)); err != nil {
+			if err := copyFile(s.cacheFS, cachePath, s.fsys, string(dstPath), &copied); err != nil {
+				return &completionError{reason: v1alpha1.FailureReason_WRITE_FAILED, err: err}
+			}
+
+			// Completion outlives the request, so its context can't be used.
+			if err := s.verifyStoredChecksum(context.Background(), f, size, string(expectedChecksum), string(dstPath)); err != nil {
+				return &completionError{reason: v1alpha1.FailureReason_CHECKSUM_MISMATCH, err: fmt.Errorf("destination checksum mismatch: %w", err)}
+			}
+
+			metadata, err := getMetadata(xattrs)
+			if err != nil {
 				return err
 			}
 
+			// The destination has been verified, so downloads can report the
+			// checksum (as X-Checksum and a strong ETag).
+			metadata[xAttrChecksum] = string(expectedChecksum)
+
+			// Not all filesystems support metadata, so this isn't fatal.
+			if err := setMetadata(s.fsys, string(dstPath), metadata); err != nil {
+				s.logger.Warn("Error setting metadata", "id", uploadID, "error", err)
+			}
+
 			// Truncate the cache file to 0 bytes now that the upload is complete.
 			if err := f.Truncate(0); err != nil {
 				return err
 			}
 
+			s.reportUpload(xattrs, size)
+
+			if s.opts.OnComplete != nil {
+				s.opts.OnComplete(string(dstPath))
+			}
+
 			return nil
 		}
 
@@ -215,6 +725,16 @@ func (s *Server) Complete(ctx context.Context, req *connect.Request[wrapperspb.S
 				if err := xattrs.Set(xAttrError, []byte(completionErr.Error())); err != nil {
 					s.logger.Error("Error setting error xattr", "error", err)
 				}
+
+				reason := v1alpha1.FailureReason_UNKNOWN
+				var cErr *completionError
+				if errors.As(completionErr, &cErr) {
+					reason = cErr.reason
+				}
+
+				if err := xattrs.Set(xAttrReason, []byte(reason.String())); err != nil {
+					s.logger.Error("Error setting reason xattr", "error", err)
+				}
 			}
 
 			if err := xattrs.Set(xAttrComplete, []byte("true")); err != nil {
@@ -231,7 +751,9 @@ func (s *Server) Complete(ctx context.Context, req *connect.Request[wrapperspb.S
 			s.logger.Error("Error completing upload", "error", completionErr)
 		}
 
-		return completionErr
+		// The error is reported to the client via the xattrs, returning it would
+		// stop the queue from processing any further completions.
+		return nil
 	})
 
 	return &connect.Response[emptypb.Empty]{}, nil
@@ -280,10 +802,16 @@ func (s *Server) PollForCompletion(ctx context.Context, req *connect.Request[wra
 	}
 
 	if errorAttr != nil {
+		reasonAttr, err := xattrs.Get(xAttrReason)
+		if err != nil && !errors.Is(err, writablefs.ErrNoSuchAttr) {
+			return nil, connect.NewError(connect.CodeInternal, fmt.Errorf("error getting reason xattr: %w", err))
+		}
+
 		return &connect.Response[v1alpha1.CompleteResponse]{
 			Msg: &v1alpha1.CompleteResponse{
 				Status: *v1alpha1.CompletionStatus_FAILED.Enum(),
 				Error:  string(errorAttr),
+				Reason: v1alpha1.FailureReason(v1alpha1.FailureReason_value[string(reasonAttr)]),
 			},
 		}, nil
 	}
@@ -295,7 +823,385 @@ func (s *Server) PollForCompletion(ctx context.Context, req *connect.Request[wra
 	}, nil
 }
 
-func copyFile(srcFS writablefs.FS, srcPath string, dstFS writablefs.FS, dstPath string) error {
+func (s *Server) Progress(ctx context.Context, req *connect.Request[wrapperspb.StringValue]) (*connect.Response[v1alpha1.ProgressResponse], error) {
+	uploadID := req.Msg.Value
+
+	if _, err := uuid.Parse(uploadID); err != nil {
+		return nil, connect.NewError(connect.CodeInvalidArgument, fmt.Errorf("invalid upload ID: %w", err))
+	}
+
+	cachePath := filepath.Join(cacheDir, uploadID)
+
+	f, err := s.cacheFS.OpenFile(cachePath, writablefs.FlagReadOnly)
+	if err != nil {
+		if errors.Is(err, writablefs.ErrNotExist) {
+			return nil, connect.NewError(connect.CodeNotFound, fmt.Errorf("upload not found"))
+		}
+
+		return nil, connect.NewError(connect.CodeInternal, fmt.Errorf("error opening cache file: %w", err))
+	}
+	defer f.Close()
+
+	xattrs, err := f.XAttrs()
+	if err != nil {
+		return nil, connect.NewError(connect.CodeInternal, fmt.Errorf("error opening xattrs: %w", err))
+	}
+
+	sizeAttr, err := xattrs.Get(xAttrSize)
+	if err != nil {
+		return nil, connect.NewError(connect.CodeInternal, fmt.Errorf("error getting size xattr: %w", err))
+	}
+
+	totalSize, err := strconv.ParseInt(string(sizeAttr), 10, 64)
+	if err != nil {
+		return nil, connect.NewError(connect.CodeInternal, fmt.Errorf("error parsing size xattr: %w", err))
+	}
+
+	received, err := getReceivedRanges(xattrs)
+	if err != nil {
+		return nil, connect.NewError(connect.CodeInternal, err)
+	}
+
+	var copiedBytes int64
+	if copied, ok := s.copyProgress.Load(uploadID); ok {
+		copiedBytes = copied.(*atomic.Int64).Load()
+	} else {
+		complete, err := xattrs.Get(xAttrComplete)
+		if err != nil && !errors.Is(err, writablefs.ErrNoSuchAttr) {
+			return nil, connect.NewError(connect.CodeInternal, fmt.Errorf("error getting complete xattr: %w", err))
+		}
+
+		if string(complete) == "true" {
+			copiedBytes = totalSize
+		}
+	}
+
+	return &connect.Response[v1alpha1.ProgressResponse]{
+		Msg: &v1alpha1.ProgressResponse{
+			TotalSize:     totalSize,
+			ReceivedBytes: received.Size(),
+			CopiedBytes:   copiedBytes,
+		},
+	}, nil
+}
+
+func (s *Server) GetReceivedRanges(ctx context.Context, req *connect.Request[wrapperspb.StringValue]) (*connect.Response[v1alpha1.ReceivedRangesResponse], error) {
+	uploadID := req.Msg.Value
+
+	if _, err := uuid.Parse(uploadID); err != nil {
+		return nil, connect.NewError(connect.CodeInvalidArgument, fmt.Errorf("invalid upload ID: %w", err))
+	}
+
+	cachePath := filepath.Join(cacheDir, uploadID)
+
+	f, err := s.cacheFS.OpenFile(cachePath, writablefs.FlagReadOnly)
+	if err != nil {
+		if errors.Is(err, writablefs.ErrNotExist) {
+			return nil, connect.NewError(connect.CodeNotFound, fmt.Errorf("upload not found"))
+		}
+
+		return nil, connect.NewError(connect.CodeInternal, fmt.Errorf("error opening cache file: %w", err))
+	}
+	defer f.Close()
+
+	xattrs, err := f.XAttrs()
+	if err != nil {
+		return nil, connect.NewError(connect.CodeInternal, fmt.Errorf("error opening xattrs: %w", err))
+	}
+
+	received, err := getReceivedRanges(xattrs)
+	if err != nil {
+		return nil, connect.NewError(connect.CodeInternal, err)
+	}
+
+	ranges := make([]*v1alpha1.ByteRange, 0, len(received))
+	for _, rng := range received {
+		ranges = append(ranges, &v1alpha1.ByteRange{
+			Start: rng.Start,
+			End:   rng.End,
+		})
+	}
+
+	return &connect.Response[v1alpha1.ReceivedRangesResponse]{
+		Msg: &v1alpha1.ReceivedRangesResponse{
+			Ranges: ranges,
+		},
+	}, nil
+}
+
+// Shutdown waits for any pending upload completions to finish. If the context
+// is cancelled first, the remaining completions are abandoned.
+func (s *Server) Shutdown(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		_ = s.completionQueue.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// reapStaleUploads periodically removes uploads that have not been modified
+// within the configured TTL (eg. the client never completed or aborted them).
+func (s *Server) reapStaleUploads(ctx context.Context) {
+	ticker := time.NewTicker(s.opts.ReapInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := s.reap(); err != nil {
+				s.logger.Warn("Error reaping stale uploads", "error", err)
+			}
+		}
+	}
+}
+
+func (s *Server) reap() error {
+	entries, err := s.cacheFS.ReadDir(cacheDir)
+	if err != nil {
+		if errors.Is(err, writablefs.ErrNotExist) {
+			return nil
+		}
+
+		return fmt.Errorf("error reading cache directory: %w", err)
+	}
+
+	for _, entry := range entries {
+		uploadID := entry.Name()
+
+		// Skip uploads that are pending completion.
+		if _, ok := s.copyProgress.Load(uploadID); ok {
+			continue
+		}
+
+		fi, err := entry.Info()
+		if err != nil {
+			return fmt.Errorf("error getting file info: %w", err)
+		}
+
+		// Every chunk write updates the modification time, so this is the
+		// time since the last activity on the upload.
+		if time.Since(fi.ModTime()) < s.opts.StaleUploadTTL {
+			continue
+		}
+
+		s.logger.Debug("Reaping stale upload", "id", uploadID, "modTime", fi.ModTime())
+
+		if s.reapingCompleted(uploadID) {
+			s.reapedCompletions.Add(uploadID, struct{}{})
+		}
+
+		if err := s.cacheFS.RemoveAll(filepath.Join(cacheDir, uploadID)); err != nil {
+			return fmt.Errorf("error removing stale upload: %w", err)
+		}
+
+		s.opts.RangeLocks.Release(uploadID)
+	}
+
+	return nil
+}
+
+// reapingCompleted reports whether an upload that is about to be reaped was
+// completed.
+func (s *Server) reapingCompleted(uploadID string) bool {
+	f, err := s.cacheFS.OpenFile(filepath.Join(cacheDir, uploadID), writablefs.FlagReadOnly)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+
+	xattrs, err := f.XAttrs()
+	if err != nil {
+		return false
+	}
+
+	completed, err := isCompleted(xattrs)
+	return err == nil && completed
+}
+
+// RemoveCache removes all staged uploads from the cache filesystem.
+func RemoveCache(cacheFS writablefs.FS) error {
+	return cacheFS.RemoveAll(cacheDir)
+}
+
+// setDeferredChecksum records the checksum of an upload whose checksum wasn't
+// known when it was created.
+func (s *Server) setDeferredChecksum(cachePath, checksum string) error {
+	checksum = strings.ToLower(checksum)
+
+	f, err := s.cacheFS.OpenFile(cachePath, writablefs.FlagReadWrite)
+	if err != nil {
+		if errors.Is(err, writablefs.ErrNotExist) {
+			return connect.NewError(connect.CodeNotFound, fmt.Errorf("upload not found"))
+		}
+
+		return connect.NewError(connect.CodeInternal, fmt.Errorf("error opening cache file: %w", err))
+	}
+	defer f.Close()
+
+	xattrs, err := f.XAttrs()
+	if err != nil {
+		return connect.NewError(connect.CodeInternal, fmt.Errorf("error getting xattrs: %w", err))
+	}
+
+	expectedChecksum, err := xattrs.Get(xAttrChecksum)
+	if err != nil {
+		return connect.NewError(connect.CodeInternal, fmt.Errorf("error getting checksum xattr: %w", err))
+	}
+
+	algorithm, digest, _ := strings.Cut(string(expectedChecksum), ":")
+	if digest != "" {
+		// The checksum was provided when the upload was created.
+		if checksum != "" && checksum != string(expectedChecksum) {
+			return connect.NewError(connect.CodeInvalidArgument, fmt.Errorf("checksum doesn't match the one provided when the upload was created"))
+		}
+
+		return nil
+	}
+
+	if checksum == "" {
+		return connect.NewError(connect.CodeInvalidArgument, fmt.Errorf("missing checksum"))
+	}
+
+	if checksumAlgorithm(checksum) != algorithm {
+		return connect.NewError(connect.CodeInvalidArgument, fmt.Errorf("expected a %s checksum", algorithm))
+	}
+
+	if err := validateChecksum(checksum); err != nil {
+		return connect.NewError(connect.CodeInvalidArgument, err)
+	}
+
+	if err := xattrs.Set(xAttrChecksum, []byte(checksum)); err != nil {
+		return connect.NewError(connect.CodeInternal, fmt.Errorf("error setting checksum xattr: %w", err))
+	}
+
+	if err := xattrs.Sync(); err != nil {
+		return connect.NewError(connect.CodeInternal, fmt.Errorf("error syncing xattrs: %w", err))
+	}
+
+	return nil
+}
+
+// verifyStoredChecksum checks the copy of an upload against the checksum
+// recorded by the destination filesystem (if any). Uploads have already been
+// verified against the client's checksum, so without a stored checksum there
+// is nothing more to do.
+func (s *Server) verifyStoredChecksum(ctx context.Context, f writablefs.File, size int64, expectedChecksum, dstPath string) error {
+	if s.opts.ChecksumSource == nil {
+		return nil
+	}
+
+	stored, err := s.opts.ChecksumSource.StoredChecksum(ctx, dstPath)
+	if err != nil {
+		// Not being able to verify the copy isn't a reason to fail the upload.
+		s.logger.Warn("Error getting stored checksum", "path", dstPath, "error", err)
+		return nil
+	}
+
+	if stored == "" {
+		return nil
+	}
+
+	// No need to read the file again if the algorithms match.
+	if checksumAlgorithm(stored) == checksumAlgorithm(expectedChecksum) {
+		return compareChecksums(expectedChecksum, stored)
+	}
+
+	return verifyChecksum(io.NewSectionReader(f, 0, size), stored)
+}
+
+// cleanDestination cleans an upload destination path, rejecting paths that
+// would escape the root of the filesystem.
+func cleanDestination(p string) (string, error) {
+	cleaned := path.Clean(filepath.ToSlash(p))
+
+	if cleaned == ".." || strings.HasPrefix(cleaned, "../") {
+		return "", fmt.Errorf("invalid destination path: %q escapes the root", p)
+	}
+
+	cleaned = strings.TrimPrefix(cleaned, "/")
+	if cleaned == "" || cleaned == "." {
+		return "", fmt.Errorf("invalid destination path: %q", p)
+	}
+
+	return cleaned, nil
+}
+
+// getSize returns the declared size of an upload.
+func getSize(xattrs writablefs.ExtendedAttributes) (int64, error) {
+	sizeAttr, err := xattrs.Get(xAttrSize)
+	if err != nil {
+		return 0, fmt.Errorf("error getting size xattr: %w", err)
+	}
+
+	size, err := strconv.ParseInt(string(sizeAttr), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("error parsing size xattr: %w", err)
+	}
+
+	return size, nil
+}
+
+// checkFullyReceived returns an error if the received ranges of an upload
+// don't cover its declared size.
+func (s *Server) checkFullyReceived(cachePath string) error {
+	f, err := s.cacheFS.OpenFile(cachePath, writablefs.FlagReadOnly)
+	if err != nil {
+		if errors.Is(err, writablefs.ErrNotExist) {
+			return connect.NewError(connect.CodeNotFound, fmt.Errorf("upload not found"))
+		}
+
+		return connect.NewError(connect.CodeInternal, fmt.Errorf("error opening cache file: %w", err))
+	}
+	defer f.Close()
+
+	xattrs, err := f.XAttrs()
+	if err != nil {
+		return connect.NewError(connect.CodeInternal, fmt.Errorf("error opening xattrs: %w", err))
+	}
+
+	totalSize, err := getSize(xattrs)
+	if err != nil {
+		return connect.NewError(connect.CodeInternal, err)
+	}
+
+	received, err := getReceivedRanges(xattrs)
+	if err != nil {
+		return connect.NewError(connect.CodeInternal, err)
+	}
+
+	if received.Size() != totalSize {
+		return connect.NewError(connect.CodeFailedPrecondition,
+			fmt.Errorf("incomplete upload: received %d of %d bytes", received.Size(), totalSize))
+	}
+
+	return nil
+}
+
+// completionError is an error that occurred while completing an upload, along
+// with a machine readable reason for the failure.
+type completionError struct {
+	reason v1alpha1.FailureReason
+	err    error
+}
+
+func (e *completionError) Error() string {
+	return e.err.Error()
+}
+
+func (e *completionError) Unwrap() error {
+	return e.err
+}
+
+func copyFile(srcFS writablefs.FS, srcPath string, dstFS writablefs.FS, dstPath string, copied *atomic.Int64) error {
 	src, err := srcFS.OpenFile(srcPath, writablefs.FlagReadOnly)
 	if err != nil {
 		return err
@@ -308,6 +1214,26 @@ func copyFile(srcFS writablefs.FS, srcPath string, dstFS writablefs.FS, dstPath
 	}
 	defer dst.Close()
 
-	_, err = io.Copy(dst, src)
-	return err
+	// In case we are overwriting an existing file.
+	if err := dst.Truncate(0); err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(dst, &countingReader{r: src, n: copied}); err != nil {
+		return err
+	}
+
+	return clearStoredChecksum(dst)
+}
+
+// countingReader is a reader that counts the number of bytes read.
+type countingReader struct {
+	r io.Reader
+	n *atomic.Int64
+}
+
+func (cr *countingReader) Read(p []byte) (int, error) {
+	n, err := cr.r.Read(p)
+	cr.n.Add(int64(n))
+	return n, err
 }
@@ -0,0 +1,66 @@
+/* SPDX-License-Identifier: AGPL-3.0-or-later
+ *
+ * Copyright 2024 Damian Peckett <damian@pecke.tt>.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+package upload
+
+import (
+	"context"
+	"path"
+	"strings"
+
+	"github.com/bucket-sailor/bucketeer/internal/util/s3client"
+	"github.com/bucket-sailor/writablefs/s3fs"
+	"github.com/minio/minio-go/v7"
+)
+
+// ChecksumSource is implemented by storage that records a checksum of each
+// file, allowing completed uploads to be verified without reading them back.
+type ChecksumSource interface {
+	// StoredChecksum returns the stored checksum of a file in the "algorithm:hex"
+	// format, or an empty string if there isn't one.
+	StoredChecksum(ctx context.Context, path string) (string, error)
+}
+
+// S3ChecksumSource retrieves the checksums S3 stores for objects.
+type S3ChecksumSource struct {
+	client     *minio.Client
+	bucketName string
+}
+
+// NewS3ChecksumSource creates a new checksum source for the bucket described by opts.
+func NewS3ChecksumSource(opts s3fs.Options, pathStyle bool) (*S3ChecksumSource, error) {
+	client, err := s3client.New(opts, pathStyle)
+	if err != nil {
+		return nil, err
+	}
+
+	return &S3ChecksumSource{
+		client:     client,
+		bucketName: opts.BucketName,
+	}, nil
+}
+
+func (s *S3ChecksumSource) StoredChecksum(ctx context.Context, filePath string) (string, error) {
+	key := strings.TrimPrefix(path.Clean("/"+filePath), "/")
+
+	info, err := s.client.StatObject(ctx, s.bucketName, key, minio.StatObjectOptions{Checksum: true})
+	if err != nil {
+		return "", err
+	}
+
+	return checksumFromS3(info), nil
+}
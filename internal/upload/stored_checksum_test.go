@@ -0,0 +1,111 @@
+/* SPDX-License-Identifier: AGPL-3.0-or-later
+ *
+ * Copyright 2024 Damian Peckett <damian@pecke.tt>.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+package upload_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/bucket-sailor/bucketeer/internal/upload"
+	"github.com/bucket-sailor/writablefs/s3fs"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestS3ChecksumSource(t *testing.T) {
+	// The checksum headers returned for each object, "Hello, World!" has an
+	// MD5 digest of 65a8e27d8879283831b664bd8b7f0ad4.
+	objects := map[string]http.Header{
+		"/my-bucket/sha256.txt": {
+			"Etag":                  {`"65a8e27d8879283831b664bd8b7f0ad4"`},
+			"X-Amz-Checksum-Sha256": {"3/1gIbsr1bCvZ2KQgJ7DpTGR3YHH9wpLKGiKNiGCmG8="},
+		},
+		"/my-bucket/crc32c.txt": {
+			"Etag":                  {`"65a8e27d8879283831b664bd8b7f0ad4"`},
+			"X-Amz-Checksum-Crc32c": {"TVUQaA=="},
+		},
+		"/my-bucket/etag.txt": {
+			"Etag": {`"65a8e27d8879283831b664bd8b7f0ad4"`},
+		},
+		"/my-bucket/multipart.txt": {
+			"Etag":                  {`"a7d414b9133d6483d9a1c4e04e856e3b-2"`},
+			"X-Amz-Checksum-Crc32c": {"Xc2lBA==-2"},
+		},
+		"/my-bucket/encrypted.txt": {
+			"Etag":                         {`"65a8e27d8879283831b664bd8b7f0ad4"`},
+			"X-Amz-Server-Side-Encryption": {"aws:kms"},
+		},
+	}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header, ok := objects[r.URL.Path]
+		if !ok || r.Method != http.MethodHead {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		if r.Header.Get("X-Amz-Checksum-Mode") != "ENABLED" {
+			header = http.Header{"Etag": header["Etag"]}
+		}
+
+		for k, v := range header {
+			w.Header()[k] = v
+		}
+		w.Header().Set("Last-Modified", time.Now().UTC().Format(http.TimeFormat))
+		w.Header().Set("Content-Length", "13")
+		w.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(srv.Close)
+
+	source, err := upload.NewS3ChecksumSource(s3fs.Options{
+		EndpointURL: srv.URL,
+		Region:      "us-east-1",
+		Credentials: credentials.NewStaticV4("access", "secret", ""),
+		BucketName:  "my-bucket",
+	}, true)
+	require.NoError(t, err)
+
+	tests := []struct {
+		path     string
+		expected string
+	}{
+		{"sha256.txt", "sha256:dffd6021bb2bd5b0af676290809ec3a53191dd81c7f70a4b28688a362182986f"},
+		{"crc32c.txt", "crc32c:4d551068"},
+		{"etag.txt", "md5:65a8e27d8879283831b664bd8b7f0ad4"},
+		{"multipart.txt", ""},
+		{"encrypted.txt", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			checksum, err := source.StoredChecksum(context.Background(), tt.path)
+			require.NoError(t, err)
+
+			assert.Equal(t, tt.expected, checksum)
+		})
+	}
+
+	t.Run("Not Found", func(t *testing.T) {
+		_, err := source.StoredChecksum(context.Background(), "missing.txt")
+		require.Error(t, err)
+	})
+}
@@ -0,0 +1,161 @@
+/* SPDX-License-Identifier: AGPL-3.0-or-later
+ *
+ * Copyright 2024 Damian Peckett <damian@pecke.tt>.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package upload
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/bucket-sailor/writablefs"
+	"github.com/google/uuid"
+)
+
+// headerReceived is the number of contiguous bytes, from the start of an
+// upload, that have been received (ie. how far the upload can be followed).
+const headerReceived = "X-Upload-Received"
+
+// handleRead serves a byte range of an upload that is still in progress, only
+// ranges that have already been received can be read.
+func (s *ChunkServer) handleRead(w http.ResponseWriter, r *http.Request) {
+	uploadID := r.URL.Query().Get("id")
+	if _, err := uuid.Parse(uploadID); err != nil {
+		http.Error(w, "Invalid upload ID", http.StatusBadRequest)
+		return
+	}
+
+	f, err := s.cacheFS.OpenFile(filepath.Join(cacheDir, uploadID), writablefs.FlagReadOnly)
+	if err != nil {
+		if errors.Is(err, writablefs.ErrNotExist) {
+			http.Error(w, "Upload not found", http.StatusNotFound)
+			return
+		}
+
+		http.Error(w, "Error opening upload", http.StatusInternalServerError)
+		return
+	}
+	defer f.Close()
+
+	xattrs, err := f.XAttrs()
+	if err != nil {
+		http.Error(w, "Error getting upload info", http.StatusInternalServerError)
+		return
+	}
+
+	// The cache file is truncated once the upload is complete.
+	complete, err := xattrs.Get(xAttrComplete)
+	if err != nil && !errors.Is(err, writablefs.ErrNoSuchAttr) {
+		http.Error(w, "Error getting upload info", http.StatusInternalServerError)
+		return
+	}
+
+	if string(complete) == "true" {
+		http.Error(w, "Upload is complete", http.StatusGone)
+		return
+	}
+
+	size, err := getSize(xattrs)
+	if err != nil {
+		http.Error(w, "Error getting upload info", http.StatusInternalServerError)
+		return
+	}
+
+	received, err := getReceivedRanges(xattrs)
+	if err != nil {
+		http.Error(w, "Error getting upload info", http.StatusInternalServerError)
+		return
+	}
+
+	var contiguous int64
+	if rng, ok := received.Containing(0); ok {
+		contiguous = rng.End + 1
+	}
+
+	w.Header().Set(headerReceived, strconv.FormatInt(contiguous, 10))
+
+	start, end := int64(0), contiguous-1
+	status := http.StatusOK
+	if rangeHeader := r.Header.Get("Range"); rangeHeader != "" {
+		start, end, err = parseRange(rangeHeader, received)
+		if err != nil {
+			w.Header().Set("Content-Range", fmt.Sprintf("bytes */%d", size))
+			http.Error(w, "Requested range not satisfiable: "+err.Error(), http.StatusRequestedRangeNotSatisfiable)
+			return
+		}
+
+		w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, end, size))
+		status = http.StatusPartialContent
+	}
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Length", strconv.FormatInt(end-start+1, 10))
+	w.WriteHeader(status)
+
+	if r.Method == http.MethodHead {
+		return
+	}
+
+	if _, err := io.Copy(w, io.NewSectionReader(f, start, end-start+1)); err != nil {
+		s.logger.Debug("Error reading upload", "id", uploadID, "error", err)
+	}
+}
+
+// parseRange parses a single range of the form "bytes=start-end", or
+// "bytes=start-" to read up to the end of the received data. The range must
+// have been received in its entirety.
+func parseRange(header string, received byteRanges) (int64, int64, error) {
+	spec, ok := strings.CutPrefix(header, "bytes=")
+	if !ok || strings.Contains(spec, ",") {
+		return 0, 0, fmt.Errorf("only a single byte range is supported")
+	}
+
+	startStr, endStr, ok := strings.Cut(spec, "-")
+	if !ok {
+		return 0, 0, fmt.Errorf("invalid range: %q", spec)
+	}
+
+	start, err := strconv.ParseInt(startStr, 10, 64)
+	if err != nil || start < 0 {
+		return 0, 0, fmt.Errorf("invalid range start: %q", startStr)
+	}
+
+	rng, ok := received.Containing(start)
+	if !ok {
+		return 0, 0, fmt.Errorf("bytes from %d have not been received", start)
+	}
+
+	if endStr == "" {
+		return start, rng.End, nil
+	}
+
+	end, err := strconv.ParseInt(endStr, 10, 64)
+	if err != nil || end < start {
+		return 0, 0, fmt.Errorf("invalid range end: %q", endStr)
+	}
+
+	if end > rng.End {
+		return 0, 0, fmt.Errorf("bytes up to %d have not been received", end)
+	}
+
+	return start, end, nil
+}
@@ -19,95 +19,1984 @@
 package upload_test
 
 import (
+	"bytes"
 	"context"
+	"crypto/md5"
 	"crypto/rand"
 	"crypto/sha256"
 	"encoding/hex"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
+	"mime/multipart"
 	"net/http"
+	"net/http/httptest"
+	"net/http/httputil"
+	"net/textproto"
+	"net/url"
 	"os"
 	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
+	"connectrpc.com/connect"
+	"github.com/bucket-sailor/bucketeer/internal/download"
+	"github.com/bucket-sailor/bucketeer/internal/gen/upload/v1alpha1"
+	"github.com/bucket-sailor/bucketeer/internal/gen/upload/v1alpha1/v1alpha1connect"
 	"github.com/bucket-sailor/bucketeer/internal/upload"
 	"github.com/bucket-sailor/bucketeer/internal/util"
+	"github.com/bucket-sailor/writablefs"
 	"github.com/bucket-sailor/writablefs/dirfs"
+	"github.com/google/uuid"
 	"github.com/labstack/echo/v4"
 	"github.com/neilotoole/slogt"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"github.com/zeebo/xxh3"
 	"golang.org/x/net/http2"
+	"google.golang.org/protobuf/types/known/wrapperspb"
 )
 
 func TestUpload(t *testing.T) {
 	logger := slogt.New(t)
 
-	testDir := t.TempDir()
+	baseURL, serverDir := startServer(t, nil)
 
-	serverDir := filepath.Join(testDir, "server")
-	cacheDir := filepath.Join(testDir, "cache")
+	f, err := os.Create(filepath.Join(t.TempDir(), "test.bin"))
+	require.NoError(t, err)
 
-	fsys, err := dirfs.New(serverDir)
+	size := int64(100000000)
+	_, err = io.CopyN(f, rand.Reader, size)
 	require.NoError(t, err)
 
-	cacheFS, err := dirfs.New(cacheDir)
+	_, err = f.Seek(0, io.SeekStart)
 	require.NoError(t, err)
 
-	e := echo.New()
-	e.HideBanner = true
+	c, err := upload.NewClient(logger, baseURL, &upload.ClientOptions{
+		NumConnections: 1,
+		ChunkSizeBytes: size,
+	})
+	require.NoError(t, err)
 
-	uploadServerPath, uploadServer := upload.NewServer(logger, fsys, cacheFS)
-	e.Any(uploadServerPath+"*", echo.WrapHandler(uploadServer))
+	ctx := context.Background()
+	err = c.Upload(ctx, filepath.Join(t.Name(), "test.bin"), f, size)
+	require.NoError(t, err)
 
-	chunkServerPath, chunkServer := upload.NewChunkServer(logger, fsys, cacheFS)
-	e.Any(chunkServerPath, echo.WrapHandler(chunkServer))
+	assert.FileExists(t, filepath.Join(serverDir, t.Name(), "test.bin"))
 
-	go func() {
-		if err := e.StartH2CServer(":0", &http2.Server{}); err != nil && !errors.Is(err, http.ErrServerClosed) {
-			logger.Error("failed to start server", "error", err)
+	expectedSum, err := fileChecksum(f.Name())
+	require.NoError(t, err)
+
+	actualSum, err := fileChecksum(filepath.Join(serverDir, t.Name(), "test.bin"))
+	require.NoError(t, err)
+
+	assert.Equal(t, expectedSum, actualSum)
+}
+
+func TestUploadCompressed(t *testing.T) {
+	logger := slogt.New(t)
+
+	baseURL, serverDir := startServer(t, nil)
+
+	// Compressible, so that the decompressed chunks are larger than the parts.
+	data := bytes.Repeat([]byte("Hello, World! "), 100000)
+	size := int64(len(data))
+
+	c, err := upload.NewClient(logger, baseURL, &upload.ClientOptions{
+		NumConnections: 4,
+		ChunkSizeBytes: 100000,
+		Compression:    upload.CompressionGzip,
+	})
+	require.NoError(t, err)
+
+	err = c.Upload(context.Background(), "test.bin", bytes.NewReader(data), size)
+	require.NoError(t, err)
+
+	written, err := os.ReadFile(filepath.Join(serverDir, "test.bin"))
+	require.NoError(t, err)
+
+	assert.Equal(t, data, written)
+
+	t.Run("Unsupported Compression", func(t *testing.T) {
+		_, err := upload.NewClient(logger, baseURL, &upload.ClientOptions{
+			Compression: "zstd",
+		})
+		require.Error(t, err)
+	})
+
+	t.Run("Invalid Encoding", func(t *testing.T) {
+		apiClient := v1alpha1connect.NewUploadClient(http.DefaultClient, baseURL+"/api/")
+
+		newResp, err := apiClient.New(context.Background(), connect.NewRequest(&v1alpha1.NewRequest{
+			Path:     "invalid.bin",
+			Size:     size,
+			Checksum: "xxh64:0000000000000000",
+		}))
+		require.NoError(t, err)
+
+		uploadChunk := func(contentEncoding string) int {
+			var body bytes.Buffer
+			multipartWriter := multipart.NewWriter(&body)
+
+			h := textproto.MIMEHeader{}
+			h.Set("Content-Disposition", fmt.Sprintf(`form-data; name="file"; filename="%s"`, newResp.Msg.Id))
+			h.Set("Content-Range", fmt.Sprintf("bytes 0-99/%d", size))
+			h.Set("Content-Encoding", contentEncoding)
+
+			fileWriter, err := multipartWriter.CreatePart(h)
+			require.NoError(t, err)
+
+			// Not actually encoded.
+			_, err = fileWriter.Write(data[:100])
+			require.NoError(t, err)
+
+			require.NoError(t, multipartWriter.Close())
+
+			req, err := http.NewRequest(http.MethodPatch, baseURL+"/files/upload", &body)
+			require.NoError(t, err)
+			req.Header.Set("Content-Type", multipartWriter.FormDataContentType())
+
+			resp, err := http.DefaultClient.Do(req)
+			require.NoError(t, err)
+			resp.Body.Close()
+
+			return resp.StatusCode
 		}
-	}()
-	t.Cleanup(func() {
-		require.NoError(t, e.Close())
+
+		assert.Equal(t, http.StatusBadRequest, uploadChunk("gzip"))
+		assert.Equal(t, http.StatusBadRequest, uploadChunk("br"))
+	})
+}
+
+func TestUploadIdempotencyKey(t *testing.T) {
+	baseURL, _ := startServer(t, nil)
+
+	ctx := context.Background()
+	apiClient := v1alpha1connect.NewUploadClient(http.DefaultClient, baseURL+"/api/")
+
+	newUpload := func(key string, size int64) (string, error) {
+		resp, err := apiClient.New(ctx, connect.NewRequest(&v1alpha1.NewRequest{
+			Path:              "test.bin",
+			Size:              size,
+			ChecksumAlgorithm: upload.AlgorithmXXH64,
+			IdempotencyKey:    key,
+		}))
+		if err != nil {
+			return "", err
+		}
+
+		return resp.Msg.Id, nil
+	}
+
+	id, err := newUpload("key", 1000)
+	require.NoError(t, err)
+
+	t.Run("Retried", func(t *testing.T) {
+		retriedID, err := newUpload("key", 1000)
+		require.NoError(t, err)
+
+		assert.Equal(t, id, retriedID)
 	})
 
-	err = util.WaitForServerReady(e, 10*time.Second)
+	t.Run("Different Upload", func(t *testing.T) {
+		_, err := newUpload("key", 2000)
+		require.Error(t, err)
+
+		assert.Equal(t, connect.CodeAlreadyExists, connect.CodeOf(err))
+	})
+
+	t.Run("Different Key", func(t *testing.T) {
+		otherID, err := newUpload("other-key", 1000)
+		require.NoError(t, err)
+
+		assert.NotEqual(t, id, otherID)
+	})
+
+	t.Run("Aborted", func(t *testing.T) {
+		_, err := apiClient.Abort(ctx, connect.NewRequest(wrapperspb.String(id)))
+		require.NoError(t, err)
+
+		// The key can be used again once the upload is gone.
+		_, err = newUpload("key", 2000)
+		require.NoError(t, err)
+	})
+}
+
+func TestUploadIdempotencyKeyCompleted(t *testing.T) {
+	ctx := context.Background()
+
+	data := []byte("Hello, World!")
+	sum := sha256.Sum256(data)
+	checksum := "sha256:" + hex.EncodeToString(sum[:])
+
+	newUpload := func(apiClient v1alpha1connect.UploadClient, key string) (string, error) {
+		resp, err := apiClient.New(ctx, connect.NewRequest(&v1alpha1.NewRequest{
+			Path:           filepath.Join(t.Name(), "test.bin"),
+			Size:           int64(len(data)),
+			Checksum:       checksum,
+			IdempotencyKey: key,
+		}))
+		if err != nil {
+			return "", err
+		}
+
+		return resp.Msg.Id, nil
+	}
+
+	completeUpload := func(t *testing.T, baseURL string, apiClient v1alpha1connect.UploadClient, key string) string {
+		uploadID, err := newUpload(apiClient, key)
+		require.NoError(t, err)
+
+		require.Equal(t, http.StatusNoContent, uploadChunk(t, baseURL, uploadID, data, 0, int64(len(data))))
+
+		_, err = apiClient.Complete(ctx, connect.NewRequest(&v1alpha1.CompleteRequest{Id: uploadID}))
+		require.NoError(t, err)
+
+		require.Eventually(t, func() bool {
+			resp, err := apiClient.PollForCompletion(ctx, connect.NewRequest(wrapperspb.String(uploadID)))
+			return err == nil && resp.Msg.Status == v1alpha1.CompletionStatus_COMPLETED
+		}, 5*time.Second, 10*time.Millisecond)
+
+		return uploadID
+	}
+
+	t.Run("Retried After Completion", func(t *testing.T) {
+		baseURL, _ := startServer(t, nil)
+
+		apiClient := v1alpha1connect.NewUploadClient(http.DefaultClient, baseURL+"/api/")
+
+		completeUpload(t, baseURL, apiClient, "key")
+
+		_, err := newUpload(apiClient, "key")
+		require.Error(t, err)
+
+		assert.Equal(t, connect.CodeFailedPrecondition, connect.CodeOf(err))
+	})
+
+	t.Run("Retried After Reaping", func(t *testing.T) {
+		baseURL, _ := startServer(t, &upload.ServerOptions{
+			StaleUploadTTL: 100 * time.Millisecond,
+			ReapInterval:   50 * time.Millisecond,
+		})
+
+		apiClient := v1alpha1connect.NewUploadClient(http.DefaultClient, baseURL+"/api/")
+
+		uploadID := completeUpload(t, baseURL, apiClient, "key")
+
+		require.Eventually(t, func() bool {
+			_, err := apiClient.PollForCompletion(ctx, connect.NewRequest(wrapperspb.String(uploadID)))
+			return connect.CodeOf(err) == connect.CodeNotFound
+		}, 5*time.Second, 50*time.Millisecond)
+
+		_, err := newUpload(apiClient, "key")
+		require.Error(t, err)
+
+		assert.Equal(t, connect.CodeFailedPrecondition, connect.CodeOf(err))
+	})
+}
+
+func TestUploadCancelChecksum(t *testing.T) {
+	logger := slogt.New(t)
+
+	baseURL, _ := startServer(t, nil)
+
+	for _, deferChecksum := range []bool{false, true} {
+		t.Run(fmt.Sprintf("Deferred=%t", deferChecksum), func(t *testing.T) {
+			c, err := upload.NewClient(logger, baseURL, &upload.ClientOptions{
+				DeferChecksum: deferChecksum,
+			})
+			require.NoError(t, err)
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			// Slow enough that hashing the whole file would take a while.
+			r := &slowReaderAt{delay: time.Millisecond, onRead: cancel}
+
+			err = c.Upload(ctx, filepath.Join(t.Name(), "test.bin"), r, 64<<20)
+			require.Error(t, err)
+
+			// Give the checksum a chance to notice the cancellation.
+			time.Sleep(300 * time.Millisecond)
+			read := r.read.Load()
+
+			time.Sleep(300 * time.Millisecond)
+			assert.Equal(t, read, r.read.Load(), "still reading after the upload was cancelled")
+		})
+	}
+}
+
+// slowReaderAt reads zeros slowly, calling onRead on every read.
+type slowReaderAt struct {
+	delay  time.Duration
+	onRead func()
+	read   atomic.Int64
+}
+
+func (r *slowReaderAt) ReadAt(p []byte, _ int64) (int, error) {
+	r.onRead()
+	time.Sleep(r.delay)
+
+	clear(p)
+	r.read.Add(int64(len(p)))
+
+	return len(p), nil
+}
+
+func TestUploadOnProgress(t *testing.T) {
+	logger := slogt.New(t)
+
+	baseURL, _ := startServer(t, nil)
+
+	data := make([]byte, 1000000)
+	_, err := rand.Read(data)
+	require.NoError(t, err)
+
+	size := int64(len(data))
+
+	var mu sync.Mutex
+	var calls int
+	var maxUploaded int64
+
+	c, err := upload.NewClient(logger, baseURL, &upload.ClientOptions{
+		NumConnections: 4,
+		ChunkSizeBytes: 100000,
+		OnProgress: func(uploaded, total int64) {
+			mu.Lock()
+			defer mu.Unlock()
+
+			calls++
+			maxUploaded = max(maxUploaded, uploaded)
+
+			assert.Equal(t, size, total)
+		},
+	})
+	require.NoError(t, err)
+
+	err = c.Upload(context.Background(), "test.bin", bytes.NewReader(data), size)
+	require.NoError(t, err)
+
+	assert.Equal(t, 10, calls)
+	assert.Equal(t, size, maxUploaded)
+}
+
+func TestUploadResume(t *testing.T) {
+	logger := slogt.New(t)
+
+	baseURL, serverDir := startServer(t, nil)
+
+	target, err := url.Parse(baseURL)
+	require.NoError(t, err)
+
+	// Fail chunks after the first few, as if the client had died.
+	var failChunks atomic.Bool
+	var chunkRequests atomic.Int32
+	proxy := httputil.NewSingleHostReverseProxy(target)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPatch && chunkRequests.Add(1) > 3 && failChunks.Load() {
+			http.Error(w, "Bad request", http.StatusBadRequest)
+			return
+		}
+
+		proxy.ServeHTTP(w, r)
+	}))
+	t.Cleanup(srv.Close)
+
+	data := make([]byte, 1000000)
+	_, err = rand.Read(data)
+	require.NoError(t, err)
+
+	size := int64(len(data))
+	uploadIDFile := filepath.Join(t.TempDir(), "upload-id")
+
+	c, err := upload.NewClient(logger, srv.URL, &upload.ClientOptions{
+		ChunkSizeBytes: 100000,
+		UploadIDFile:   uploadIDFile,
+	})
 	require.NoError(t, err)
 
+	ctx := context.Background()
+
+	failChunks.Store(true)
+	err = c.Upload(ctx, "test.bin", bytes.NewReader(data), size)
+	require.Error(t, err)
+
+	uploadID, err := upload.LoadUploadID(uploadIDFile)
+	require.NoError(t, err)
+	require.NotEmpty(t, uploadID)
+
+	failChunks.Store(false)
+	chunkRequests.Store(0)
+
+	err = c.ResumeUpload(ctx, uploadID, "test.bin", bytes.NewReader(data), size)
+	require.NoError(t, err)
+
+	// Only the missing chunks should have been uploaded.
+	assert.Equal(t, int32(7), chunkRequests.Load())
+
+	uploaded, err := os.ReadFile(filepath.Join(serverDir, "test.bin"))
+	require.NoError(t, err)
+	assert.Equal(t, data, uploaded)
+
+	assert.NoFileExists(t, uploadIDFile)
+
+	t.Run("Unknown Upload", func(t *testing.T) {
+		err := c.ResumeUpload(ctx, uuid.New().String(), "fallback.bin", bytes.NewReader(data), size)
+		require.NoError(t, err)
+
+		uploaded, err := os.ReadFile(filepath.Join(serverDir, "fallback.bin"))
+		require.NoError(t, err)
+		assert.Equal(t, data, uploaded)
+	})
+
+	t.Run("Already Complete", func(t *testing.T) {
+		err := c.ResumeUpload(ctx, uploadID, "test.bin", bytes.NewReader(data), size)
+		require.NoError(t, err)
+	})
+}
+
+func TestUploadChecksumAlgorithms(t *testing.T) {
+	logger := slogt.New(t)
+
+	baseURL, serverDir := startServer(t, nil)
+
 	f, err := os.Create(filepath.Join(t.TempDir(), "test.bin"))
 	require.NoError(t, err)
 
-	size := int64(100000000)
+	size := int64(1000000)
 	_, err = io.CopyN(f, rand.Reader, size)
 	require.NoError(t, err)
 
-	_, err = f.Seek(0, io.SeekStart)
-	require.NoError(t, err)
+	algorithms := []string{
+		upload.AlgorithmXXH64,
+		upload.AlgorithmXXH3,
+		upload.AlgorithmSHA256,
+		upload.AlgorithmMD5,
+		upload.AlgorithmCRC32C,
+	}
 
-	baseURL := fmt.Sprintf("http://%s", e.Listener.Addr().String())
+	for _, algorithm := range algorithms {
+		t.Run(algorithm, func(t *testing.T) {
+			c, err := upload.NewClient(logger, baseURL, &upload.ClientOptions{
+				ChecksumAlgorithm: algorithm,
+			})
+			require.NoError(t, err)
 
-	c, err := upload.NewClient(logger, baseURL, &upload.ClientOptions{
-		NumConnections: 1,
-		ChunkSizeBytes: size,
+			err = c.Upload(context.Background(), filepath.Join(t.Name(), "test.bin"), f, size)
+			require.NoError(t, err)
+
+			assert.FileExists(t, filepath.Join(serverDir, t.Name(), "test.bin"))
+		})
+	}
+
+	t.Run("Unsupported", func(t *testing.T) {
+		c, err := upload.NewClient(logger, baseURL, &upload.ClientOptions{
+			ChecksumAlgorithm: "sha1",
+		})
+		require.NoError(t, err)
+
+		err = c.Upload(context.Background(), filepath.Join(t.Name(), "test.bin"), f, size)
+		require.Error(t, err)
 	})
+}
+
+func TestUploadInvalidChecksum(t *testing.T) {
+	baseURL, _ := startServer(t, nil)
+
+	ctx := context.Background()
+	apiClient := v1alpha1connect.NewUploadClient(http.DefaultClient, baseURL+"/api/")
+
+	tests := []struct {
+		name     string
+		checksum string
+	}{
+		{"Missing Algorithm", "0000000000000000"},
+		{"Unsupported Algorithm", "sha1:0000000000000000000000000000000000000000"},
+		{"Not Hex", "xxh64:zzzzzzzzzzzzzzzz"},
+		{"Wrong Length", "sha256:00"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := apiClient.New(ctx, connect.NewRequest(&v1alpha1.NewRequest{
+				Path:     filepath.Join(t.Name(), "test.bin"),
+				Size:     1000,
+				Checksum: tt.checksum,
+			}))
+			require.Error(t, err)
+			assert.Equal(t, connect.CodeInvalidArgument, connect.CodeOf(err))
+		})
+	}
+}
+
+func TestUploadProgress(t *testing.T) {
+	baseURL, _ := startServer(t, nil)
+
+	ctx := context.Background()
+	apiClient := v1alpha1connect.NewUploadClient(http.DefaultClient, baseURL+"/api/")
+
+	size := int64(1000)
+	newResp, err := apiClient.New(ctx, connect.NewRequest(&v1alpha1.NewRequest{
+		Path:     filepath.Join(t.Name(), "test.bin"),
+		Size:     size,
+		Checksum: "xxh64:0000000000000000",
+	}))
+	require.NoError(t, err)
+
+	uploadID := newResp.Msg.Id
+
+	progressResp, err := apiClient.Progress(ctx, connect.NewRequest(&wrapperspb.StringValue{Value: uploadID}))
 	require.NoError(t, err)
 
+	assert.Equal(t, size, progressResp.Msg.TotalSize)
+	assert.Zero(t, progressResp.Msg.ReceivedBytes)
+
+	data := make([]byte, size)
+	_, err = rand.Read(data)
+	require.NoError(t, err)
+
+	// Upload two overlapping chunks, the overlap should only be counted once.
+	require.Equal(t, http.StatusNoContent, uploadChunk(t, baseURL, uploadID, data[0:500], 0, size))
+	require.Equal(t, http.StatusNoContent, uploadChunk(t, baseURL, uploadID, data[250:750], 250, size))
+
+	progressResp, err = apiClient.Progress(ctx, connect.NewRequest(&wrapperspb.StringValue{Value: uploadID}))
+	require.NoError(t, err)
+
+	assert.Equal(t, size, progressResp.Msg.TotalSize)
+	assert.Equal(t, int64(750), progressResp.Msg.ReceivedBytes)
+	assert.Zero(t, progressResp.Msg.CopiedBytes)
+}
+
+func TestUploadReceivedRanges(t *testing.T) {
+	baseURL, _ := startServer(t, nil)
+
 	ctx := context.Background()
-	err = c.Upload(ctx, filepath.Join(t.Name(), "test.bin"), f, size)
+	apiClient := v1alpha1connect.NewUploadClient(http.DefaultClient, baseURL+"/api/")
+
+	size := int64(1000)
+	newResp, err := apiClient.New(ctx, connect.NewRequest(&v1alpha1.NewRequest{
+		Path:     filepath.Join(t.Name(), "test.bin"),
+		Size:     size,
+		Checksum: "xxh64:0000000000000000",
+	}))
 	require.NoError(t, err)
 
-	assert.FileExists(t, filepath.Join(serverDir, t.Name(), "test.bin"))
+	uploadID := newResp.Msg.Id
 
-	expectedSum, err := fileChecksum(f.Name())
+	data := make([]byte, size)
+	_, err = rand.Read(data)
 	require.NoError(t, err)
 
-	actualSum, err := fileChecksum(filepath.Join(serverDir, t.Name(), "test.bin"))
+	require.Equal(t, http.StatusNoContent, uploadChunk(t, baseURL, uploadID, data[0:100], 0, size))
+	require.Equal(t, http.StatusNoContent, uploadChunk(t, baseURL, uploadID, data[200:300], 200, size))
+	require.Equal(t, http.StatusNoContent, uploadChunk(t, baseURL, uploadID, data[100:150], 100, size))
+
+	rangesResp, err := apiClient.GetReceivedRanges(ctx, connect.NewRequest(&wrapperspb.StringValue{Value: uploadID}))
 	require.NoError(t, err)
 
-	assert.Equal(t, expectedSum, actualSum)
+	require.Len(t, rangesResp.Msg.Ranges, 2)
+	assert.Equal(t, int64(0), rangesResp.Msg.Ranges[0].Start)
+	assert.Equal(t, int64(149), rangesResp.Msg.Ranges[0].End)
+	assert.Equal(t, int64(200), rangesResp.Msg.Ranges[1].Start)
+	assert.Equal(t, int64(299), rangesResp.Msg.Ranges[1].End)
+
+	_, err = apiClient.GetReceivedRanges(ctx, connect.NewRequest(&wrapperspb.StringValue{Value: "00000000-0000-0000-0000-000000000000"}))
+	require.Error(t, err)
+	assert.Equal(t, connect.CodeNotFound, connect.CodeOf(err))
+}
+
+func TestUploadIncomplete(t *testing.T) {
+	baseURL, _ := startServer(t, nil)
+
+	ctx := context.Background()
+	apiClient := v1alpha1connect.NewUploadClient(http.DefaultClient, baseURL+"/api/")
+
+	size := int64(1000)
+	newResp, err := apiClient.New(ctx, connect.NewRequest(&v1alpha1.NewRequest{
+		Path:     filepath.Join(t.Name(), "test.bin"),
+		Size:     size,
+		Checksum: "xxh64:0000000000000000",
+	}))
+	require.NoError(t, err)
+
+	uploadID := newResp.Msg.Id
+
+	data := make([]byte, size)
+	_, err = rand.Read(data)
+	require.NoError(t, err)
+
+	// Leave a gap in the middle.
+	require.Equal(t, http.StatusNoContent, uploadChunk(t, baseURL, uploadID, data[0:250], 0, size))
+	require.Equal(t, http.StatusNoContent, uploadChunk(t, baseURL, uploadID, data[500:], 500, size))
+
+	_, err = apiClient.Complete(ctx, connect.NewRequest(&v1alpha1.CompleteRequest{Id: uploadID}))
+	require.Error(t, err)
+	assert.Equal(t, connect.CodeFailedPrecondition, connect.CodeOf(err))
+	assert.Contains(t, err.Error(), "incomplete upload")
+}
+
+func TestUploadDeferredChecksum(t *testing.T) {
+	baseURL, serverDir := startServer(t, nil)
+
+	ctx := context.Background()
+	apiClient := v1alpha1connect.NewUploadClient(http.DefaultClient, baseURL+"/api/")
+
+	t.Run("Invalid Algorithm", func(t *testing.T) {
+		_, err := apiClient.New(ctx, connect.NewRequest(&v1alpha1.NewRequest{
+			Path:              filepath.Join(t.Name(), "test.bin"),
+			Size:              1000,
+			ChecksumAlgorithm: "crc64",
+		}))
+		require.Error(t, err)
+		assert.Equal(t, connect.CodeInvalidArgument, connect.CodeOf(err))
+	})
+
+	data := make([]byte, 1000)
+	_, err := rand.Read(data)
+	require.NoError(t, err)
+
+	sum := sha256.Sum256(data)
+	expectedChecksum := "sha256:" + hex.EncodeToString(sum[:])
+
+	newResp, err := apiClient.New(ctx, connect.NewRequest(&v1alpha1.NewRequest{
+		Path:              filepath.Join(t.Name(), "test.bin"),
+		Size:              int64(len(data)),
+		ChecksumAlgorithm: "sha256",
+	}))
+	require.NoError(t, err)
+
+	uploadID := newResp.Msg.Id
+
+	require.Equal(t, http.StatusNoContent, uploadChunk(t, baseURL, uploadID, data, 0, int64(len(data))))
+
+	t.Run("Missing Checksum", func(t *testing.T) {
+		_, err := apiClient.Complete(ctx, connect.NewRequest(&v1alpha1.CompleteRequest{Id: uploadID}))
+		require.Error(t, err)
+		assert.Equal(t, connect.CodeInvalidArgument, connect.CodeOf(err))
+	})
+
+	t.Run("Wrong Algorithm", func(t *testing.T) {
+		_, err := apiClient.Complete(ctx, connect.NewRequest(&v1alpha1.CompleteRequest{
+			Id:       uploadID,
+			Checksum: "xxh64:0000000000000000",
+		}))
+		require.Error(t, err)
+		assert.Equal(t, connect.CodeInvalidArgument, connect.CodeOf(err))
+	})
+
+	_, err = apiClient.Complete(ctx, connect.NewRequest(&v1alpha1.CompleteRequest{
+		Id:       uploadID,
+		Checksum: expectedChecksum,
+	}))
+	require.NoError(t, err)
+
+	var completeResp *connect.Response[v1alpha1.CompleteResponse]
+	require.Eventually(t, func() bool {
+		completeResp, err = apiClient.PollForCompletion(ctx, connect.NewRequest(&wrapperspb.StringValue{Value: uploadID}))
+		return err == nil && completeResp.Msg.Status != v1alpha1.CompletionStatus_PENDING
+	}, 5*time.Second, 10*time.Millisecond)
+
+	require.Equal(t, v1alpha1.CompletionStatus_COMPLETED, completeResp.Msg.Status)
+
+	uploaded, err := os.ReadFile(filepath.Join(serverDir, t.Name(), "test.bin"))
+	require.NoError(t, err)
+
+	assert.Equal(t, data, uploaded)
+
+	t.Run("Client", func(t *testing.T) {
+		c, err := upload.NewClient(slogt.New(t), baseURL, &upload.ClientOptions{
+			DeferChecksum: true,
+		})
+		require.NoError(t, err)
+
+		err = c.Upload(ctx, filepath.Join(t.Name(), "test.bin"), bytes.NewReader(data), int64(len(data)))
+		require.NoError(t, err)
+
+		uploaded, err := os.ReadFile(filepath.Join(serverDir, t.Name(), "test.bin"))
+		require.NoError(t, err)
+
+		assert.Equal(t, data, uploaded)
+	})
+}
+
+func TestUploadMaxSize(t *testing.T) {
+	baseURL, _ := startServer(t, &upload.ServerOptions{
+		MaxUploadSize: 1000,
+	})
+
+	ctx := context.Background()
+	apiClient := v1alpha1connect.NewUploadClient(http.DefaultClient, baseURL+"/api/")
+
+	_, err := apiClient.New(ctx, connect.NewRequest(&v1alpha1.NewRequest{
+		Path:     filepath.Join(t.Name(), "test.bin"),
+		Size:     1001,
+		Checksum: "xxh64:0000000000000000",
+	}))
+	require.Error(t, err)
+	assert.Equal(t, connect.CodeInvalidArgument, connect.CodeOf(err))
+
+	size := int64(1000)
+	newResp, err := apiClient.New(ctx, connect.NewRequest(&v1alpha1.NewRequest{
+		Path:     filepath.Join(t.Name(), "test.bin"),
+		Size:     size,
+		Checksum: "xxh64:0000000000000000",
+	}))
+	require.NoError(t, err)
+
+	uploadID := newResp.Msg.Id
+
+	// Writes past the declared size should be rejected.
+	status := uploadChunk(t, baseURL, uploadID, make([]byte, 100), 950, size)
+	assert.Equal(t, http.StatusBadRequest, status)
+}
+
+func TestUploadChunkSize(t *testing.T) {
+	logger := slogt.New(t)
+
+	baseURL, serverDir := startServer(t, &upload.ServerOptions{
+		ChunkSize: 1000,
+	})
+
+	ctx := context.Background()
+	apiClient := v1alpha1connect.NewUploadClient(http.DefaultClient, baseURL+"/api/")
+
+	newResp, err := apiClient.New(ctx, connect.NewRequest(&v1alpha1.NewRequest{
+		Path:     filepath.Join(t.Name(), "test.bin"),
+		Size:     1000,
+		Checksum: "xxh64:0000000000000000",
+	}))
+	require.NoError(t, err)
+
+	assert.Equal(t, int64(1000), newResp.Msg.ChunkSize)
+
+	data := make([]byte, 10500)
+	_, err = rand.Read(data)
+	require.NoError(t, err)
+
+	// The client should use the server's recommended chunk size.
+	c, err := upload.NewClient(logger, baseURL, &upload.ClientOptions{
+		NumConnections: 4,
+	})
+	require.NoError(t, err)
+
+	err = c.Upload(ctx, filepath.Join(t.Name(), "uploaded.bin"), bytes.NewReader(data), int64(len(data)))
+	require.NoError(t, err)
+
+	uploaded, err := os.ReadFile(filepath.Join(serverDir, t.Name(), "uploaded.bin"))
+	require.NoError(t, err)
+
+	assert.Equal(t, data, uploaded)
+}
+
+func TestUploadWorkers(t *testing.T) {
+	logger := slogt.New(t)
+
+	baseURL, serverDir := startServer(t, &upload.ServerOptions{
+		Workers: 1,
+	})
+
+	c, err := upload.NewClient(logger, baseURL, nil)
+	require.NoError(t, err)
+
+	// More uploads than workers, completions should queue rather than fail.
+	var wg sync.WaitGroup
+	errs := make([]error, 4)
+	for i := range errs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			data := []byte(fmt.Sprintf("Hello, World %d!", i))
+			errs[i] = c.Upload(context.Background(), fmt.Sprintf("test-%d.bin", i), bytes.NewReader(data), int64(len(data)))
+		}(i)
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		require.NoError(t, err)
+	}
+
+	for i := 0; i < 4; i++ {
+		uploaded, err := os.ReadFile(filepath.Join(serverDir, fmt.Sprintf("test-%d.bin", i)))
+		require.NoError(t, err)
+
+		assert.Equal(t, fmt.Sprintf("Hello, World %d!", i), string(uploaded))
+	}
+}
+
+func TestUploadRetryAfter(t *testing.T) {
+	logger := slogt.New(t)
+
+	baseURL, serverDir := startServer(t, nil)
+
+	target, err := url.Parse(baseURL)
+	require.NoError(t, err)
+
+	// Rate limit the first chunk, asking the client to wait a second.
+	var chunkRequests atomic.Int32
+	proxy := httputil.NewSingleHostReverseProxy(target)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPatch && chunkRequests.Add(1) == 1 {
+			w.Header().Set("Retry-After", "1")
+			http.Error(w, "Too many requests", http.StatusTooManyRequests)
+			return
+		}
+
+		proxy.ServeHTTP(w, r)
+	}))
+	t.Cleanup(srv.Close)
+
+	c, err := upload.NewClient(logger, srv.URL, nil)
+	require.NoError(t, err)
+
+	data := []byte("Hello, World!")
+
+	start := time.Now()
+	err = c.Upload(context.Background(), "test.bin", bytes.NewReader(data), int64(len(data)))
+	require.NoError(t, err)
+
+	assert.Equal(t, int32(2), chunkRequests.Load())
+	assert.GreaterOrEqual(t, time.Since(start), time.Second)
+
+	uploaded, err := os.ReadFile(filepath.Join(serverDir, "test.bin"))
+	require.NoError(t, err)
+
+	assert.Equal(t, data, uploaded)
+}
+
+func TestUploadTail(t *testing.T) {
+	baseURL, _ := startServer(t, nil)
+
+	ctx := context.Background()
+	apiClient := v1alpha1connect.NewUploadClient(http.DefaultClient, baseURL+"/api/")
+
+	data := []byte("0123456789")
+	size := int64(len(data))
+
+	resp, err := apiClient.New(ctx, connect.NewRequest(&v1alpha1.NewRequest{
+		Path:     "tail.log",
+		Size:     size,
+		Checksum: "xxh64:0000000000000000",
+	}))
+	require.NoError(t, err)
+
+	uploadID := resp.Msg.Id
+
+	read := func(t *testing.T, rangeHeader string) (*http.Response, string) {
+		req, err := http.NewRequest(http.MethodGet, baseURL+"/files/upload?id="+uploadID, nil)
+		require.NoError(t, err)
+
+		if rangeHeader != "" {
+			req.Header.Set("Range", rangeHeader)
+		}
+
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		t.Cleanup(func() {
+			_ = resp.Body.Close()
+		})
+
+		body, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+
+		return resp, string(body)
+	}
+
+	require.Equal(t, http.StatusNoContent, uploadChunk(t, baseURL, uploadID, data[:5], 0, size))
+	require.Equal(t, http.StatusNoContent, uploadChunk(t, baseURL, uploadID, data[7:], 7, size))
+
+	t.Run("Received", func(t *testing.T) {
+		resp, body := read(t, "")
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, "5", resp.Header.Get("X-Upload-Received"))
+		assert.Equal(t, "01234", body)
+	})
+
+	t.Run("Open Ended Range", func(t *testing.T) {
+		resp, body := read(t, "bytes=2-")
+		assert.Equal(t, http.StatusPartialContent, resp.StatusCode)
+		assert.Equal(t, "bytes 2-4/10", resp.Header.Get("Content-Range"))
+		assert.Equal(t, "234", body)
+	})
+
+	t.Run("Later Range", func(t *testing.T) {
+		resp, body := read(t, "bytes=7-9")
+		assert.Equal(t, http.StatusPartialContent, resp.StatusCode)
+		assert.Equal(t, "789", body)
+	})
+
+	t.Run("Not Received", func(t *testing.T) {
+		for _, rangeHeader := range []string{"bytes=5-", "bytes=3-7", "bytes=0-1,3-4"} {
+			resp, _ := read(t, rangeHeader)
+			assert.Equal(t, http.StatusRequestedRangeNotSatisfiable, resp.StatusCode, rangeHeader)
+			assert.Equal(t, "bytes */10", resp.Header.Get("Content-Range"))
+		}
+	})
+
+	t.Run("Not Found", func(t *testing.T) {
+		resp, err := http.Get(baseURL + "/files/upload?id=" + uuid.New().String())
+		require.NoError(t, err)
+		resp.Body.Close()
+
+		assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+	})
+}
+
+func TestUploadCacheStatus(t *testing.T) {
+	baseURL, _ := startServer(t, &upload.ServerOptions{
+		CacheDir: t.TempDir(),
+	})
+
+	ctx := context.Background()
+	apiClient := v1alpha1connect.NewUploadClient(http.DefaultClient, baseURL+"/api/")
+
+	getCacheStatus := func(t *testing.T) map[string]uint64 {
+		resp, err := http.Get(baseURL + "/api/v1alpha1/fs/cache-status")
+		require.NoError(t, err)
+		defer resp.Body.Close()
+
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+
+		var status map[string]uint64
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&status))
+
+		return status
+	}
+
+	status := getCacheStatus(t)
+	assert.NotZero(t, status["totalBytes"])
+	assert.LessOrEqual(t, status["freeBytes"], status["totalBytes"])
+	assert.Zero(t, status["inFlightUploads"])
+
+	_, err := apiClient.New(ctx, connect.NewRequest(&v1alpha1.NewRequest{
+		Path:     filepath.Join(t.Name(), "test.bin"),
+		Size:     1000,
+		Checksum: "xxh64:0000000000000000",
+	}))
+	require.NoError(t, err)
+
+	assert.Equal(t, uint64(1), getCacheStatus(t)["inFlightUploads"])
+
+	t.Run("Not Enough Free Space", func(t *testing.T) {
+		_, err := apiClient.New(ctx, connect.NewRequest(&v1alpha1.NewRequest{
+			Path:     filepath.Join(t.Name(), "test.bin"),
+			Size:     1 << 62,
+			Checksum: "xxh64:0000000000000000",
+		}))
+		require.Error(t, err)
+		assert.Equal(t, connect.CodeResourceExhausted, connect.CodeOf(err))
+	})
+}
+
+func TestReapStaleUploads(t *testing.T) {
+	baseURL, _ := startServer(t, &upload.ServerOptions{
+		StaleUploadTTL: 100 * time.Millisecond,
+		ReapInterval:   50 * time.Millisecond,
+	})
+
+	ctx := context.Background()
+	apiClient := v1alpha1connect.NewUploadClient(http.DefaultClient, baseURL+"/api/")
+
+	newResp, err := apiClient.New(ctx, connect.NewRequest(&v1alpha1.NewRequest{
+		Path:     filepath.Join(t.Name(), "test.bin"),
+		Size:     1000,
+		Checksum: "xxh64:0000000000000000",
+	}))
+	require.NoError(t, err)
+
+	uploadID := newResp.Msg.Id
+
+	require.Eventually(t, func() bool {
+		_, err := apiClient.Progress(ctx, connect.NewRequest(&wrapperspb.StringValue{Value: uploadID}))
+		return connect.CodeOf(err) == connect.CodeNotFound
+	}, 5*time.Second, 50*time.Millisecond)
+}
+
+func TestUploadOverlappingChunks(t *testing.T) {
+	baseURL, _ := startServer(t, nil)
+
+	ctx := context.Background()
+	apiClient := v1alpha1connect.NewUploadClient(http.DefaultClient, baseURL+"/api/")
+
+	size := int64(1000)
+	newResp, err := apiClient.New(ctx, connect.NewRequest(&v1alpha1.NewRequest{
+		Path:     filepath.Join(t.Name(), "test.bin"),
+		Size:     size,
+		Checksum: "xxh64:0000000000000000",
+	}))
+	require.NoError(t, err)
+
+	uploadID := newResp.Msg.Id
+
+	data := make([]byte, size)
+	_, err = rand.Read(data)
+	require.NoError(t, err)
+
+	require.Equal(t, http.StatusNoContent, uploadChunk(t, baseURL, uploadID, data[0:500], 0, size))
+
+	t.Run("Identical", func(t *testing.T) {
+		status := uploadChunk(t, baseURL, uploadID, data[0:500], 0, size)
+		assert.Equal(t, http.StatusNoContent, status)
+	})
+
+	t.Run("Conflicting", func(t *testing.T) {
+		conflicting := append([]byte{}, data[250:750]...)
+		conflicting[0] ^= 0xff
+
+		status := uploadChunk(t, baseURL, uploadID, conflicting, 250, size)
+		assert.Equal(t, http.StatusBadRequest, status)
+	})
+}
+
+func TestUploadContentRangeTotal(t *testing.T) {
+	baseURL, _ := startServer(t, nil)
+
+	ctx := context.Background()
+	apiClient := v1alpha1connect.NewUploadClient(http.DefaultClient, baseURL+"/api/")
+
+	size := int64(1000)
+	newResp, err := apiClient.New(ctx, connect.NewRequest(&v1alpha1.NewRequest{
+		Path:     filepath.Join(t.Name(), "test.bin"),
+		Size:     size,
+		Checksum: "xxh64:0000000000000000",
+	}))
+	require.NoError(t, err)
+
+	uploadID := newResp.Msg.Id
+
+	data := make([]byte, size)
+	_, err = rand.Read(data)
+	require.NoError(t, err)
+
+	t.Run("Mismatched", func(t *testing.T) {
+		status := uploadChunk(t, baseURL, uploadID, data[0:500], 0, size*2)
+		assert.Equal(t, http.StatusBadRequest, status)
+
+		rangesResp, err := apiClient.GetReceivedRanges(ctx, connect.NewRequest(&wrapperspb.StringValue{Value: uploadID}))
+		require.NoError(t, err)
+
+		assert.Empty(t, rangesResp.Msg.Ranges)
+	})
+
+	t.Run("Matching", func(t *testing.T) {
+		status := uploadChunk(t, baseURL, uploadID, data[0:500], 0, size)
+		assert.Equal(t, http.StatusNoContent, status)
+	})
+}
+
+func TestUploadShortChunk(t *testing.T) {
+	baseURL, _ := startServer(t, nil)
+
+	ctx := context.Background()
+	apiClient := v1alpha1connect.NewUploadClient(http.DefaultClient, baseURL+"/api/")
+
+	size := int64(1000)
+	newResp, err := apiClient.New(ctx, connect.NewRequest(&v1alpha1.NewRequest{
+		Path:     filepath.Join(t.Name(), "test.bin"),
+		Size:     size,
+		Checksum: "xxh64:0000000000000000",
+	}))
+	require.NoError(t, err)
+
+	uploadID := newResp.Msg.Id
+
+	data := make([]byte, size)
+	_, err = rand.Read(data)
+	require.NoError(t, err)
+
+	var body bytes.Buffer
+	multipartWriter := multipart.NewWriter(&body)
+
+	// Declares 500 bytes, but only contains 250.
+	h := textproto.MIMEHeader{}
+	h.Set("Content-Disposition", fmt.Sprintf(`form-data; name="file"; filename="%s"`, uploadID))
+	h.Set("Content-Type", "application/octet-stream")
+	h.Set("Content-Range", fmt.Sprintf("bytes 0-499/%d", size))
+
+	fileWriter, err := multipartWriter.CreatePart(h)
+	require.NoError(t, err)
+
+	_, err = fileWriter.Write(data[:250])
+	require.NoError(t, err)
+
+	require.NoError(t, multipartWriter.Close())
+
+	req, err := http.NewRequest(http.MethodPatch, baseURL+"/files/upload", &body)
+	require.NoError(t, err)
+	req.Header.Set("Content-Type", multipartWriter.FormDataContentType())
+
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	rangesResp, err := apiClient.GetReceivedRanges(ctx, connect.NewRequest(&wrapperspb.StringValue{Value: uploadID}))
+	require.NoError(t, err)
+
+	assert.Empty(t, rangesResp.Msg.Ranges)
+
+	t.Run("Resent", func(t *testing.T) {
+		status := uploadChunk(t, baseURL, uploadID, data[0:500], 0, size)
+		assert.Equal(t, http.StatusNoContent, status)
+	})
+}
+
+func TestUploadMissingContentRange(t *testing.T) {
+	baseURL, _ := startServer(t, nil)
+
+	ctx := context.Background()
+	apiClient := v1alpha1connect.NewUploadClient(http.DefaultClient, baseURL+"/api/")
+
+	size := int64(1000)
+	newResp, err := apiClient.New(ctx, connect.NewRequest(&v1alpha1.NewRequest{
+		Path:     filepath.Join(t.Name(), "test.bin"),
+		Size:     size,
+		Checksum: "xxh64:0000000000000000",
+	}))
+	require.NoError(t, err)
+
+	uploadID := newResp.Msg.Id
+
+	data := make([]byte, 500)
+	_, err = rand.Read(data)
+	require.NoError(t, err)
+
+	// The part has no Content-Range header, so it falls back to the request's.
+	uploadWithRequestHeader := func(contentRange string) int {
+		var body bytes.Buffer
+		multipartWriter := multipart.NewWriter(&body)
+
+		fileWriter, err := multipartWriter.CreateFormFile("file", uploadID)
+		require.NoError(t, err)
+
+		_, err = fileWriter.Write(data)
+		require.NoError(t, err)
+
+		require.NoError(t, multipartWriter.Close())
+
+		req, err := http.NewRequest(http.MethodPatch, baseURL+"/files/upload", &body)
+		require.NoError(t, err)
+		req.Header.Set("Content-Type", multipartWriter.FormDataContentType())
+		if contentRange != "" {
+			req.Header.Set("Content-Range", contentRange)
+		}
+
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		resp.Body.Close()
+
+		return resp.StatusCode
+	}
+
+	t.Run("Missing", func(t *testing.T) {
+		assert.Equal(t, http.StatusBadRequest, uploadWithRequestHeader(""))
+	})
+
+	t.Run("Invalid", func(t *testing.T) {
+		assert.Equal(t, http.StatusBadRequest, uploadWithRequestHeader("bytes garbage"))
+	})
+
+	t.Run("Request Header", func(t *testing.T) {
+		assert.Equal(t, http.StatusNoContent, uploadWithRequestHeader(fmt.Sprintf("bytes 0-499/%d", size)))
+	})
+}
+
+func TestUploadStreamingChecksum(t *testing.T) {
+	baseURL, serverDir := startServer(t, nil)
+
+	ctx := context.Background()
+	apiClient := v1alpha1connect.NewUploadClient(http.DefaultClient, baseURL+"/api/")
+
+	size := int64(1000)
+	data := make([]byte, size)
+	_, err := rand.Read(data)
+	require.NoError(t, err)
+
+	sum := sha256.Sum256(data)
+	checksum := "sha256:" + hex.EncodeToString(sum[:])
+
+	xxh3Sum := xxh3.Hash128(data).Bytes()
+	xxh3Checksum := "xxh3:" + hex.EncodeToString(xxh3Sum[:])
+
+	tests := []struct {
+		name     string
+		checksum string
+		starts   []int64
+		status   v1alpha1.CompletionStatus
+		reason   v1alpha1.FailureReason
+	}{
+		{"In Order", checksum, []int64{0, 250, 500, 750}, v1alpha1.CompletionStatus_COMPLETED, v1alpha1.FailureReason_UNKNOWN},
+		{"Out Of Order", checksum, []int64{500, 0, 750, 250}, v1alpha1.CompletionStatus_COMPLETED, v1alpha1.FailureReason_UNKNOWN},
+		{"Retried", checksum, []int64{0, 250, 0, 250, 500, 750}, v1alpha1.CompletionStatus_COMPLETED, v1alpha1.FailureReason_UNKNOWN},
+		{"XXH3", xxh3Checksum, []int64{0, 250, 500, 750}, v1alpha1.CompletionStatus_COMPLETED, v1alpha1.FailureReason_UNKNOWN},
+		{"Mismatch", "sha256:" + hex.EncodeToString(make([]byte, sha256.Size)), []int64{0, 250, 500, 750}, v1alpha1.CompletionStatus_FAILED, v1alpha1.FailureReason_CHECKSUM_MISMATCH},
+		{"Mismatch Out Of Order", "sha256:" + hex.EncodeToString(make([]byte, sha256.Size)), []int64{750, 500, 250, 0}, v1alpha1.CompletionStatus_FAILED, v1alpha1.FailureReason_CHECKSUM_MISMATCH},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			newResp, err := apiClient.New(ctx, connect.NewRequest(&v1alpha1.NewRequest{
+				Path:     filepath.Join(t.Name(), "test.bin"),
+				Size:     size,
+				Checksum: tt.checksum,
+			}))
+			require.NoError(t, err)
+
+			uploadID := newResp.Msg.Id
+
+			for _, start := range tt.starts {
+				require.Equal(t, http.StatusNoContent, uploadChunk(t, baseURL, uploadID, data[start:start+250], start, size))
+			}
+
+			_, err = apiClient.Complete(ctx, connect.NewRequest(&v1alpha1.CompleteRequest{Id: uploadID}))
+			require.NoError(t, err)
+
+			var completeResp *connect.Response[v1alpha1.CompleteResponse]
+			require.Eventually(t, func() bool {
+				completeResp, err = apiClient.PollForCompletion(ctx, connect.NewRequest(&wrapperspb.StringValue{Value: uploadID}))
+				return err == nil && completeResp.Msg.Status != v1alpha1.CompletionStatus_PENDING
+			}, 5*time.Second, 10*time.Millisecond)
+
+			assert.Equal(t, tt.status, completeResp.Msg.Status)
+			assert.Equal(t, tt.reason, completeResp.Msg.Reason)
+
+			if tt.status == v1alpha1.CompletionStatus_COMPLETED {
+				uploaded, err := os.ReadFile(filepath.Join(serverDir, t.Name(), "test.bin"))
+				require.NoError(t, err)
+
+				assert.Equal(t, data, uploaded)
+			}
+		})
+	}
+}
+
+func TestUploadNoOverwrite(t *testing.T) {
+	logger := slogt.New(t)
+
+	baseURL, serverDir := startServer(t, nil)
+
+	data := []byte("Hello, World!")
+	size := int64(len(data))
+
+	c, err := upload.NewClient(logger, baseURL, nil)
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	err = c.Upload(ctx, "test.bin", bytes.NewReader(data), size)
+	require.NoError(t, err)
+
+	t.Run("Overwrite", func(t *testing.T) {
+		err := c.Upload(ctx, "test.bin", bytes.NewReader(data), size)
+		require.NoError(t, err)
+	})
+
+	t.Run("No Overwrite", func(t *testing.T) {
+		c, err := upload.NewClient(logger, baseURL, &upload.ClientOptions{
+			NoOverwrite: true,
+		})
+		require.NoError(t, err)
+
+		err = c.Upload(ctx, "test.bin", bytes.NewReader([]byte("Goodbye, World!")), 15)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "destination already exists")
+
+		uploaded, err := os.ReadFile(filepath.Join(serverDir, "test.bin"))
+		require.NoError(t, err)
+
+		assert.Equal(t, data, uploaded)
+	})
+}
+
+func TestUploadPathTraversal(t *testing.T) {
+	baseURL, _ := startServer(t, nil)
+
+	ctx := context.Background()
+	apiClient := v1alpha1connect.NewUploadClient(http.DefaultClient, baseURL+"/api/")
+
+	payloads := []string{
+		"..",
+		"../test.bin",
+		"../../etc/passwd",
+		"foo/../../test.bin",
+		"./foo/../../../test.bin",
+		"foo/bar/../../../test.bin",
+		".",
+		"/",
+	}
+
+	for _, p := range payloads {
+		t.Run(p, func(t *testing.T) {
+			_, err := apiClient.New(ctx, connect.NewRequest(&v1alpha1.NewRequest{
+				Path:     p,
+				Size:     1000,
+				Checksum: "xxh64:0000000000000000",
+			}))
+			require.Error(t, err)
+			assert.Equal(t, connect.CodeInvalidArgument, connect.CodeOf(err))
+		})
+	}
+
+	t.Run("Cleaned", func(t *testing.T) {
+		for _, p := range []string{"foo/../test.bin", "/../test.bin", "./test.bin"} {
+			_, err := apiClient.New(ctx, connect.NewRequest(&v1alpha1.NewRequest{
+				Path:     p,
+				Size:     1000,
+				Checksum: "xxh64:0000000000000000",
+			}))
+			require.NoError(t, err, p)
+		}
+	})
+}
+
+func TestUploadAbortSession(t *testing.T) {
+	baseURL, _ := startServer(t, nil)
+
+	ctx := context.Background()
+	apiClient := v1alpha1connect.NewUploadClient(http.DefaultClient, baseURL+"/api/")
+
+	newUpload := func(t *testing.T, name, sessionID string) string {
+		resp, err := apiClient.New(ctx, connect.NewRequest(&v1alpha1.NewRequest{
+			Path:      filepath.Join(t.Name(), name),
+			Size:      1000,
+			Checksum:  "xxh64:0000000000000000",
+			SessionId: sessionID,
+		}))
+		require.NoError(t, err)
+
+		return resp.Msg.Id
+	}
+
+	abortedIDs := []string{newUpload(t, "a.bin", "session-a"), newUpload(t, "b.bin", "session-a")}
+	otherID := newUpload(t, "c.bin", "session-b")
+	noSessionID := newUpload(t, "d.bin", "")
+
+	_, err := apiClient.AbortSession(ctx, connect.NewRequest(wrapperspb.String("session-a")))
+	require.NoError(t, err)
+
+	for _, id := range abortedIDs {
+		_, err := apiClient.Progress(ctx, connect.NewRequest(wrapperspb.String(id)))
+		require.Error(t, err)
+		assert.Equal(t, connect.CodeNotFound, connect.CodeOf(err))
+	}
+
+	for _, id := range []string{otherID, noSessionID} {
+		_, err := apiClient.Progress(ctx, connect.NewRequest(wrapperspb.String(id)))
+		require.NoError(t, err)
+	}
+
+	t.Run("Missing Session ID", func(t *testing.T) {
+		_, err := apiClient.AbortSession(ctx, connect.NewRequest(wrapperspb.String("")))
+		require.Error(t, err)
+		assert.Equal(t, connect.CodeInvalidArgument, connect.CodeOf(err))
+	})
+}
+
+func TestUploadStoredChecksum(t *testing.T) {
+	logger := slogt.New(t)
+
+	data := []byte("Hello, World!")
+	size := int64(len(data))
+
+	tests := []struct {
+		name     string
+		stored   string
+		matching bool
+	}{
+		{"Matching", "md5:65a8e27d8879283831b664bd8b7f0ad4", true},
+		{"Mismatched", "md5:00000000000000000000000000000000", false},
+		{"None", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			baseURL, _ := startServer(t, &upload.ServerOptions{
+				ChecksumSource: staticChecksumSource(tt.stored),
+			})
+
+			c, err := upload.NewClient(logger, baseURL, nil)
+			require.NoError(t, err)
+
+			err = c.Upload(context.Background(), "test.bin", bytes.NewReader(data), size)
+			if tt.matching {
+				require.NoError(t, err)
+			} else {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), "checksum mismatch")
+			}
+		})
+	}
+}
+
+func TestUploadDownloadChecksum(t *testing.T) {
+	logger := slogt.New(t)
+
+	baseURL, _ := startServer(t, nil)
+
+	data := make([]byte, 1000)
+	_, err := rand.Read(data)
+	require.NoError(t, err)
+
+	c, err := upload.NewClient(logger, baseURL, &upload.ClientOptions{
+		ChecksumAlgorithm: upload.AlgorithmSHA256,
+	})
+	require.NoError(t, err)
+
+	err = c.Upload(context.Background(), "test.bin", bytes.NewReader(data), int64(len(data)))
+	require.NoError(t, err)
+
+	resp, err := http.Get(baseURL + "/files/download/test.bin")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	sum := sha256.Sum256(data)
+	assert.Equal(t, "sha256:"+hex.EncodeToString(sum[:]), resp.Header.Get("X-Checksum"))
+	assert.Equal(t, fmt.Sprintf("%q", "sha256:"+hex.EncodeToString(sum[:])), resp.Header.Get("ETag"))
+}
+
+type staticChecksumSource string
+
+func (s staticChecksumSource) StoredChecksum(_ context.Context, _ string) (string, error) {
+	return string(s), nil
+}
+
+func TestUploadContentType(t *testing.T) {
+	logger := slogt.New(t)
+
+	baseURL, serverDir := startServer(t, nil)
+
+	ctx := context.Background()
+
+	t.Run("Preserved", func(t *testing.T) {
+		c, err := upload.NewClient(logger, baseURL, nil)
+		require.NoError(t, err)
+
+		data := []byte("<html></html>")
+		err = c.Upload(ctx, filepath.Join(t.Name(), "index.html"), bytes.NewReader(data), int64(len(data)))
+		require.NoError(t, err)
+
+		fsys, err := dirfs.New(serverDir)
+		require.NoError(t, err)
+
+		f, err := fsys.OpenFile(filepath.Join(t.Name(), "index.html"), writablefs.FlagReadOnly)
+		require.NoError(t, err)
+		t.Cleanup(func() {
+			_ = f.Close()
+		})
+
+		xattrs, err := f.XAttrs()
+		require.NoError(t, err)
+
+		contentType, err := xattrs.Get("content-type")
+		require.NoError(t, err)
+
+		assert.Equal(t, "text/html; charset=utf-8", string(contentType))
+	})
+
+	t.Run("Invalid", func(t *testing.T) {
+		apiClient := v1alpha1connect.NewUploadClient(http.DefaultClient, baseURL+"/api/")
+
+		_, err := apiClient.New(ctx, connect.NewRequest(&v1alpha1.NewRequest{
+			Path:        filepath.Join(t.Name(), "test.bin"),
+			Size:        1000,
+			Checksum:    "xxh64:0000000000000000",
+			ContentType: "not a/valid type;",
+		}))
+		require.Error(t, err)
+		assert.Equal(t, connect.CodeInvalidArgument, connect.CodeOf(err))
+	})
+}
+
+func TestUploadMetadata(t *testing.T) {
+	logger := slogt.New(t)
+
+	baseURL, serverDir := startServer(t, nil)
+
+	ctx := context.Background()
+
+	t.Run("Preserved", func(t *testing.T) {
+		c, err := upload.NewClient(logger, baseURL, &upload.ClientOptions{
+			Metadata: map[string]string{
+				"Cache-Control":    "max-age=3600",
+				"x-amz-meta-owner": "alice",
+			},
+		})
+		require.NoError(t, err)
+
+		data := []byte("Hello, World!")
+		err = c.Upload(ctx, filepath.Join(t.Name(), "test.txt"), bytes.NewReader(data), int64(len(data)))
+		require.NoError(t, err)
+
+		fsys, err := dirfs.New(serverDir)
+		require.NoError(t, err)
+
+		f, err := fsys.OpenFile(filepath.Join(t.Name(), "test.txt"), writablefs.FlagReadOnly)
+		require.NoError(t, err)
+		t.Cleanup(func() {
+			_ = f.Close()
+		})
+
+		xattrs, err := f.XAttrs()
+		require.NoError(t, err)
+
+		cacheControl, err := xattrs.Get("cache-control")
+		require.NoError(t, err)
+		assert.Equal(t, "max-age=3600", string(cacheControl))
+
+		owner, err := xattrs.Get("owner")
+		require.NoError(t, err)
+		assert.Equal(t, "alice", string(owner))
+
+		contentType, err := xattrs.Get("content-type")
+		require.NoError(t, err)
+		assert.Equal(t, "text/plain; charset=utf-8", string(contentType))
+	})
+
+	t.Run("Invalid", func(t *testing.T) {
+		apiClient := v1alpha1connect.NewUploadClient(http.DefaultClient, baseURL+"/api/")
+
+		for _, md := range []map[string]string{
+			{"x-custom": "value"},
+			{"x-amz-meta-": "value"},
+			{"x-amz-meta-bucketeer.path": "/etc/passwd"},
+			{"cache-control": "bad\nvalue"},
+			{"x-amz-meta-big": strings.Repeat("a", 4096)},
+		} {
+			_, err := apiClient.New(ctx, connect.NewRequest(&v1alpha1.NewRequest{
+				Path:     filepath.Join(t.Name(), "test.bin"),
+				Size:     1000,
+				Checksum: "xxh64:0000000000000000",
+				Metadata: md,
+			}))
+			require.Error(t, err)
+			assert.Equal(t, connect.CodeInvalidArgument, connect.CodeOf(err), md)
+		}
+	})
+}
+
+func TestUploadReleasesRangeLocks(t *testing.T) {
+	rangeLocks := upload.NewRangeLocks()
+
+	baseURL, _ := startServer(t, &upload.ServerOptions{
+		RangeLocks: rangeLocks,
+	})
+
+	ctx := context.Background()
+	apiClient := v1alpha1connect.NewUploadClient(http.DefaultClient, baseURL+"/api/")
+
+	data := []byte("Hello, World!")
+	size := int64(len(data))
+
+	newUpload := func(t *testing.T) string {
+		newResp, err := apiClient.New(ctx, connect.NewRequest(&v1alpha1.NewRequest{
+			Path:     filepath.Join(t.Name(), "test.bin"),
+			Size:     size,
+			Checksum: "xxh64:0000000000000000",
+		}))
+		require.NoError(t, err)
+
+		uploadID := newResp.Msg.Id
+
+		require.Equal(t, http.StatusNoContent, uploadChunk(t, baseURL, uploadID, data, 0, size))
+		require.Equal(t, 1, rangeLocks.Len())
+
+		return uploadID
+	}
+
+	t.Run("Abort", func(t *testing.T) {
+		uploadID := newUpload(t)
+
+		_, err := apiClient.Abort(ctx, connect.NewRequest(&wrapperspb.StringValue{Value: uploadID}))
+		require.NoError(t, err)
+
+		assert.Zero(t, rangeLocks.Len())
+	})
+
+	t.Run("Complete", func(t *testing.T) {
+		uploadID := newUpload(t)
+
+		_, err := apiClient.Complete(ctx, connect.NewRequest(&v1alpha1.CompleteRequest{Id: uploadID}))
+		require.NoError(t, err)
+
+		assert.Eventually(t, func() bool {
+			return rangeLocks.Len() == 0
+		}, 5*time.Second, 10*time.Millisecond)
+	})
+}
+
+func TestUploadLockTimeout(t *testing.T) {
+	rangeLocks := upload.NewRangeLocks()
+
+	baseURL, _ := startServer(t, &upload.ServerOptions{
+		RangeLocks:  rangeLocks,
+		LockTimeout: 100 * time.Millisecond,
+	})
+
+	ctx := context.Background()
+	apiClient := v1alpha1connect.NewUploadClient(http.DefaultClient, baseURL+"/api/")
+
+	data := []byte("Hello, World!")
+	size := int64(len(data))
+
+	newResp, err := apiClient.New(ctx, connect.NewRequest(&v1alpha1.NewRequest{
+		Path:     filepath.Join(t.Name(), "test.bin"),
+		Size:     size,
+		Checksum: "xxh64:0000000000000000",
+	}))
+	require.NoError(t, err)
+
+	uploadID := newResp.Msg.Id
+
+	// Simulate a stuck chunk holding the lock.
+	lock := rangeLocks.Get(uploadID)
+	id, err := lock.Lock(ctx, 0, size-1)
+	require.NoError(t, err)
+
+	resp := uploadChunkResponse(t, baseURL, uploadID, data, 0, size)
+	resp.Body.Close()
+
+	assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+	assert.NotEmpty(t, resp.Header.Get("Retry-After"))
+
+	lock.Unlock(id)
+
+	assert.Equal(t, http.StatusNoContent, uploadChunk(t, baseURL, uploadID, data, 0, size))
+}
+
+func TestUploadReadOnly(t *testing.T) {
+	baseURL, _ := startServer(t, &upload.ServerOptions{
+		ReadOnly: true,
+	})
+
+	ctx := context.Background()
+	apiClient := v1alpha1connect.NewUploadClient(http.DefaultClient, baseURL+"/api/")
+
+	_, err := apiClient.New(ctx, connect.NewRequest(&v1alpha1.NewRequest{
+		Path:     filepath.Join(t.Name(), "test.bin"),
+		Size:     1000,
+		Checksum: "xxh64:0000000000000000",
+	}))
+	require.Error(t, err)
+	assert.Equal(t, connect.CodePermissionDenied, connect.CodeOf(err))
+
+	status := uploadChunk(t, baseURL, "00000000-0000-0000-0000-000000000000", make([]byte, 1000), 0, 1000)
+	assert.Equal(t, http.StatusForbidden, status)
+}
+
+func TestUploadPut(t *testing.T) {
+	baseURL, serverDir := startServer(t, &upload.ServerOptions{
+		MaxPutSize: 1000,
+	})
+
+	data := make([]byte, 500)
+	_, err := rand.Read(data)
+	require.NoError(t, err)
+
+	sum := sha256.Sum256(data)
+
+	put := func(p string, body []byte, header http.Header) int {
+		req, err := http.NewRequest(http.MethodPut, baseURL+"/files/upload/"+p, bytes.NewReader(body))
+		require.NoError(t, err)
+
+		for name, values := range header {
+			req.Header[name] = values
+		}
+
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		resp.Body.Close()
+
+		return resp.StatusCode
+	}
+
+	t.Run("Created", func(t *testing.T) {
+		status := put("dir/test.bin", data, http.Header{
+			"X-Checksum": {"sha256:" + hex.EncodeToString(sum[:])},
+		})
+		require.Equal(t, http.StatusCreated, status)
+
+		written, err := os.ReadFile(filepath.Join(serverDir, "dir", "test.bin"))
+		require.NoError(t, err)
+		assert.Equal(t, data, written)
+	})
+
+	t.Run("Overwrite", func(t *testing.T) {
+		status := put("dir/test.bin", data[:100], nil)
+		require.Equal(t, http.StatusNoContent, status)
+
+		written, err := os.ReadFile(filepath.Join(serverDir, "dir", "test.bin"))
+		require.NoError(t, err)
+		assert.Equal(t, data[:100], written)
+	})
+
+	t.Run("No Overwrite", func(t *testing.T) {
+		status := put("dir/test.bin", data, http.Header{"If-None-Match": {"*"}})
+		assert.Equal(t, http.StatusPreconditionFailed, status)
+	})
+
+	t.Run("Checksum Mismatch", func(t *testing.T) {
+		status := put("mismatch.bin", data, http.Header{
+			"Content-MD5": {"AAAAAAAAAAAAAAAAAAAAAA=="},
+		})
+		assert.Equal(t, http.StatusBadRequest, status)
+		assert.NoFileExists(t, filepath.Join(serverDir, "mismatch.bin"))
+	})
+
+	t.Run("Too Large", func(t *testing.T) {
+		status := put("large.bin", make([]byte, 1001), nil)
+		assert.Equal(t, http.StatusRequestEntityTooLarge, status)
+		assert.NoFileExists(t, filepath.Join(serverDir, "large.bin"))
+	})
+}
+
+func uploadChunk(t *testing.T, baseURL, uploadID string, data []byte, start, size int64) int {
+	resp := uploadChunkResponse(t, baseURL, uploadID, data, start, size)
+	defer resp.Body.Close()
+
+	return resp.StatusCode
+}
+
+func uploadChunkResponse(t *testing.T, baseURL, uploadID string, data []byte, start, size int64) *http.Response {
+	var body bytes.Buffer
+	multipartWriter := multipart.NewWriter(&body)
+
+	h := textproto.MIMEHeader{}
+	h.Set("Content-Disposition", fmt.Sprintf(`form-data; name="file"; filename="%s"`, uploadID))
+	h.Set("Content-Type", "application/octet-stream")
+	h.Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, start+int64(len(data))-1, size))
+
+	fileWriter, err := multipartWriter.CreatePart(h)
+	require.NoError(t, err)
+
+	_, err = fileWriter.Write(data)
+	require.NoError(t, err)
+
+	require.NoError(t, multipartWriter.Close())
+
+	req, err := http.NewRequest(http.MethodPatch, baseURL+"/files/upload", &body)
+	require.NoError(t, err)
+	req.Header.Set("Content-Type", multipartWriter.FormDataContentType())
+
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+
+	return resp
+}
+
+func TestChecksum(t *testing.T) {
+	baseURL, serverDir := startServer(t, nil)
+
+	data := make([]byte, 1000)
+	_, err := rand.Read(data)
+	require.NoError(t, err)
+
+	require.NoError(t, os.MkdirAll(filepath.Join(serverDir, "dir"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(serverDir, "dir", "test.bin"), data, 0o644))
+
+	computeChecksum := func(p, algorithm string) (*http.Response, map[string]string) {
+		query := url.Values{"path": {p}}
+		if algorithm != "" {
+			query.Set("algorithm", algorithm)
+		}
+
+		resp, err := http.Post(baseURL+"/api/v1alpha1/fs/checksum?"+query.Encode(), "", nil)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+
+		var body map[string]string
+		if resp.StatusCode == http.StatusOK {
+			require.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+		}
+
+		return resp, body
+	}
+
+	sum := sha256.Sum256(data)
+
+	resp, body := computeChecksum("dir/test.bin", "")
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	assert.Equal(t, map[string]string{"algorithm": "sha256", "hex": hex.EncodeToString(sum[:])}, body)
+
+	t.Run("Stored", func(t *testing.T) {
+		fsys, err := dirfs.New(serverDir)
+		require.NoError(t, err)
+
+		f, err := fsys.OpenFile("dir/test.bin", writablefs.FlagReadOnly)
+		require.NoError(t, err)
+		defer f.Close()
+
+		xattrs, err := f.XAttrs()
+		require.NoError(t, err)
+
+		stored, err := xattrs.Get("bucketeer.checksum")
+		require.NoError(t, err)
+
+		assert.Equal(t, "sha256:"+hex.EncodeToString(sum[:]), string(stored))
+	})
+
+	t.Run("Algorithm", func(t *testing.T) {
+		md5Sum := md5.Sum(data)
+
+		resp, body := computeChecksum("dir/test.bin", "md5")
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+
+		assert.Equal(t, map[string]string{"algorithm": "md5", "hex": hex.EncodeToString(md5Sum[:])}, body)
+	})
+
+	t.Run("Modified", func(t *testing.T) {
+		modified := append([]byte("modified"), data...)
+		require.NoError(t, os.WriteFile(filepath.Join(serverDir, "dir", "test.bin"), modified, 0o644))
+
+		modifiedSum := sha256.Sum256(modified)
+
+		resp, body := computeChecksum("dir/test.bin", "sha256")
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+
+		assert.Equal(t, hex.EncodeToString(modifiedSum[:]), body["hex"])
+	})
+
+	t.Run("Overwritten", func(t *testing.T) {
+		storedChecksum := func(t *testing.T) string {
+			fsys, err := dirfs.New(serverDir)
+			require.NoError(t, err)
+
+			f, err := fsys.OpenFile("dir/test.bin", writablefs.FlagReadOnly)
+			require.NoError(t, err)
+			defer f.Close()
+
+			xattrs, err := f.XAttrs()
+			require.NoError(t, err)
+
+			stored, err := xattrs.Get("bucketeer.checksum")
+			if errors.Is(err, writablefs.ErrNoSuchAttr) {
+				return ""
+			}
+			require.NoError(t, err)
+
+			return string(stored)
+		}
+
+		overwritten := []byte("overwritten")
+		overwrittenSum := sha256.Sum256(overwritten)
+
+		t.Run("Put", func(t *testing.T) {
+			resp, _ := computeChecksum("dir/test.bin", "")
+			require.Equal(t, http.StatusOK, resp.StatusCode)
+			require.NotEmpty(t, storedChecksum(t))
+
+			req, err := http.NewRequest(http.MethodPut, baseURL+"/files/upload/dir/test.bin", bytes.NewReader(overwritten))
+			require.NoError(t, err)
+
+			resp, err = http.DefaultClient.Do(req)
+			require.NoError(t, err)
+			resp.Body.Close()
+			require.Equal(t, http.StatusNoContent, resp.StatusCode)
+
+			assert.Empty(t, storedChecksum(t))
+		})
+
+		t.Run("Upload", func(t *testing.T) {
+			resp, body := computeChecksum("dir/test.bin", "")
+			require.Equal(t, http.StatusOK, resp.StatusCode)
+			require.Equal(t, hex.EncodeToString(overwrittenSum[:]), body["hex"])
+
+			c, err := upload.NewClient(slogt.New(t), baseURL, &upload.ClientOptions{
+				ChecksumAlgorithm: upload.AlgorithmSHA256,
+			})
+			require.NoError(t, err)
+
+			// Shorter than the existing file.
+			err = c.Upload(context.Background(), "dir/test.bin", bytes.NewReader(overwritten[:4]), 4)
+			require.NoError(t, err)
+
+			written, err := os.ReadFile(filepath.Join(serverDir, "dir", "test.bin"))
+			require.NoError(t, err)
+			assert.Equal(t, overwritten[:4], written)
+
+			// Replaced by the checksum of the upload.
+			uploadedSum := sha256.Sum256(overwritten[:4])
+			assert.Equal(t, "sha256:"+hex.EncodeToString(uploadedSum[:]), storedChecksum(t))
+		})
+	})
+
+	t.Run("Unsupported Algorithm", func(t *testing.T) {
+		resp, _ := computeChecksum("dir/test.bin", "sha1")
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	})
+
+	t.Run("Directory", func(t *testing.T) {
+		resp, _ := computeChecksum("dir", "")
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	})
+
+	t.Run("Not Found", func(t *testing.T) {
+		resp, _ := computeChecksum("dir/missing.bin", "")
+		assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+	})
+}
+
+func startServer(t *testing.T, opts *upload.ServerOptions) (string, string) {
+	logger := slogt.New(t)
+
+	testDir := t.TempDir()
+
+	serverDir := filepath.Join(testDir, "server")
+	cacheDir := filepath.Join(testDir, "cache")
+
+	fsys, err := dirfs.New(serverDir)
+	require.NoError(t, err)
+
+	require.NoError(t, os.MkdirAll(cacheDir, 0o755))
+
+	cacheFS, err := dirfs.New(cacheDir)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	e := echo.New()
+	e.HideBanner = true
+
+	uploadServerPath, uploadServer := upload.NewServer(ctx, logger, fsys, cacheFS, opts)
+	e.Any(uploadServerPath+"*", echo.WrapHandler(uploadServer))
+
+	chunkServerPath, chunkServer := upload.NewChunkServer(logger, fsys, cacheFS, opts)
+	e.Any(chunkServerPath, echo.WrapHandler(chunkServer))
+
+	putServerPath, putServer := upload.NewPutServer(logger, fsys, opts)
+	e.Any(putServerPath+"*", echo.WrapHandler(putServer))
+
+	checksumServerPath, checksumServer := upload.NewChecksumServer(logger, fsys, opts)
+	e.Any(checksumServerPath, echo.WrapHandler(checksumServer))
+
+	cacheStatusServerPath, cacheStatusServer := upload.NewCacheStatusServer(logger, cacheFS, &upload.ServerOptions{
+		CacheDir: cacheDir,
+	})
+	e.Any(cacheStatusServerPath, echo.WrapHandler(cacheStatusServer))
+
+	downloadServerPath, downloadServer := download.NewServer(logger, fsys, nil)
+	e.Any(downloadServerPath+"*", echo.WrapHandler(downloadServer))
+
+	go func() {
+		if err := e.StartH2CServer(":0", &http2.Server{}); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logger.Error("failed to start server", "error", err)
+		}
+	}()
+	t.Cleanup(func() {
+		require.NoError(t, e.Close())
+	})
+
+	err = util.WaitForServerReady(e, 10*time.Second)
+	require.NoError(t, err)
+
+	return fmt.Sprintf("http://%s", e.Listener.Addr().String()), serverDir
 }
 
 func fileChecksum(path string) (string, error) {
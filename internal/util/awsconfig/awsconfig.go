@@ -0,0 +1,83 @@
+/* SPDX-License-Identifier: AGPL-3.0-or-later
+ *
+ * Copyright 2024 Damian Peckett <damian@pecke.tt>.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package awsconfig
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"gopkg.in/ini.v1"
+)
+
+// Profile is the subset of an AWS config profile that bucketeer uses.
+type Profile struct {
+	Region      string
+	EndpointURL string
+}
+
+// Load reads the named profile from the AWS config file (~/.aws/config or
+// $AWS_CONFIG_FILE). If the config file does not exist an empty profile is
+// returned.
+func Load(profile string) (*Profile, error) {
+	configPath := os.Getenv("AWS_CONFIG_FILE")
+	if configPath == "" {
+		homeDir, err := os.UserHomeDir()
+		if err != nil {
+			return nil, fmt.Errorf("failed to get home directory: %w", err)
+		}
+
+		configPath = filepath.Join(homeDir, ".aws", "config")
+	}
+
+	return LoadFile(configPath, profile)
+}
+
+// LoadFile reads the named profile from the given AWS config file.
+func LoadFile(configPath, profile string) (*Profile, error) {
+	if profile == "" {
+		profile = "default"
+	}
+
+	cfg, err := ini.Load(configPath)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return &Profile{}, nil
+		}
+
+		return nil, fmt.Errorf("failed to load aws config: %w", err)
+	}
+
+	// Named profiles are prefixed with "profile" in the config file (but not the default profile).
+	sectionName := "profile " + profile
+	if profile == "default" {
+		sectionName = "default"
+	}
+
+	section, err := cfg.GetSection(sectionName)
+	if err != nil {
+		return nil, fmt.Errorf("profile %q not found in aws config", profile)
+	}
+
+	return &Profile{
+		Region:      section.Key("region").String(),
+		EndpointURL: section.Key("endpoint_url").String(),
+	}, nil
+}
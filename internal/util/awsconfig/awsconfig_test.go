@@ -0,0 +1,68 @@
+/* SPDX-License-Identifier: AGPL-3.0-or-later
+ *
+ * Copyright 2024 Damian Peckett <damian@pecke.tt>.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package awsconfig_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/bucket-sailor/bucketeer/internal/util/awsconfig"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadFile(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "config")
+
+	err := os.WriteFile(configPath, []byte(`[default]
+region = us-east-1
+
+[profile minio]
+region = eu-west-1
+endpoint_url = http://localhost:9000
+`), 0o644)
+	require.NoError(t, err)
+
+	t.Run("Default", func(t *testing.T) {
+		profile, err := awsconfig.LoadFile(configPath, "")
+		require.NoError(t, err)
+
+		assert.Equal(t, &awsconfig.Profile{Region: "us-east-1"}, profile)
+	})
+
+	t.Run("Named", func(t *testing.T) {
+		profile, err := awsconfig.LoadFile(configPath, "minio")
+		require.NoError(t, err)
+
+		assert.Equal(t, &awsconfig.Profile{Region: "eu-west-1", EndpointURL: "http://localhost:9000"}, profile)
+	})
+
+	t.Run("Missing Profile", func(t *testing.T) {
+		_, err := awsconfig.LoadFile(configPath, "missing")
+		assert.Error(t, err)
+	})
+
+	t.Run("Missing File", func(t *testing.T) {
+		profile, err := awsconfig.LoadFile(filepath.Join(t.TempDir(), "missing"), "")
+		require.NoError(t, err)
+
+		assert.Equal(t, &awsconfig.Profile{}, profile)
+	})
+}
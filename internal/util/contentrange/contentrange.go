@@ -24,6 +24,13 @@ import (
 	"strings"
 )
 
+// ContentRange is a parsed Content-Range header.
+//
+// Start and End are inclusive byte offsets. If the header omits the end
+// (eg. "bytes 500-/1000"), End is set to the last byte of the total size.
+// If the header omits the range entirely (eg. "bytes */1000"), which is
+// used to signal the total size before any data is sent, both Start and
+// End are -1. A Total of -1 indicates the total size is unknown.
 type ContentRange struct {
 	Start, End, Total int64
 }
@@ -47,6 +54,31 @@ func Parse(s string) (*ContentRange, error) {
 	}
 
 	rangePart, totalStr := parts[0], parts[1]
+
+	var total int64
+	if totalStr == "*" {
+		total = -1 // Indicate unknown total size
+	} else {
+		var err error
+		total, err = strconv.ParseInt(totalStr, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid total size")
+		}
+	}
+
+	// No range, just the total size.
+	if rangePart == "*" {
+		if total == -1 {
+			return nil, fmt.Errorf("total size is required when range is omitted")
+		}
+
+		return &ContentRange{
+			Start: -1,
+			End:   -1,
+			Total: total,
+		}, nil
+	}
+
 	startEnd := strings.Split(rangePart, "-")
 	if len(startEnd) != 2 {
 		return nil, fmt.Errorf("invalid range format")
@@ -58,18 +90,17 @@ func Parse(s string) (*ContentRange, error) {
 		return nil, fmt.Errorf("invalid start value")
 	}
 
-	end, err := strconv.ParseInt(endStr, 10, 64)
-	if err != nil {
-		return nil, fmt.Errorf("invalid end value")
-	}
+	var end int64
+	if endStr == "" {
+		if total == -1 {
+			return nil, fmt.Errorf("total size is required when end is omitted")
+		}
 
-	var total int64
-	if totalStr == "*" {
-		total = -1 // Indicate unknown total size
+		end = total - 1 // To the last byte
 	} else {
-		total, err = strconv.ParseInt(totalStr, 10, 64)
+		end, err = strconv.ParseInt(endStr, 10, 64)
 		if err != nil {
-			return nil, fmt.Errorf("invalid total size")
+			return nil, fmt.Errorf("invalid end value")
 		}
 	}
 
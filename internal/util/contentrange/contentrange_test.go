@@ -0,0 +1,86 @@
+/* SPDX-License-Identifier: AGPL-3.0-or-later
+ *
+ * Copyright 2024 Damian Peckett <damian@pecke.tt>.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package contentrange_test
+
+import (
+	"testing"
+
+	"github.com/bucket-sailor/bucketeer/internal/util/contentrange"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name     string
+		header   string
+		expected *contentrange.ContentRange
+	}{
+		{
+			name:     "Full",
+			header:   "bytes 0-499/1000",
+			expected: &contentrange.ContentRange{Start: 0, End: 499, Total: 1000},
+		},
+		{
+			name:     "UnknownTotal",
+			header:   "bytes 500-999/*",
+			expected: &contentrange.ContentRange{Start: 500, End: 999, Total: -1},
+		},
+		{
+			name:     "OpenEnded",
+			header:   "bytes 500-/1000",
+			expected: &contentrange.ContentRange{Start: 500, End: 999, Total: 1000},
+		},
+		{
+			name:     "TotalOnly",
+			header:   "bytes */1000",
+			expected: &contentrange.ContentRange{Start: -1, End: -1, Total: 1000},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rng, err := contentrange.Parse(tt.header)
+			require.NoError(t, err)
+
+			assert.Equal(t, tt.expected, rng)
+		})
+	}
+}
+
+func TestParseInvalid(t *testing.T) {
+	headers := []string{
+		"",
+		"0-499/1000",
+		"bytes 0-499",
+		"bytes 499-0/1000",
+		"bytes a-499/1000",
+		"bytes 0-b/1000",
+		"bytes 0-499/c",
+		"bytes 500-/*",
+		"bytes */*",
+	}
+
+	for _, header := range headers {
+		t.Run(header, func(t *testing.T) {
+			_, err := contentrange.Parse(header)
+			assert.Error(t, err)
+		})
+	}
+}
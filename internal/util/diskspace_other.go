@@ -0,0 +1,32 @@
+//go:build !linux && !darwin
+
+/* SPDX-License-Identifier: AGPL-3.0-or-later
+ *
+ * Copyright 2024 Damian Peckett <damian@pecke.tt>.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package util
+
+import "errors"
+
+// ErrDiskSpaceUnsupported is returned by DiskSpace on unsupported platforms.
+var ErrDiskSpaceUnsupported = errors.New("disk space is not supported on this platform")
+
+// DiskSpace returns the total size of the filesystem containing path, and the
+// number of bytes available to unprivileged users.
+func DiskSpace(path string) (total, free uint64, err error) {
+	return 0, 0, ErrDiskSpaceUnsupported
+}
@@ -0,0 +1,51 @@
+/* SPDX-License-Identifier: AGPL-3.0-or-later
+ *
+ * Copyright 2024 Damian Peckett <damian@pecke.tt>.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package util_test
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/bucket-sailor/bucketeer/internal/util"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExpandPath(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("CERTS_DIR", "/etc/certs")
+
+	for _, tc := range []struct {
+		path     string
+		expected string
+	}{
+		{"~", home},
+		{"~/certs/ca.pem", filepath.Join(home, "certs/ca.pem")},
+		{"$CERTS_DIR/ca.pem", "/etc/certs/ca.pem"},
+		{"${HOME}/bucketeer.log", filepath.Join(home, "bucketeer.log")},
+		{"/var/~user/ca.pem", "/var/~user/ca.pem"},
+		{"relative/ca.pem", "relative/ca.pem"},
+	} {
+		expanded, err := util.ExpandPath(tc.path)
+		require.NoError(t, err)
+
+		assert.Equal(t, tc.expected, expanded, tc.path)
+	}
+}
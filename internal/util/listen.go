@@ -0,0 +1,72 @@
+/* SPDX-License-Identifier: AGPL-3.0-or-later
+ *
+ * Copyright 2024 Damian Peckett <damian@pecke.tt>.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package util
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"os"
+	"strings"
+)
+
+const unixSocketPrefix = "unix://"
+
+// Listen creates a listener for the given address. Addresses of the form
+// "unix:///path/to/sock" listen on a unix domain socket (with the given
+// permissions, if non-zero), anything else is treated as a TCP address.
+// The socket file is removed when the listener is closed.
+func Listen(address string, socketMode os.FileMode) (net.Listener, error) {
+	socketPath, ok := strings.CutPrefix(address, unixSocketPrefix)
+	if !ok {
+		return net.Listen("tcp", address)
+	}
+
+	if socketPath == "" {
+		return nil, fmt.Errorf("missing socket path in address: %s", address)
+	}
+
+	// Remove any stale socket left behind by a previous run.
+	if fi, err := os.Lstat(socketPath); err == nil {
+		if fi.Mode().Type() != fs.ModeSocket {
+			return nil, fmt.Errorf("refusing to replace non-socket file: %s", socketPath)
+		}
+
+		if err := os.Remove(socketPath); err != nil {
+			return nil, fmt.Errorf("failed to remove stale socket: %w", err)
+		}
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+
+	l, err := net.Listen("unix", socketPath)
+	if err != nil {
+		return nil, err
+	}
+
+	if socketMode != 0 {
+		if err := os.Chmod(socketPath, socketMode); err != nil {
+			_ = l.Close()
+			return nil, fmt.Errorf("failed to set socket permissions: %w", err)
+		}
+	}
+
+	return l, nil
+}
@@ -0,0 +1,77 @@
+/* SPDX-License-Identifier: AGPL-3.0-or-later
+ *
+ * Copyright 2024 Damian Peckett <damian@pecke.tt>.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package util_test
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/bucket-sailor/bucketeer/internal/util"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestListen(t *testing.T) {
+	t.Run("TCP", func(t *testing.T) {
+		l, err := util.Listen("localhost:0", 0)
+		require.NoError(t, err)
+		t.Cleanup(func() {
+			_ = l.Close()
+		})
+
+		assert.Equal(t, "tcp", l.Addr().Network())
+	})
+
+	t.Run("Unix", func(t *testing.T) {
+		socketPath := filepath.Join(t.TempDir(), "bucketeer.sock")
+
+		// A stale socket from a previous run.
+		stale, err := net.Listen("unix", socketPath)
+		require.NoError(t, err)
+		stale.(*net.UnixListener).SetUnlinkOnClose(false)
+		require.NoError(t, stale.Close())
+
+		l, err := util.Listen("unix://"+socketPath, 0o600)
+		require.NoError(t, err)
+
+		fi, err := os.Stat(socketPath)
+		require.NoError(t, err)
+
+		assert.Equal(t, os.ModeSocket, fi.Mode().Type())
+		assert.Equal(t, os.FileMode(0o600), fi.Mode().Perm())
+
+		conn, err := net.Dial("unix", socketPath)
+		require.NoError(t, err)
+		require.NoError(t, conn.Close())
+
+		// The socket file should be removed on close.
+		require.NoError(t, l.Close())
+		assert.NoFileExists(t, socketPath)
+	})
+
+	t.Run("Not A Socket", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "file")
+		require.NoError(t, os.WriteFile(path, nil, 0o644))
+
+		_, err := util.Listen("unix://"+path, 0)
+		require.Error(t, err)
+	})
+}
@@ -0,0 +1,55 @@
+/* SPDX-License-Identifier: AGPL-3.0-or-later
+ *
+ * Copyright 2024 Damian Peckett <damian@pecke.tt>.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+package s3client
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"github.com/bucket-sailor/writablefs/s3fs"
+	"github.com/minio/minio-go/v7"
+)
+
+// New creates a client for talking directly to the bucket described by opts.
+// If pathStyle is true, path-style addressing (endpoint/bucket/key) will always
+// be used, otherwise the style is chosen based on the endpoint.
+func New(opts s3fs.Options, pathStyle bool) (*minio.Client, error) {
+	endpointURL, err := url.Parse(opts.EndpointURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid endpoint url: %w", err)
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if opts.TLSClientConfig != nil {
+		transport.TLSClientConfig = opts.TLSClientConfig
+	}
+
+	bucketLookup := minio.BucketLookupAuto
+	if pathStyle {
+		bucketLookup = minio.BucketLookupPath
+	}
+
+	return minio.New(endpointURL.Host, &minio.Options{
+		Region:       opts.Region,
+		Transport:    transport,
+		Secure:       endpointURL.Scheme == "https",
+		Creds:        opts.Credentials,
+		BucketLookup: bucketLookup,
+	})
+}
@@ -0,0 +1,48 @@
+/* SPDX-License-Identifier: AGPL-3.0-or-later
+ *
+ * Copyright 2024 Damian Peckett <damian@pecke.tt>.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+package version_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"testing"
+
+	"github.com/bucket-sailor/bucketeer/internal/constants"
+	"github.com/bucket-sailor/bucketeer/internal/version"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHandler(t *testing.T) {
+	rec := httptest.NewRecorder()
+	version.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1alpha1/version", nil))
+
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "application/json", rec.Header().Get("Content-Type"))
+
+	var info map[string]string
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&info))
+
+	assert.Equal(t, constants.Version, info["version"])
+	assert.Equal(t, runtime.Version(), info["goVersion"])
+	assert.Equal(t, runtime.GOOS, info["os"])
+	assert.Equal(t, runtime.GOARCH, info["arch"])
+	assert.Contains(t, info, "commit")
+}
@@ -77,6 +77,23 @@ const App = ({ baseURL, basePath }: AppProps): React.ReactElement => {
   const [isDeleteModalOpen, setIsDeleteModalOpen] = useState(false)
   const [isPropertiesModalOpen, setIsPropertiesModalOpen] = useState(false)
 
+  // Pick up changes made to the current directory by other users.
+  useEffect(() => {
+    if (currentDirectory === undefined) {
+      return
+    }
+
+    const events = new EventSource(`${baseURL}/api/v1alpha1/fs/watch?path=${encodeURIComponent(currentDirectory)}`)
+
+    for (const eventType of ['added', 'removed', 'modified']) {
+      events.addEventListener(eventType, refreshFiles)
+    }
+
+    return () => {
+      events.close()
+    }
+  }, [baseURL, currentDirectory])
+
   // For statistical purposes.
   const isMobile = useMediaQuery('(max-width:600px)')
   const isTablet = useMediaQuery('(min-width:601px) and (max-width:900px)')
@@ -160,10 +177,17 @@ const App = ({ baseURL, basePath }: AppProps): React.ReactElement => {
     handleFileMenuClose()
 
     if (currentDirectory !== undefined && selectedFile !== undefined) {
+      let isDir = false
+      directoryContents.forEach((value, _) => {
+        if (value.name === selectedFile) {
+          isDir = value.isDir
+        }
+      })
+
       const path = (currentDirectory !== '' ? currentDirectory + '/' : '') + selectedFile
-      downloadFile(path)
+      downloadFile(path, isDir)
     }
-  }, [currentDirectory, selectedFile])
+  }, [currentDirectory, selectedFile, directoryContents])
 
   const handleOpenDeleteModal = (): void => {
     setFileMenuOpen(false)
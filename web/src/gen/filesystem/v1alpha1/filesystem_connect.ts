@@ -20,7 +20,7 @@
 /* eslint-disable */
 // @ts-nocheck
 
-import { FileInfo, ReadDirRequest, ReadDirResponse } from "./filesystem_pb";
+import { CopyRequest, FileInfo, MoveRequest, PresignRequest, PresignResponse, ReadDirPageRequest, ReadDirPageResponse, ReadDirRequest, ReadDirResponse, RemoveBatchRequest, RemoveBatchResponse, RenameRequest, RestoreRequest, RestoreResponse, TouchRequest, UsageResponse } from "./filesystem_pb";
 import { Empty, MethodKind, StringValue } from "@bufbuild/protobuf";
 
 /**
@@ -40,6 +40,19 @@ export const Filesystem = {
       O: ReadDirResponse,
       kind: MethodKind.Unary,
     },
+    /**
+     * ReadDirPage returns a single page of a directory listing (sorted by name),
+     * without listing the entire directory up front. This is better suited to
+     * very large directories than ReadDir.
+     *
+     * @generated from rpc bucketeer.filesystem.v1alpha1.Filesystem.ReadDirPage
+     */
+    readDirPage: {
+      name: "ReadDirPage",
+      I: ReadDirPageRequest,
+      O: ReadDirPageResponse,
+      kind: MethodKind.Unary,
+    },
     /**
      * Stat returns information about a file or directory.
      *
@@ -63,7 +76,19 @@ export const Filesystem = {
       kind: MethodKind.Unary,
     },
     /**
-     * RemoveAll removes a directory and any children it contains.
+     * Touch creates an empty file and any necessary parent directories.
+     *
+     * @generated from rpc bucketeer.filesystem.v1alpha1.Filesystem.Touch
+     */
+    touch: {
+      name: "Touch",
+      I: TouchRequest,
+      O: Empty,
+      kind: MethodKind.Unary,
+    },
+    /**
+     * RemoveAll removes a directory and any children it contains. If the
+     * server has trash enabled it is moved to the trash instead.
      *
      * @generated from rpc bucketeer.filesystem.v1alpha1.Filesystem.RemoveAll
      */
@@ -73,6 +98,100 @@ export const Filesystem = {
       O: Empty,
       kind: MethodKind.Unary,
     },
+    /**
+     * RemoveBatch removes multiple files or directories, reporting the result
+     * for each path.
+     *
+     * @generated from rpc bucketeer.filesystem.v1alpha1.Filesystem.RemoveBatch
+     */
+    removeBatch: {
+      name: "RemoveBatch",
+      I: RemoveBatchRequest,
+      O: RemoveBatchResponse,
+      kind: MethodKind.Unary,
+    },
+    /**
+     * Copy copies a file or directory (recursively) to a new location.
+     *
+     * @generated from rpc bucketeer.filesystem.v1alpha1.Filesystem.Copy
+     */
+    copy: {
+      name: "Copy",
+      I: CopyRequest,
+      O: Empty,
+      kind: MethodKind.Unary,
+    },
+    /**
+     * Rename moves a file or directory to a new location, creating any
+     * necessary parent directories.
+     *
+     * @generated from rpc bucketeer.filesystem.v1alpha1.Filesystem.Rename
+     */
+    rename: {
+      name: "Rename",
+      I: RenameRequest,
+      O: Empty,
+      kind: MethodKind.Unary,
+    },
+    /**
+     * Move moves a file or directory to a new location, if the filesystem
+     * can't rename it (eg. a directory on S3) it is copied and the source is
+     * then removed.
+     *
+     * @generated from rpc bucketeer.filesystem.v1alpha1.Filesystem.Move
+     */
+    move: {
+      name: "Move",
+      I: MoveRequest,
+      O: Empty,
+      kind: MethodKind.Unary,
+    },
+    /**
+     * Usage returns the total size of a directory and its children.
+     *
+     * @generated from rpc bucketeer.filesystem.v1alpha1.Filesystem.Usage
+     */
+    usage: {
+      name: "Usage",
+      I: StringValue,
+      O: UsageResponse,
+      kind: MethodKind.Unary,
+    },
+    /**
+     * Presign returns a presigned URL that can be used to download a file
+     * directly from the underlying storage.
+     *
+     * @generated from rpc bucketeer.filesystem.v1alpha1.Filesystem.Presign
+     */
+    presign: {
+      name: "Presign",
+      I: PresignRequest,
+      O: PresignResponse,
+      kind: MethodKind.Unary,
+    },
+    /**
+     * Restore moves a file or directory out of the trash, by default back to
+     * where it was removed from.
+     *
+     * @generated from rpc bucketeer.filesystem.v1alpha1.Filesystem.Restore
+     */
+    restore: {
+      name: "Restore",
+      I: RestoreRequest,
+      O: RestoreResponse,
+      kind: MethodKind.Unary,
+    },
+    /**
+     * EmptyTrash permanently removes everything in the trash.
+     *
+     * @generated from rpc bucketeer.filesystem.v1alpha1.Filesystem.EmptyTrash
+     */
+    emptyTrash: {
+      name: "EmptyTrash",
+      I: Empty,
+      O: Empty,
+      kind: MethodKind.Unary,
+    },
   }
 } as const;
 
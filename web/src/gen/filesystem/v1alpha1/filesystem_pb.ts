@@ -21,7 +21,63 @@
 // @ts-nocheck
 
 import type { BinaryReadOptions, FieldList, JsonReadOptions, JsonValue, PartialMessage, PlainMessage } from "@bufbuild/protobuf";
-import { Message, proto3, protoInt64, Timestamp } from "@bufbuild/protobuf";
+import { Duration, Message, proto3, protoInt64, Timestamp } from "@bufbuild/protobuf";
+
+/**
+ * SortBy is the field to sort directory listings by.
+ *
+ * @generated from enum bucketeer.filesystem.v1alpha1.SortBy
+ */
+export enum SortBy {
+  /**
+   * Sort by file name.
+   *
+   * @generated from enum value: NAME = 0;
+   */
+  NAME = 0,
+
+  /**
+   * Sort by file size.
+   *
+   * @generated from enum value: SIZE = 1;
+   */
+  SIZE = 1,
+
+  /**
+   * Sort by modification time.
+   *
+   * @generated from enum value: MOD_TIME = 2;
+   */
+  MOD_TIME = 2,
+}
+// Retrieve enum metadata with: proto3.getEnumType(SortBy)
+proto3.util.setEnumType(SortBy, "bucketeer.filesystem.v1alpha1.SortBy", [
+  { no: 0, name: "NAME" },
+  { no: 1, name: "SIZE" },
+  { no: 2, name: "MOD_TIME" },
+]);
+
+/**
+ * SortOrder is the order to sort directory listings in.
+ *
+ * @generated from enum bucketeer.filesystem.v1alpha1.SortOrder
+ */
+export enum SortOrder {
+  /**
+   * @generated from enum value: ASCENDING = 0;
+   */
+  ASCENDING = 0,
+
+  /**
+   * @generated from enum value: DESCENDING = 1;
+   */
+  DESCENDING = 1,
+}
+// Retrieve enum metadata with: proto3.getEnumType(SortOrder)
+proto3.util.setEnumType(SortOrder, "bucketeer.filesystem.v1alpha1.SortOrder", [
+  { no: 0, name: "ASCENDING" },
+  { no: 1, name: "DESCENDING" },
+]);
 
 /**
  * @generated from message bucketeer.filesystem.v1alpha1.FileInfo
@@ -47,6 +103,14 @@ export class FileInfo extends Message<FileInfo> {
    */
   modTime?: Timestamp;
 
+  /**
+   * An opaque token identifying the current contents of a file (the same as
+   * the ETag of a download), only populated by Stat().
+   *
+   * @generated from field: string etag = 5;
+   */
+  etag = "";
+
   constructor(data?: PartialMessage<FileInfo>) {
     super();
     proto3.util.initPartial(data, this);
@@ -59,6 +123,7 @@ export class FileInfo extends Message<FileInfo> {
     { no: 2, name: "is_dir", kind: "scalar", T: 8 /* ScalarType.BOOL */ },
     { no: 3, name: "size", kind: "scalar", T: 3 /* ScalarType.INT64 */ },
     { no: 4, name: "mod_time", kind: "message", T: Timestamp },
+    { no: 5, name: "etag", kind: "scalar", T: 9 /* ScalarType.STRING */ },
   ]);
 
   static fromBinary(bytes: Uint8Array, options?: Partial<BinaryReadOptions>): FileInfo {
@@ -102,6 +167,27 @@ export class ReadDirRequest extends Message<ReadDirRequest> {
    */
   stopIndex = protoInt64.zero;
 
+  /**
+   * The field to sort the listing by (defaults to name).
+   *
+   * @generated from field: bucketeer.filesystem.v1alpha1.SortBy sort_by = 5;
+   */
+  sortBy = SortBy.NAME;
+
+  /**
+   * The order to sort the listing in (defaults to ascending).
+   *
+   * @generated from field: bucketeer.filesystem.v1alpha1.SortOrder order = 6;
+   */
+  order = SortOrder.ASCENDING;
+
+  /**
+   * An optional glob pattern (eg. "*.json") to filter entries by name.
+   *
+   * @generated from field: string filter = 7;
+   */
+  filter = "";
+
   constructor(data?: PartialMessage<ReadDirRequest>) {
     super();
     proto3.util.initPartial(data, this);
@@ -114,6 +200,9 @@ export class ReadDirRequest extends Message<ReadDirRequest> {
     { no: 2, name: "path", kind: "scalar", T: 9 /* ScalarType.STRING */ },
     { no: 3, name: "start_index", kind: "scalar", T: 3 /* ScalarType.INT64 */ },
     { no: 4, name: "stop_index", kind: "scalar", T: 3 /* ScalarType.INT64 */ },
+    { no: 5, name: "sort_by", kind: "enum", T: proto3.getEnumType(SortBy) },
+    { no: 6, name: "order", kind: "enum", T: proto3.getEnumType(SortOrder) },
+    { no: 7, name: "filter", kind: "scalar", T: 9 /* ScalarType.STRING */ },
   ]);
 
   static fromBinary(bytes: Uint8Array, options?: Partial<BinaryReadOptions>): ReadDirRequest {
@@ -230,3 +319,712 @@ export class ReadDirResponse_FileInfoWithIndex extends Message<ReadDirResponse_F
   }
 }
 
+/**
+ * @generated from message bucketeer.filesystem.v1alpha1.ReadDirPageRequest
+ */
+export class ReadDirPageRequest extends Message<ReadDirPageRequest> {
+  /**
+   * @generated from field: string path = 1;
+   */
+  path = "";
+
+  /**
+   * The token returned with the previous page (empty for the first page).
+   *
+   * @generated from field: string token = 2;
+   */
+  token = "";
+
+  /**
+   * The maximum number of entries to return (defaults to, and at most, 1000).
+   *
+   * @generated from field: int32 limit = 3;
+   */
+  limit = 0;
+
+  constructor(data?: PartialMessage<ReadDirPageRequest>) {
+    super();
+    proto3.util.initPartial(data, this);
+  }
+
+  static readonly runtime: typeof proto3 = proto3;
+  static readonly typeName = "bucketeer.filesystem.v1alpha1.ReadDirPageRequest";
+  static readonly fields: FieldList = proto3.util.newFieldList(() => [
+    { no: 1, name: "path", kind: "scalar", T: 9 /* ScalarType.STRING */ },
+    { no: 2, name: "token", kind: "scalar", T: 9 /* ScalarType.STRING */ },
+    { no: 3, name: "limit", kind: "scalar", T: 5 /* ScalarType.INT32 */ },
+  ]);
+
+  static fromBinary(bytes: Uint8Array, options?: Partial<BinaryReadOptions>): ReadDirPageRequest {
+    return new ReadDirPageRequest().fromBinary(bytes, options);
+  }
+
+  static fromJson(jsonValue: JsonValue, options?: Partial<JsonReadOptions>): ReadDirPageRequest {
+    return new ReadDirPageRequest().fromJson(jsonValue, options);
+  }
+
+  static fromJsonString(jsonString: string, options?: Partial<JsonReadOptions>): ReadDirPageRequest {
+    return new ReadDirPageRequest().fromJsonString(jsonString, options);
+  }
+
+  static equals(a: ReadDirPageRequest | PlainMessage<ReadDirPageRequest> | undefined, b: ReadDirPageRequest | PlainMessage<ReadDirPageRequest> | undefined): boolean {
+    return proto3.util.equals(ReadDirPageRequest, a, b);
+  }
+}
+
+/**
+ * @generated from message bucketeer.filesystem.v1alpha1.ReadDirPageResponse
+ */
+export class ReadDirPageResponse extends Message<ReadDirPageResponse> {
+  /**
+   * @generated from field: repeated bucketeer.filesystem.v1alpha1.FileInfo files = 1;
+   */
+  files: FileInfo[] = [];
+
+  /**
+   * The token used to retrieve the next page, empty if this is the last page.
+   *
+   * @generated from field: string next_token = 2;
+   */
+  nextToken = "";
+
+  constructor(data?: PartialMessage<ReadDirPageResponse>) {
+    super();
+    proto3.util.initPartial(data, this);
+  }
+
+  static readonly runtime: typeof proto3 = proto3;
+  static readonly typeName = "bucketeer.filesystem.v1alpha1.ReadDirPageResponse";
+  static readonly fields: FieldList = proto3.util.newFieldList(() => [
+    { no: 1, name: "files", kind: "message", T: FileInfo, repeated: true },
+    { no: 2, name: "next_token", kind: "scalar", T: 9 /* ScalarType.STRING */ },
+  ]);
+
+  static fromBinary(bytes: Uint8Array, options?: Partial<BinaryReadOptions>): ReadDirPageResponse {
+    return new ReadDirPageResponse().fromBinary(bytes, options);
+  }
+
+  static fromJson(jsonValue: JsonValue, options?: Partial<JsonReadOptions>): ReadDirPageResponse {
+    return new ReadDirPageResponse().fromJson(jsonValue, options);
+  }
+
+  static fromJsonString(jsonString: string, options?: Partial<JsonReadOptions>): ReadDirPageResponse {
+    return new ReadDirPageResponse().fromJsonString(jsonString, options);
+  }
+
+  static equals(a: ReadDirPageResponse | PlainMessage<ReadDirPageResponse> | undefined, b: ReadDirPageResponse | PlainMessage<ReadDirPageResponse> | undefined): boolean {
+    return proto3.util.equals(ReadDirPageResponse, a, b);
+  }
+}
+
+/**
+ * @generated from message bucketeer.filesystem.v1alpha1.RemoveBatchRequest
+ */
+export class RemoveBatchRequest extends Message<RemoveBatchRequest> {
+  /**
+   * The paths to remove (at most 1000).
+   *
+   * @generated from field: repeated string paths = 1;
+   */
+  paths: string[] = [];
+
+  constructor(data?: PartialMessage<RemoveBatchRequest>) {
+    super();
+    proto3.util.initPartial(data, this);
+  }
+
+  static readonly runtime: typeof proto3 = proto3;
+  static readonly typeName = "bucketeer.filesystem.v1alpha1.RemoveBatchRequest";
+  static readonly fields: FieldList = proto3.util.newFieldList(() => [
+    { no: 1, name: "paths", kind: "scalar", T: 9 /* ScalarType.STRING */, repeated: true },
+  ]);
+
+  static fromBinary(bytes: Uint8Array, options?: Partial<BinaryReadOptions>): RemoveBatchRequest {
+    return new RemoveBatchRequest().fromBinary(bytes, options);
+  }
+
+  static fromJson(jsonValue: JsonValue, options?: Partial<JsonReadOptions>): RemoveBatchRequest {
+    return new RemoveBatchRequest().fromJson(jsonValue, options);
+  }
+
+  static fromJsonString(jsonString: string, options?: Partial<JsonReadOptions>): RemoveBatchRequest {
+    return new RemoveBatchRequest().fromJsonString(jsonString, options);
+  }
+
+  static equals(a: RemoveBatchRequest | PlainMessage<RemoveBatchRequest> | undefined, b: RemoveBatchRequest | PlainMessage<RemoveBatchRequest> | undefined): boolean {
+    return proto3.util.equals(RemoveBatchRequest, a, b);
+  }
+}
+
+/**
+ * @generated from message bucketeer.filesystem.v1alpha1.RemoveBatchResponse
+ */
+export class RemoveBatchResponse extends Message<RemoveBatchResponse> {
+  /**
+   * The result for each requested path, in request order.
+   *
+   * @generated from field: repeated bucketeer.filesystem.v1alpha1.RemoveBatchResponse.Result results = 1;
+   */
+  results: RemoveBatchResponse_Result[] = [];
+
+  constructor(data?: PartialMessage<RemoveBatchResponse>) {
+    super();
+    proto3.util.initPartial(data, this);
+  }
+
+  static readonly runtime: typeof proto3 = proto3;
+  static readonly typeName = "bucketeer.filesystem.v1alpha1.RemoveBatchResponse";
+  static readonly fields: FieldList = proto3.util.newFieldList(() => [
+    { no: 1, name: "results", kind: "message", T: RemoveBatchResponse_Result, repeated: true },
+  ]);
+
+  static fromBinary(bytes: Uint8Array, options?: Partial<BinaryReadOptions>): RemoveBatchResponse {
+    return new RemoveBatchResponse().fromBinary(bytes, options);
+  }
+
+  static fromJson(jsonValue: JsonValue, options?: Partial<JsonReadOptions>): RemoveBatchResponse {
+    return new RemoveBatchResponse().fromJson(jsonValue, options);
+  }
+
+  static fromJsonString(jsonString: string, options?: Partial<JsonReadOptions>): RemoveBatchResponse {
+    return new RemoveBatchResponse().fromJsonString(jsonString, options);
+  }
+
+  static equals(a: RemoveBatchResponse | PlainMessage<RemoveBatchResponse> | undefined, b: RemoveBatchResponse | PlainMessage<RemoveBatchResponse> | undefined): boolean {
+    return proto3.util.equals(RemoveBatchResponse, a, b);
+  }
+}
+
+/**
+ * @generated from message bucketeer.filesystem.v1alpha1.RemoveBatchResponse.Result
+ */
+export class RemoveBatchResponse_Result extends Message<RemoveBatchResponse_Result> {
+  /**
+   * @generated from field: string path = 1;
+   */
+  path = "";
+
+  /**
+   * @generated from field: bool ok = 2;
+   */
+  ok = false;
+
+  /**
+   * The reason the path could not be removed (if not ok).
+   *
+   * @generated from field: string error = 3;
+   */
+  error = "";
+
+  constructor(data?: PartialMessage<RemoveBatchResponse_Result>) {
+    super();
+    proto3.util.initPartial(data, this);
+  }
+
+  static readonly runtime: typeof proto3 = proto3;
+  static readonly typeName = "bucketeer.filesystem.v1alpha1.RemoveBatchResponse.Result";
+  static readonly fields: FieldList = proto3.util.newFieldList(() => [
+    { no: 1, name: "path", kind: "scalar", T: 9 /* ScalarType.STRING */ },
+    { no: 2, name: "ok", kind: "scalar", T: 8 /* ScalarType.BOOL */ },
+    { no: 3, name: "error", kind: "scalar", T: 9 /* ScalarType.STRING */ },
+  ]);
+
+  static fromBinary(bytes: Uint8Array, options?: Partial<BinaryReadOptions>): RemoveBatchResponse_Result {
+    return new RemoveBatchResponse_Result().fromBinary(bytes, options);
+  }
+
+  static fromJson(jsonValue: JsonValue, options?: Partial<JsonReadOptions>): RemoveBatchResponse_Result {
+    return new RemoveBatchResponse_Result().fromJson(jsonValue, options);
+  }
+
+  static fromJsonString(jsonString: string, options?: Partial<JsonReadOptions>): RemoveBatchResponse_Result {
+    return new RemoveBatchResponse_Result().fromJsonString(jsonString, options);
+  }
+
+  static equals(a: RemoveBatchResponse_Result | PlainMessage<RemoveBatchResponse_Result> | undefined, b: RemoveBatchResponse_Result | PlainMessage<RemoveBatchResponse_Result> | undefined): boolean {
+    return proto3.util.equals(RemoveBatchResponse_Result, a, b);
+  }
+}
+
+/**
+ * @generated from message bucketeer.filesystem.v1alpha1.TouchRequest
+ */
+export class TouchRequest extends Message<TouchRequest> {
+  /**
+   * The path of the file to create.
+   *
+   * @generated from field: string path = 1;
+   */
+  path = "";
+
+  /**
+   * Replace the file with an empty one if it already exists.
+   *
+   * @generated from field: bool force = 2;
+   */
+  force = false;
+
+  constructor(data?: PartialMessage<TouchRequest>) {
+    super();
+    proto3.util.initPartial(data, this);
+  }
+
+  static readonly runtime: typeof proto3 = proto3;
+  static readonly typeName = "bucketeer.filesystem.v1alpha1.TouchRequest";
+  static readonly fields: FieldList = proto3.util.newFieldList(() => [
+    { no: 1, name: "path", kind: "scalar", T: 9 /* ScalarType.STRING */ },
+    { no: 2, name: "force", kind: "scalar", T: 8 /* ScalarType.BOOL */ },
+  ]);
+
+  static fromBinary(bytes: Uint8Array, options?: Partial<BinaryReadOptions>): TouchRequest {
+    return new TouchRequest().fromBinary(bytes, options);
+  }
+
+  static fromJson(jsonValue: JsonValue, options?: Partial<JsonReadOptions>): TouchRequest {
+    return new TouchRequest().fromJson(jsonValue, options);
+  }
+
+  static fromJsonString(jsonString: string, options?: Partial<JsonReadOptions>): TouchRequest {
+    return new TouchRequest().fromJsonString(jsonString, options);
+  }
+
+  static equals(a: TouchRequest | PlainMessage<TouchRequest> | undefined, b: TouchRequest | PlainMessage<TouchRequest> | undefined): boolean {
+    return proto3.util.equals(TouchRequest, a, b);
+  }
+}
+
+/**
+ * @generated from message bucketeer.filesystem.v1alpha1.CopyRequest
+ */
+export class CopyRequest extends Message<CopyRequest> {
+  /**
+   * The path of the file or directory to copy.
+   *
+   * @generated from field: string src_path = 1;
+   */
+  srcPath = "";
+
+  /**
+   * The destination path.
+   *
+   * @generated from field: string dst_path = 2;
+   */
+  dstPath = "";
+
+  /**
+   * Overwrite the destination if it already exists.
+   *
+   * @generated from field: bool force = 3;
+   */
+  force = false;
+
+  /**
+   * If set, the destination is only overwritten if its etag matches, this
+   * implies force.
+   *
+   * @generated from field: string if_match = 4;
+   */
+  ifMatch = "";
+
+  constructor(data?: PartialMessage<CopyRequest>) {
+    super();
+    proto3.util.initPartial(data, this);
+  }
+
+  static readonly runtime: typeof proto3 = proto3;
+  static readonly typeName = "bucketeer.filesystem.v1alpha1.CopyRequest";
+  static readonly fields: FieldList = proto3.util.newFieldList(() => [
+    { no: 1, name: "src_path", kind: "scalar", T: 9 /* ScalarType.STRING */ },
+    { no: 2, name: "dst_path", kind: "scalar", T: 9 /* ScalarType.STRING */ },
+    { no: 3, name: "force", kind: "scalar", T: 8 /* ScalarType.BOOL */ },
+    { no: 4, name: "if_match", kind: "scalar", T: 9 /* ScalarType.STRING */ },
+  ]);
+
+  static fromBinary(bytes: Uint8Array, options?: Partial<BinaryReadOptions>): CopyRequest {
+    return new CopyRequest().fromBinary(bytes, options);
+  }
+
+  static fromJson(jsonValue: JsonValue, options?: Partial<JsonReadOptions>): CopyRequest {
+    return new CopyRequest().fromJson(jsonValue, options);
+  }
+
+  static fromJsonString(jsonString: string, options?: Partial<JsonReadOptions>): CopyRequest {
+    return new CopyRequest().fromJsonString(jsonString, options);
+  }
+
+  static equals(a: CopyRequest | PlainMessage<CopyRequest> | undefined, b: CopyRequest | PlainMessage<CopyRequest> | undefined): boolean {
+    return proto3.util.equals(CopyRequest, a, b);
+  }
+}
+
+/**
+ * @generated from message bucketeer.filesystem.v1alpha1.RenameRequest
+ */
+export class RenameRequest extends Message<RenameRequest> {
+  /**
+   * The current path of the file or directory.
+   *
+   * @generated from field: string old_path = 1;
+   */
+  oldPath = "";
+
+  /**
+   * The new path.
+   *
+   * @generated from field: string new_path = 2;
+   */
+  newPath = "";
+
+  /**
+   * If set, the new path is only overwritten if its etag matches, this
+   * implies force.
+   *
+   * @generated from field: string if_match = 3;
+   */
+  ifMatch = "";
+
+  /**
+   * Overwrite the new path if it already exists.
+   *
+   * @generated from field: bool force = 4;
+   */
+  force = false;
+
+  constructor(data?: PartialMessage<RenameRequest>) {
+    super();
+    proto3.util.initPartial(data, this);
+  }
+
+  static readonly runtime: typeof proto3 = proto3;
+  static readonly typeName = "bucketeer.filesystem.v1alpha1.RenameRequest";
+  static readonly fields: FieldList = proto3.util.newFieldList(() => [
+    { no: 1, name: "old_path", kind: "scalar", T: 9 /* ScalarType.STRING */ },
+    { no: 2, name: "new_path", kind: "scalar", T: 9 /* ScalarType.STRING */ },
+    { no: 3, name: "if_match", kind: "scalar", T: 9 /* ScalarType.STRING */ },
+    { no: 4, name: "force", kind: "scalar", T: 8 /* ScalarType.BOOL */ },
+  ]);
+
+  static fromBinary(bytes: Uint8Array, options?: Partial<BinaryReadOptions>): RenameRequest {
+    return new RenameRequest().fromBinary(bytes, options);
+  }
+
+  static fromJson(jsonValue: JsonValue, options?: Partial<JsonReadOptions>): RenameRequest {
+    return new RenameRequest().fromJson(jsonValue, options);
+  }
+
+  static fromJsonString(jsonString: string, options?: Partial<JsonReadOptions>): RenameRequest {
+    return new RenameRequest().fromJsonString(jsonString, options);
+  }
+
+  static equals(a: RenameRequest | PlainMessage<RenameRequest> | undefined, b: RenameRequest | PlainMessage<RenameRequest> | undefined): boolean {
+    return proto3.util.equals(RenameRequest, a, b);
+  }
+}
+
+/**
+ * @generated from message bucketeer.filesystem.v1alpha1.MoveRequest
+ */
+export class MoveRequest extends Message<MoveRequest> {
+  /**
+   * The path of the file or directory to move.
+   *
+   * @generated from field: string src_path = 1;
+   */
+  srcPath = "";
+
+  /**
+   * The destination path.
+   *
+   * @generated from field: string dst_path = 2;
+   */
+  dstPath = "";
+
+  /**
+   * Overwrite the destination if it already exists.
+   *
+   * @generated from field: bool force = 3;
+   */
+  force = false;
+
+  /**
+   * If set, the destination is only overwritten if its etag matches, this
+   * implies force.
+   *
+   * @generated from field: string if_match = 4;
+   */
+  ifMatch = "";
+
+  constructor(data?: PartialMessage<MoveRequest>) {
+    super();
+    proto3.util.initPartial(data, this);
+  }
+
+  static readonly runtime: typeof proto3 = proto3;
+  static readonly typeName = "bucketeer.filesystem.v1alpha1.MoveRequest";
+  static readonly fields: FieldList = proto3.util.newFieldList(() => [
+    { no: 1, name: "src_path", kind: "scalar", T: 9 /* ScalarType.STRING */ },
+    { no: 2, name: "dst_path", kind: "scalar", T: 9 /* ScalarType.STRING */ },
+    { no: 3, name: "force", kind: "scalar", T: 8 /* ScalarType.BOOL */ },
+    { no: 4, name: "if_match", kind: "scalar", T: 9 /* ScalarType.STRING */ },
+  ]);
+
+  static fromBinary(bytes: Uint8Array, options?: Partial<BinaryReadOptions>): MoveRequest {
+    return new MoveRequest().fromBinary(bytes, options);
+  }
+
+  static fromJson(jsonValue: JsonValue, options?: Partial<JsonReadOptions>): MoveRequest {
+    return new MoveRequest().fromJson(jsonValue, options);
+  }
+
+  static fromJsonString(jsonString: string, options?: Partial<JsonReadOptions>): MoveRequest {
+    return new MoveRequest().fromJsonString(jsonString, options);
+  }
+
+  static equals(a: MoveRequest | PlainMessage<MoveRequest> | undefined, b: MoveRequest | PlainMessage<MoveRequest> | undefined): boolean {
+    return proto3.util.equals(MoveRequest, a, b);
+  }
+}
+
+/**
+ * @generated from message bucketeer.filesystem.v1alpha1.RestoreRequest
+ */
+export class RestoreRequest extends Message<RestoreRequest> {
+  /**
+   * The path of the file or directory in the trash.
+   *
+   * @generated from field: string path = 1;
+   */
+  path = "";
+
+  /**
+   * The destination path, if empty it is restored to its original location.
+   *
+   * @generated from field: string dst_path = 2;
+   */
+  dstPath = "";
+
+  /**
+   * Overwrite the destination if it already exists.
+   *
+   * @generated from field: bool force = 3;
+   */
+  force = false;
+
+  constructor(data?: PartialMessage<RestoreRequest>) {
+    super();
+    proto3.util.initPartial(data, this);
+  }
+
+  static readonly runtime: typeof proto3 = proto3;
+  static readonly typeName = "bucketeer.filesystem.v1alpha1.RestoreRequest";
+  static readonly fields: FieldList = proto3.util.newFieldList(() => [
+    { no: 1, name: "path", kind: "scalar", T: 9 /* ScalarType.STRING */ },
+    { no: 2, name: "dst_path", kind: "scalar", T: 9 /* ScalarType.STRING */ },
+    { no: 3, name: "force", kind: "scalar", T: 8 /* ScalarType.BOOL */ },
+  ]);
+
+  static fromBinary(bytes: Uint8Array, options?: Partial<BinaryReadOptions>): RestoreRequest {
+    return new RestoreRequest().fromBinary(bytes, options);
+  }
+
+  static fromJson(jsonValue: JsonValue, options?: Partial<JsonReadOptions>): RestoreRequest {
+    return new RestoreRequest().fromJson(jsonValue, options);
+  }
+
+  static fromJsonString(jsonString: string, options?: Partial<JsonReadOptions>): RestoreRequest {
+    return new RestoreRequest().fromJsonString(jsonString, options);
+  }
+
+  static equals(a: RestoreRequest | PlainMessage<RestoreRequest> | undefined, b: RestoreRequest | PlainMessage<RestoreRequest> | undefined): boolean {
+    return proto3.util.equals(RestoreRequest, a, b);
+  }
+}
+
+/**
+ * @generated from message bucketeer.filesystem.v1alpha1.RestoreResponse
+ */
+export class RestoreResponse extends Message<RestoreResponse> {
+  /**
+   * The path the file or directory was restored to.
+   *
+   * @generated from field: string path = 1;
+   */
+  path = "";
+
+  constructor(data?: PartialMessage<RestoreResponse>) {
+    super();
+    proto3.util.initPartial(data, this);
+  }
+
+  static readonly runtime: typeof proto3 = proto3;
+  static readonly typeName = "bucketeer.filesystem.v1alpha1.RestoreResponse";
+  static readonly fields: FieldList = proto3.util.newFieldList(() => [
+    { no: 1, name: "path", kind: "scalar", T: 9 /* ScalarType.STRING */ },
+  ]);
+
+  static fromBinary(bytes: Uint8Array, options?: Partial<BinaryReadOptions>): RestoreResponse {
+    return new RestoreResponse().fromBinary(bytes, options);
+  }
+
+  static fromJson(jsonValue: JsonValue, options?: Partial<JsonReadOptions>): RestoreResponse {
+    return new RestoreResponse().fromJson(jsonValue, options);
+  }
+
+  static fromJsonString(jsonString: string, options?: Partial<JsonReadOptions>): RestoreResponse {
+    return new RestoreResponse().fromJsonString(jsonString, options);
+  }
+
+  static equals(a: RestoreResponse | PlainMessage<RestoreResponse> | undefined, b: RestoreResponse | PlainMessage<RestoreResponse> | undefined): boolean {
+    return proto3.util.equals(RestoreResponse, a, b);
+  }
+}
+
+/**
+ * @generated from message bucketeer.filesystem.v1alpha1.UsageResponse
+ */
+export class UsageResponse extends Message<UsageResponse> {
+  /**
+   * The total size of all files in bytes.
+   *
+   * @generated from field: int64 total_bytes = 1;
+   */
+  totalBytes = protoInt64.zero;
+
+  /**
+   * The number of files.
+   *
+   * @generated from field: int64 file_count = 2;
+   */
+  fileCount = protoInt64.zero;
+
+  /**
+   * The number of directories (excluding the root).
+   *
+   * @generated from field: int64 dir_count = 3;
+   */
+  dirCount = protoInt64.zero;
+
+  constructor(data?: PartialMessage<UsageResponse>) {
+    super();
+    proto3.util.initPartial(data, this);
+  }
+
+  static readonly runtime: typeof proto3 = proto3;
+  static readonly typeName = "bucketeer.filesystem.v1alpha1.UsageResponse";
+  static readonly fields: FieldList = proto3.util.newFieldList(() => [
+    { no: 1, name: "total_bytes", kind: "scalar", T: 3 /* ScalarType.INT64 */ },
+    { no: 2, name: "file_count", kind: "scalar", T: 3 /* ScalarType.INT64 */ },
+    { no: 3, name: "dir_count", kind: "scalar", T: 3 /* ScalarType.INT64 */ },
+  ]);
+
+  static fromBinary(bytes: Uint8Array, options?: Partial<BinaryReadOptions>): UsageResponse {
+    return new UsageResponse().fromBinary(bytes, options);
+  }
+
+  static fromJson(jsonValue: JsonValue, options?: Partial<JsonReadOptions>): UsageResponse {
+    return new UsageResponse().fromJson(jsonValue, options);
+  }
+
+  static fromJsonString(jsonString: string, options?: Partial<JsonReadOptions>): UsageResponse {
+    return new UsageResponse().fromJsonString(jsonString, options);
+  }
+
+  static equals(a: UsageResponse | PlainMessage<UsageResponse> | undefined, b: UsageResponse | PlainMessage<UsageResponse> | undefined): boolean {
+    return proto3.util.equals(UsageResponse, a, b);
+  }
+}
+
+/**
+ * @generated from message bucketeer.filesystem.v1alpha1.PresignRequest
+ */
+export class PresignRequest extends Message<PresignRequest> {
+  /**
+   * The path of the file to generate a URL for.
+   *
+   * @generated from field: string path = 1;
+   */
+  path = "";
+
+  /**
+   * How long the URL should be valid for (clamped to the server maximum).
+   *
+   * @generated from field: google.protobuf.Duration expiry = 2;
+   */
+  expiry?: Duration;
+
+  constructor(data?: PartialMessage<PresignRequest>) {
+    super();
+    proto3.util.initPartial(data, this);
+  }
+
+  static readonly runtime: typeof proto3 = proto3;
+  static readonly typeName = "bucketeer.filesystem.v1alpha1.PresignRequest";
+  static readonly fields: FieldList = proto3.util.newFieldList(() => [
+    { no: 1, name: "path", kind: "scalar", T: 9 /* ScalarType.STRING */ },
+    { no: 2, name: "expiry", kind: "message", T: Duration },
+  ]);
+
+  static fromBinary(bytes: Uint8Array, options?: Partial<BinaryReadOptions>): PresignRequest {
+    return new PresignRequest().fromBinary(bytes, options);
+  }
+
+  static fromJson(jsonValue: JsonValue, options?: Partial<JsonReadOptions>): PresignRequest {
+    return new PresignRequest().fromJson(jsonValue, options);
+  }
+
+  static fromJsonString(jsonString: string, options?: Partial<JsonReadOptions>): PresignRequest {
+    return new PresignRequest().fromJsonString(jsonString, options);
+  }
+
+  static equals(a: PresignRequest | PlainMessage<PresignRequest> | undefined, b: PresignRequest | PlainMessage<PresignRequest> | undefined): boolean {
+    return proto3.util.equals(PresignRequest, a, b);
+  }
+}
+
+/**
+ * @generated from message bucketeer.filesystem.v1alpha1.PresignResponse
+ */
+export class PresignResponse extends Message<PresignResponse> {
+  /**
+   * The presigned URL.
+   *
+   * @generated from field: string url = 1;
+   */
+  url = "";
+
+  /**
+   * When the URL expires.
+   *
+   * @generated from field: google.protobuf.Timestamp expires_at = 2;
+   */
+  expiresAt?: Timestamp;
+
+  constructor(data?: PartialMessage<PresignResponse>) {
+    super();
+    proto3.util.initPartial(data, this);
+  }
+
+  static readonly runtime: typeof proto3 = proto3;
+  static readonly typeName = "bucketeer.filesystem.v1alpha1.PresignResponse";
+  static readonly fields: FieldList = proto3.util.newFieldList(() => [
+    { no: 1, name: "url", kind: "scalar", T: 9 /* ScalarType.STRING */ },
+    { no: 2, name: "expires_at", kind: "message", T: Timestamp },
+  ]);
+
+  static fromBinary(bytes: Uint8Array, options?: Partial<BinaryReadOptions>): PresignResponse {
+    return new PresignResponse().fromBinary(bytes, options);
+  }
+
+  static fromJson(jsonValue: JsonValue, options?: Partial<JsonReadOptions>): PresignResponse {
+    return new PresignResponse().fromJson(jsonValue, options);
+  }
+
+  static fromJsonString(jsonString: string, options?: Partial<JsonReadOptions>): PresignResponse {
+    return new PresignResponse().fromJsonString(jsonString, options);
+  }
+
+  static equals(a: PresignResponse | PlainMessage<PresignResponse> | undefined, b: PresignResponse | PlainMessage<PresignResponse> | undefined): boolean {
+    return proto3.util.equals(PresignResponse, a, b);
+  }
+}
+
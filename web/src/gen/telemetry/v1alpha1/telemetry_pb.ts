@@ -123,7 +123,8 @@ export class StackFrame extends Message<StackFrame> {
  */
 export class TelemetryEvent extends Message<TelemetryEvent> {
   /**
-   * The session ID associated with the event.
+   * The session ID associated with the event. The session id is short-lived and not persisted.
+   * It is only used to link events together (as there might be a relationship between them).
    *
    * @generated from field: string session_id = 1;
    */
@@ -20,7 +20,7 @@
 /* eslint-disable */
 // @ts-nocheck
 
-import { CompleteResponse, NewRequest } from "./upload_pb";
+import { CompleteRequest, CompleteResponse, NewRequest, NewResponse, ProgressResponse, ReceivedRangesResponse } from "./upload_pb";
 import { Empty, MethodKind, StringValue } from "@bufbuild/protobuf";
 
 /**
@@ -37,7 +37,7 @@ export const Upload = {
     new: {
       name: "New",
       I: NewRequest,
-      O: StringValue,
+      O: NewResponse,
       kind: MethodKind.Unary,
     },
     /**
@@ -51,6 +51,19 @@ export const Upload = {
       O: Empty,
       kind: MethodKind.Unary,
     },
+    /**
+     * AbortSession aborts every upload created with the given session ID (eg.
+     * when a browser tab is closed), uploads that are already being completed
+     * are not affected.
+     *
+     * @generated from rpc bucketeer.upload.v1alpha1.Upload.AbortSession
+     */
+    abortSession: {
+      name: "AbortSession",
+      I: StringValue,
+      O: Empty,
+      kind: MethodKind.Unary,
+    },
     /**
      * Complete begins the process of completing an upload, data isn't guaranteed
      * to be flushed to disk until PollForCompletion() returns a status of
@@ -61,7 +74,7 @@ export const Upload = {
      */
     complete: {
       name: "Complete",
-      I: StringValue,
+      I: CompleteRequest,
       O: Empty,
       kind: MethodKind.Unary,
     },
@@ -77,6 +90,30 @@ export const Upload = {
       O: CompleteResponse,
       kind: MethodKind.Unary,
     },
+    /**
+     * Progress returns the number of bytes received so far for an upload, and
+     * once completion has begun, the number of bytes copied to the destination.
+     *
+     * @generated from rpc bucketeer.upload.v1alpha1.Upload.Progress
+     */
+    progress: {
+      name: "Progress",
+      I: StringValue,
+      O: ProgressResponse,
+      kind: MethodKind.Unary,
+    },
+    /**
+     * GetReceivedRanges returns the byte ranges of an upload that have been
+     * received so far, so that an interrupted upload can be resumed.
+     *
+     * @generated from rpc bucketeer.upload.v1alpha1.Upload.GetReceivedRanges
+     */
+    getReceivedRanges: {
+      name: "GetReceivedRanges",
+      I: StringValue,
+      O: ReceivedRangesResponse,
+      kind: MethodKind.Unary,
+    },
   }
 } as const;
 
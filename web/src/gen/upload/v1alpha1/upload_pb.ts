@@ -57,6 +57,48 @@ proto3.util.setEnumType(CompletionStatus, "bucketeer.upload.v1alpha1.CompletionS
   { no: 2, name: "FAILED" },
 ]);
 
+/**
+ * FailureReason is a machine readable reason for a failed upload.
+ *
+ * @generated from enum bucketeer.upload.v1alpha1.FailureReason
+ */
+export enum FailureReason {
+  /**
+   * The reason for the failure is unknown.
+   *
+   * @generated from enum value: UNKNOWN = 0;
+   */
+  UNKNOWN = 0,
+
+  /**
+   * The checksum of the received data did not match the expected checksum.
+   *
+   * @generated from enum value: CHECKSUM_MISMATCH = 1;
+   */
+  CHECKSUM_MISMATCH = 1,
+
+  /**
+   * The upload could not be written to the destination.
+   *
+   * @generated from enum value: WRITE_FAILED = 2;
+   */
+  WRITE_FAILED = 2,
+
+  /**
+   * A file already exists at the destination path.
+   *
+   * @generated from enum value: DEST_EXISTS = 3;
+   */
+  DEST_EXISTS = 3,
+}
+// Retrieve enum metadata with: proto3.getEnumType(FailureReason)
+proto3.util.setEnumType(FailureReason, "bucketeer.upload.v1alpha1.FailureReason", [
+  { no: 0, name: "UNKNOWN" },
+  { no: 1, name: "CHECKSUM_MISMATCH" },
+  { no: 2, name: "WRITE_FAILED" },
+  { no: 3, name: "DEST_EXISTS" },
+]);
+
 /**
  * @generated from message bucketeer.upload.v1alpha1.NewRequest
  */
@@ -77,11 +119,63 @@ export class NewRequest extends Message<NewRequest> {
 
   /**
    * The expected checksum of the uploaded file in the format "algorithm:hex".
+   * It can be omitted if checksum_algorithm is set, in which case it must be
+   * provided to Complete() instead (so that clients can checksum the file while
+   * uploading it).
    *
    * @generated from field: string checksum = 3;
    */
   checksum = "";
 
+  /**
+   * If true, the upload will fail rather than overwrite an existing file.
+   *
+   * @generated from field: bool no_overwrite = 4;
+   */
+  noOverwrite = false;
+
+  /**
+   * The MIME type of the uploaded file, set on the destination if the
+   * filesystem supports it (eg. S3).
+   *
+   * @generated from field: string content_type = 5;
+   */
+  contentType = "";
+
+  /**
+   * An optional identifier used to group uploads, so that they can be aborted
+   * together with AbortSession().
+   *
+   * @generated from field: string session_id = 6;
+   */
+  sessionId = "";
+
+  /**
+   * The algorithm of a checksum that will be provided to Complete().
+   *
+   * @generated from field: string checksum_algorithm = 7;
+   */
+  checksumAlgorithm = "";
+
+  /**
+   * Metadata set on the destination if the filesystem supports it. Keys are
+   * either standard headers (eg. "Cache-Control", "Content-Encoding") or user
+   * metadata prefixed with "x-amz-meta-".
+   *
+   * @generated from field: map<string, string> metadata = 8;
+   */
+  metadata: { [key: string]: string } = {};
+
+  /**
+   * An optional key that makes New() safe to retry, if an upload with the
+   * same key (and the same path, size and checksum) exists its ID is returned
+   * rather than a new upload being created. Once the upload has been completed
+   * the key can't be reused (FAILED_PRECONDITION is returned).
+   *
+   * @generated from field: string idempotency_key = 9;
+   */
+  idempotencyKey = "";
+
   constructor(data?: PartialMessage<NewRequest>) {
     super();
     proto3.util.initPartial(data, this);
@@ -93,6 +187,12 @@ export class NewRequest extends Message<NewRequest> {
     { no: 1, name: "path", kind: "scalar", T: 9 /* ScalarType.STRING */ },
     { no: 2, name: "size", kind: "scalar", T: 3 /* ScalarType.INT64 */ },
     { no: 3, name: "checksum", kind: "scalar", T: 9 /* ScalarType.STRING */ },
+    { no: 4, name: "no_overwrite", kind: "scalar", T: 8 /* ScalarType.BOOL */ },
+    { no: 5, name: "content_type", kind: "scalar", T: 9 /* ScalarType.STRING */ },
+    { no: 6, name: "session_id", kind: "scalar", T: 9 /* ScalarType.STRING */ },
+    { no: 7, name: "checksum_algorithm", kind: "scalar", T: 9 /* ScalarType.STRING */ },
+    { no: 8, name: "metadata", kind: "map", K: 9 /* ScalarType.STRING */, V: {kind: "scalar", T: 9 /* ScalarType.STRING */} },
+    { no: 9, name: "idempotency_key", kind: "scalar", T: 9 /* ScalarType.STRING */ },
   ]);
 
   static fromBinary(bytes: Uint8Array, options?: Partial<BinaryReadOptions>): NewRequest {
@@ -112,6 +212,102 @@ export class NewRequest extends Message<NewRequest> {
   }
 }
 
+/**
+ * @generated from message bucketeer.upload.v1alpha1.NewResponse
+ */
+export class NewResponse extends Message<NewResponse> {
+  /**
+   * The unique identifier of the upload.
+   *
+   * @generated from field: string id = 1;
+   */
+  id = "";
+
+  /**
+   * The chunk size recommended by the server, zero if the server has no
+   * preference.
+   *
+   * @generated from field: int64 chunk_size = 2;
+   */
+  chunkSize = protoInt64.zero;
+
+  constructor(data?: PartialMessage<NewResponse>) {
+    super();
+    proto3.util.initPartial(data, this);
+  }
+
+  static readonly runtime: typeof proto3 = proto3;
+  static readonly typeName = "bucketeer.upload.v1alpha1.NewResponse";
+  static readonly fields: FieldList = proto3.util.newFieldList(() => [
+    { no: 1, name: "id", kind: "scalar", T: 9 /* ScalarType.STRING */ },
+    { no: 2, name: "chunk_size", kind: "scalar", T: 3 /* ScalarType.INT64 */ },
+  ]);
+
+  static fromBinary(bytes: Uint8Array, options?: Partial<BinaryReadOptions>): NewResponse {
+    return new NewResponse().fromBinary(bytes, options);
+  }
+
+  static fromJson(jsonValue: JsonValue, options?: Partial<JsonReadOptions>): NewResponse {
+    return new NewResponse().fromJson(jsonValue, options);
+  }
+
+  static fromJsonString(jsonString: string, options?: Partial<JsonReadOptions>): NewResponse {
+    return new NewResponse().fromJsonString(jsonString, options);
+  }
+
+  static equals(a: NewResponse | PlainMessage<NewResponse> | undefined, b: NewResponse | PlainMessage<NewResponse> | undefined): boolean {
+    return proto3.util.equals(NewResponse, a, b);
+  }
+}
+
+/**
+ * @generated from message bucketeer.upload.v1alpha1.CompleteRequest
+ */
+export class CompleteRequest extends Message<CompleteRequest> {
+  /**
+   * The unique identifier of the upload.
+   *
+   * @generated from field: string id = 1;
+   */
+  id = "";
+
+  /**
+   * The expected checksum of the uploaded file, required if it wasn't
+   * provided when the upload was created.
+   *
+   * @generated from field: string checksum = 2;
+   */
+  checksum = "";
+
+  constructor(data?: PartialMessage<CompleteRequest>) {
+    super();
+    proto3.util.initPartial(data, this);
+  }
+
+  static readonly runtime: typeof proto3 = proto3;
+  static readonly typeName = "bucketeer.upload.v1alpha1.CompleteRequest";
+  static readonly fields: FieldList = proto3.util.newFieldList(() => [
+    { no: 1, name: "id", kind: "scalar", T: 9 /* ScalarType.STRING */ },
+    { no: 2, name: "checksum", kind: "scalar", T: 9 /* ScalarType.STRING */ },
+  ]);
+
+  static fromBinary(bytes: Uint8Array, options?: Partial<BinaryReadOptions>): CompleteRequest {
+    return new CompleteRequest().fromBinary(bytes, options);
+  }
+
+  static fromJson(jsonValue: JsonValue, options?: Partial<JsonReadOptions>): CompleteRequest {
+    return new CompleteRequest().fromJson(jsonValue, options);
+  }
+
+  static fromJsonString(jsonString: string, options?: Partial<JsonReadOptions>): CompleteRequest {
+    return new CompleteRequest().fromJsonString(jsonString, options);
+  }
+
+  static equals(a: CompleteRequest | PlainMessage<CompleteRequest> | undefined, b: CompleteRequest | PlainMessage<CompleteRequest> | undefined): boolean {
+    return proto3.util.equals(CompleteRequest, a, b);
+  }
+}
+
 /**
  * @generated from message bucketeer.upload.v1alpha1.CompleteResponse
  */
@@ -130,6 +326,13 @@ export class CompleteResponse extends Message<CompleteResponse> {
    */
   error = "";
 
+  /**
+   * The reason the upload failed.
+   *
+   * @generated from field: bucketeer.upload.v1alpha1.FailureReason reason = 3;
+   */
+  reason = FailureReason.UNKNOWN;
+
   constructor(data?: PartialMessage<CompleteResponse>) {
     super();
     proto3.util.initPartial(data, this);
@@ -140,6 +343,7 @@ export class CompleteResponse extends Message<CompleteResponse> {
   static readonly fields: FieldList = proto3.util.newFieldList(() => [
     { no: 1, name: "status", kind: "enum", T: proto3.getEnumType(CompletionStatus) },
     { no: 2, name: "error", kind: "scalar", T: 9 /* ScalarType.STRING */ },
+    { no: 3, name: "reason", kind: "enum", T: proto3.getEnumType(FailureReason) },
   ]);
 
   static fromBinary(bytes: Uint8Array, options?: Partial<BinaryReadOptions>): CompleteResponse {
@@ -159,3 +363,146 @@ export class CompleteResponse extends Message<CompleteResponse> {
   }
 }
 
+/**
+ * @generated from message bucketeer.upload.v1alpha1.ProgressResponse
+ */
+export class ProgressResponse extends Message<ProgressResponse> {
+  /**
+   * The total size of the uploaded file.
+   *
+   * @generated from field: int64 total_size = 1;
+   */
+  totalSize = protoInt64.zero;
+
+  /**
+   * The number of bytes received by the server so far.
+   *
+   * @generated from field: int64 received_bytes = 2;
+   */
+  receivedBytes = protoInt64.zero;
+
+  /**
+   * The number of bytes copied to the destination during completion.
+   *
+   * @generated from field: int64 copied_bytes = 3;
+   */
+  copiedBytes = protoInt64.zero;
+
+  constructor(data?: PartialMessage<ProgressResponse>) {
+    super();
+    proto3.util.initPartial(data, this);
+  }
+
+  static readonly runtime: typeof proto3 = proto3;
+  static readonly typeName = "bucketeer.upload.v1alpha1.ProgressResponse";
+  static readonly fields: FieldList = proto3.util.newFieldList(() => [
+    { no: 1, name: "total_size", kind: "scalar", T: 3 /* ScalarType.INT64 */ },
+    { no: 2, name: "received_bytes", kind: "scalar", T: 3 /* ScalarType.INT64 */ },
+    { no: 3, name: "copied_bytes", kind: "scalar", T: 3 /* ScalarType.INT64 */ },
+  ]);
+
+  static fromBinary(bytes: Uint8Array, options?: Partial<BinaryReadOptions>): ProgressResponse {
+    return new ProgressResponse().fromBinary(bytes, options);
+  }
+
+  static fromJson(jsonValue: JsonValue, options?: Partial<JsonReadOptions>): ProgressResponse {
+    return new ProgressResponse().fromJson(jsonValue, options);
+  }
+
+  static fromJsonString(jsonString: string, options?: Partial<JsonReadOptions>): ProgressResponse {
+    return new ProgressResponse().fromJsonString(jsonString, options);
+  }
+
+  static equals(a: ProgressResponse | PlainMessage<ProgressResponse> | undefined, b: ProgressResponse | PlainMessage<ProgressResponse> | undefined): boolean {
+    return proto3.util.equals(ProgressResponse, a, b);
+  }
+}
+
+/**
+ * ByteRange is an inclusive range of bytes.
+ *
+ * @generated from message bucketeer.upload.v1alpha1.ByteRange
+ */
+export class ByteRange extends Message<ByteRange> {
+  /**
+   * The offset of the first byte in the range.
+   *
+   * @generated from field: int64 start = 1;
+   */
+  start = protoInt64.zero;
+
+  /**
+   * The offset of the last byte in the range.
+   *
+   * @generated from field: int64 end = 2;
+   */
+  end = protoInt64.zero;
+
+  constructor(data?: PartialMessage<ByteRange>) {
+    super();
+    proto3.util.initPartial(data, this);
+  }
+
+  static readonly runtime: typeof proto3 = proto3;
+  static readonly typeName = "bucketeer.upload.v1alpha1.ByteRange";
+  static readonly fields: FieldList = proto3.util.newFieldList(() => [
+    { no: 1, name: "start", kind: "scalar", T: 3 /* ScalarType.INT64 */ },
+    { no: 2, name: "end", kind: "scalar", T: 3 /* ScalarType.INT64 */ },
+  ]);
+
+  static fromBinary(bytes: Uint8Array, options?: Partial<BinaryReadOptions>): ByteRange {
+    return new ByteRange().fromBinary(bytes, options);
+  }
+
+  static fromJson(jsonValue: JsonValue, options?: Partial<JsonReadOptions>): ByteRange {
+    return new ByteRange().fromJson(jsonValue, options);
+  }
+
+  static fromJsonString(jsonString: string, options?: Partial<JsonReadOptions>): ByteRange {
+    return new ByteRange().fromJsonString(jsonString, options);
+  }
+
+  static equals(a: ByteRange | PlainMessage<ByteRange> | undefined, b: ByteRange | PlainMessage<ByteRange> | undefined): boolean {
+    return proto3.util.equals(ByteRange, a, b);
+  }
+}
+
+/**
+ * @generated from message bucketeer.upload.v1alpha1.ReceivedRangesResponse
+ */
+export class ReceivedRangesResponse extends Message<ReceivedRangesResponse> {
+  /**
+   * The sorted, non-overlapping ranges of bytes received so far.
+   *
+   * @generated from field: repeated bucketeer.upload.v1alpha1.ByteRange ranges = 1;
+   */
+  ranges: ByteRange[] = [];
+
+  constructor(data?: PartialMessage<ReceivedRangesResponse>) {
+    super();
+    proto3.util.initPartial(data, this);
+  }
+
+  static readonly runtime: typeof proto3 = proto3;
+  static readonly typeName = "bucketeer.upload.v1alpha1.ReceivedRangesResponse";
+  static readonly fields: FieldList = proto3.util.newFieldList(() => [
+    { no: 1, name: "ranges", kind: "message", T: ByteRange, repeated: true },
+  ]);
+
+  static fromBinary(bytes: Uint8Array, options?: Partial<BinaryReadOptions>): ReceivedRangesResponse {
+    return new ReceivedRangesResponse().fromBinary(bytes, options);
+  }
+
+  static fromJson(jsonValue: JsonValue, options?: Partial<JsonReadOptions>): ReceivedRangesResponse {
+    return new ReceivedRangesResponse().fromJson(jsonValue, options);
+  }
+
+  static fromJsonString(jsonString: string, options?: Partial<JsonReadOptions>): ReceivedRangesResponse {
+    return new ReceivedRangesResponse().fromJsonString(jsonString, options);
+  }
+
+  static equals(a: ReceivedRangesResponse | PlainMessage<ReceivedRangesResponse> | undefined, b: ReceivedRangesResponse | PlainMessage<ReceivedRangesResponse> | undefined): boolean {
+    return proto3.util.equals(ReceivedRangesResponse, a, b);
+  }
+}
+
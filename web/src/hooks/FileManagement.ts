@@ -19,7 +19,7 @@
 import { createPromiseClient } from '@connectrpc/connect'
 import { createConnectTransport } from '@connectrpc/connect-web'
 import type React from 'react'
-import { useCallback, useRef, useState } from 'react'
+import { useCallback, useEffect, useRef, useState } from 'react'
 import { type FileInfo } from '../gen/filesystem/v1alpha1/filesystem_pb'
 import { Filesystem } from '../gen/filesystem/v1alpha1/filesystem_connect'
 import UploadClient from '../upload/Client'
@@ -40,7 +40,7 @@ export interface UseFileManagement {
   deleteFile: (path: string) => Promise<void>
   makeDirectory: (path: string) => Promise<void>
   uploadFile: (path: string) => Promise<void>
-  downloadFile: (path: string) => void
+  downloadFile: (path: string, isDir?: boolean) => void
 }
 
 export const useFileManagement = ({ baseURL, fileGridLoaderRef }: UseFileManagementProps): UseFileManagement => {
@@ -52,6 +52,19 @@ export const useFileManagement = ({ baseURL, fileGridLoaderRef }: UseFileManagem
   const filesystemClient = createPromiseClient(Filesystem, createConnectTransport({ baseUrl: baseURL + '/api' }))
   const uploadClient = new UploadClient(baseURL)
 
+  useEffect(() => {
+    // Don't leave partial uploads behind if the page is closed.
+    const onPageHide = (): void => {
+      uploadClient.abortSession()
+    }
+
+    window.addEventListener('pagehide', onPageHide)
+
+    return () => {
+      window.removeEventListener('pagehide', onPageHide)
+    }
+  }, [baseURL])
+
   const refreshFiles = useCallback(() => {
     // Reset the list ID.
     loadFilesListIDRef.current = undefined
@@ -142,9 +155,10 @@ export const useFileManagement = ({ baseURL, fileGridLoaderRef }: UseFileManagem
     }
   }, [filesystemClient])
 
-  const downloadFile = useCallback((path: string) => {
+  const downloadFile = useCallback((path: string, isDir?: boolean) => {
     const a = document.createElement('a')
-    a.href = encodeURI(`${baseURL}/files/download/${path}`)
+    // Directories are only archived when asked for (if auto archiving is disabled).
+    a.href = encodeURI(`${baseURL}/files/download/${path}`) + (isDir === true ? '?format=zip' : '')
     a.setAttribute('download', '')
     a.style.display = 'none'
 
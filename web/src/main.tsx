@@ -28,10 +28,13 @@ import '@fontsource/roboto/400.css'
 import '@fontsource/roboto/500.css'
 import '@fontsource/roboto/700.css'
 
-const baseURL = import.meta.env.PROD ? window.location.origin : 'http://localhost:16321'
+// When serving multiple buckets, the server tells us which bucket we're browsing.
+const bucket = document.querySelector('meta[name="bucketeer-bucket"]')?.getAttribute('content')
 
-// defined in vite.config.ts
-const basePath = '/browse/'
+const baseURL = (import.meta.env.PROD ? window.location.origin : 'http://localhost:16321') +
+  (bucket != null ? `/buckets/${encodeURIComponent(bucket)}` : '')
+
+const basePath = bucket != null ? `/browse/${bucket}/` : '/browse/'
 
 ReactDOM.createRoot(document.getElementById('root') as Element).render(
   <React.StrictMode>
@@ -24,6 +24,11 @@ import isNetworkError from 'is-network-error'
 import { Upload } from '../gen/upload/v1alpha1/upload_connect'
 import { CompletionStatus } from '../gen/upload/v1alpha1/upload_pb'
 import { createXXHash64 } from 'hash-wasm'
+import { generateID } from '../util/GenerateID'
+
+// All uploads started from this page share a session, so they can be aborted
+// together when the page is closed.
+const sessionID = generateID(32)
 
 export interface ClientOptions {
   numConnections?: number
@@ -54,28 +59,42 @@ class Client {
     this.opts = opts
   }
 
+  // Abort all in-progress uploads for this page, safe to call while the page is unloading.
+  abortSession (): void {
+    navigator.sendBeacon(`${this.baseURL}/api/${Upload.typeName}/AbortSession`,
+      new Blob([JSON.stringify({ value: sessionID })], { type: 'application/json' }))
+  }
+
   // Upload a file to the server.
   async upload (path: string, file: File): Promise<void> {
-    const checksum = await this.checksum(file)
-
-    const uploadIDResp = await this.apiClient.new({
+    // The checksum is provided on completion, so that the file can be
+    // checksummed while it's being uploaded.
+    const newResp = await this.apiClient.new({
       path,
       size: BigInt(file.size),
-      checksum
+      checksumAlgorithm: 'xxh64',
+      contentType: file.type,
+      sessionId: sessionID
     })
 
-    const uploadID = uploadIDResp.value
+    const uploadID = newResp.id
+
+    // Prefer the configured chunk size, then the server's recommendation (older
+    // servers don't recommend one).
+    const chunkSizeBytes = this.opts.chunkSizeBytes ?? (newResp.chunkSize > 0 ? Number(newResp.chunkSize) : 16000000) // 16 MB
 
-    await this.uploadChunks(uploadID, file)
+    const [, checksum] = await Promise.all([
+      this.uploadChunks(uploadID, file, chunkSizeBytes),
+      this.checksum(file)
+    ])
 
-    await this.apiClient.complete({ value: uploadID })
+    await this.apiClient.complete({ id: uploadID, checksum })
 
     await this.pollForCompletion(uploadID)
   }
 
-  private async uploadChunks (uploadID: string, file: File): Promise<void> {
+  private async uploadChunks (uploadID: string, file: File, chunkSizeBytes: number): Promise<void> {
     const fileSize = file.size
-    const chunkSizeBytes = this.opts.chunkSizeBytes ?? 16000000 // 16 MB
     const numConnections = this.opts.numConnections ?? 4 // Number of concurrent uploads.
 
     const queue = new PQueue({ concurrency: numConnections })